@@ -17,11 +17,15 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -31,23 +35,39 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/thanos-io/thanos/pkg/reloader"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/googleauth"
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/logging"
 )
 
 func main() {
 	var (
-		watchedDirs      stringSlice
-		configFile       = flag.String("config-file", "", "config file to watch for changes")
-		configFileOutput = flag.String("config-file-output", "", "config file to write with interpolated environment variables")
-		reloadURLStr     = flag.String("reload-url", "http://127.0.0.1:19090/-/reload", "Prometheus reload endpoint")
-		listenAddress    = flag.String("listen-address", ":19091", "address on which to expose metrics")
+		watchedDirs       stringSlice
+		configFiles       stringSlice
+		configFileOutputs stringSlice
+		reloadURLStr      = flag.String("reload-url", "http://127.0.0.1:19090/-/reload", "Prometheus reload endpoint")
+		listenAddress     = flag.String("listen-address", ":19091", "address on which to expose metrics")
+		debounce          = flag.Duration("debounce", 3*time.Second, "how long to wait without new file changes before triggering a reload, coalescing rapid successive changes into one reload")
+		failureThreshold  = flag.Int("reload-failure-threshold", 0, "number of consecutive reload failures after which the /-/ready endpoint reports unready, so a readiness probe can take the pod out of service. 0 disables the check.")
+		gcpTokenDir       = flag.String("gcp-token-dir", "", "directory in which to maintain Google-signed tokens for scrape authorization, as referenced by the watched config files. Empty disables token refreshing.")
+		logLevel          = flag.String("log.level", "info", logging.LevelFlagHelp)
+		logFormat         = flag.String("log.format", "logfmt", logging.FormatFlagHelp)
 	)
 	flag.Var(&watchedDirs, "watched-dir", "directory to watch for file changes (for rule and secret files, may be repeated)")
+	flag.Var(&configFiles, "config-file", "config file to watch for changes (may be repeated)")
+	flag.Var(&configFileOutputs, "config-file-output", "config file to write with interpolated environment variables (must be given once per --config-file, in the same order, or not at all)")
 
 	flag.Parse()
 
-	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
-	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
-	logger = log.With(logger, "caller", log.DefaultCaller)
+	logger, err := logging.NewLogger(*logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid logging flags:", err)
+		os.Exit(2)
+	}
+	if len(configFileOutputs) > 0 && len(configFileOutputs) != len(configFiles) {
+		level.Error(logger).Log("msg", "--config-file-output must be given once per --config-file, in the same order")
+		os.Exit(1)
+	}
 
 	metrics := prometheus.NewRegistry()
 	metrics.MustRegister(
@@ -60,26 +80,67 @@ func main() {
 		level.Error(logger).Log("msg", "parsing reloader URL failed", "err", err)
 		os.Exit(1)
 	}
-	rel := reloader.New(
-		logger,
-		metrics,
-		&reloader.Options{
-			ReloadURL:     reloadURL,
-			CfgFile:       *configFile,
-			CfgOutputFile: *configFileOutput,
-			WatchedDirs:   watchedDirs,
-			// There are some reliability issues with fsnotify picking up file changes.
-			// Configure a very aggress refresh for now. The reloader will only send reload signals
-			// to Prometheus if the contents actually changed. So this should not have any practical
-			// drawbacks.
-			WatchInterval: 10 * time.Second,
-			RetryInterval: 5 * time.Second,
-			DelayInterval: 3 * time.Second,
-		},
-	)
+	transport := &reloadTransport{
+		next: http.DefaultTransport,
+		gauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "config_reloader_reload_consecutive_failures",
+			Help: "Number of reload attempts since the last successful reload.",
+		}),
+	}
+	metrics.MustRegister(transport.gauge)
+	// Run one reloader per config file. The watched directories are attached to
+	// the first reloader only so directory changes trigger a single reload.
+	// The reloader exposes success and failure counters as well as timestamps of
+	// the last successful reload; a config_file label tells the instances apart.
+	tokenConfigFiles := configFiles
+	if len(configFiles) == 0 {
+		configFiles = stringSlice{""}
+	}
+	var rels []*reloader.Reloader
+	for i, cfgFile := range configFiles {
+		var cfgOutputFile string
+		if len(configFileOutputs) > 0 {
+			cfgOutputFile = configFileOutputs[i]
+		}
+		var dirs []string
+		if i == 0 {
+			dirs = watchedDirs
+		}
+		rel := reloader.New(
+			log.With(logger, "config_file", cfgFile),
+			prometheus.WrapRegistererWith(prometheus.Labels{"config_file": cfgFile}, metrics),
+			&reloader.Options{
+				ReloadURL:     reloadURL,
+				CfgFile:       cfgFile,
+				CfgOutputFile: cfgOutputFile,
+				WatchedDirs:   dirs,
+				// There are some reliability issues with fsnotify picking up file changes.
+				// Configure a very aggress refresh for now. The reloader will only send reload signals
+				// to Prometheus if the contents actually changed. So this should not have any practical
+				// drawbacks.
+				WatchInterval: 10 * time.Second,
+				RetryInterval: 5 * time.Second,
+				DelayInterval: *debounce,
+			},
+		)
+		rel.SetHttpClient(http.Client{Transport: transport})
+		rels = append(rels, rel)
+	}
 
 	var g run.Group
-	{
+	if *gcpTokenDir != "" {
+		// Scan the config files for referenced token files and keep fresh
+		// Google-signed tokens in place for the scraping Prometheus to attach.
+		refresher := googleauth.NewRefresher(log.With(logger, "component", "token-refresher"), *gcpTokenDir, tokenConfigFiles)
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return refresher.Run(ctx, time.Minute)
+		}, func(error) {
+			cancel()
+		})
+	}
+	for _, rel := range rels {
+		rel := rel
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
 			return rel.Watch(ctx)
@@ -109,6 +170,13 @@ func main() {
 	{
 		server := &http.Server{Addr: *listenAddress}
 		http.Handle("/metrics", promhttp.HandlerFor(metrics, promhttp.HandlerOpts{Registry: metrics}))
+		http.HandleFunc("/-/ready", func(w http.ResponseWriter, _ *http.Request) {
+			if *failureThreshold > 0 && transport.consecutiveFailures() >= *failureThreshold {
+				http.Error(w, "too many consecutive reload failures", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, "OK")
+		})
 
 		g.Add(func() error {
 			level.Info(logger).Log("msg", "Starting web server for metrics", "listen", *listenAddress)
@@ -126,6 +194,65 @@ func main() {
 	}
 }
 
+// reloadTransport sends reload requests with a short exponential backoff and
+// tracks consecutive failures for the readiness endpoint. The reloader itself
+// keeps retrying failed reloads at its retry interval, so the last-good config
+// stays in place and the failure metrics keep being served throughout.
+type reloadTransport struct {
+	next  http.RoundTripper
+	gauge prometheus.Gauge
+
+	mtx      sync.Mutex
+	failures int
+}
+
+func (t *reloadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		resp *http.Response
+		err  error
+	)
+	for backoff := 250 * time.Millisecond; ; backoff *= 2 {
+		resp, err = t.next.RoundTrip(req)
+		if err == nil && resp.StatusCode/100 == 2 {
+			t.observe(true)
+			return resp, nil
+		}
+		if backoff > 2*time.Second {
+			break
+		}
+		if err == nil {
+			// Drain the response so the connection can be reused for the retry.
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			t.observe(false)
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+	}
+	t.observe(false)
+	return resp, err
+}
+
+func (t *reloadTransport) observe(success bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if success {
+		t.failures = 0
+	} else {
+		t.failures++
+	}
+	t.gauge.Set(float64(t.failures))
+}
+
+func (t *reloadTransport) consecutiveFailures() int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.failures
+}
+
 type stringSlice []string
 
 func (ss *stringSlice) String() string {
@@ -0,0 +1,381 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The export-sidecar runs alongside a self-managed Prometheus server, tails
+// its write-ahead log, and exports the samples to Google Cloud Monitoring
+// through the same export path as data scraped by the managed collectors.
+// It allows keeping an existing Prometheus setup while using managed storage.
+// For servers that cannot share a volume with the sidecar, the
+// remote-write-receiver accepts the same data via remote_write instead.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wal"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	exportsetup "github.com/GoogleCloudPlatform/prometheus-engine/pkg/export/setup"
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/logging"
+)
+
+func main() {
+	a := kingpin.New("export-sidecar", "Write-ahead log exporter sidecar for Google Cloud Prometheus Engine")
+
+	a.HelpFlag.Short('h')
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	newExporter := exportsetup.FromFlags(a, fmt.Sprintf("export-sidecar/%s", export.Version))
+
+	storagePath := a.Flag("prometheus.storage-path", "The Prometheus TSDB storage path as passed to its --storage.tsdb.path flag, which contains the tailed write-ahead log. Must be mounted into the sidecar.").
+		Required().String()
+
+	prometheusEndpoint := a.Flag("prometheus.endpoint", "Base URL of the Prometheus server's API, used to look up metric metadata. An empty value disables the lookup and metrics without known metadata are exported as untyped.").
+		Default("http://localhost:9090").String()
+
+	listenAddress := a.Flag("web.listen-address", "The address to listen on for HTTP requests.").
+		Default(":9112").String()
+
+	logLevel := a.Flag("log.level", logging.LevelFlagHelp).
+		Default("info").String()
+
+	logFormat := a.Flag("log.format", logging.FormatFlagHelp).
+		Default("logfmt").String()
+
+	extraArgs, err := exportsetup.ExtraArgs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error parsing commandline arguments:", err)
+		a.Usage(os.Args[1:])
+		os.Exit(2)
+	}
+	if _, err := a.Parse(append(os.Args[1:], extraArgs...)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error parsing commandline arguments:", err)
+		a.Usage(os.Args[1:])
+		os.Exit(2)
+	}
+
+	logger, err := logging.NewLogger(*logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid logging flags:", err)
+		os.Exit(2)
+	}
+
+	exporter, err := newExporter(logger, reg)
+	if err != nil {
+		level.Error(logger).Log("msg", "Creating a Cloud Monitoring Exporter failed", "err", err)
+		os.Exit(1)
+	}
+	destination := export.NewStorage(exporter)
+	if err := destination.ApplyConfig(&config.DefaultConfig); err != nil {
+		level.Error(logger).Log("msg", "Applying default config failed", "err", err)
+		os.Exit(1)
+	}
+
+	var metadata *metadataCache
+	if *prometheusEndpoint != "" {
+		metadata = newMetadataCache(logger, *prometheusEndpoint)
+	}
+
+	tailer := &walTailer{
+		logger:      logger,
+		destination: destination,
+		metadata:    metadata,
+		series:      map[chunks.HeadSeriesRef]walSeries{},
+		samplesIngested: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "export_sidecar_samples_ingested_total",
+			Help: "Number of WAL samples handed to the exporter.",
+		}),
+		samplesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "export_sidecar_samples_dropped_total",
+			Help: "Number of WAL samples dropped before export.",
+		}, []string{"reason"}),
+	}
+	reg.MustRegister(tailer.samplesIngested, tailer.samplesDropped)
+
+	watcher := wal.NewWatcher(
+		wal.NewWatcherMetrics(reg),
+		wal.NewLiveReaderMetrics(reg),
+		logger, "gcm", tailer, *storagePath, false,
+	)
+	// Only export samples written after startup. Replaying the full log on
+	// every restart would re-send hours of data the exporter cannot
+	// deduplicate against what was already written to GCM.
+	watcher.SetStartTime(time.Now())
+
+	var g run.Group
+	// Termination handler.
+	{
+		term := make(chan os.Signal, 1)
+		cancel := make(chan struct{})
+		signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+
+		g.Add(
+			func() error {
+				select {
+				case <-term:
+					level.Info(logger).Log("msg", "received SIGTERM, exiting gracefully...")
+				case <-cancel:
+				}
+				return nil
+			},
+			func(err error) {
+				close(cancel)
+			},
+		)
+	}
+	// Exporter.
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return destination.Run(ctx)
+		}, func(err error) {
+			cancel()
+		})
+	}
+	// Metadata refresh.
+	if metadata != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			metadata.run(ctx)
+			return nil
+		}, func(err error) {
+			cancel()
+		})
+	}
+	// WAL watcher.
+	{
+		done := make(chan struct{})
+		g.Add(func() error {
+			level.Info(logger).Log("msg", "Tailing write-ahead log", "path", *storagePath)
+			watcher.Start()
+			<-done
+			return nil
+		}, func(err error) {
+			watcher.Stop()
+			close(done)
+		})
+	}
+	// Web server.
+	{
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+
+		server := &http.Server{Addr: *listenAddress, Handler: mux}
+
+		g.Add(func() error {
+			level.Info(logger).Log("msg", "Starting web server", "listen", *listenAddress)
+			return server.ListenAndServe()
+		}, func(err error) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			server.Shutdown(ctx)
+			cancel()
+		})
+	}
+	if err := g.Run(); err != nil {
+		level.Error(logger).Log("msg", "running export-sidecar failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+// walSeries is the cached state for a series read from the WAL.
+type walSeries struct {
+	lset labels.Labels
+	// The WAL segment in which the series record was last seen, used for
+	// garbage collection against completed checkpoints.
+	segment int
+}
+
+// walTailer receives the records the WAL watcher reads and hands the samples
+// to the exporter. It implements wal.WriteTo.
+type walTailer struct {
+	logger      log.Logger
+	destination *export.Storage
+	metadata    *metadataCache
+
+	mtx    sync.Mutex
+	series map[chunks.HeadSeriesRef]walSeries
+
+	samplesIngested prometheus.Counter
+	samplesDropped  *prometheus.CounterVec
+}
+
+func (t *walTailer) Append(samples []record.RefSample) bool {
+	var metadata export.MetadataFunc
+	if t.metadata != nil {
+		metadata = t.metadata.get
+	}
+	app := t.destination.AppenderWithMetadata(metadata)
+
+	t.mtx.Lock()
+	for _, s := range samples {
+		entry, ok := t.series[s.Ref]
+		if !ok {
+			// The series record may precede the start of the tailed range.
+			t.samplesDropped.WithLabelValues("unknown_series").Inc()
+			continue
+		}
+		if _, err := app.Append(0, entry.lset, s.T, s.V); err != nil {
+			level.Warn(t.logger).Log("msg", "appending sample failed", "err", err)
+			continue
+		}
+		t.samplesIngested.Inc()
+	}
+	t.mtx.Unlock()
+
+	if err := app.Commit(); err != nil {
+		level.Warn(t.logger).Log("msg", "committing samples failed", "err", err)
+	}
+	return true
+}
+
+func (t *walTailer) AppendExemplars(exemplars []record.RefExemplar) bool {
+	// Exemplars are not exported.
+	return true
+}
+
+func (t *walTailer) StoreSeries(series []record.RefSeries, segment int) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for _, s := range series {
+		t.series[s.Ref] = walSeries{lset: s.Labels, segment: segment}
+	}
+}
+
+func (t *walTailer) UpdateSeriesSegment(series []record.RefSeries, segment int) {
+	t.StoreSeries(series, segment)
+}
+
+func (t *walTailer) SeriesReset(segment int) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	// All series not seen in a checkpoint at or above the given segment were
+	// deleted from the WAL and no further samples can reference them.
+	for ref, s := range t.series {
+		if s.segment < segment {
+			delete(t.series, ref)
+		}
+	}
+}
+
+// metadataCache periodically retrieves metric metadata from the Prometheus
+// server's API so exported samples carry their proper metric types.
+type metadataCache struct {
+	logger   log.Logger
+	endpoint string
+	client   *http.Client
+
+	mtx   sync.RWMutex
+	types map[string]textparse.MetricType
+}
+
+func newMetadataCache(logger log.Logger, endpoint string) *metadataCache {
+	return &metadataCache{
+		logger:   logger,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		types:    map[string]textparse.MetricType{},
+	}
+}
+
+// get returns the cached metadata for the given metric name. It matches the
+// export.MetadataFunc signature.
+func (c *metadataCache) get(metric string) (export.MetricMetadata, bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	t, ok := c.types[metric]
+	if !ok {
+		return export.MetricMetadata{}, false
+	}
+	return export.MetricMetadata{Metric: metric, Type: t}, true
+}
+
+// run refreshes the cache periodically until the context is cancelled.
+func (c *metadataCache) run(ctx context.Context) {
+	tick := time.NewTicker(30 * time.Second)
+	defer tick.Stop()
+
+	for {
+		if err := c.refresh(ctx); err != nil {
+			level.Warn(c.logger).Log("msg", "refreshing metric metadata failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (c *metadataCache) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"/api/v1/metadata", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %q", resp.Status)
+	}
+	var payload struct {
+		Status string `json:"status"`
+		Data   map[string][]struct {
+			Type string `json:"type"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return err
+	}
+	types := make(map[string]textparse.MetricType, len(payload.Data))
+	for metric, mds := range payload.Data {
+		if len(mds) > 0 {
+			types[metric] = textparse.MetricType(mds[0].Type)
+		}
+	}
+	c.mtx.Lock()
+	c.types = types
+	c.mtx.Unlock()
+
+	return nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// queryAllowlist restricts which series the frontend serves. A selector is
+// permitted if its metric name carries one of the allowed prefixes or if it
+// selects one of the allowed namespace label values by equality. This lets a
+// frontend instance exposed to a single team serve only that team's metrics
+// even though the underlying project contains metrics of other teams.
+type queryAllowlist struct {
+	metricPrefixes []string
+	namespaces     map[string]bool
+}
+
+// newQueryAllowlist builds an allowlist from comma-separated metric name
+// prefixes and namespace values. It returns nil if both are empty, i.e. no
+// restriction is configured.
+func newQueryAllowlist(metricPrefixes, namespaces string) *queryAllowlist {
+	if metricPrefixes == "" && namespaces == "" {
+		return nil
+	}
+	al := &queryAllowlist{namespaces: map[string]bool{}}
+	for _, p := range strings.Split(metricPrefixes, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			al.metricPrefixes = append(al.metricPrefixes, p)
+		}
+	}
+	for _, ns := range strings.Split(namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			al.namespaces[ns] = true
+		}
+	}
+	return al
+}
+
+// check validates that every selector of the expression is permitted. A
+// selector without an explicit metric name must select an allowed namespace
+// to stay verifiable.
+func (al *queryAllowlist) check(expr parser.Expr) error {
+	var selErr error
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok || selErr != nil {
+			return nil
+		}
+		name := vs.Name
+		var nsAllowed bool
+		for _, m := range vs.LabelMatchers {
+			if m.Type != labels.MatchEqual {
+				continue
+			}
+			if m.Name == labels.MetricName && name == "" {
+				name = m.Value
+			}
+			if m.Name == "namespace" && al.namespaces[m.Value] {
+				nsAllowed = true
+			}
+		}
+		if nsAllowed {
+			return nil
+		}
+		for _, p := range al.metricPrefixes {
+			if name != "" && strings.HasPrefix(name, p) {
+				return nil
+			}
+		}
+		selErr = fmt.Errorf("selector %q is not permitted by this frontend's allowlist", vs.String())
+		return nil
+	})
+	return selErr
+}
+
+// enforce wraps the handler with allowlist checks on all PromQL expressions
+// of the request, i.e. the query parameter and any match[] parameters. It is
+// a no-op for a nil allowlist.
+func (al *queryAllowlist) enforce(next http.Handler) http.Handler {
+	if al == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, query := range extractExprs(req) {
+			expr, err := parser.ParseExpr(query)
+			if err != nil {
+				// Let the query API produce its own parse error.
+				continue
+			}
+			if err := al.check(expr); err != nil {
+				writeAnalyzeError(w, http.StatusForbidden, err.Error())
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// extractExprs returns all PromQL expressions of a query API request, i.e.
+// the query parameter and any match[] parameters of both the URL and a form
+// body, without consuming the request body.
+func extractExprs(req *http.Request) []string {
+	var exprs []string
+	collect := func(vals url.Values) {
+		exprs = append(exprs, vals["query"]...)
+		exprs = append(exprs, vals["match[]"]...)
+	}
+	collect(req.URL.Query())
+	if req.Method == http.MethodPost && req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body = io.NopCloser(bytes.NewReader(b))
+		if err == nil {
+			if vals, err := url.ParseQuery(string(b)); err == nil {
+				collect(vals)
+			}
+		}
+	}
+	return exprs
+}
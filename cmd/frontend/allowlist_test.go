@@ -0,0 +1,75 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestQueryAllowlistEnforce(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	if h := (*queryAllowlist)(nil).enforce(next); h == nil {
+		t.Fatal("expected pass-through handler for nil allowlist")
+	}
+	if newQueryAllowlist("", "") != nil {
+		t.Fatal("expected nil allowlist for empty configuration")
+	}
+
+	al := newQueryAllowlist("http_,team_a_", "team-a")
+	handler := al.enforce(next)
+
+	cases := []struct {
+		doc   string
+		query string
+		want  int
+	}{
+		{doc: "allowed metric prefix", query: `sum(rate(http_requests_total[5m]))`, want: http.StatusOK},
+		{doc: "allowed namespace", query: `up{namespace="team-a"}`, want: http.StatusOK},
+		{doc: "denied metric", query: `up`, want: http.StatusForbidden},
+		{doc: "denied namespace", query: `team_b_errors{namespace="team-b"}`, want: http.StatusForbidden},
+		{doc: "one denied selector rejects the query", query: `http_requests_total / other_total`, want: http.StatusForbidden},
+		{doc: "regex namespace matcher is not sufficient", query: `up{namespace=~"team-.*"}`, want: http.StatusForbidden},
+		{doc: "no expressions pass through", query: "", want: http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			target := "/api/v1/query"
+			if c.query != "" {
+				target += "?query=" + url.QueryEscape(c.query)
+			}
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != c.want {
+				t.Fatalf("expected status %d, got %d", c.want, rec.Code)
+			}
+		})
+	}
+
+	// match[] parameters of series requests are checked as well.
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/series?match[]="+url.QueryEscape(`other_total`), nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// analyzeUnsupportedFunctions are PromQL functions the GCM query API does not
+// support or only supports with deviating semantics. The list mirrors the
+// published PromQL compatibility notes of Cloud Monitoring.
+var analyzeUnsupportedFunctions = map[string]string{
+	"absent":           "may produce no result as GCM cannot distinguish absent series from delayed ingestion",
+	"absent_over_time": "may produce no result as GCM cannot distinguish absent series from delayed ingestion",
+	"holt_winters":     "not supported by the GCM query API",
+	"predict_linear":   "evaluated on downsampled data, results may deviate from a local Prometheus",
+}
+
+// analyzePushdownFunctions are range-vector functions the GCM query API
+// evaluates close to the storage layer rather than fetching raw samples.
+var analyzePushdownFunctions = map[string]bool{
+	"rate":     true,
+	"irate":    true,
+	"increase": true,
+	"delta":    true,
+	"idelta":   true,
+}
+
+// queryAnalysis is the result of statically and dynamically analyzing a
+// PromQL query against the GCM query API.
+type queryAnalysis struct {
+	// The selectors contained in the query, each with the current number
+	// of time series it touches.
+	Selectors []selectorAnalysis `json:"selectors"`
+	// Total number of time series touched across all selectors.
+	TotalSeries int64 `json:"totalSeries"`
+	// Functions used by the query that GCM does not support or evaluates
+	// with deviating semantics, with an explanation each.
+	UnsupportedFunctions []string `json:"unsupportedFunctions,omitempty"`
+	// Parts of the query that GCM evaluates close to the storage layer
+	// rather than fetching raw samples into the query engine.
+	Pushdowns []string `json:"pushdowns,omitempty"`
+}
+
+type selectorAnalysis struct {
+	// The selector as it appears in the query.
+	Selector string `json:"selector"`
+	// Number of time series the selector currently matches. Negative if
+	// the estimation query failed.
+	Series int64 `json:"series"`
+}
+
+// analyzeHandler serves a query analysis endpoint that explains how a PromQL
+// query maps onto the GCM query API: how many series its selectors touch,
+// which of its functions are unsupported, and which parts are pushed down.
+// It helps users iterate on expensive queries before putting them on
+// dashboards.
+func analyzeHandler(logger log.Logger, v1api v1.API) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.FormValue("query")
+		if query == "" {
+			writeAnalyzeError(w, http.StatusBadRequest, "missing query parameter")
+			return
+		}
+		ts := time.Now()
+		if v := req.FormValue("time"); v != "" {
+			parsed, err := parseQueryTime(v)
+			if err != nil {
+				writeAnalyzeError(w, http.StatusBadRequest, fmt.Sprintf("invalid time parameter: %s", err))
+				return
+			}
+			ts = parsed
+		}
+		expr, err := parser.ParseExpr(query)
+		if err != nil {
+			writeAnalyzeError(w, http.StatusBadRequest, fmt.Sprintf("invalid query: %s", err))
+			return
+		}
+		analysis := analyzeExpr(expr)
+
+		// Estimate the number of series each selector touches with a count
+		// query per selector. Failed estimates don't invalidate the static
+		// analysis and are marked instead.
+		for i, sel := range analysis.Selectors {
+			n, err := countSeries(req.Context(), v1api, sel.Selector, ts)
+			if err != nil {
+				level.Warn(logger).Log("msg", "estimating selector series failed", "selector", sel.Selector, "err", err)
+				analysis.Selectors[i].Series = -1
+				continue
+			}
+			analysis.Selectors[i].Series = n
+			analysis.TotalSeries += n
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   analysis,
+		})
+	})
+}
+
+// analyzeExpr statically analyzes the query's AST for selectors, unsupported
+// functions, and evaluation steps the GCM query API pushes down.
+func analyzeExpr(expr parser.Expr) *queryAnalysis {
+	analysis := &queryAnalysis{}
+	var (
+		unsupported = map[string]bool{}
+		pushdowns   = map[string]bool{}
+	)
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			analysis.Selectors = append(analysis.Selectors, selectorAnalysis{Selector: n.String()})
+		case *parser.Call:
+			if reason, ok := analyzeUnsupportedFunctions[n.Func.Name]; ok {
+				unsupported[fmt.Sprintf("%s: %s", n.Func.Name, reason)] = true
+			}
+			if analyzePushdownFunctions[n.Func.Name] {
+				pushdowns[fmt.Sprintf("%s is evaluated close to storage", n.String())] = true
+			}
+		case *parser.AggregateExpr:
+			// Aggregations directly over a selector or a pushed-down function
+			// reduce the data fetched into the query engine.
+			switch inner := n.Expr.(type) {
+			case *parser.VectorSelector:
+				pushdowns[fmt.Sprintf("aggregation %s is evaluated close to storage", n.String())] = true
+			case *parser.Call:
+				if analyzePushdownFunctions[inner.Func.Name] {
+					pushdowns[fmt.Sprintf("aggregation %s is evaluated close to storage", n.String())] = true
+				}
+			}
+		}
+		return nil
+	})
+	for s := range unsupported {
+		analysis.UnsupportedFunctions = append(analysis.UnsupportedFunctions, s)
+	}
+	for s := range pushdowns {
+		analysis.Pushdowns = append(analysis.Pushdowns, s)
+	}
+	sort.Strings(analysis.UnsupportedFunctions)
+	sort.Strings(analysis.Pushdowns)
+	return analysis
+}
+
+// countSeries returns the number of series the given selector currently
+// matches in GCM.
+func countSeries(ctx context.Context, v1api v1.API, selector string, ts time.Time) (int64, error) {
+	val, _, err := v1api.Query(ctx, fmt.Sprintf("count(%s)", selector), ts)
+	if err != nil {
+		return 0, err
+	}
+	vec, ok := val.(model.Vector)
+	if !ok {
+		return 0, fmt.Errorf("unexpected result type %q", val.Type())
+	}
+	// An empty vector means the selector matches no series at all.
+	if len(vec) == 0 {
+		return 0, nil
+	}
+	return int64(vec[0].Value), nil
+}
+
+// parseQueryTime parses a query API timestamp, accepting both RFC 3339 and Unix
+// timestamps with optional fractions.
+func parseQueryTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	var sec, frac float64
+	if _, err := fmt.Sscanf(s, "%f", &sec); err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse %q as timestamp", s)
+	}
+	frac = sec - float64(int64(sec))
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+}
+
+func writeAnalyzeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "error",
+		"error":  msg,
+	})
+}
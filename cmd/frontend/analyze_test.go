@@ -0,0 +1,113 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+func TestAnalyzeExpr(t *testing.T) {
+	cases := []struct {
+		doc             string
+		query           string
+		wantSelectors   []string
+		wantUnsupported int
+		wantPushdowns   int
+	}{
+		{
+			doc:           "plain selector",
+			query:         `up{job="test"}`,
+			wantSelectors: []string{`up{job="test"}`},
+		}, {
+			doc:           "aggregated rate is pushed down",
+			query:         `sum by (pod) (rate(http_requests_total[5m]))`,
+			wantSelectors: []string{`http_requests_total`},
+			// The rate itself and the aggregation over it.
+			wantPushdowns: 2,
+		}, {
+			doc:           "aggregation over selector is pushed down",
+			query:         `count(up)`,
+			wantSelectors: []string{`up`},
+			wantPushdowns: 1,
+		}, {
+			doc:             "unsupported function is flagged",
+			query:           `holt_winters(http_requests_total[1h], 0.5, 0.5)`,
+			wantSelectors:   []string{`http_requests_total`},
+			wantUnsupported: 1,
+			wantPushdowns:   0,
+		}, {
+			doc:           "binary expression with two selectors",
+			query:         `errors_total / requests_total`,
+			wantSelectors: []string{`errors_total`, `requests_total`},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			expr, err := parser.ParseExpr(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			analysis := analyzeExpr(expr)
+
+			if len(analysis.Selectors) != len(c.wantSelectors) {
+				t.Fatalf("expected %d selectors, got %v", len(c.wantSelectors), analysis.Selectors)
+			}
+			for i, want := range c.wantSelectors {
+				if analysis.Selectors[i].Selector != want {
+					t.Errorf("expected selector %q at index %d, got %q", want, i, analysis.Selectors[i].Selector)
+				}
+			}
+			if len(analysis.UnsupportedFunctions) != c.wantUnsupported {
+				t.Errorf("expected %d unsupported functions, got %v", c.wantUnsupported, analysis.UnsupportedFunctions)
+			}
+			if len(analysis.Pushdowns) != c.wantPushdowns {
+				t.Errorf("expected %d pushdowns, got %v", c.wantPushdowns, analysis.Pushdowns)
+			}
+		})
+	}
+}
+
+func TestAnalyzeExprUnsupportedReason(t *testing.T) {
+	expr, err := parser.ParseExpr(`absent(up)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysis := analyzeExpr(expr)
+	if len(analysis.UnsupportedFunctions) != 1 {
+		t.Fatalf("expected one unsupported function, got %v", analysis.UnsupportedFunctions)
+	}
+	if !strings.HasPrefix(analysis.UnsupportedFunctions[0], "absent: ") {
+		t.Fatalf("expected explanation for absent, got %q", analysis.UnsupportedFunctions[0])
+	}
+}
+
+func TestParseQueryTime(t *testing.T) {
+	if _, err := parseQueryTime("2022-05-10T10:00:00Z"); err != nil {
+		t.Errorf("unexpected error for RFC 3339 timestamp: %s", err)
+	}
+	ts, err := parseQueryTime("1652176800.5")
+	if err != nil {
+		t.Fatalf("unexpected error for Unix timestamp: %s", err)
+	}
+	if ts.UnixMilli() != 1652176800500 {
+		t.Errorf("unexpected timestamp %d", ts.UnixMilli())
+	}
+	if _, err := parseQueryTime("not-a-time"); err == nil {
+		t.Errorf("expected error for invalid timestamp")
+	}
+}
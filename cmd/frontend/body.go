@@ -0,0 +1,116 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+var errBodyTooLarge = errors.New("request body exceeds the configured maximum size")
+
+// decodeRequestBody returns a handler that decompresses gzip- or
+// snappy-encoded request bodies and enforces a maximum decompressed body size
+// before passing the request on. Clients like Grafana send long templated
+// queries as optionally compressed POST bodies, which neither the allowlist
+// checks nor the GCM API could read in encoded form.
+func decodeRequestBody(maxSize int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Body == nil || req.Body == http.NoBody {
+			next.ServeHTTP(w, req)
+			return
+		}
+		body, err := readBody(req, maxSize)
+		if err != nil {
+			if errors.Is(err, errBodyTooLarge) {
+				writeAnalyzeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			} else {
+				writeAnalyzeError(w, http.StatusBadRequest, fmt.Sprintf("reading request body failed: %s", err))
+			}
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Del("Content-Encoding")
+		req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		next.ServeHTTP(w, req)
+	})
+}
+
+// readBody reads the request body, decompressing it according to the
+// Content-Encoding header. It returns errBodyTooLarge if the raw or
+// decompressed body exceeds maxSize bytes. A maxSize of 0 disables the limit.
+func readBody(req *http.Request, maxSize int64) ([]byte, error) {
+	b, err := readLimited(req.Body, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	switch enc := strings.ToLower(req.Header.Get("Content-Encoding")); enc {
+	case "", "identity":
+		return b, nil
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer zr.Close()
+		dec, err := readLimited(zr, maxSize)
+		if err != nil && !errors.Is(err, errBodyTooLarge) {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		return dec, err
+	case "snappy":
+		// Snappy has a block and a framed stream format. Clients generally
+		// send the block format over HTTP, as Prometheus remote write does,
+		// but accept the stream format as well.
+		if dec, err := snappy.Decode(nil, b); err == nil {
+			if maxSize > 0 && int64(len(dec)) > maxSize {
+				return nil, errBodyTooLarge
+			}
+			return dec, nil
+		}
+		dec, err := readLimited(snappy.NewReader(bytes.NewReader(b)), maxSize)
+		if err != nil && !errors.Is(err, errBodyTooLarge) {
+			return nil, fmt.Errorf("invalid snappy body: %w", err)
+		}
+		return dec, err
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", enc)
+	}
+}
+
+// readLimited reads r in full but returns errBodyTooLarge if it yields more
+// than maxSize bytes. A maxSize of 0 disables the limit.
+func readLimited(r io.Reader, maxSize int64) ([]byte, error) {
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && int64(len(b)) > maxSize {
+		return nil, errBodyTooLarge
+	}
+	return b, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+func TestDecodeRequestBody(t *testing.T) {
+	gzipped := func(s string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return buf.Bytes()
+	}
+	cases := []struct {
+		doc      string
+		encoding string
+		body     []byte
+		maxSize  int64
+		wantCode int
+		wantBody string
+	}{
+		{
+			doc:      "plain body passes through",
+			body:     []byte("query=up"),
+			maxSize:  1024,
+			wantCode: http.StatusOK,
+			wantBody: "query=up",
+		}, {
+			doc:      "gzip body is decompressed",
+			encoding: "gzip",
+			body:     gzipped("query=up"),
+			maxSize:  1024,
+			wantCode: http.StatusOK,
+			wantBody: "query=up",
+		}, {
+			doc:      "snappy block body is decompressed",
+			encoding: "snappy",
+			body:     snappy.Encode(nil, []byte("query=up")),
+			maxSize:  1024,
+			wantCode: http.StatusOK,
+			wantBody: "query=up",
+		}, {
+			doc:      "no limit with max size zero",
+			body:     []byte(strings.Repeat("x", 100)),
+			maxSize:  0,
+			wantCode: http.StatusOK,
+			wantBody: strings.Repeat("x", 100),
+		}, {
+			doc:      "raw body over the limit is rejected",
+			body:     []byte(strings.Repeat("x", 100)),
+			maxSize:  10,
+			wantCode: http.StatusRequestEntityTooLarge,
+		}, {
+			doc:      "decompressed body over the limit is rejected",
+			encoding: "gzip",
+			body:     gzipped(strings.Repeat("x", 1000)),
+			maxSize:  100,
+			wantCode: http.StatusRequestEntityTooLarge,
+		}, {
+			doc:      "broken gzip body is rejected",
+			encoding: "gzip",
+			body:     []byte("not gzip"),
+			maxSize:  1024,
+			wantCode: http.StatusBadRequest,
+		}, {
+			doc:      "unsupported encoding is rejected",
+			encoding: "br",
+			body:     []byte("query=up"),
+			maxSize:  1024,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			var gotBody string
+			var gotEncoding []string
+			h := decodeRequestBody(c.maxSize, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				b, err := io.ReadAll(req.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotBody = string(b)
+				gotEncoding = req.Header.Values("Content-Encoding")
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/query", bytes.NewReader(c.body))
+			if c.encoding != "" {
+				req.Header.Set("Content-Encoding", c.encoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != c.wantCode {
+				t.Fatalf("expected status %d, got %d (%s)", c.wantCode, rec.Code, rec.Body)
+			}
+			if c.wantCode != http.StatusOK {
+				return
+			}
+			if gotBody != c.wantBody {
+				t.Errorf("expected body %q, got %q", c.wantBody, gotBody)
+			}
+			if len(gotEncoding) != 0 {
+				t.Errorf("expected Content-Encoding to be removed, got %v", gotEncoding)
+			}
+		})
+	}
+}
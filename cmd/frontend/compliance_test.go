@@ -0,0 +1,433 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// complianceFixture is the sample data the compliance queries are evaluated
+// against. Samples are spaced 15 seconds apart starting at the zero timestamp.
+const complianceFixture = `
+load 15s
+	http_requests_total{job="api", instance="inst-0", code="200"} 0+10x100
+	http_requests_total{job="api", instance="inst-0", code="500"} 0+1x100
+	http_requests_total{job="api", instance="inst-1", code="200"} 0+20x100
+	http_requests_total{job="web", instance="inst-0", code="200"} 0+30x100
+	go_goroutines{job="api", instance="inst-0"} 20+5x100
+	go_goroutines{job="api", instance="inst-1"} 50-1x50
+	request_duration_seconds_bucket{job="api", le="0.1"} 0+5x100
+	request_duration_seconds_bucket{job="api", le="0.5"} 0+8x100
+	request_duration_seconds_bucket{job="api", le="+Inf"} 0+10x100
+`
+
+// complianceQueries is a corpus of PromQL expressions covering the common
+// surface of the query API. It is not exhaustive but a regression guard for
+// the frontend's handling of the query endpoints.
+var complianceQueries = []string{
+	`http_requests_total`,
+	`http_requests_total{job=~"a.*", code!="500"}`,
+	`rate(http_requests_total[5m])`,
+	`increase(http_requests_total[10m])`,
+	`sum by (job) (rate(http_requests_total[5m]))`,
+	`avg without (instance) (go_goroutines)`,
+	`topk(2, http_requests_total)`,
+	`quantile(0.9, go_goroutines)`,
+	`histogram_quantile(0.9, rate(request_duration_seconds_bucket[5m]))`,
+	`sum by (job) (rate(http_requests_total[5m])) / sum by (job) (rate(http_requests_total[5m]))`,
+	`go_goroutines > 30`,
+	`go_goroutines > bool 30`,
+	`absent(nonexistent_metric)`,
+	`clamp_max(go_goroutines, 25)`,
+	`http_requests_total offset 5m`,
+	`max_over_time(rate(http_requests_total[5m])[10m:1m])`,
+	`label_replace(go_goroutines, "host", "$1", "instance", "inst-(.*)")`,
+	`vector(1)`,
+	`time()`,
+	`sum(`, // Parse errors must be passed through verbatim as well.
+}
+
+// TestQueryCompliance runs the query corpus against a Prometheus-compatible
+// query API backed by the vendored PromQL engine, both directly and through
+// the frontend's forwarding handlers, and verifies that responses are passed
+// through unaltered.
+func TestQueryCompliance(t *testing.T) {
+	ptest, err := promql.NewTest(t, complianceFixture)
+	if err != nil {
+		t.Fatalf("parse fixture: %s", err)
+	}
+	defer ptest.Close()
+	if err := ptest.Run(); err != nil {
+		t.Fatalf("load fixture: %s", err)
+	}
+	backend := httptest.NewServer(newQueryBackend(ptest).handler())
+	defer backend.Close()
+
+	frontend := httptest.NewServer(newFrontendMux(t, backend.URL))
+	defer frontend.Close()
+
+	// All sample timestamps are relative to the zero time, as is the query range.
+	var (
+		evalTime = time.Unix(600, 0).UTC()
+		start    = time.Unix(0, 0).UTC()
+		end      = time.Unix(1200, 0).UTC()
+	)
+	for _, q := range complianceQueries {
+		t.Run(q, func(t *testing.T) {
+			compareResponses(t, backend.URL, frontend.URL, "/api/v1/query", url.Values{
+				"query": []string{q},
+				"time":  []string{formatTime(evalTime)},
+			})
+			compareResponses(t, backend.URL, frontend.URL, "/api/v1/query_range", url.Values{
+				"query": []string{q},
+				"start": []string{formatTime(start)},
+				"end":   []string{formatTime(end)},
+				"step":  []string{"60"},
+			})
+		})
+	}
+	t.Run("metadata endpoints", func(t *testing.T) {
+		params := url.Values{
+			"start": []string{formatTime(start)},
+			"end":   []string{formatTime(end)},
+		}
+		compareResponses(t, backend.URL, frontend.URL, "/api/v1/labels", params)
+		compareResponses(t, backend.URL, frontend.URL, "/api/v1/label/job/values", params)
+
+		seriesParams := url.Values{"match[]": []string{`http_requests_total{job="api"}`}}
+		for k, v := range params {
+			seriesParams[k] = v
+		}
+		compareResponses(t, backend.URL, frontend.URL, "/api/v1/series", seriesParams)
+
+		// The label endpoints are served through a cache in the frontend. A repeated
+		// request must still produce the identical response.
+		compareResponses(t, backend.URL, frontend.URL, "/api/v1/labels", params)
+		compareResponses(t, backend.URL, frontend.URL, "/api/v1/label/job/values", params)
+	})
+}
+
+// newFrontendMux assembles the query serving handlers of the frontend just
+// like the main function does.
+func newFrontendMux(t *testing.T, backendURL string) *http.ServeMux {
+	target, err := url.Parse(backendURL)
+	if err != nil {
+		t.Fatalf("parse backend URL: %s", err)
+	}
+	logger := log.NewNopLogger()
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", forward(logger, nil, target, http.DefaultTransport))
+
+	labelsHandler := newLabelsCacheHandler(forward(logger, nil, target, http.DefaultTransport), newMemoryLabelsCache(), 5*time.Minute, 0)
+	mux.Handle("/api/v1/labels", labelsHandler)
+	mux.Handle("/api/v1/label/", labelsHandler)
+	return mux
+}
+
+// compareResponses requests the same endpoint from the backend and the
+// frontend and verifies that status code and response payload are identical.
+func compareResponses(t *testing.T, backendURL, frontendURL, path string, params url.Values) {
+	t.Helper()
+
+	wantStatus, wantBody := fetch(t, backendURL, path, params)
+	gotStatus, gotBody := fetch(t, frontendURL, path, params)
+
+	if gotStatus != wantStatus {
+		t.Errorf("unexpected status code for %q: want %d, got %d", path, wantStatus, gotStatus)
+	}
+	var want, got interface{}
+	if err := json.Unmarshal(wantBody, &want); err != nil {
+		t.Fatalf("unmarshal backend response %q: %s", wantBody, err)
+	}
+	if err := json.Unmarshal(gotBody, &got); err != nil {
+		t.Fatalf("unmarshal frontend response %q: %s", gotBody, err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("response for %q differs between backend and frontend (-want, +got): %s", path, diff)
+	}
+}
+
+func fetch(t *testing.T, base, path string, params url.Values) (int, []byte) {
+	t.Helper()
+
+	resp, err := http.Get(base + path + "?" + params.Encode())
+	if err != nil {
+		t.Fatalf("request %q: %s", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read response body: %s", err)
+	}
+	return resp.StatusCode, body
+}
+
+// queryBackend serves the subset of the Prometheus HTTP API the frontend
+// forwards, evaluated by the vendored PromQL engine over fixture data. It
+// stands in for the GCM query API in hermetic tests.
+type queryBackend struct {
+	engine    *promql.Engine
+	queryable storage.Queryable
+}
+
+func newQueryBackend(ptest *promql.Test) *queryBackend {
+	return &queryBackend{
+		engine:    ptest.QueryEngine(),
+		queryable: ptest.Queryable(),
+	}
+}
+
+func (b *queryBackend) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/query", b.instantQuery)
+	mux.HandleFunc("/api/v1/query_range", b.rangeQuery)
+	mux.HandleFunc("/api/v1/labels", b.labelNames)
+	mux.HandleFunc("/api/v1/label/", b.labelValues)
+	mux.HandleFunc("/api/v1/series", b.series)
+	return mux
+}
+
+func (b *queryBackend) instantQuery(w http.ResponseWriter, r *http.Request) {
+	ts, err := parseTime(r.FormValue("time"), time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+	query, err := b.engine.NewInstantQuery(b.queryable, nil, r.FormValue("query"), ts)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+	defer query.Close()
+	writeQueryResult(w, query.Exec(r.Context()))
+}
+
+func (b *queryBackend) rangeQuery(w http.ResponseWriter, r *http.Request) {
+	start, err := parseTime(r.FormValue("start"), time.Time{})
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+	end, err := parseTime(r.FormValue("end"), time.Time{})
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+	step, err := strconv.ParseFloat(r.FormValue("step"), 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+	query, err := b.engine.NewRangeQuery(b.queryable, nil, r.FormValue("query"), start, end, time.Duration(step*float64(time.Second)))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+	defer query.Close()
+	writeQueryResult(w, query.Exec(r.Context()))
+}
+
+func (b *queryBackend) labelNames(w http.ResponseWriter, r *http.Request) {
+	querier, err := b.querierFor(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+	defer querier.Close()
+
+	names, _, err := querier.LabelNames()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	writeAPIResponse(w, names)
+}
+
+func (b *queryBackend) labelValues(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/label/"), "/values")
+
+	querier, err := b.querierFor(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+	defer querier.Close()
+
+	values, _, err := querier.LabelValues(name)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	writeAPIResponse(w, values)
+}
+
+func (b *queryBackend) series(w http.ResponseWriter, r *http.Request) {
+	querier, err := b.querierFor(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+	defer querier.Close()
+
+	r.ParseForm()
+
+	result := []map[string]string{}
+	for _, expr := range r.Form["match[]"] {
+		matchers, err := parser.ParseMetricSelector(expr)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "bad_data", err)
+			return
+		}
+		set := querier.Select(false, nil, matchers...)
+		for set.Next() {
+			result = append(result, set.At().Labels().Map())
+		}
+		if err := set.Err(); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "internal", err)
+			return
+		}
+	}
+	writeAPIResponse(w, result)
+}
+
+func (b *queryBackend) querierFor(r *http.Request) (storage.Querier, error) {
+	mint, maxt := int64(math.MinInt64), int64(math.MaxInt64)
+
+	if s := r.FormValue("start"); s != "" {
+		start, err := parseTime(s, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		mint = start.UnixMilli()
+	}
+	if s := r.FormValue("end"); s != "" {
+		end, err := parseTime(s, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		maxt = end.UnixMilli()
+	}
+	return b.queryable.Querier(r.Context(), mint, maxt)
+}
+
+func writeQueryResult(w http.ResponseWriter, res *promql.Result) {
+	if res.Err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, "execution", res.Err)
+		return
+	}
+	value, err := marshalValue(res.Value)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	writeAPIResponse(w, map[string]interface{}{
+		"resultType": res.Value.Type(),
+		"result":     value,
+	})
+}
+
+// marshalValue encodes a PromQL result value in the JSON shape of the
+// Prometheus query API.
+func marshalValue(value parser.Value) (interface{}, error) {
+	switch v := value.(type) {
+	case promql.Vector:
+		samples := []interface{}{}
+		for _, s := range v {
+			samples = append(samples, map[string]interface{}{
+				"metric": s.Metric.Map(),
+				"value":  marshalSample(s.T, s.V),
+			})
+		}
+		return samples, nil
+	case promql.Matrix:
+		series := []interface{}{}
+		for _, s := range v {
+			points := []interface{}{}
+			for _, p := range s.Points {
+				points = append(points, marshalSample(p.T, p.V))
+			}
+			series = append(series, map[string]interface{}{
+				"metric": s.Metric.Map(),
+				"values": points,
+			})
+		}
+		return series, nil
+	case promql.Scalar:
+		return marshalSample(v.T, v.V), nil
+	case promql.String:
+		return []interface{}{formatTimestamp(v.T), v.V}, nil
+	}
+	return nil, fmt.Errorf("unknown result value type %q", value.Type())
+}
+
+func marshalSample(t int64, v float64) []interface{} {
+	return []interface{}{formatTimestamp(t), strconv.FormatFloat(v, 'f', -1, 64)}
+}
+
+func formatTimestamp(t int64) json.Number {
+	return json.Number(strconv.FormatFloat(float64(t)/1000, 'f', -1, 64))
+}
+
+func writeAPIResponse(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"data":   data,
+	})
+}
+
+func writeAPIError(w http.ResponseWriter, code int, errType string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "error",
+		"errorType": errType,
+		"error":     err.Error(),
+	})
+}
+
+// parseTime parses a query API timestamp, given as Unix seconds or RFC 3339.
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC(), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/float64(time.Second), 'f', -1, 64)
+}
@@ -0,0 +1,205 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// federatedQueryHandler serves the instant and range query endpoints with
+// results merged across the GCM query API and a secondary
+// Prometheus-compatible endpoint. It bridges migrations during which
+// historical data still lives in a self-hosted Prometheus while new data is
+// ingested into GCM, so dashboards see one continuous view.
+// Series are deduplicated by their label sets. For range queries the samples
+// of a series present in both systems are merged, with the primary winning
+// on equal timestamps.
+func federatedQueryHandler(logger log.Logger, primary, secondary v1.API) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.FormValue("query")
+		if query == "" {
+			writeAnalyzeError(w, http.StatusBadRequest, "missing query parameter")
+			return
+		}
+		var runQuery func(v1.API) (model.Value, v1.Warnings, error)
+
+		if strings.HasSuffix(req.URL.Path, "/query_range") {
+			start, err := parseQueryTime(req.FormValue("start"))
+			if err != nil {
+				writeAnalyzeError(w, http.StatusBadRequest, fmt.Sprintf("invalid start parameter: %s", err))
+				return
+			}
+			end, err := parseQueryTime(req.FormValue("end"))
+			if err != nil {
+				writeAnalyzeError(w, http.StatusBadRequest, fmt.Sprintf("invalid end parameter: %s", err))
+				return
+			}
+			step, err := parseQueryStep(req.FormValue("step"))
+			if err != nil {
+				writeAnalyzeError(w, http.StatusBadRequest, fmt.Sprintf("invalid step parameter: %s", err))
+				return
+			}
+			r := v1.Range{Start: start, End: end, Step: step}
+			runQuery = func(api v1.API) (model.Value, v1.Warnings, error) {
+				return api.QueryRange(req.Context(), query, r)
+			}
+		} else {
+			ts := time.Now()
+			if v := req.FormValue("time"); v != "" {
+				parsed, err := parseQueryTime(v)
+				if err != nil {
+					writeAnalyzeError(w, http.StatusBadRequest, fmt.Sprintf("invalid time parameter: %s", err))
+					return
+				}
+				ts = parsed
+			}
+			runQuery = func(api v1.API) (model.Value, v1.Warnings, error) {
+				return api.Query(req.Context(), query, ts)
+			}
+		}
+
+		val, warnings, err := runQuery(primary)
+		if err != nil {
+			writeAnalyzeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("querying GCM failed: %s", err))
+			return
+		}
+		// The secondary typically gets decommissioned at some point during the
+		// migration. Serve the primary result and surface its failure as a
+		// warning rather than failing the query outright.
+		secVal, secWarnings, err := runQuery(secondary)
+		if err != nil {
+			level.Warn(logger).Log("msg", "querying secondary endpoint failed", "err", err)
+			warnings = append(warnings, fmt.Sprintf("querying secondary endpoint failed: %s", err))
+		} else {
+			warnings = append(warnings, secWarnings...)
+			val = mergeValues(val, secVal)
+		}
+
+		resp := map[string]interface{}{
+			"status": "success",
+			"data": map[string]interface{}{
+				"resultType": val.Type().String(),
+				"result":     val,
+			},
+		}
+		if len(warnings) > 0 {
+			resp["warnings"] = warnings
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// mergeValues merges the secondary query result into the primary one,
+// deduplicating series by their label sets. Results of mismatching or
+// label-less types are served from the primary alone.
+func mergeValues(primary, secondary model.Value) model.Value {
+	switch p := primary.(type) {
+	case model.Vector:
+		if s, ok := secondary.(model.Vector); ok {
+			return mergeVectors(p, s)
+		}
+	case model.Matrix:
+		if s, ok := secondary.(model.Matrix); ok {
+			return mergeMatrices(p, s)
+		}
+	}
+	return primary
+}
+
+// mergeVectors appends secondary samples whose label sets are not already
+// present in the primary vector.
+func mergeVectors(primary, secondary model.Vector) model.Vector {
+	seen := make(map[model.Fingerprint]bool, len(primary))
+	for _, s := range primary {
+		seen[s.Metric.Fingerprint()] = true
+	}
+	out := primary
+	for _, s := range secondary {
+		if !seen[s.Metric.Fingerprint()] {
+			out = append(out, s)
+		}
+	}
+	sort.Sort(out)
+	return out
+}
+
+// mergeMatrices merges the series of both matrices by their label sets. The
+// sample streams of series present in both are combined, with the primary
+// sample winning when both have one at the same timestamp.
+func mergeMatrices(primary, secondary model.Matrix) model.Matrix {
+	idx := make(map[model.Fingerprint]int, len(primary))
+	for i, ss := range primary {
+		idx[ss.Metric.Fingerprint()] = i
+	}
+	out := primary
+	for _, ss := range secondary {
+		i, ok := idx[ss.Metric.Fingerprint()]
+		if !ok {
+			out = append(out, ss)
+			continue
+		}
+		out[i].Values = mergeSamplePairs(out[i].Values, ss.Values)
+	}
+	sort.Sort(out)
+	return out
+}
+
+// mergeSamplePairs merges two sample slices in ascending timestamp order,
+// preferring the primary sample when both contain one for the same timestamp.
+func mergeSamplePairs(primary, secondary []model.SamplePair) []model.SamplePair {
+	out := make([]model.SamplePair, 0, len(primary)+len(secondary))
+	var i, j int
+	for i < len(primary) && j < len(secondary) {
+		switch {
+		case primary[i].Timestamp < secondary[j].Timestamp:
+			out = append(out, primary[i])
+			i++
+		case primary[i].Timestamp > secondary[j].Timestamp:
+			out = append(out, secondary[j])
+			j++
+		default:
+			out = append(out, primary[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, primary[i:]...)
+	out = append(out, secondary[j:]...)
+	return out
+}
+
+// parseQueryStep parses a query API step parameter, accepting both duration
+// strings and float seconds.
+func parseQueryStep(s string) (time.Duration, error) {
+	if d, err := model.ParseDuration(s); err == nil {
+		return time.Duration(d), nil
+	}
+	var sec float64
+	if _, err := fmt.Sscanf(s, "%f", &sec); err != nil {
+		return 0, fmt.Errorf("cannot parse %q as duration", s)
+	}
+	return time.Duration(sec * float64(time.Second)), nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestMergeVectors(t *testing.T) {
+	metric := func(job string) model.Metric {
+		return model.Metric{"__name__": "up", "job": model.LabelValue(job)}
+	}
+	primary := model.Vector{
+		{Metric: metric("a"), Value: 1},
+		{Metric: metric("b"), Value: 1},
+	}
+	secondary := model.Vector{
+		// Duplicate of the primary with a deviating value; must be dropped.
+		{Metric: metric("b"), Value: 0},
+		{Metric: metric("c"), Value: 1},
+	}
+	out := mergeVectors(primary, secondary)
+	if len(out) != 3 {
+		t.Fatalf("expected 3 samples, got %v", out)
+	}
+	for _, s := range out {
+		if s.Value != 1 {
+			t.Errorf("expected primary value 1 for %s, got %v", s.Metric, s.Value)
+		}
+	}
+}
+
+func TestMergeMatrices(t *testing.T) {
+	metric := func(job string) model.Metric {
+		return model.Metric{"__name__": "up", "job": model.LabelValue(job)}
+	}
+	primary := model.Matrix{
+		{Metric: metric("a"), Values: []model.SamplePair{{Timestamp: 20, Value: 1}, {Timestamp: 30, Value: 1}}},
+	}
+	secondary := model.Matrix{
+		// Overlaps the primary at timestamp 20, where the primary must win.
+		{Metric: metric("a"), Values: []model.SamplePair{{Timestamp: 10, Value: 0}, {Timestamp: 20, Value: 0}}},
+		{Metric: metric("b"), Values: []model.SamplePair{{Timestamp: 10, Value: 0}}},
+	}
+	out := mergeMatrices(primary, secondary)
+	if len(out) != 2 {
+		t.Fatalf("expected 2 series, got %v", out)
+	}
+	var merged *model.SampleStream
+	for _, ss := range out {
+		if ss.Metric["job"] == "a" {
+			merged = ss
+		}
+	}
+	if merged == nil {
+		t.Fatalf("series for job a missing in %v", out)
+	}
+	want := []model.SamplePair{{Timestamp: 10, Value: 0}, {Timestamp: 20, Value: 1}, {Timestamp: 30, Value: 1}}
+	if len(merged.Values) != len(want) {
+		t.Fatalf("expected %d samples, got %v", len(want), merged.Values)
+	}
+	for i, sp := range want {
+		if merged.Values[i] != sp {
+			t.Errorf("expected sample %v at index %d, got %v", sp, i, merged.Values[i])
+		}
+	}
+}
+
+func TestParseQueryStep(t *testing.T) {
+	if d, err := parseQueryStep("15s"); err != nil || d != 15*time.Second {
+		t.Errorf("unexpected result (%v, %v) for duration string", d, err)
+	}
+	if d, err := parseQueryStep("0.5"); err != nil || d != 500*time.Millisecond {
+		t.Errorf("unexpected result (%v, %v) for float seconds", d, err)
+	}
+	if _, err := parseQueryStep("not-a-step"); err == nil {
+		t.Errorf("expected error for invalid step")
+	}
+}
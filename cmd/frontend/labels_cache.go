@@ -0,0 +1,232 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/thanos/pkg/cacheutil"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// labelsCacheStore stores serialized API responses under a key for a TTL.
+// Implementations must be safe for concurrent use.
+type labelsCacheStore interface {
+	get(ctx context.Context, key string) ([]byte, bool)
+	set(ctx context.Context, key string, value []byte, ttl time.Duration)
+}
+
+// memoryLabelsCache is a process-local labelsCacheStore.
+type memoryLabelsCache struct {
+	mtx     sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryLabelsCache() *memoryLabelsCache {
+	return &memoryLabelsCache{entries: map[string]memoryCacheEntry{}}
+}
+
+func (c *memoryLabelsCache) get(_ context.Context, key string) ([]byte, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *memoryLabelsCache) set(_ context.Context, key string, value []byte, ttl time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// Opportunistically drop expired entries to bound memory usage.
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = memoryCacheEntry{value: value, expires: now.Add(ttl)}
+}
+
+// memcachedLabelsCache is a labelsCacheStore backed by a shared memcached
+// deployment so that horizontally scaled frontends share a single cache.
+type memcachedLabelsCache struct {
+	client cacheutil.RemoteCacheClient
+}
+
+// newMemcachedLabelsCache creates a cache store against the given comma-separated
+// list of memcached addresses.
+func newMemcachedLabelsCache(logger log.Logger, addresses []string, reg prometheus.Registerer) (*memcachedLabelsCache, error) {
+	conf, err := yaml.Marshal(cacheutil.MemcachedClientConfig{Addresses: addresses})
+	if err != nil {
+		return nil, err
+	}
+	client, err := cacheutil.NewMemcachedClient(logger, "labels", conf, reg)
+	if err != nil {
+		return nil, err
+	}
+	return &memcachedLabelsCache{client: client}, nil
+}
+
+func (c *memcachedLabelsCache) get(ctx context.Context, key string) ([]byte, bool) {
+	res := c.client.GetMulti(ctx, []string{key})
+	b, ok := res[key]
+	return b, ok
+}
+
+func (c *memcachedLabelsCache) set(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	// Failed async stores are tracked by the client itself, nothing to do here.
+	c.client.SetAsync(ctx, key, value, ttl)
+}
+
+// labelsCacheHandler caches successful responses of the label name and label
+// value endpoints for a fixed TTL. Grafana variable queries repeatedly hit
+// these endpoints and tend to dominate latency and GCM API quota.
+// It optionally constrains the queried time range to a maximum lookback window.
+type labelsCacheHandler struct {
+	next        http.Handler
+	store       labelsCacheStore
+	ttl         time.Duration
+	maxLookback time.Duration
+}
+
+// cachedResponse is the serialized representation of a cached API response.
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+func newLabelsCacheHandler(next http.Handler, store labelsCacheStore, ttl, maxLookback time.Duration) *labelsCacheHandler {
+	return &labelsCacheHandler{
+		next:        next,
+		store:       store,
+		ttl:         ttl,
+		maxLookback: maxLookback,
+	}
+}
+
+func (h *labelsCacheHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// Only GET requests are cacheable. Everything else is passed through.
+	if req.Method != http.MethodGet {
+		h.next.ServeHTTP(w, req)
+		return
+	}
+
+	if h.maxLookback > 0 {
+		h.constrainLookback(req)
+	}
+	if h.ttl <= 0 {
+		h.next.ServeHTTP(w, req)
+		return
+	}
+	// Hash the key to stay within the length and character restrictions of
+	// external caches.
+	sum := sha256.Sum256([]byte(req.URL.Path + "?" + req.URL.Query().Encode()))
+	key := "labels:" + hex.EncodeToString(sum[:])
+
+	if b, ok := h.store.get(req.Context(), key); ok {
+		var cached cachedResponse
+		if err := json.Unmarshal(b, &cached); err == nil {
+			copyHeader(w.Header(), cached.Header)
+			w.WriteHeader(cached.Status)
+			w.Write(cached.Body)
+			return
+		}
+	}
+
+	rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	h.next.ServeHTTP(rec, req)
+
+	if rec.status != http.StatusOK {
+		return
+	}
+	b, err := json.Marshal(cachedResponse{
+		Status: rec.status,
+		Header: rec.Header().Clone(),
+		Body:   rec.body.Bytes(),
+	})
+	if err != nil {
+		return
+	}
+	h.store.set(req.Context(), key, b, h.ttl)
+}
+
+// constrainLookback limits the start of the queried time range to the
+// configured maximum lookback window.
+func (h *labelsCacheHandler) constrainLookback(req *http.Request) {
+	var (
+		q        = req.URL.Query()
+		earliest = time.Now().Add(-h.maxLookback)
+	)
+	start, err := parseTimeParam(q.Get("start"))
+	if err != nil || start.Before(earliest) {
+		q.Set("start", fmt.Sprintf("%d", earliest.Unix()))
+	}
+	if _, err := parseTimeParam(q.Get("end")); err != nil {
+		q.Set("end", fmt.Sprintf("%d", time.Now().Unix()))
+	}
+	req.URL.RawQuery = q.Encode()
+}
+
+// parseTimeParam parses a time parameter in the formats accepted by the
+// Prometheus HTTP API, i.e. Unix seconds (with optional fractions) or RFC3339.
+func parseTimeParam(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty time value")
+	}
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := int64(t), t-float64(int64(t))
+		return time.Unix(sec, int64(frac*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// responseRecorder captures the response for caching while writing it through
+// to the client.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -36,11 +36,14 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/api"
+	apiv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/api/option"
 	apihttp "google.golang.org/api/transport/http"
 
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/logging"
 	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/ui"
 )
 
@@ -63,14 +66,58 @@ var (
 
 	targetURLStr = flag.String("query.target-url", fmt.Sprintf("https://monitoring.googleapis.com/v1/projects/%s/location/global/prometheus", projectIDVar),
 		fmt.Sprintf("The URL to forward authenticated requests to. (%s is replaced with the --project-id flag.)", projectIDVar))
+
+	rulesTargetURLStr = flag.String("rules.target-url", "",
+		"The URL of a rule-evaluator instance to forward requests for /api/v1/rules and /api/v1/alerts to. Leaving it empty disables serving those endpoints.")
+
+	alertmanagerTargetURLStr = flag.String("alertmanager.target-url", "",
+		"The URL of an Alertmanager instance to forward requests under /alertmanager to. Leaving it empty disables serving those endpoints.")
+
+	secondaryTargetURLStr = flag.String("query.secondary-target-url", "",
+		"The URL of a secondary Prometheus-compatible endpoint to merge query results with, e.g. a self-hosted Prometheus holding historical data during a migration to GMP. Series present in both systems are deduplicated by their labels, with GCM taking precedence. Leaving it empty disables result merging.")
+
+	labelsCacheTTL = flag.Duration("query.labels-cache-ttl", 5*time.Minute,
+		"How long responses of the label name and label value endpoints are cached. Set to 0 to disable caching.")
+
+	labelsMaxLookback = flag.Duration("query.labels-max-lookback", 0,
+		"Maximum lookback window for label name and label value queries. Requests with an older or absent start time are constrained to this window. Set to 0 to not constrain requests.")
+
+	memcachedAddresses = flag.String("query.cache-memcached-addresses", "",
+		"Comma-separated list of memcached addresses to use as a cache shared across frontend replicas. If empty, an in-memory cache local to this instance is used.")
+
+	tenantCreds  = tenantCredentials{}
+	tenantHeader = flag.String("query.tenant-header", "X-Tenant",
+		"Header by which requests are mapped to per-tenant credentials configured via --query.tenant-credentials. Requests without the header use the default credentials.")
+
+	logLevel  = flag.String("log.level", "info", logging.LevelFlagHelp)
+	logFormat = flag.String("log.format", "logfmt", logging.FormatFlagHelp)
+
+	allowedMetricPrefixes = flag.String("query.allowed-metric-prefixes", "",
+		"Comma-separated list of metric name prefixes this frontend is allowed to serve. Combined with --query.allowed-namespaces; leaving both empty disables the restriction.")
+
+	allowedNamespaces = flag.String("query.allowed-namespaces", "",
+		"Comma-separated list of namespace label values this frontend is allowed to serve. Combined with --query.allowed-metric-prefixes; leaving both empty disables the restriction.")
+
+	maxQuerySeries = flag.Int64("query.max-series", 0,
+		"Maximum estimated number of time series a single query may touch. Queries exceeding the limit are rejected before being forwarded to GCM. Set to 0 to disable the limit.")
+
+	maxRequestBodySize = flag.Int64("web.max-request-body-size", 10*1024*1024,
+		"Maximum accepted size in bytes of a request body after decompression. Requests with larger bodies are rejected. Set to 0 to disable the limit.")
+
+	enableAccessLog = flag.Bool("web.enable-access-log", false,
+		"Emit a JSON-formatted access log line on stdout for each proxied request, including the authenticated principal, PromQL query, time range, duration, and response size as a coarse Cloud Monitoring API cost indicator.")
 )
 
 func main() {
+	flag.Var(tenantCreds, "query.tenant-credentials",
+		"Mapping of format <tenant>=<credentials file> assigning dedicated GCP credentials to requests carrying the tenant header. May be repeated.")
 	flag.Parse()
 
-	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
-	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
-	logger = log.With(logger, "caller", log.DefaultCaller)
+	logger, err := logging.NewLogger(*logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid logging flags:", err)
+		os.Exit(2)
+	}
 
 	metrics := prometheus.NewRegistry()
 	metrics.MustRegister(
@@ -78,6 +125,12 @@ func main() {
 		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
 	)
 
+	var accessLogger log.Logger
+	if *enableAccessLog {
+		accessLogger = log.NewJSONLogger(log.NewSyncWriter(os.Stdout))
+		accessLogger = log.With(accessLogger, "ts", log.DefaultTimestampUTC, "component", "access_log")
+	}
+
 	if *projectID == "" {
 		level.Error(logger).Log("msg", "--project-id must be set")
 		os.Exit(1)
@@ -95,6 +148,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	var rulesTargetURL, alertmanagerTargetURL *url.URL
+	if *rulesTargetURLStr != "" {
+		rulesTargetURL, err = url.Parse(*rulesTargetURLStr)
+		if err != nil {
+			level.Error(logger).Log("msg", "parsing rules target URL failed", "err", err)
+			os.Exit(1)
+		}
+	}
+	if *alertmanagerTargetURLStr != "" {
+		alertmanagerTargetURL, err = url.Parse(*alertmanagerTargetURLStr)
+		if err != nil {
+			level.Error(logger).Log("msg", "parsing alertmanager target URL failed", "err", err)
+			os.Exit(1)
+		}
+	}
+
 	var g run.Group
 	{
 		term := make(chan os.Signal, 1)
@@ -122,24 +191,119 @@ func main() {
 		}
 		ctx, cancel := context.WithCancel(context.Background())
 
-		transport, err := apihttp.NewTransport(ctx, http.DefaultTransport, opts...)
+		var transport http.RoundTripper
+		transport, err = apihttp.NewTransport(ctx, http.DefaultTransport, opts...)
 		if err != nil {
 			level.Error(logger).Log("msg", "create proxy HTTP transport", "err", err)
 			os.Exit(1)
 		}
+		// Route requests of known tenants through transports with their own
+		// dedicated credentials.
+		if len(tenantCreds) > 0 {
+			transport, err = newTenantTransport(ctx, *tenantHeader, transport, tenantCreds)
+			if err != nil {
+				level.Error(logger).Log("msg", "create per-tenant HTTP transports", "err", err)
+				os.Exit(1)
+			}
+		}
+
+		// Optionally scope the frontend to an allowlist of metric name prefixes
+		// and namespaces so an instance exposed to a single team cannot read
+		// other teams' metrics within the same project.
+		allowlist := newQueryAllowlist(*allowedMetricPrefixes, *allowedNamespaces)
+
+		// Grafana sends long templated queries as POST bodies and optionally
+		// compresses them. Decompress and size-bound bodies before the
+		// allowlist checks and the forward to GCM, neither of which could
+		// read an encoded body. The remote read endpoint is excluded as its
+		// handler decodes its snappy-framed protobuf payload itself.
+		decode := func(next http.Handler) http.Handler {
+			return decodeRequestBody(*maxRequestBodySize, next)
+		}
 
 		server := &http.Server{Addr: *listenAddress}
 		http.Handle("/metrics", promhttp.HandlerFor(metrics, promhttp.HandlerOpts{Registry: metrics}))
-		http.Handle("/api/", forward(logger, targetURL, transport))
+		http.Handle("/api/", decode(allowlist.enforce(forward(logger, accessLogger, targetURL, transport))))
+
+		// Grafana variable queries hammer the label endpoints. Serve them through
+		// a cache and optionally constrain their time range.
+		// With multiple frontend replicas a shared memcached avoids cache stampedes
+		// as all replicas serve from the same entries.
+		var cacheStore labelsCacheStore = newMemoryLabelsCache()
+		if *memcachedAddresses != "" {
+			cacheStore, err = newMemcachedLabelsCache(logger, strings.Split(*memcachedAddresses, ","), metrics)
+			if err != nil {
+				level.Error(logger).Log("msg", "creating memcached cache client failed", "err", err)
+				os.Exit(1)
+			}
+		}
+		labelsHandler := decode(allowlist.enforce(newLabelsCacheHandler(forward(logger, accessLogger, targetURL, transport), cacheStore, *labelsCacheTTL, *labelsMaxLookback)))
+		http.Handle("/api/v1/labels", labelsHandler)
+		http.Handle("/api/v1/label/", labelsHandler)
+
+		// The GCM query API does not implement the remote read protocol. Serve it
+		// directly, backed by regular queries against the API.
+		apiClient, err := api.NewClient(api.Config{Address: targetURL.String(), RoundTripper: transport})
+		if err != nil {
+			level.Error(logger).Log("msg", "creating GCM API client failed", "err", err)
+			os.Exit(1)
+		}
+		// Remote read carries its matchers in a protobuf body the allowlist
+		// middleware cannot inspect. Disable the endpoint entirely when a
+		// restriction is configured rather than serving unchecked reads.
+		if allowlist == nil {
+			http.Handle("/api/v1/read", remoteReadHandler(logger, apiv1.NewAPI(apiClient)))
+		} else {
+			http.Handle("/api/v1/read", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "remote read is disabled on allowlist-restricted frontends", http.StatusForbidden)
+			}))
+		}
 
+		// Explain how a PromQL query maps onto the GCM query API so users can
+		// iterate on expensive queries before putting them on dashboards.
+		http.Handle("/api/v1/analyze", decode(analyzeHandler(logger, apiv1.NewAPI(apiClient))))
+
+		// GCM does not store metric metadata. Synthesize it from the label API
+		// so the metrics explorer and autocompletion of the bundled UI work.
+		http.Handle("/api/v1/metadata", metadataHandler(logger, apiv1.NewAPI(apiClient)))
+
+		// Serve query endpoints by forwarding to GCM or, if a secondary
+		// endpoint is configured, by merging results across both systems for
+		// the duration of a migration.
+		queryHandler := forward(logger, accessLogger, targetURL, transport)
+		if *secondaryTargetURLStr != "" {
+			secondaryClient, err := api.NewClient(api.Config{Address: *secondaryTargetURLStr})
+			if err != nil {
+				level.Error(logger).Log("msg", "creating secondary API client failed", "err", err)
+				os.Exit(1)
+			}
+			queryHandler = federatedQueryHandler(logger, apiv1.NewAPI(apiClient), apiv1.NewAPI(secondaryClient))
+		}
+		// Attach cost estimates to query responses and optionally abort queries
+		// that exceed the configured series budget.
+		queryForward := decode(allowlist.enforce(queryCostHandler(logger, apiv1.NewAPI(apiClient), *maxQuerySeries, queryHandler)))
+		http.Handle("/api/v1/query", queryForward)
+		http.Handle("/api/v1/query_range", queryForward)
+
+		// Rule and alert state is not served by the GCM query API. Forward those
+		// endpoints to the rule-evaluator and Alertmanager if configured so that
+		// clients like Grafana can work against a single endpoint.
+		if rulesTargetURL != nil {
+			http.Handle("/api/v1/rules", forward(logger, accessLogger, rulesTargetURL, http.DefaultTransport))
+			http.Handle("/api/v1/alerts", forward(logger, accessLogger, rulesTargetURL, http.DefaultTransport))
+		}
+		if alertmanagerTargetURL != nil {
+			http.Handle("/alertmanager/", http.StripPrefix("/alertmanager", forward(logger, accessLogger, alertmanagerTargetURL, http.DefaultTransport)))
+		}
+
+		// Liveness only reflects whether the process is serving. Readiness additionally
+		// verifies that GCM can be reached with the configured credentials so that load
+		// balancers stop routing to instances that cannot serve queries.
 		http.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			fmt.Fprintf(w, "Prometheus frontend is Healthy.\n")
 		})
-		http.HandleFunc("/-/ready", func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintf(w, "Prometheus frontend is Ready.\n")
-		})
+		http.HandleFunc("/-/ready", checkReady(logger, targetURL, transport))
 
 		http.Handle("/", ui.Handler(externalURL))
 
@@ -159,23 +323,50 @@ func main() {
 	}
 }
 
-func forward(logger log.Logger, target *url.URL, transport http.RoundTripper) http.Handler {
+func forward(logger, accessLogger log.Logger, target *url.URL, transport http.RoundTripper) http.Handler {
 	client := http.Client{Transport: transport}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var (
+			start     = time.Now()
+			principal string
+			status    int
+			respBytes int64
+		)
+		if accessLogger != nil {
+			defer func() {
+				q := req.URL.Query()
+				accessLogger.Log(
+					"principal", principal,
+					"method", req.Method,
+					"path", req.URL.Path,
+					"query", q.Get("query"),
+					"start", q.Get("start"),
+					"end", q.Get("end"),
+					"step", q.Get("step"),
+					"status", status,
+					"duration_seconds", time.Since(start).Seconds(),
+					"response_bytes", respBytes,
+				)
+			}()
+		}
+
 		username := os.Getenv(authUsernameEnv)
 		password := os.Getenv(authPasswordEnv)
 		if len(username) > 0 && len(password) > 0 {
 			level.Info(logger).Log("msg", "AUTH_USERNAME and AUTH_PASSWORD are set, handling request with basic auth")
 			reqUser, reqPass, ok := req.BasicAuth()
 			if !ok {
-				w.WriteHeader(http.StatusUnauthorized)
+				status = http.StatusUnauthorized
+				w.WriteHeader(status)
 				return
 			}
 			if reqUser != username || reqPass != password {
-				w.WriteHeader(http.StatusForbidden)
+				status = http.StatusForbidden
+				w.WriteHeader(status)
 				return
 			}
+			principal = reqUser
 		}
 
 		u := *target
@@ -195,7 +386,8 @@ func forward(logger log.Logger, target *url.URL, transport http.RoundTripper) ht
 		newReq, err := http.NewRequestWithContext(req.Context(), method, u.String(), req.Body)
 		if err != nil {
 			level.Warn(logger).Log("msg", "creating request failed", "err", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			status = http.StatusInternalServerError
+			w.WriteHeader(status)
 			return
 		}
 		copyHeader(newReq.Header, req.Header)
@@ -203,21 +395,62 @@ func forward(logger log.Logger, target *url.URL, transport http.RoundTripper) ht
 		resp, err := client.Do(newReq)
 		if err != nil {
 			level.Warn(logger).Log("msg", "requesting GCM failed", "err", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			status = http.StatusInternalServerError
+			w.WriteHeader(status)
 			return
 		}
 
 		copyHeader(w.Header(), resp.Header)
-		w.WriteHeader(resp.StatusCode)
+		status = resp.StatusCode
+		w.WriteHeader(status)
 
 		defer resp.Body.Close()
-		if _, err := io.Copy(w, resp.Body); err != nil {
+		if respBytes, err = io.Copy(w, resp.Body); err != nil {
 			level.Warn(logger).Log("msg", "copying response body failed", "err", err)
 			return
 		}
 	})
 }
 
+// checkReady probes the query API with a trivial query through the authenticated
+// transport. It reports unready if the request cannot be built, sent, or is
+// rejected, e.g. due to expired credentials.
+func checkReady(logger log.Logger, target *url.URL, transport http.RoundTripper) http.HandlerFunc {
+	client := http.Client{Transport: transport}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := *target
+		u.Path = path.Join(u.Path, "/api/v1/query")
+		u.RawQuery = url.Values{"query": []string{"vector(1)"}}.Encode()
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			level.Warn(logger).Log("msg", "creating readiness probe request failed", "err", err)
+			http.Error(w, "Prometheus frontend is not Ready.", http.StatusServiceUnavailable)
+			return
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			level.Warn(logger).Log("msg", "readiness probe against GCM failed", "err", err)
+			http.Error(w, "Prometheus frontend is not Ready.", http.StatusServiceUnavailable)
+			return
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode/100 != 2 {
+			level.Warn(logger).Log("msg", "readiness probe against GCM returned non-success", "status", resp.StatusCode)
+			http.Error(w, "Prometheus frontend is not Ready.", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Prometheus frontend is Ready.\n")
+	}
+}
+
 func copyHeader(dst, src http.Header) {
 	for k, vals := range src {
 		for _, v := range vals {
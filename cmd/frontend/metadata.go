@@ -0,0 +1,129 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+const (
+	// metadataLookback is the window over which metric names are listed from
+	// the label API. It bounds the cost of the listing query while still
+	// covering metrics that are scraped infrequently.
+	metadataLookback = 12 * time.Hour
+	// metadataCacheTTL is how long a synthesized metadata listing is reused.
+	// The UI requests metadata on every page load and the set of metric names
+	// changes rarely.
+	metadataCacheTTL = 5 * time.Minute
+)
+
+// metricMetadata mirrors the entries of the Prometheus metadata endpoint.
+type metricMetadata struct {
+	Type string `json:"type"`
+	Help string `json:"help"`
+	Unit string `json:"unit"`
+}
+
+// metadataHandler serves the Prometheus metadata endpoint, which the bundled
+// web UI's metrics explorer and query autocompletion rely on. GCM does not
+// store metric metadata, so entries are synthesized from the metric names
+// served by the label API, with the type inferred from conventional name
+// suffixes.
+func metadataHandler(logger log.Logger, v1api v1.API) http.Handler {
+	var (
+		mtx     sync.Mutex
+		cached  map[string][]metricMetadata
+		expires time.Time
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if cached == nil || time.Now().After(expires) {
+			now := time.Now()
+			names, warnings, err := v1api.LabelValues(req.Context(), "__name__", nil, now.Add(-metadataLookback), now)
+			if err != nil {
+				writeAnalyzeError(w, http.StatusInternalServerError, fmt.Sprintf("listing metric names failed: %s", err))
+				return
+			}
+			if len(warnings) > 0 {
+				level.Warn(logger).Log("msg", "listing metric names produced warnings", "warnings", fmt.Sprint(warnings))
+			}
+			cached = make(map[string][]metricMetadata, len(names))
+			for _, name := range names {
+				cached[string(name)] = []metricMetadata{{Type: inferMetricType(string(name))}}
+			}
+			expires = now.Add(metadataCacheTTL)
+		}
+		data := cached
+		if metric := req.FormValue("metric"); metric != "" {
+			data = map[string][]metricMetadata{}
+			if md, ok := cached[metric]; ok {
+				data[metric] = md
+			}
+		}
+		if v := req.FormValue("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil {
+				writeAnalyzeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit parameter: %s", err))
+				return
+			}
+			if limit >= 0 && len(data) > limit {
+				truncated := make(map[string][]metricMetadata, limit)
+				for name, md := range data {
+					if len(truncated) == limit {
+						break
+					}
+					truncated[name] = md
+				}
+				data = truncated
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   data,
+		})
+	})
+}
+
+// inferMetricType guesses the metadata type of a metric from its name. GCM
+// does not store the type originally exposed by the target, but the naming
+// conventions of the Prometheus ecosystem make the common cases reliable.
+func inferMetricType(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_total"):
+		return "counter"
+	case strings.HasSuffix(name, "_bucket"):
+		return "histogram"
+	// The _sum and _count series exist for both histograms and summaries, so
+	// neither type would be reliable.
+	case strings.HasSuffix(name, "_sum"), strings.HasSuffix(name, "_count"):
+		return "unknown"
+	// Everything else defaults to the most common type.
+	default:
+		return "gauge"
+	}
+}
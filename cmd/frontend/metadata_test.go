@@ -0,0 +1,36 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestInferMetricType(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"http_requests_total", "counter"},
+		{"http_request_duration_seconds_bucket", "histogram"},
+		{"http_request_duration_seconds_sum", "unknown"},
+		{"http_request_duration_seconds_count", "unknown"},
+		{"node_memory_usage_bytes", "gauge"},
+		{"up", "gauge"},
+	}
+	for _, c := range cases {
+		if got := inferMetricType(c.name); got != c.want {
+			t.Errorf("expected type %q for %q, got %q", c.want, c.name, got)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Response headers carrying the estimated cost of the executed query as a
+// coarse Cloud Monitoring API cost indicator.
+const (
+	headerEstimatedSeries = "X-Query-Estimated-Series"
+	headerSeriesLimit     = "X-Query-Series-Limit"
+)
+
+// queryCostHandler estimates the number of time series a query touches before
+// forwarding it and returns the estimate as a response header. If a maximum is
+// configured, queries exceeding it are rejected so a single runaway query
+// cannot exhaust the quota of a shared project.
+// The estimate is computed with one cheap count() instant query per selector
+// of the incoming query.
+func queryCostHandler(logger log.Logger, v1api v1.API, maxSeries int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query, ok := extractQuery(req)
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+		expr, err := parser.ParseExpr(query)
+		if err != nil {
+			// Let the query API produce its own parse error.
+			next.ServeHTTP(w, req)
+			return
+		}
+		var total int64
+		for _, sel := range analyzeExpr(expr).Selectors {
+			n, err := countSeries(req.Context(), v1api, sel.Selector, time.Now())
+			if err != nil {
+				// An incomplete estimate must not block queries. Forward without
+				// enforcing the limit.
+				level.Warn(logger).Log("msg", "estimating query cost failed", "selector", sel.Selector, "err", err)
+				next.ServeHTTP(w, req)
+				return
+			}
+			total += n
+		}
+		w.Header().Set(headerEstimatedSeries, strconv.FormatInt(total, 10))
+		if maxSeries > 0 {
+			w.Header().Set(headerSeriesLimit, strconv.FormatInt(maxSeries, 10))
+			if total > maxSeries {
+				writeAnalyzeError(w, http.StatusUnprocessableEntity,
+					fmt.Sprintf("query touches an estimated %d series, exceeding the configured limit of %d", total, maxSeries))
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// extractQuery returns the PromQL expression of a query API request without
+// consuming the request body.
+func extractQuery(req *http.Request) (string, bool) {
+	if q := req.URL.Query().Get("query"); q != "" {
+		return q, true
+	}
+	if req.Method != http.MethodPost || req.Body == nil {
+		return "", false
+	}
+	b, err := io.ReadAll(req.Body)
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return "", false
+	}
+	vals, err := url.ParseQuery(string(b))
+	if err != nil {
+		return "", false
+	}
+	q := vals.Get("query")
+	return q, q != ""
+}
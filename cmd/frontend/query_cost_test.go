@@ -0,0 +1,96 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/api"
+	apiv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+func TestExtractQuery(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil)
+	if q, ok := extractQuery(req); !ok || q != "up" {
+		t.Fatalf("expected query %q, got %q (ok=%v)", "up", q, ok)
+	}
+
+	body := "query=up&time=123"
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/query", strings.NewReader(body))
+	if q, ok := extractQuery(req); !ok || q != "up" {
+		t.Fatalf("expected query %q, got %q (ok=%v)", "up", q, ok)
+	}
+	// The body must remain readable for the forwarded request.
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != body {
+		t.Fatalf("expected preserved body %q, got %q", body, b)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/query_range", nil)
+	if _, ok := extractQuery(req); ok {
+		t.Fatalf("expected no query to be extracted")
+	}
+}
+
+func TestQueryCostHandler(t *testing.T) {
+	// Stub GCM endpoint serving the count queries of the cost estimation.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1,"25"]}]}}`)
+	}))
+	defer backend.Close()
+
+	apiClient, err := api.NewClient(api.Config{Address: backend.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		doc        string
+		maxSeries  int64
+		want       int
+		wantHeader string
+	}{
+		{doc: "no limit", maxSeries: 0, want: http.StatusOK, wantHeader: "25"},
+		{doc: "within limit", maxSeries: 100, want: http.StatusOK, wantHeader: "25"},
+		{doc: "over limit", maxSeries: 10, want: http.StatusUnprocessableEntity, wantHeader: "25"},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			handler := queryCostHandler(log.NewNopLogger(), apiv1.NewAPI(apiClient), c.maxSeries, next)
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != c.want {
+				t.Fatalf("expected status %d, got %d", c.want, rec.Code)
+			}
+			if got := rec.Header().Get(headerEstimatedSeries); got != c.wantHeader {
+				t.Fatalf("expected estimated series header %q, got %q", c.wantHeader, got)
+			}
+		})
+	}
+}
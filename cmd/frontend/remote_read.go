@@ -0,0 +1,116 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+)
+
+// remoteReadHandler serves the Prometheus remote_read protocol backed by range
+// queries against the GCM query API. It allows an on-prem Prometheus or Thanos
+// to federate GMP data with standard remote read configuration.
+func remoteReadHandler(logger log.Logger, v1api v1.API) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		readReq, err := remote.DecodeReadRequest(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := &prompb.ReadResponse{
+			Results: make([]*prompb.QueryResult, len(readReq.Queries)),
+		}
+		for i, query := range readReq.Queries {
+			result, err := executeRemoteReadQuery(req.Context(), v1api, query)
+			if err != nil {
+				level.Warn(logger).Log("msg", "executing remote read query failed", "err", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			resp.Results[i] = result
+		}
+		if err := remote.EncodeReadResponse(resp, w); err != nil {
+			level.Warn(logger).Log("msg", "encoding remote read response failed", "err", err)
+		}
+	})
+}
+
+// executeRemoteReadQuery translates the label matchers of the remote read query
+// into an instant query over a matrix selector, equivalent to how the
+// rule-evaluator restores alert state through the GCM query API.
+func executeRemoteReadQuery(ctx context.Context, v1api v1.API, query *prompb.Query) (*prompb.QueryResult, error) {
+	matchers, err := remote.FromLabelMatchers(query.Matchers)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode label matchers")
+	}
+	duration := (query.EndTimestampMs - query.StartTimestampMs) / 1000
+	if duration <= 0 {
+		return &prompb.QueryResult{}, nil
+	}
+	matcherStrs := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		matcherStrs = append(matcherStrs, m.String())
+	}
+	expr := fmt.Sprintf("{%s}[%ds]", strings.Join(matcherStrs, ", "), duration)
+
+	end := time.Unix(query.EndTimestampMs/1000, 0)
+	val, _, err := v1api.Query(ctx, expr, end)
+	if err != nil {
+		return nil, errors.Wrap(err, "query GCM")
+	}
+	matrix, ok := val.(model.Matrix)
+	if !ok {
+		return nil, errors.Errorf("expected matrix response from query, got %v", val.Type())
+	}
+
+	result := &prompb.QueryResult{}
+	for _, series := range matrix {
+		ts := &prompb.TimeSeries{
+			Labels:  make([]prompb.Label, 0, len(series.Metric)),
+			Samples: make([]prompb.Sample, 0, len(series.Values)),
+		}
+		for name, value := range series.Metric {
+			ts.Labels = append(ts.Labels, prompb.Label{Name: string(name), Value: string(value)})
+		}
+		sort.Slice(ts.Labels, func(i, j int) bool { return ts.Labels[i].Name < ts.Labels[j].Name })
+
+		for _, sample := range series.Values {
+			// Samples before the query start time may be returned by the matrix
+			// selector, drop them to honor the requested range.
+			if int64(sample.Timestamp) < query.StartTimestampMs {
+				continue
+			}
+			ts.Samples = append(ts.Samples, prompb.Sample{
+				Timestamp: int64(sample.Timestamp),
+				Value:     float64(sample.Value),
+			})
+		}
+		result.Timeseries = append(result.Timeseries, ts)
+	}
+	return result, nil
+}
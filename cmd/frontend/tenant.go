@@ -0,0 +1,98 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/option"
+	apihttp "google.golang.org/api/transport/http"
+)
+
+// tenantCredentials maps a tenant name to a GCP credentials file, populated
+// from a repeatable tenant=file flag.
+type tenantCredentials map[string]string
+
+func (tc tenantCredentials) String() string {
+	var parts []string
+	for tenant, file := range tc {
+		parts = append(parts, fmt.Sprintf("%s=%s", tenant, file))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (tc tenantCredentials) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("flag must be of format <tenant>=<credentials file>, got %q", value)
+	}
+	tc[parts[0]] = parts[1]
+	return nil
+}
+
+// tenantTransport selects the transport authenticating against GCM based on
+// the tenant header of the request. This allows a single frontend to serve
+// multiple teams with their own isolated IAM permissions.
+type tenantTransport struct {
+	header           string
+	defaultTransport http.RoundTripper
+	byTenant         map[string]http.RoundTripper
+}
+
+// newTenantTransport creates an authenticated transport per tenant based on
+// the given credential mapping. Requests without the tenant header use the
+// provided default transport.
+func newTenantTransport(ctx context.Context, header string, defaultTransport http.RoundTripper, creds tenantCredentials) (*tenantTransport, error) {
+	t := &tenantTransport{
+		header:           header,
+		defaultTransport: defaultTransport,
+		byTenant:         map[string]http.RoundTripper{},
+	}
+	for tenant, file := range creds {
+		opts := []option.ClientOption{
+			option.WithScopes("https://www.googleapis.com/auth/monitoring.read"),
+			option.WithCredentialsFile(file),
+		}
+		transport, err := apihttp.NewTransport(ctx, http.DefaultTransport, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("create transport for tenant %q: %w", tenant, err)
+		}
+		t.byTenant[tenant] = transport
+	}
+	return t, nil
+}
+
+func (t *tenantTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tenant := req.Header.Get(t.header)
+	if tenant == "" {
+		return t.defaultTransport.RoundTrip(req)
+	}
+	transport, ok := t.byTenant[tenant]
+	if !ok {
+		// Reject unknown tenants rather than falling back to the default
+		// credentials, which may have broader permissions.
+		return &http.Response{
+			StatusCode: http.StatusForbidden,
+			Header:     make(http.Header),
+			Body:       io.NopCloser(strings.NewReader(fmt.Sprintf("unknown tenant %q\n", tenant))),
+			Request:    req,
+		}, nil
+	}
+	return transport.RoundTrip(req)
+}
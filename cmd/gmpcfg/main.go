@@ -0,0 +1,55 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command gmpcfg is offline tooling for Managed Service for Prometheus
+// configuration. Unlike the kubectl-gmp plugin it requires no cluster access
+// and is thus suitable for CI pipelines and local development.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Offline tooling for Managed Service for Prometheus configuration.
+
+Usage:
+  gmpcfg lint <files...>                         Validate monitoring resources in
+                                                 manifest files.
+  gmpcfg migrate --config-file=<prometheus.yml>  Convert a Prometheus configuration
+                                                 into equivalent monitoring resources.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "lint":
+		err = lintCmd(os.Args[2:])
+	case "migrate":
+		err = migrateCmd(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown subcommand %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	promconfig "github.com/prometheus/prometheus/config"
+	discoverykube "github.com/prometheus/prometheus/discovery/kubernetes"
+	"github.com/prometheus/prometheus/model/relabel"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	kyaml "sigs.k8s.io/yaml"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator"
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func migrateCmd(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configFile := fs.String("config-file", "", "Prometheus configuration file to convert.")
+	fs.Parse(args)
+
+	if *configFile == "" {
+		return errors.New("--config-file must be set")
+	}
+	cfg, err := promconfig.LoadFile(*configFile, false, false, log.NewNopLogger())
+	if err != nil {
+		return errors.Wrapf(err, "load Prometheus config %q", *configFile)
+	}
+	m := newMigration(cfg)
+	m.run()
+
+	if err := m.writeManifests(os.Stdout); err != nil {
+		return err
+	}
+	m.writeReport(os.Stderr)
+	return nil
+}
+
+// migration converts a Prometheus configuration into monitoring resources.
+// Constructs without an equivalent are collected in a report rather than
+// failing the conversion, so a best-effort result is always produced.
+type migration struct {
+	cfg     *promconfig.Config
+	objects []interface{}
+	notes   []string
+}
+
+func newMigration(cfg *promconfig.Config) *migration {
+	return &migration{cfg: cfg}
+}
+
+func (m *migration) notef(format string, args ...interface{}) {
+	m.notes = append(m.notes, fmt.Sprintf(format, args...))
+}
+
+func (m *migration) run() {
+	m.convertGlobal()
+
+	if len(m.cfg.RemoteWriteConfigs) > 0 {
+		m.notef("remote_write: Managed Service for Prometheus exports data to Cloud Monitoring directly, remote write configurations were not converted")
+	}
+	if len(m.cfg.RuleFiles) > 0 {
+		m.notef("rule_files: recording and alerting rules must be converted into Rules or ClusterRules resources separately")
+	}
+	if m.cfg.AlertingConfig.AlertmanagerConfigs != nil && len(m.cfg.AlertingConfig.AlertmanagerConfigs) > 0 {
+		m.notef("alerting: configure Alertmanager through the managedAlertmanager section of the OperatorConfig instead")
+	}
+	for _, sc := range m.cfg.ScrapeConfigs {
+		m.convertScrapeConfig(sc)
+	}
+}
+
+// convertGlobal turns global configuration sections into an OperatorConfig.
+func (m *migration) convertGlobal() {
+	externalLabels := map[string]string{}
+	for _, l := range m.cfg.GlobalConfig.ExternalLabels {
+		externalLabels[l.Name] = l.Value
+	}
+	if len(externalLabels) == 0 {
+		return
+	}
+	m.objects = append(m.objects, &monitoringv1.OperatorConfig{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: monitoringv1.SchemeGroupVersion.String(),
+			Kind:       "OperatorConfig",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      operator.NameOperatorConfig,
+			Namespace: operator.DefaultPublicNamespace,
+		},
+		Collection: monitoringv1.CollectionSpec{
+			ExternalLabels: externalLabels,
+		},
+	})
+}
+
+func (m *migration) convertScrapeConfig(sc *promconfig.ScrapeConfig) {
+	var sds []*discoverykube.SDConfig
+	for _, c := range sc.ServiceDiscoveryConfigs {
+		sd, ok := c.(*discoverykube.SDConfig)
+		if !ok {
+			m.notef("job %q: discovery mechanism %q is not supported, only kubernetes_sd_configs can be converted", sc.JobName, c.Name())
+			continue
+		}
+		sds = append(sds, sd)
+	}
+	if len(sds) == 0 {
+		m.notef("job %q: skipped, no kubernetes_sd_configs found", sc.JobName)
+		return
+	}
+	var namespaces []string
+	for _, sd := range sds {
+		if sd.Role != discoverykube.RolePod {
+			m.notef("job %q: kubernetes_sd_configs role %q is not supported, PodMonitoring resources always discover pods", sc.JobName, sd.Role)
+			return
+		}
+		namespaces = append(namespaces, sd.NamespaceDiscovery.Names...)
+	}
+
+	endpoint := monitoringv1.ScrapeEndpoint{
+		Interval: sc.ScrapeInterval.String(),
+		Timeout:  sc.ScrapeTimeout.String(),
+		Params:   sc.Params,
+	}
+	if sc.MetricsPath != "/metrics" {
+		endpoint.Path = sc.MetricsPath
+	}
+	if sc.Scheme != "http" {
+		endpoint.Scheme = sc.Scheme
+	}
+
+	selector := map[string]string{}
+	var fromPod []monitoringv1.LabelMapping
+
+	for _, rc := range sc.RelabelConfigs {
+		podLabel, literal := podLabelSource(rc)
+
+		switch {
+		// Keeping targets by an exact pod label match translates into the
+		// pod selector of the monitoring resource.
+		case rc.Action == relabel.Keep && podLabel != "" && literal:
+			selector[podLabel] = regexString(rc.Regex)
+		// Keeping targets by an exact container port name determines the
+		// scrape port.
+		case rc.Action == relabel.Keep && sourceLabel(rc) == "__meta_kubernetes_pod_container_port_name" && literalRegex(rc.Regex):
+			endpoint.Port = intstr.FromString(regexString(rc.Regex))
+		// Copying a pod label into a target label translates into a fromPod
+		// label mapping.
+		case rc.Action == relabel.Replace && podLabel != "" && regexString(rc.Regex) == "(.*)" && rc.Replacement == "$1" && rc.TargetLabel != "":
+			fromPod = append(fromPod, monitoringv1.LabelMapping{From: podLabel, To: rc.TargetLabel})
+		default:
+			m.notef("job %q: relabel rule (action %q, source labels %v) cannot be expressed and was dropped", sc.JobName, rc.Action, rc.SourceLabels)
+		}
+	}
+	if endpoint.Port.StrVal == "" && endpoint.Port.IntVal == 0 {
+		m.notef("job %q: skipped, scrape port could not be determined from the relabel rules; create a PodMonitoring with an explicit endpoint port manually", sc.JobName)
+		return
+	}
+	for _, rc := range sc.MetricRelabelConfigs {
+		endpoint.MetricRelabeling = append(endpoint.MetricRelabeling, monitoringv1.RelabelingRule{
+			SourceLabels: labelNames(rc.SourceLabels),
+			Separator:    rc.Separator,
+			TargetLabel:  rc.TargetLabel,
+			Regex:        regexString(rc.Regex),
+			Modulus:      rc.Modulus,
+			Replacement:  rc.Replacement,
+			Action:       string(rc.Action),
+		})
+	}
+
+	name := resourceName(sc.JobName)
+	if name != sc.JobName {
+		m.notef("job %q: renamed to %q to be a valid resource name, the job target label changes accordingly", sc.JobName, name)
+	}
+	if len(namespaces) == 0 {
+		m.objects = append(m.objects, &monitoringv1.ClusterPodMonitoring{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: monitoringv1.SchemeGroupVersion.String(),
+				Kind:       "ClusterPodMonitoring",
+			},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: monitoringv1.ClusterPodMonitoringSpec{
+				Selector:     metav1.LabelSelector{MatchLabels: selector},
+				Endpoints:    []monitoringv1.ScrapeEndpoint{endpoint},
+				TargetLabels: monitoringv1.TargetLabels{FromPod: fromPod},
+			},
+		})
+		return
+	}
+	for _, ns := range namespaces {
+		m.objects = append(m.objects, &monitoringv1.PodMonitoring{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: monitoringv1.SchemeGroupVersion.String(),
+				Kind:       "PodMonitoring",
+			},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+			Spec: monitoringv1.PodMonitoringSpec{
+				Selector:     metav1.LabelSelector{MatchLabels: selector},
+				Endpoints:    []monitoringv1.ScrapeEndpoint{endpoint},
+				TargetLabels: monitoringv1.TargetLabels{FromPod: fromPod},
+			},
+		})
+	}
+}
+
+func (m *migration) writeManifests(w io.Writer) error {
+	for _, obj := range m.objects {
+		b, err := kyaml.Marshal(obj)
+		if err != nil {
+			return errors.Wrap(err, "marshal manifest")
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *migration) writeReport(w io.Writer) {
+	if len(m.notes) == 0 {
+		fmt.Fprintln(w, "The configuration was converted without remarks.")
+		return
+	}
+	fmt.Fprintf(w, "The following %d construct(s) could not be fully converted:\n", len(m.notes))
+	for _, n := range m.notes {
+		fmt.Fprintf(w, "  - %s\n", n)
+	}
+}
+
+const podLabelPrefix = "__meta_kubernetes_pod_label_"
+
+// podLabelSource returns the pod label a relabel rule matches against, if it
+// has exactly one source label populated from pod labels, and whether its
+// regex only matches a literal value.
+func podLabelSource(rc *relabel.Config) (label string, literal bool) {
+	src := sourceLabel(rc)
+	if !strings.HasPrefix(src, podLabelPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(src, podLabelPrefix), literalRegex(rc.Regex)
+}
+
+// sourceLabel returns the single source label of a relabel rule, or an empty
+// string if it has none or several.
+func sourceLabel(rc *relabel.Config) string {
+	if len(rc.SourceLabels) != 1 {
+		return ""
+	}
+	return string(rc.SourceLabels[0])
+}
+
+// regexString returns the original pattern of a relabel regex.
+func regexString(re relabel.Regexp) string {
+	v, err := re.MarshalYAML()
+	if err != nil {
+		return ""
+	}
+	s, _ := v.(string)
+	return s
+}
+
+// literalRegex determines whether a regex matches exactly one literal string.
+func literalRegex(re relabel.Regexp) bool {
+	s := regexString(re)
+	return s != "" && regexp.QuoteMeta(s) == s
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// resourceName derives a valid Kubernetes resource name from a scrape job name.
+func resourceName(job string) string {
+	return strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(job), "-"), "-")
+}
+
+// labelNames converts Prometheus label names to plain strings.
+func labelNames(names model.LabelNames) []string {
+	var res []string
+	for _, n := range names {
+		res = append(res, string(n))
+	}
+	return res
+}
@@ -0,0 +1,388 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command kubectl-gmp is a kubectl plugin for inspecting the state of Managed
+// Service for Prometheus in a cluster. Install it by placing the binary named
+// kubectl-gmp on the PATH and run it as `kubectl gmp <subcommand>`.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Blank import required to register GCP auth handlers to talk to GKE clusters.
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator"
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const usage = `Inspect the state of Managed Service for Prometheus in a cluster.
+
+Usage:
+  kubectl gmp status           Show status conditions of monitoring resources.
+  kubectl gmp targets          Show scrape target health across all collectors.
+  kubectl gmp rendered-config  Print the generated collector configuration.
+  kubectl gmp validate <file>  Validate monitoring resources in manifest files.
+  kubectl gmp trace [entry]    Trace generated config entries to their source objects.
+  kubectl gmp rbac <file>      Generate minimal RBAC manifests for the given monitoring resources.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "status":
+		err = statusCmd(os.Args[2:])
+	case "targets":
+		err = targetsCmd(os.Args[2:])
+	case "rendered-config":
+		err = renderedConfigCmd(os.Args[2:])
+	case "validate":
+		err = validateCmd(os.Args[2:])
+	case "trace":
+		err = traceCmd(os.Args[2:])
+	case "rbac":
+		err = rbacCmd(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown subcommand %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// newClient returns a controller-runtime client with the monitoring types
+// registered, using the same kubeconfig resolution as kubectl.
+func newClient() (client.Client, error) {
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "loading kubeconfig failed")
+	}
+	sc := runtime.NewScheme()
+	if err := scheme.AddToScheme(sc); err != nil {
+		return nil, errors.Wrap(err, "add Kubernetes core scheme")
+	}
+	if err := monitoringv1.AddToScheme(sc); err != nil {
+		return nil, errors.Wrap(err, "add monitoring scheme")
+	}
+	return client.New(cfg, client.Options{Scheme: sc})
+}
+
+func statusCmd(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	namespace := fs.String("namespace", "", "Only show resources in this namespace. Empty means all namespaces.")
+	fs.Parse(args)
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	var opts []client.ListOption
+	if *namespace != "" {
+		opts = append(opts, client.InNamespace(*namespace))
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tCONDITION\tSTATUS\tREASON\tMESSAGE")
+
+	var podMons monitoringv1.PodMonitoringList
+	if err := c.List(ctx, &podMons, opts...); err != nil {
+		return errors.Wrap(err, "list PodMonitorings")
+	}
+	for _, pm := range podMons.Items {
+		printConditions(w, "PodMonitoring", pm.Namespace, pm.Name, pm.Status.Conditions)
+	}
+	var clusterPodMons monitoringv1.ClusterPodMonitoringList
+	if err := c.List(ctx, &clusterPodMons); err != nil {
+		return errors.Wrap(err, "list ClusterPodMonitorings")
+	}
+	for _, cm := range clusterPodMons.Items {
+		printConditions(w, "ClusterPodMonitoring", "", cm.Name, cm.Status.Conditions)
+	}
+	var rules monitoringv1.RulesList
+	if err := c.List(ctx, &rules, opts...); err != nil {
+		return errors.Wrap(err, "list Rules")
+	}
+	for _, rs := range rules.Items {
+		printConditions(w, "Rules", rs.Namespace, rs.Name, rs.Status.Conditions)
+	}
+	return nil
+}
+
+func printConditions(w *tabwriter.Writer, kind, namespace, name string, conds []metav1.Condition) {
+	if len(conds) == 0 {
+		fmt.Fprintf(w, "%s\t%s\t%s\t\t\t\t\n", kind, namespace, name)
+		return
+	}
+	for _, c := range conds {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", kind, namespace, name, c.Type, c.Status, c.Reason, c.Message)
+	}
+}
+
+// collectorTargetsPort is the port of the collector's Prometheus web UI, used
+// to retrieve target health through the API server's pod proxy.
+const collectorTargetsPort = 19090
+
+func targetsCmd(args []string) error {
+	fs := flag.NewFlagSet("targets", flag.ExitOnError)
+	operatorNamespace := fs.String("operator-namespace", operator.DefaultOperatorNamespace,
+		"Namespace in which the collectors run.")
+	unhealthyOnly := fs.Bool("unhealthy-only", false, "Only show targets that are not up.")
+	fs.Parse(args)
+
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "loading kubeconfig failed")
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return errors.Wrap(err, "build Kubernetes clientset")
+	}
+	ctx := context.Background()
+
+	pods, err := clientset.CoreV1().Pods(*operatorNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", operator.LabelAppName, operator.NameCollector),
+	})
+	if err != nil {
+		return errors.Wrap(err, "list collector pods")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "COLLECTOR\tJOB\tINSTANCE\tHEALTH\tLAST ERROR")
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		b, err := clientset.CoreV1().RESTClient().Get().
+			Namespace(*operatorNamespace).
+			Resource("pods").
+			Name(fmt.Sprintf("%s:%d", pod.Name, collectorTargetsPort)).
+			SubResource("proxy").
+			Suffix("api/v1/targets").
+			DoRaw(ctx)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t\t\tunreachable\t%s\n", pod.Name, err)
+			continue
+		}
+		var resp targetsResponse
+		if err := json.Unmarshal(b, &resp); err != nil {
+			return errors.Wrapf(err, "decode targets response from pod %q", pod.Name)
+		}
+		for _, t := range resp.Data.ActiveTargets {
+			if *unhealthyOnly && t.Health == "up" {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pod.Name, t.Labels["job"], t.Labels["instance"], t.Health, t.LastError)
+		}
+	}
+	return nil
+}
+
+// targetsResponse mirrors the relevant fields of the Prometheus /api/v1/targets
+// response.
+type targetsResponse struct {
+	Data struct {
+		ActiveTargets []struct {
+			Labels    map[string]string `json:"labels"`
+			Health    string            `json:"health"`
+			LastError string            `json:"lastError"`
+		} `json:"activeTargets"`
+	} `json:"data"`
+}
+
+func renderedConfigCmd(args []string) error {
+	fs := flag.NewFlagSet("rendered-config", flag.ExitOnError)
+	operatorNamespace := fs.String("operator-namespace", operator.DefaultOperatorNamespace,
+		"Namespace in which the operator manages its resources.")
+	fs.Parse(args)
+
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "loading kubeconfig failed")
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return errors.Wrap(err, "build Kubernetes clientset")
+	}
+	cm, err := clientset.CoreV1().ConfigMaps(*operatorNamespace).Get(context.Background(), operator.NameCollector, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "get collector ConfigMap")
+	}
+	data, ok := cm.Data["config.yaml"]
+	if !ok {
+		return errors.Errorf("ConfigMap %s/%s has no config.yaml entry", *operatorNamespace, operator.NameCollector)
+	}
+	fmt.Print(data)
+	return nil
+}
+
+func traceCmd(args []string) error {
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+	operatorNamespace := fs.String("operator-namespace", operator.DefaultOperatorNamespace,
+		"Namespace in which the operator manages its resources.")
+	fs.Parse(args)
+
+	// Without an argument all attributed entries are listed. Otherwise matches
+	// are restricted to entries containing the argument, e.g. a scrape job name
+	// taken from a config line or a target's job label.
+	var filter string
+	if fs.NArg() > 0 {
+		filter = fs.Arg(0)
+	}
+
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "loading kubeconfig failed")
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return errors.Wrap(err, "build Kubernetes clientset")
+	}
+	ctx := context.Background()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "OBJECT\tENTRY\tSOURCE KIND\tNAMESPACE\tNAME\tGENERATION")
+
+	found := false
+	printAttribution := func(object, annotation string) error {
+		if annotation == "" {
+			return nil
+		}
+		attrs, err := operator.ParseSourceAttribution(annotation)
+		if err != nil {
+			return errors.Wrapf(err, "parse source attribution of %q", object)
+		}
+		entries := make([]string, 0, len(attrs))
+		for entry := range attrs {
+			entries = append(entries, entry)
+		}
+		sort.Strings(entries)
+		for _, entry := range entries {
+			if filter != "" && !strings.Contains(entry, filter) {
+				continue
+			}
+			ref := attrs[entry]
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", object, entry, ref.Kind, ref.Namespace, ref.Name, ref.Generation)
+			found = true
+		}
+		return nil
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps(*operatorNamespace).Get(ctx, operator.NameCollector, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "get collector ConfigMap")
+	} else if err == nil {
+		if err := printAttribution("configmap/"+operator.NameCollector, cm.Annotations[operator.AnnotationSourceAttribution]); err != nil {
+			return err
+		}
+	}
+	rcm, err := clientset.CoreV1().ConfigMaps(*operatorNamespace).Get(ctx, operator.NameRulesGenerated, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "get generated rules ConfigMap")
+	} else if err == nil {
+		if err := printAttribution("configmap/"+operator.NameRulesGenerated, rcm.Annotations[operator.AnnotationSourceAttribution]); err != nil {
+			return err
+		}
+	}
+	secret, err := clientset.CoreV1().Secrets(*operatorNamespace).Get(ctx, operator.CollectionSecretName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "get collection Secret")
+	} else if err == nil {
+		if err := printAttribution("secret/"+operator.CollectionSecretName, secret.Annotations[operator.AnnotationSourceAttribution]); err != nil {
+			return err
+		}
+	}
+	if !found && filter != "" {
+		return errors.Errorf("no generated config entry matching %q found", filter)
+	}
+	return nil
+}
+
+func validateCmd(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	projectID := fs.String("project-id", "example-project", "Project ID substituted into generated configuration.")
+	location := fs.String("location", "example-location", "Location substituted into generated configuration.")
+	cluster := fs.String("cluster", "example-cluster", "Cluster name substituted into generated configuration.")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("no manifest files given")
+	}
+	// Run the files through the operator's config generation against a discarded
+	// writer. Any error is a validation failure the admission webhooks or the
+	// reconcilers would surface in the cluster.
+	err := operator.GenerateFromFiles(ioutil.Discard, operator.Options{
+		ProjectID: *projectID,
+		Location:  *location,
+		Cluster:   *cluster,
+	}, fs.Args()...)
+	if err != nil {
+		return err
+	}
+	fmt.Println("All manifests are valid.")
+	return nil
+}
+
+func rbacCmd(args []string) error {
+	fs := flag.NewFlagSet("rbac", flag.ExitOnError)
+	operatorNamespace := fs.String("operator-namespace", operator.DefaultOperatorNamespace,
+		"Namespace in which the operator manages its resources.")
+	publicNamespace := fs.String("public-namespace", operator.DefaultPublicNamespace,
+		"Namespace in which the operator reads user-specified configuration.")
+	featureGates := fs.String("feature-gates", "",
+		"Comma-separated list of key=value pairs of the feature gates the operator runs with.")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("no manifest files given")
+	}
+	gates, err := operator.ParseFeatureGates(*featureGates)
+	if err != nil {
+		return errors.Wrap(err, "parse feature gates")
+	}
+	return operator.GenerateRBACFromFiles(os.Stdout, operator.Options{
+		OperatorNamespace: *operatorNamespace,
+		PublicNamespace:   *publicNamespace,
+		FeatureGates:      gates,
+	}, fs.Args()...)
+}
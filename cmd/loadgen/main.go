@@ -0,0 +1,239 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The loadgen binary serves synthetic metrics with configurable shape. It is
+// used to load test collectors and the export path with realistic series
+// counts, label cardinality, and series churn.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	addr = flag.String("listen-address", ":8080",
+		"The address the first target listens on for HTTP requests. Further targets listen on consecutive ports.")
+	targetCount = flag.Int("targets", 1,
+		"Number of scrape targets to expose. Each target gets its own port and serves an independent set of series.")
+	familyCount = flag.Int("metric-families", 10,
+		"Number of metric families per target. Families alternate between counters and gauges.")
+	seriesCount = flag.Int("series-per-family", 10,
+		"Number of series per metric family, i.e. the label cardinality of each family.")
+	updateInterval = flag.Duration("update-interval", 5*time.Second,
+		"Interval at which all series receive new sample values.")
+	churnInterval = flag.Duration("churn-interval", 0,
+		"Interval at which a fraction of series per family is replaced with new label values. Disabled if zero.")
+	churnRatio = flag.Float64("churn-ratio", 0.1,
+		"Fraction of series per family that is replaced on each churn.")
+)
+
+func main() {
+	flag.Parse()
+
+	if *targetCount < 1 || *familyCount < 1 || *seriesCount < 1 {
+		log.Fatalln("--targets, --metric-families, and --series-per-family must be positive")
+	}
+	host, port, err := net.SplitHostPort(*addr)
+	if err != nil {
+		log.Fatalf("Invalid listen address %q: %s", *addr, err)
+	}
+	basePort, err := net.LookupPort("tcp", port)
+	if err != nil {
+		log.Fatalf("Invalid listen port %q: %s", port, err)
+	}
+
+	var g run.Group
+
+	// Termination handler.
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+
+	g.Add(
+		func() error {
+			<-term
+			log.Println("Received SIGTERM, exiting gracefully...")
+			return nil
+		},
+		func(error) {},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < *targetCount; i++ {
+		tgt := newTarget(*familyCount, *seriesCount)
+		taddr := net.JoinHostPort(host, fmt.Sprint(basePort+i))
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(tgt.registry, promhttp.HandlerOpts{}))
+		if i == 0 {
+			mux.Handle("/debug/pprof/", http.DefaultServeMux)
+		}
+		server := &http.Server{Addr: taddr, Handler: mux}
+
+		g.Add(
+			func() error {
+				log.Printf("Serving target on %s", taddr)
+				return server.ListenAndServe()
+			},
+			func(error) {
+				server.Close()
+			},
+		)
+		g.Add(
+			func() error {
+				return tgt.update(ctx, *updateInterval, *churnInterval, *churnRatio)
+			},
+			func(error) {
+				cancel()
+			},
+		)
+	}
+	if err := g.Run(); err != nil {
+		log.Fatalln("Exit with error:", err)
+	}
+}
+
+// target holds the synthetic metric families exposed through a single
+// registry on a dedicated port.
+type target struct {
+	registry *prometheus.Registry
+	mtx      sync.Mutex
+	families []*family
+}
+
+// family is a single metric family along with the label values of its
+// currently active series.
+type family struct {
+	counter *prometheus.CounterVec
+	gauge   *prometheus.GaugeVec
+	series  []string
+	nextID  int
+}
+
+func newTarget(families, series int) *target {
+	t := &target{registry: prometheus.NewRegistry()}
+
+	for i := 0; i < families; i++ {
+		f := &family{}
+		// Alternate between counters and gauges so both delta and gauge
+		// export paths are exercised.
+		if i%2 == 0 {
+			f.counter = prometheus.NewCounterVec(
+				prometheus.CounterOpts{Name: fmt.Sprintf("loadgen_counter_%03d_total", i)},
+				[]string{"series"},
+			)
+			t.registry.MustRegister(f.counter)
+		} else {
+			f.gauge = prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{Name: fmt.Sprintf("loadgen_gauge_%03d", i)},
+				[]string{"series"},
+			)
+			t.registry.MustRegister(f.gauge)
+		}
+		for j := 0; j < series; j++ {
+			f.addSeries()
+		}
+		t.families = append(t.families, f)
+	}
+	return t
+}
+
+// update periodically writes new sample values to all series and, if enabled,
+// churns a fraction of series per family by replacing their label values.
+func (t *target) update(ctx context.Context, updateEvery, churnEvery time.Duration, churnRatio float64) error {
+	updateTick := time.NewTicker(updateEvery)
+	defer updateTick.Stop()
+
+	var churn <-chan time.Time
+	if churnEvery > 0 {
+		churnTick := time.NewTicker(churnEvery)
+		defer churnTick.Stop()
+		churn = churnTick.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-updateTick.C:
+			t.mtx.Lock()
+			for _, f := range t.families {
+				for _, s := range f.series {
+					if f.counter != nil {
+						f.counter.WithLabelValues(s).Add(rand.Float64() * 10)
+					} else {
+						f.gauge.WithLabelValues(s).Set(rand.NormFloat64() * 100)
+					}
+				}
+			}
+			t.mtx.Unlock()
+		case <-churn:
+			t.mtx.Lock()
+			for _, f := range t.families {
+				n := int(churnRatio * float64(len(f.series)))
+				if n < 1 {
+					n = 1
+				}
+				for i := 0; i < n; i++ {
+					f.dropSeries()
+					f.addSeries()
+				}
+			}
+			t.mtx.Unlock()
+		}
+	}
+}
+
+// addSeries activates a new series with a unique label value.
+func (f *family) addSeries() {
+	s := fmt.Sprintf("series_%06d", f.nextID)
+	f.nextID++
+
+	if f.counter != nil {
+		f.counter.WithLabelValues(s)
+	} else {
+		f.gauge.WithLabelValues(s)
+	}
+	f.series = append(f.series, s)
+}
+
+// dropSeries removes the oldest active series of the family.
+func (f *family) dropSeries() {
+	if len(f.series) == 0 {
+		return
+	}
+	s := f.series[0]
+	f.series = f.series[1:]
+
+	if f.counter != nil {
+		f.counter.DeleteLabelValues(s)
+	} else {
+		f.gauge.DeleteLabelValues(s)
+	}
+}
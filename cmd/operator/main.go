@@ -17,15 +17,19 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"cloud.google.com/go/compute/metadata"
 	"github.com/oklog/run"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	uberzap "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -41,6 +45,15 @@ func unstableFlagHelp(help string) string {
 	return help + " (Setting this flag voids any guarantees of proper behavior of the operator.)"
 }
 
+// splitNonEmpty splits a comma-separated flag value, treating an empty value
+// as an empty list.
+func splitNonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
 func main() {
 	var (
 		defaultProjectID string
@@ -53,7 +66,11 @@ func main() {
 		defaultLocation, _ = metadata.InstanceAttributeValue("cluster-location")
 	}
 	var (
-		logVerbosity      = flag.Int("v", 0, "Logging verbosity")
+		logVerbosity = flag.Int("v", 0, "Logging verbosity")
+		logLevel     = flag.String("log.level", "",
+			"Log level, one of: debug, info, warn, error. Takes precedence over -v when set.")
+		logFormat = flag.String("log.format", "logfmt",
+			"Log format, one of: logfmt, json.")
 		projectID         = flag.String("project-id", defaultProjectID, "Project ID of the cluster. May be left empty on GKE.")
 		location          = flag.String("location", defaultLocation, "Google Cloud region or zone where your data will be stored. May be left empty on GKE.")
 		cluster           = flag.String("cluster", defaultCluster, "Name of the cluster the operator acts on. May be left empty on GKE.")
@@ -74,12 +91,105 @@ func main() {
 		// feature.
 		cleanupAnnotKey = flag.String("cleanup-unless-annotation-key", "",
 			"Clean up operator-managed workloads without the provided annotation key.")
+
+		leaderElection = flag.Bool("leader-election", false,
+			"Enable leader election so the operator can run with multiple replicas where only one acts at a time.")
+
+		certValidity = flag.Duration("webhook-cert-validity", 365*24*time.Hour,
+			"Lifetime of self-signed webhook certificates generated by the operator.")
+		certRotation = flag.Duration("webhook-cert-rotation", 0,
+			"Interval at which generated webhook certificates are rotated. 0 disables rotation.")
+		tlsSecretName = flag.String("webhook-tls-secret", "",
+			"Name of a Secret in the operator namespace providing the webhook serving certificate (keys tls.crt, tls.key, and optionally ca.crt). Changes are picked up without restart. Takes precedence over the base64 TLS flags.")
+
+		allowedNamespaces = flag.String("watch-namespaces", "",
+			"Comma-separated list of namespaces from which PodMonitoring and Rules resources are considered. An empty list means all namespaces.")
+		deniedNamespaces = flag.String("deny-namespaces", "",
+			"Comma-separated list of namespaces from which PodMonitoring and Rules resources are ignored. Takes precedence over --watch-namespaces.")
+
+		crdsDir = flag.String("crds-dir", "",
+			"Directory with CRD manifests that the operator installs and upgrades at startup. An empty value leaves CRD management to out-of-band installation.")
+
+		collectorCanary = flag.Bool("collector-config-canary", false,
+			"Apply new collector configuration to the canary collector DaemonSet first and promote it fleet-wide only after the canaries scrape their targets successfully for the soak duration.")
+		canarySoak = flag.Duration("collector-config-canary-soak", 10*time.Minute,
+			"How long new collector configuration soaks on the canary collectors before fleet-wide promotion.")
+		configReloadInterval = flag.Duration("collector-config-min-interval", 30*time.Second,
+			"Minimum interval between updates of the generated collector configuration. Changes arriving within the interval are coalesced into a single update to debounce collector config reloads.")
+
+		seriesWarnThreshold = flag.Int("pod-monitoring-series-warn-threshold", 100000,
+			"Estimated number of active series above which admission of a PodMonitoring or ClusterPodMonitoring returns a warning. A negative value disables the warning.")
+
+		disableWebhooks = flag.Bool("disable-webhooks", false,
+			"Run without admission webhooks and apply validation and defaulting during reconciliation instead, e.g. for clusters whose control plane cannot reach webhook servers on workload nodes. Validation errors are reported via status conditions and events.")
+
+		prometheusOperatorCompat = flag.Bool("prometheus-operator-compat", false,
+			"Translate prometheus-operator PodMonitor and ServiceMonitor resources into PodMonitorings. Fields without an equivalent are reported in an annotation and an event on the source resource.")
+
+		featureGates = flag.String("feature-gates", "",
+			"Comma-separated list of key=value pairs toggling experimental features, e.g. \"ScrapeHealthMetrics=true\".")
+
+		mode = flag.String("mode", "run",
+			"Mode the operator runs in. \"run\" starts the controllers against the cluster. \"generate\" reads custom resources from the manifest files given as arguments, prints the rendered Prometheus configuration and rule files to stdout, and exits without talking to a cluster.")
 	)
 	flag.Parse()
 
-	logger := zap.New(zap.Level(zapcore.Level(-*logVerbosity)))
+	lvl := zapcore.Level(-*logVerbosity)
+	switch *logLevel {
+	case "":
+	case "debug":
+		lvl = zapcore.DebugLevel
+	case "info":
+		lvl = zapcore.InfoLevel
+	case "warn":
+		lvl = zapcore.WarnLevel
+	case "error":
+		lvl = zapcore.ErrorLevel
+	default:
+		fmt.Fprintf(os.Stderr, "unknown log level %q, expected one of: debug, info, warn, error\n", *logLevel)
+		os.Exit(2)
+	}
+	encCfg := uberzap.NewProductionEncoderConfig()
+	encCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+	var enc zapcore.Encoder
+	switch *logFormat {
+	case "", "logfmt":
+		enc = zapcore.NewConsoleEncoder(encCfg)
+	case "json":
+		enc = zapcore.NewJSONEncoder(encCfg)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown log format %q, expected one of: logfmt, json\n", *logFormat)
+		os.Exit(2)
+	}
+	logger := zap.New(zap.Level(lvl), zap.Encoder(enc))
 	ctrl.SetLogger(logger)
 
+	gates, err := operator.ParseFeatureGates(*featureGates)
+	if err != nil {
+		logger.Error(err, "invalid --feature-gates flag")
+		os.Exit(1)
+	}
+
+	if *mode == "generate" {
+		err := operator.GenerateFromFiles(os.Stdout, operator.Options{
+			ProjectID:         *projectID,
+			Location:          *location,
+			Cluster:           *cluster,
+			OperatorNamespace: *operatorNamespace,
+			PublicNamespace:   *publicNamespace,
+			AllowedNamespaces: splitNonEmpty(*allowedNamespaces),
+			DeniedNamespaces:  splitNonEmpty(*deniedNamespaces),
+		}, flag.Args()...)
+		if err != nil {
+			logger.Error(err, "generating configuration failed")
+			os.Exit(1)
+		}
+		return
+	} else if *mode != "run" {
+		logger.Error(errors.Errorf("unknown mode %q", *mode), "invalid flags")
+		os.Exit(1)
+	}
+
 	cfg, err := ctrl.GetConfig()
 	if err != nil {
 		logger.Error(err, "loading kubeconfig failed")
@@ -103,6 +213,21 @@ func main() {
 		CACert:            *caCert,
 		ListenAddr:        *webhookAddr,
 		CleanupAnnotKey:   *cleanupAnnotKey,
+		LeaderElection:    *leaderElection,
+		CertValidity:      *certValidity,
+		CertRotation:      *certRotation,
+		TLSSecretName:     *tlsSecretName,
+		AllowedNamespaces: splitNonEmpty(*allowedNamespaces),
+		DeniedNamespaces:  splitNonEmpty(*deniedNamespaces),
+		CRDsDir:           *crdsDir,
+
+		PrometheusOperatorCompat: *prometheusOperatorCompat,
+		DisableWebhooks:          *disableWebhooks,
+		CollectorCanary:          *collectorCanary,
+		CanarySoakDuration:       *canarySoak,
+		ConfigReloadInterval:     *configReloadInterval,
+		SeriesWarnThreshold:      *seriesWarnThreshold,
+		FeatureGates:             gates,
 	})
 	if err != nil {
 		logger.Error(err, "instantiating operator failed")
@@ -130,10 +255,19 @@ func main() {
 			},
 		)
 	}
-	// Operator monitoring.
+	// Operator monitoring and status API.
 	{
+		statusAPI, err := op.StatusAPIHandler()
+		if err != nil {
+			logger.Error(err, "instantiating status API failed")
+			os.Exit(1)
+		}
 		server := &http.Server{Addr: *metricsAddr}
 		http.Handle("/metrics", promhttp.HandlerFor(metrics, promhttp.HandlerOpts{Registry: metrics}))
+		http.Handle("/api/status/", statusAPI)
+		// HTTP service discovery for externally discovered scrape targets,
+		// refetched periodically by the collectors.
+		http.Handle("/discovery/", statusAPI)
 		g.Add(func() error {
 			return server.ListenAndServe()
 		}, func(err error) {
@@ -0,0 +1,234 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/util/strutil"
+
+	collectormetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+)
+
+// sample is a single converted data point ready for appending.
+type sample struct {
+	lset labels.Labels
+	t    int64
+	v    float64
+}
+
+// otlpBatch holds the converted samples of one OTLP export request along with
+// the metric metadata gathered during conversion.
+type otlpBatch struct {
+	samples []sample
+	types   map[string]textparse.MetricType
+}
+
+// metadata is a export.MetadataFunc serving the types recorded for the batch.
+func (b *otlpBatch) metadata(metric string) (export.MetricMetadata, bool) {
+	t, ok := b.types[metric]
+	if !ok {
+		return export.MetricMetadata{}, false
+	}
+	return export.MetricMetadata{Metric: metric, Type: t}, true
+}
+
+// convertOTLP converts the metrics of an OTLP export request into Prometheus-style
+// samples. Gauges, cumulative sums, cumulative explicit-bucket histograms, and
+// summaries are supported. Data points of other kinds or temporalities are
+// dropped and accounted for in the given counter.
+//
+// The well-known OpenTelemetry resource attributes identifying the sending
+// workload are mapped onto the job, instance, and namespace target labels so
+// pushed data gets the same resource attribution in GCM as scraped data.
+func convertOTLP(req *collectormetricspb.ExportMetricsServiceRequest, dropped *prometheus.CounterVec) *otlpBatch {
+	b := &otlpBatch{types: map[string]textparse.MetricType{}}
+
+	for _, rm := range req.ResourceMetrics {
+		var resLabels labels.Labels
+		if rm.Resource != nil {
+			resLabels = resourceLabels(rm.Resource.Attributes)
+		}
+		for _, ilm := range rm.InstrumentationLibraryMetrics {
+			for _, m := range ilm.Metrics {
+				name := strutil.SanitizeLabelName(m.Name)
+
+				switch data := m.Data.(type) {
+				case *metricspb.Metric_Gauge:
+					b.types[name] = textparse.MetricTypeGauge
+					for _, dp := range data.Gauge.DataPoints {
+						b.appendNumber(name, resLabels, dp)
+					}
+				case *metricspb.Metric_Sum:
+					if data.Sum.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+						dropped.WithLabelValues("non_cumulative_sum").Add(float64(len(data.Sum.DataPoints)))
+						continue
+					}
+					if data.Sum.IsMonotonic {
+						b.types[name] = textparse.MetricTypeCounter
+					} else {
+						b.types[name] = textparse.MetricTypeGauge
+					}
+					for _, dp := range data.Sum.DataPoints {
+						b.appendNumber(name, resLabels, dp)
+					}
+				case *metricspb.Metric_Histogram:
+					if data.Histogram.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+						dropped.WithLabelValues("non_cumulative_histogram").Add(float64(len(data.Histogram.DataPoints)))
+						continue
+					}
+					b.types[name] = textparse.MetricTypeHistogram
+					for _, dp := range data.Histogram.DataPoints {
+						b.appendHistogram(name, resLabels, dp)
+					}
+				case *metricspb.Metric_Summary:
+					b.types[name] = textparse.MetricTypeSummary
+					for _, dp := range data.Summary.DataPoints {
+						b.appendSummary(name, resLabels, dp)
+					}
+				default:
+					dropped.WithLabelValues("unsupported_type").Inc()
+				}
+			}
+		}
+	}
+	return b
+}
+
+func (b *otlpBatch) appendNumber(name string, resLabels labels.Labels, dp *metricspb.NumberDataPoint) {
+	var v float64
+	switch value := dp.Value.(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		v = value.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		v = float64(value.AsInt)
+	}
+	b.samples = append(b.samples, sample{
+		lset: pointLabels(name, resLabels, dp.Attributes),
+		t:    int64(dp.TimeUnixNano / 1e6),
+		v:    v,
+	})
+}
+
+// appendHistogram converts an explicit-bucket histogram data point into the
+// conventional _bucket, _sum, and _count series. OTLP carries per-bucket
+// counts while Prometheus buckets are cumulative, so counts are summed up
+// across buckets, with the implicit +Inf bucket holding the total count.
+func (b *otlpBatch) appendHistogram(name string, resLabels labels.Labels, dp *metricspb.HistogramDataPoint) {
+	t := int64(dp.TimeUnixNano / 1e6)
+	lset := pointLabels(name, resLabels, dp.Attributes)
+
+	var cum uint64
+	for i, bound := range dp.ExplicitBounds {
+		if i < len(dp.BucketCounts) {
+			cum += dp.BucketCounts[i]
+		}
+		lb := labels.NewBuilder(lset)
+		lb.Set(labels.MetricName, name+"_bucket")
+		lb.Set("le", strconv.FormatFloat(bound, 'f', -1, 64))
+		b.samples = append(b.samples, sample{lset: lb.Labels(), t: t, v: float64(cum)})
+	}
+	lb := labels.NewBuilder(lset)
+	lb.Set(labels.MetricName, name+"_bucket")
+	lb.Set("le", "+Inf")
+	b.samples = append(b.samples, sample{lset: lb.Labels(), t: t, v: float64(dp.Count)})
+
+	lb = labels.NewBuilder(lset)
+	lb.Set(labels.MetricName, name+"_sum")
+	b.samples = append(b.samples, sample{lset: lb.Labels(), t: t, v: dp.Sum})
+
+	lb = labels.NewBuilder(lset)
+	lb.Set(labels.MetricName, name+"_count")
+	b.samples = append(b.samples, sample{lset: lb.Labels(), t: t, v: float64(dp.Count)})
+}
+
+func (b *otlpBatch) appendSummary(name string, resLabels labels.Labels, dp *metricspb.SummaryDataPoint) {
+	t := int64(dp.TimeUnixNano / 1e6)
+	lset := pointLabels(name, resLabels, dp.Attributes)
+
+	for _, q := range dp.QuantileValues {
+		lb := labels.NewBuilder(lset)
+		lb.Set("quantile", strconv.FormatFloat(q.Quantile, 'f', -1, 64))
+		b.samples = append(b.samples, sample{lset: lb.Labels(), t: t, v: q.Value})
+	}
+	lb := labels.NewBuilder(lset)
+	lb.Set(labels.MetricName, name+"_sum")
+	b.samples = append(b.samples, sample{lset: lb.Labels(), t: t, v: dp.Sum})
+
+	lb = labels.NewBuilder(lset)
+	lb.Set(labels.MetricName, name+"_count")
+	b.samples = append(b.samples, sample{lset: lb.Labels(), t: t, v: float64(dp.Count)})
+}
+
+// pointLabels combines metric name, resource labels, and data point attributes
+// into the label set of the resulting series.
+func pointLabels(name string, resLabels labels.Labels, attrs []*commonpb.KeyValue) labels.Labels {
+	lb := labels.NewBuilder(resLabels)
+	lb.Set(labels.MetricName, name)
+	for _, kv := range attrs {
+		lb.Set(strutil.SanitizeLabelName(kv.Key), attrValue(kv.Value))
+	}
+	return lb.Labels()
+}
+
+// resourceLabels maps the well-known OpenTelemetry resource attributes onto
+// the Prometheus target labels the exporter attributes resources by.
+func resourceLabels(attrs []*commonpb.KeyValue) labels.Labels {
+	var serviceName, serviceNamespace string
+	lb := labels.NewBuilder(nil)
+	for _, kv := range attrs {
+		switch kv.Key {
+		case "service.name":
+			serviceName = attrValue(kv.Value)
+		case "service.namespace":
+			serviceNamespace = attrValue(kv.Value)
+		case "service.instance.id":
+			lb.Set("instance", attrValue(kv.Value))
+		case "k8s.namespace.name":
+			lb.Set("namespace", attrValue(kv.Value))
+		}
+	}
+	job := serviceName
+	if serviceNamespace != "" {
+		job = serviceNamespace + "/" + serviceName
+	}
+	if job != "" {
+		lb.Set("job", job)
+	}
+	return lb.Labels()
+}
+
+func attrValue(v *commonpb.AnyValue) string {
+	switch value := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return value.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(value.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(value.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(value.DoubleValue, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/textparse"
+
+	collectormetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+func TestConvertOTLPHistogram(t *testing.T) {
+	req := &collectormetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			InstrumentationLibraryMetrics: []*metricspb.InstrumentationLibraryMetrics{{
+				Metrics: []*metricspb.Metric{{
+					Name: "request_duration_seconds",
+					Data: &metricspb.Metric_Histogram{
+						Histogram: &metricspb.Histogram{
+							AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+							DataPoints: []*metricspb.HistogramDataPoint{{
+								TimeUnixNano:   1e9,
+								Count:          6,
+								Sum:            4.2,
+								ExplicitBounds: []float64{0.1, 0.5},
+								BucketCounts:   []uint64{1, 2, 3},
+							}},
+						},
+					},
+				}},
+			}},
+		}},
+	}
+	dropped := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "dropped"}, []string{"reason"})
+	b := convertOTLP(req, dropped)
+
+	// Three buckets (cumulative counts 1, 3, 6), sum, and count.
+	want := map[string]float64{
+		`{__name__="request_duration_seconds_bucket", le="0.1"}`:  1,
+		`{__name__="request_duration_seconds_bucket", le="0.5"}`:  3,
+		`{__name__="request_duration_seconds_bucket", le="+Inf"}`: 6,
+		`{__name__="request_duration_seconds_sum"}`:               4.2,
+		`{__name__="request_duration_seconds_count"}`:             6,
+	}
+	if len(b.samples) != len(want) {
+		t.Fatalf("expected %d samples, got %v", len(want), b.samples)
+	}
+	for _, s := range b.samples {
+		v, ok := want[s.lset.String()]
+		if !ok {
+			t.Errorf("unexpected series %s", s.lset)
+			continue
+		}
+		if s.v != v {
+			t.Errorf("expected value %v for %s, got %v", v, s.lset, s.v)
+		}
+		if s.t != 1000 {
+			t.Errorf("expected timestamp 1000 for %s, got %d", s.lset, s.t)
+		}
+	}
+	if md, ok := b.metadata("request_duration_seconds"); !ok || md.Type != textparse.MetricTypeHistogram {
+		t.Errorf("expected histogram metadata, got %v (%v)", md, ok)
+	}
+
+	// A delta histogram must be dropped entirely.
+	req.ResourceMetrics[0].InstrumentationLibraryMetrics[0].Metrics[0].GetHistogram().AggregationTemporality = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	if b := convertOTLP(req, dropped); len(b.samples) != 0 {
+		t.Errorf("expected no samples for delta histogram, got %v", b.samples)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The otlp-receiver accepts pushed OTLP metrics over HTTP and exports them to
+// Google Cloud Monitoring through the same export path as scraped data, so
+// push-based OpenTelemetry applications and pull-based scraping share one
+// pipeline and resource attribution.
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/prometheus/config"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	collectormetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	exportsetup "github.com/GoogleCloudPlatform/prometheus-engine/pkg/export/setup"
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/logging"
+)
+
+func main() {
+	a := kingpin.New("otlp-receiver", "OTLP metrics receiver for Google Cloud Prometheus Engine")
+
+	a.HelpFlag.Short('h')
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	newExporter := exportsetup.FromFlags(a, fmt.Sprintf("otlp-receiver/%s", export.Version))
+
+	listenAddress := a.Flag("web.listen-address", "The address to listen on for HTTP requests.").
+		Default(":9110").String()
+
+	logLevel := a.Flag("log.level", logging.LevelFlagHelp).
+		Default("info").String()
+
+	logFormat := a.Flag("log.format", logging.FormatFlagHelp).
+		Default("logfmt").String()
+
+	extraArgs, err := exportsetup.ExtraArgs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error parsing commandline arguments:", err)
+		a.Usage(os.Args[1:])
+		os.Exit(2)
+	}
+	if _, err := a.Parse(append(os.Args[1:], extraArgs...)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error parsing commandline arguments:", err)
+		a.Usage(os.Args[1:])
+		os.Exit(2)
+	}
+
+	logger, err := logging.NewLogger(*logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid logging flags:", err)
+		os.Exit(2)
+	}
+
+	exporter, err := newExporter(logger, reg)
+	if err != nil {
+		level.Error(logger).Log("msg", "Creating a Cloud Monitoring Exporter failed", "err", err)
+		os.Exit(1)
+	}
+	destination := export.NewStorage(exporter)
+	// The exporter takes its target fields from the flags and GCE metadata.
+	// Apply an empty default config so it is ready to export.
+	if err := destination.ApplyConfig(&config.DefaultConfig); err != nil {
+		level.Error(logger).Log("msg", "Applying default config failed", "err", err)
+		os.Exit(1)
+	}
+
+	handler := newOTLPHandler(logger, destination, reg)
+
+	var g run.Group
+	// Termination handler.
+	{
+		term := make(chan os.Signal, 1)
+		cancel := make(chan struct{})
+		signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+
+		g.Add(
+			func() error {
+				select {
+				case <-term:
+					level.Info(logger).Log("msg", "received SIGTERM, exiting gracefully...")
+				case <-cancel:
+				}
+				return nil
+			},
+			func(err error) {
+				close(cancel)
+			},
+		)
+	}
+	// Exporter.
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return destination.Run(ctx)
+		}, func(err error) {
+			cancel()
+		})
+	}
+	// Web server.
+	{
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+		// Path of the OTLP/HTTP metrics service as defined by the protocol.
+		mux.Handle("/v1/metrics", handler)
+
+		server := &http.Server{Addr: *listenAddress, Handler: mux}
+
+		g.Add(func() error {
+			level.Info(logger).Log("msg", "Starting web server", "listen", *listenAddress)
+			return server.ListenAndServe()
+		}, func(err error) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			server.Shutdown(ctx)
+			cancel()
+		})
+	}
+	if err := g.Run(); err != nil {
+		level.Error(logger).Log("msg", "running otlp-receiver failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func newOTLPHandler(logger log.Logger, destination *export.Storage, reg prometheus.Registerer) http.Handler {
+	samplesIngested := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "otlp_receiver_samples_ingested_total",
+		Help: "Number of OTLP data points converted and handed to the exporter.",
+	})
+	samplesDropped := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "otlp_receiver_samples_dropped_total",
+		Help: "Number of OTLP data points dropped during conversion.",
+	}, []string{"reason"})
+	reg.MustRegister(samplesIngested, samplesDropped)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var body io.Reader = req.Body
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			gr, err := gzip.NewReader(body)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("decompressing request failed: %s", err), http.StatusBadRequest)
+				return
+			}
+			defer gr.Close()
+			body = gr
+		}
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("reading request failed: %s", err), http.StatusBadRequest)
+			return
+		}
+		var exportReq collectormetricspb.ExportMetricsServiceRequest
+		if err := proto.Unmarshal(b, &exportReq); err != nil {
+			http.Error(w, fmt.Sprintf("decoding OTLP request failed: %s", err), http.StatusBadRequest)
+			return
+		}
+		batch := convertOTLP(&exportReq, samplesDropped)
+		app := destination.AppenderWithMetadata(batch.metadata)
+		for _, s := range batch.samples {
+			if _, err := app.Append(0, s.lset, s.t, s.v); err != nil {
+				level.Warn(logger).Log("msg", "appending sample failed", "err", err)
+			}
+		}
+		if err := app.Commit(); err != nil {
+			http.Error(w, fmt.Sprintf("committing samples failed: %s", err), http.StatusInternalServerError)
+			return
+		}
+		samplesIngested.Add(float64(len(batch.samples)))
+		// An empty ExportMetricsServiceResponse signals full success.
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		resp, _ := proto.Marshal(&collectormetricspb.ExportMetricsServiceResponse{})
+		w.Write(resp)
+	})
+}
@@ -0,0 +1,292 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+)
+
+const cleanupInterval = time.Minute
+
+// gateway accepts pushes of metric groups, exports them, and tracks the groups
+// for TTL-based cleanup.
+type gateway struct {
+	logger      log.Logger
+	destination *export.Storage
+	ttl         time.Duration
+
+	mtx    sync.Mutex
+	groups map[string]*metricGroup
+
+	groupsTracked  prometheus.Gauge
+	pushesAccepted prometheus.Counter
+	pushesRejected *prometheus.CounterVec
+}
+
+type metricGroup struct {
+	labels   labels.Labels
+	lastPush time.Time
+}
+
+func newGateway(logger log.Logger, destination *export.Storage, ttl time.Duration, reg prometheus.Registerer) *gateway {
+	g := &gateway{
+		logger:      logger,
+		destination: destination,
+		ttl:         ttl,
+		groups:      map[string]*metricGroup{},
+		groupsTracked: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "push_gateway_groups",
+			Help: "Number of metric groups currently tracked.",
+		}),
+		pushesAccepted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "push_gateway_pushes_accepted_total",
+			Help: "Number of pushes accepted and exported.",
+		}),
+		pushesRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "push_gateway_pushes_rejected_total",
+			Help: "Number of pushes rejected before export.",
+		}, []string{"reason"}),
+	}
+	reg.MustRegister(g.groupsTracked, g.pushesAccepted, g.pushesRejected)
+	return g
+}
+
+// runCleanup periodically drops groups that received no push within the TTL.
+func (g *gateway) runCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.mtx.Lock()
+			for key, grp := range g.groups {
+				if time.Since(grp.lastPush) > g.ttl {
+					level.Info(g.logger).Log("msg", "cleaning up expired metric group", "group", key)
+					delete(g.groups, key)
+				}
+			}
+			g.groupsTracked.Set(float64(len(g.groups)))
+			g.mtx.Unlock()
+		}
+	}
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	groupLabels, err := parseGroupingKey(req.URL.Path)
+	if err != nil {
+		g.pushesRejected.WithLabelValues("invalid_grouping_key").Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := groupLabels.String()
+
+	switch req.Method {
+	case http.MethodPut, http.MethodPost:
+	case http.MethodDelete:
+		g.mtx.Lock()
+		delete(g.groups, key)
+		g.groupsTracked.Set(float64(len(g.groups)))
+		g.mtx.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+		return
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(req.Body)
+	if err != nil {
+		g.pushesRejected.WithLabelValues("parse_error").Inc()
+		http.Error(w, fmt.Sprintf("parsing pushed metrics failed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	ts := now.UnixNano() / 1e6
+
+	types := map[string]textparse.MetricType{}
+	var samples []exportSample
+	for name, mf := range families {
+		types[name] = familyType(mf)
+		samples = append(samples, convertFamily(mf, groupLabels, ts)...)
+	}
+	// Record the push time alongside the metrics, mirroring the pushgateway's
+	// push_time_seconds convention.
+	types["push_time_seconds"] = textparse.MetricTypeGauge
+	lb := labels.NewBuilder(groupLabels)
+	lb.Set(labels.MetricName, "push_time_seconds")
+	samples = append(samples, exportSample{lset: lb.Labels(), t: ts, v: float64(now.Unix())})
+
+	app := g.destination.AppenderWithMetadata(func(metric string) (export.MetricMetadata, bool) {
+		t, ok := types[metric]
+		if !ok {
+			return export.MetricMetadata{}, false
+		}
+		return export.MetricMetadata{Metric: metric, Type: t}, true
+	})
+	for _, s := range samples {
+		if _, err := app.Append(0, s.lset, s.t, s.v); err != nil {
+			level.Warn(g.logger).Log("msg", "appending sample failed", "err", err)
+		}
+	}
+	if err := app.Commit(); err != nil {
+		http.Error(w, fmt.Sprintf("committing samples failed: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	g.mtx.Lock()
+	g.groups[key] = &metricGroup{labels: groupLabels, lastPush: now}
+	g.groupsTracked.Set(float64(len(g.groups)))
+	g.mtx.Unlock()
+
+	g.pushesAccepted.Inc()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Labels that pushers must not set through the grouping key as they are
+// reserved for resource attribution by the exporter.
+var reservedGroupingLabels = map[string]bool{
+	"project_id": true,
+	"location":   true,
+	"cluster":    true,
+}
+
+// parseGroupingKey parses the grouping key from a pushgateway-style URL path
+// /metrics/job/<job>{/<label>/<value>} and validates its hygiene: the job
+// label is mandatory, label names must be valid, and labels reserved for
+// resource attribution cannot be set.
+func parseGroupingKey(path string) (labels.Labels, error) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/metrics"), "/"), "/")
+	if len(parts) < 2 || parts[0] != "job" || parts[1] == "" {
+		return nil, fmt.Errorf("grouping key must start with a non-empty job label")
+	}
+	if len(parts)%2 != 0 {
+		return nil, fmt.Errorf("grouping key has a label %q without a value", parts[len(parts)-1])
+	}
+	lb := labels.NewBuilder(nil)
+	for i := 0; i < len(parts); i += 2 {
+		name, value := parts[i], parts[i+1]
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("invalid grouping label name %q", name)
+		}
+		if reservedGroupingLabels[name] {
+			return nil, fmt.Errorf("grouping label %q is reserved for resource attribution", name)
+		}
+		lb.Set(name, value)
+	}
+	return lb.Labels(), nil
+}
+
+// exportSample is a single converted sample ready for appending.
+type exportSample struct {
+	lset labels.Labels
+	t    int64
+	v    float64
+}
+
+func familyType(mf *dto.MetricFamily) textparse.MetricType {
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		return textparse.MetricTypeCounter
+	case dto.MetricType_GAUGE:
+		return textparse.MetricTypeGauge
+	case dto.MetricType_SUMMARY:
+		return textparse.MetricTypeSummary
+	case dto.MetricType_HISTOGRAM:
+		return textparse.MetricTypeHistogram
+	default:
+		return textparse.MetricTypeUnknown
+	}
+}
+
+// convertFamily converts a parsed metric family into samples. The grouping key
+// labels override any identically named labels of the pushed metrics.
+func convertFamily(mf *dto.MetricFamily, groupLabels labels.Labels, ts int64) []exportSample {
+	var samples []exportSample
+	name := mf.GetName()
+
+	for _, m := range mf.Metric {
+		base := labels.NewBuilder(nil)
+		base.Set(labels.MetricName, name)
+		for _, lp := range m.Label {
+			base.Set(lp.GetName(), lp.GetValue())
+		}
+		for _, l := range groupLabels {
+			base.Set(l.Name, l.Value)
+		}
+		lset := base.Labels()
+
+		add := func(suffix string, extra []labels.Label, v float64) {
+			lb := labels.NewBuilder(lset)
+			lb.Set(labels.MetricName, name+suffix)
+			for _, l := range extra {
+				lb.Set(l.Name, l.Value)
+			}
+			samples = append(samples, exportSample{lset: lb.Labels(), t: ts, v: v})
+		}
+
+		switch {
+		case m.Counter != nil:
+			add("", nil, m.Counter.GetValue())
+		case m.Gauge != nil:
+			add("", nil, m.Gauge.GetValue())
+		case m.Untyped != nil:
+			add("", nil, m.Untyped.GetValue())
+		case m.Summary != nil:
+			for _, q := range m.Summary.Quantile {
+				add("", []labels.Label{{Name: "quantile", Value: formatFloat(q.GetQuantile())}}, q.GetValue())
+			}
+			add("_sum", nil, m.Summary.GetSampleSum())
+			add("_count", nil, float64(m.Summary.GetSampleCount()))
+		case m.Histogram != nil:
+			for _, b := range m.Histogram.Bucket {
+				add("_bucket", []labels.Label{{Name: "le", Value: formatFloat(b.GetUpperBound())}}, float64(b.GetCumulativeCount()))
+			}
+			add("_bucket", []labels.Label{{Name: "le", Value: "+Inf"}}, float64(m.Histogram.GetSampleCount()))
+			add("_sum", nil, m.Histogram.GetSampleSum())
+			add("_count", nil, float64(m.Histogram.GetSampleCount()))
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return labels.Compare(samples[i].lset, samples[j].lset) < 0
+	})
+	return samples
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
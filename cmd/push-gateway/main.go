@@ -0,0 +1,163 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The push-gateway accepts pushgateway-style pushes of final metrics from
+// ephemeral workloads such as Kubernetes Jobs and CronJobs and exports them to
+// Google Cloud Monitoring through the same export path as scraped data. Unlike
+// the upstream pushgateway, pushed samples are exported immediately rather
+// than held for scraping, which avoids scrape race conditions for short-lived
+// workloads. Metric groups that receive no further pushes are cleaned up after
+// a TTL.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/prometheus/config"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	exportsetup "github.com/GoogleCloudPlatform/prometheus-engine/pkg/export/setup"
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/logging"
+)
+
+func main() {
+	a := kingpin.New("push-gateway", "Push acceptor for ephemeral workloads on Google Cloud Prometheus Engine")
+
+	a.HelpFlag.Short('h')
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	newExporter := exportsetup.FromFlags(a, fmt.Sprintf("push-gateway/%s", export.Version))
+
+	listenAddress := a.Flag("web.listen-address", "The address to listen on for HTTP requests.").
+		Default(":9112").String()
+
+	ttl := a.Flag("push.ttl", "TTL after which a metric group that received no further pushes is cleaned up.").
+		Default("30m").Duration()
+
+	logLevel := a.Flag("log.level", logging.LevelFlagHelp).
+		Default("info").String()
+
+	logFormat := a.Flag("log.format", logging.FormatFlagHelp).
+		Default("logfmt").String()
+
+	extraArgs, err := exportsetup.ExtraArgs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error parsing commandline arguments:", err)
+		a.Usage(os.Args[1:])
+		os.Exit(2)
+	}
+	if _, err := a.Parse(append(os.Args[1:], extraArgs...)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error parsing commandline arguments:", err)
+		a.Usage(os.Args[1:])
+		os.Exit(2)
+	}
+
+	logger, err := logging.NewLogger(*logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid logging flags:", err)
+		os.Exit(2)
+	}
+
+	exporter, err := newExporter(logger, reg)
+	if err != nil {
+		level.Error(logger).Log("msg", "Creating a Cloud Monitoring Exporter failed", "err", err)
+		os.Exit(1)
+	}
+	destination := export.NewStorage(exporter)
+	if err := destination.ApplyConfig(&config.DefaultConfig); err != nil {
+		level.Error(logger).Log("msg", "Applying default config failed", "err", err)
+		os.Exit(1)
+	}
+
+	gateway := newGateway(logger, destination, *ttl, reg)
+
+	var g run.Group
+	// Termination handler.
+	{
+		term := make(chan os.Signal, 1)
+		cancel := make(chan struct{})
+		signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+
+		g.Add(
+			func() error {
+				select {
+				case <-term:
+					level.Info(logger).Log("msg", "received SIGTERM, exiting gracefully...")
+				case <-cancel:
+				}
+				return nil
+			},
+			func(err error) {
+				close(cancel)
+			},
+		)
+	}
+	// Exporter.
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return destination.Run(ctx)
+		}, func(err error) {
+			cancel()
+		})
+	}
+	// Group cleanup loop.
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			gateway.runCleanup(ctx)
+			return nil
+		}, func(err error) {
+			cancel()
+		})
+	}
+	// Web server.
+	{
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+		// Pushgateway-compatible path layout /metrics/job/<job>{/<label>/<value>}.
+		mux.Handle("/metrics/", gateway)
+
+		server := &http.Server{Addr: *listenAddress, Handler: mux}
+
+		g.Add(func() error {
+			level.Info(logger).Log("msg", "Starting web server", "listen", *listenAddress)
+			return server.ListenAndServe()
+		}, func(err error) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			server.Shutdown(ctx)
+			cancel()
+		})
+	}
+	if err := g.Run(); err != nil {
+		level.Error(logger).Log("msg", "running push-gateway failed", "err", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// haTracker elects one replica per sending cluster. The first replica seen for
+// a cluster is elected and its pushes accepted; pushes of other replicas are
+// rejected until the elected replica has not pushed for the failover timeout.
+type haTracker struct {
+	failoverTimeout time.Duration
+
+	mtx      sync.Mutex
+	clusters map[string]*haElection
+}
+
+type haElection struct {
+	replica  string
+	lastSeen time.Time
+}
+
+func newHATracker(failoverTimeout time.Duration) *haTracker {
+	return &haTracker{
+		failoverTimeout: failoverTimeout,
+		clusters:        map[string]*haElection{},
+	}
+}
+
+// accept reports whether a push of the given replica for the given cluster
+// should be accepted.
+func (t *haTracker) accept(cluster, replica string) bool {
+	now := time.Now()
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	e, ok := t.clusters[cluster]
+	if !ok || now.Sub(e.lastSeen) > t.failoverTimeout {
+		t.clusters[cluster] = &haElection{replica: replica, lastSeen: now}
+		return true
+	}
+	if e.replica != replica {
+		return false
+	}
+	e.lastSeen = now
+	return true
+}
@@ -0,0 +1,302 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The remote-write-receiver accepts Prometheus remote_write pushes, e.g. from
+// short-lived jobs or out-of-cluster Prometheus servers, and exports the
+// samples to Google Cloud Monitoring through the same export path as scraped
+// data. Pushes from highly-available Prometheus pairs are deduplicated and
+// series are required to carry the target labels GCM attributes resources by.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/prompb"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	exportsetup "github.com/GoogleCloudPlatform/prometheus-engine/pkg/export/setup"
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/logging"
+)
+
+func main() {
+	a := kingpin.New("remote-write-receiver", "Prometheus remote-write receiver for Google Cloud Prometheus Engine")
+
+	a.HelpFlag.Short('h')
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	newExporter := exportsetup.FromFlags(a, fmt.Sprintf("remote-write-receiver/%s", export.Version))
+
+	listenAddress := a.Flag("web.listen-address", "The address to listen on for HTTP requests.").
+		Default(":9111").String()
+
+	bearerTokenFile := a.Flag("web.auth.bearer-token-file", "File containing the bearer token incoming requests must present in the Authorization header. An empty value disables authentication.").
+		Default("").String()
+
+	replicaLabels := a.Flag("write.replica-label", "Label identifying the replica of a highly-available Prometheus setup. Stripped from incoming series and used to deduplicate pushes from HA pairs. May be repeated.").
+		Default("prometheus_replica", "__replica__").Strings()
+
+	haFailoverTimeout := a.Flag("write.ha-failover-timeout", "How long after the last push of the elected HA replica pushes of another replica take over.").
+		Default("30s").Duration()
+
+	logLevel := a.Flag("log.level", logging.LevelFlagHelp).
+		Default("info").String()
+
+	logFormat := a.Flag("log.format", logging.FormatFlagHelp).
+		Default("logfmt").String()
+
+	extraArgs, err := exportsetup.ExtraArgs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error parsing commandline arguments:", err)
+		a.Usage(os.Args[1:])
+		os.Exit(2)
+	}
+	if _, err := a.Parse(append(os.Args[1:], extraArgs...)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error parsing commandline arguments:", err)
+		a.Usage(os.Args[1:])
+		os.Exit(2)
+	}
+
+	logger, err := logging.NewLogger(*logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid logging flags:", err)
+		os.Exit(2)
+	}
+
+	exporter, err := newExporter(logger, reg)
+	if err != nil {
+		level.Error(logger).Log("msg", "Creating a Cloud Monitoring Exporter failed", "err", err)
+		os.Exit(1)
+	}
+	destination := export.NewStorage(exporter)
+	if err := destination.ApplyConfig(&config.DefaultConfig); err != nil {
+		level.Error(logger).Log("msg", "Applying default config failed", "err", err)
+		os.Exit(1)
+	}
+
+	handler := &writeHandler{
+		logger:          logger,
+		destination:     destination,
+		bearerTokenFile: *bearerTokenFile,
+		replicaLabels:   *replicaLabels,
+		ha:              newHATracker(*haFailoverTimeout),
+		samplesIngested: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "remote_write_receiver_samples_ingested_total",
+			Help: "Number of pushed samples handed to the exporter.",
+		}),
+		samplesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "remote_write_receiver_samples_dropped_total",
+			Help: "Number of pushed samples dropped before export.",
+		}, []string{"reason"}),
+	}
+	reg.MustRegister(handler.samplesIngested, handler.samplesDropped)
+
+	var g run.Group
+	// Termination handler.
+	{
+		term := make(chan os.Signal, 1)
+		cancel := make(chan struct{})
+		signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+
+		g.Add(
+			func() error {
+				select {
+				case <-term:
+					level.Info(logger).Log("msg", "received SIGTERM, exiting gracefully...")
+				case <-cancel:
+				}
+				return nil
+			},
+			func(err error) {
+				close(cancel)
+			},
+		)
+	}
+	// Exporter.
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return destination.Run(ctx)
+		}, func(err error) {
+			cancel()
+		})
+	}
+	// Web server.
+	{
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+		mux.Handle("/api/v1/write", handler)
+
+		server := &http.Server{Addr: *listenAddress, Handler: mux}
+
+		g.Add(func() error {
+			level.Info(logger).Log("msg", "Starting web server", "listen", *listenAddress)
+			return server.ListenAndServe()
+		}, func(err error) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			server.Shutdown(ctx)
+			cancel()
+		})
+	}
+	if err := g.Run(); err != nil {
+		level.Error(logger).Log("msg", "running remote-write-receiver failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+type writeHandler struct {
+	logger          log.Logger
+	destination     *export.Storage
+	bearerTokenFile string
+	replicaLabels   []string
+	ha              *haTracker
+
+	samplesIngested prometheus.Counter
+	samplesDropped  *prometheus.CounterVec
+}
+
+func (h *writeHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.bearerTokenFile != "" {
+		token, err := ioutil.ReadFile(h.bearerTokenFile)
+		if err != nil {
+			http.Error(w, "reading bearer token failed", http.StatusInternalServerError)
+			return
+		}
+		if req.Header.Get("Authorization") != "Bearer "+strings.TrimSpace(string(token)) {
+			http.Error(w, "invalid or missing bearer token", http.StatusUnauthorized)
+			return
+		}
+	}
+	compressed, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading request failed: %s", err), http.StatusBadRequest)
+		return
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("decompressing request failed: %s", err), http.StatusBadRequest)
+		return
+	}
+	var wreq prompb.WriteRequest
+	if err := wreq.Unmarshal(b); err != nil {
+		http.Error(w, fmt.Sprintf("decoding write request failed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	types := map[string]textparse.MetricType{}
+	for _, md := range wreq.Metadata {
+		types[md.MetricFamilyName] = metadataType(md.Type)
+	}
+	metadata := func(metric string) (export.MetricMetadata, bool) {
+		t, ok := types[metric]
+		if !ok {
+			return export.MetricMetadata{}, false
+		}
+		return export.MetricMetadata{Metric: metric, Type: t}, true
+	}
+
+	app := h.destination.AppenderWithMetadata(metadata)
+	for _, ts := range wreq.Timeseries {
+		lset, replica := h.splitReplica(ts.Labels)
+
+		// Deduplicate pushes from HA pairs: samples are only accepted from the
+		// currently elected replica of the sending cluster.
+		if replica != "" && !h.ha.accept(lset.Get("cluster"), replica) {
+			h.samplesDropped.WithLabelValues("ha_duplicate").Add(float64(len(ts.Samples)))
+			continue
+		}
+		// The exporter attributes series to monitored resources through the
+		// job and instance target labels. Enforce their presence rather than
+		// silently exporting samples that would collide between senders.
+		if lset.Get("job") == "" || lset.Get("instance") == "" {
+			h.samplesDropped.WithLabelValues("missing_target_labels").Add(float64(len(ts.Samples)))
+			continue
+		}
+		for _, s := range ts.Samples {
+			if _, err := app.Append(0, lset, s.Timestamp, s.Value); err != nil {
+				level.Warn(h.logger).Log("msg", "appending sample failed", "err", err)
+			}
+			h.samplesIngested.Inc()
+		}
+	}
+	if err := app.Commit(); err != nil {
+		http.Error(w, fmt.Sprintf("committing samples failed: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// splitReplica converts the label pairs into a label set with any replica
+// label removed, returning the replica value separately.
+func (h *writeHandler) splitReplica(pairs []prompb.Label) (labels.Labels, string) {
+	var replica string
+	lb := labels.NewBuilder(nil)
+	for _, l := range pairs {
+		isReplica := false
+		for _, rl := range h.replicaLabels {
+			if l.Name == rl {
+				replica = l.Value
+				isReplica = true
+				break
+			}
+		}
+		if !isReplica {
+			lb.Set(l.Name, l.Value)
+		}
+	}
+	return lb.Labels(), replica
+}
+
+func metadataType(t prompb.MetricMetadata_MetricType) textparse.MetricType {
+	switch t {
+	case prompb.MetricMetadata_COUNTER:
+		return textparse.MetricTypeCounter
+	case prompb.MetricMetadata_GAUGE:
+		return textparse.MetricTypeGauge
+	case prompb.MetricMetadata_HISTOGRAM:
+		return textparse.MetricTypeHistogram
+	case prompb.MetricMetadata_GAUGEHISTOGRAM:
+		return textparse.MetricTypeGaugeHistogram
+	case prompb.MetricMetadata_SUMMARY:
+		return textparse.MetricTypeSummary
+	default:
+		return textparse.MetricTypeUnknown
+	}
+}
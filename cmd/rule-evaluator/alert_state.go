@@ -0,0 +1,188 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// alertStateSnapshotInterval is the interval at which active alert state is
+// written to the state file. It bounds how much pending time an alert can
+// lose across a restart and should stay well below typical 'for' durations.
+const alertStateSnapshotInterval = 15 * time.Second
+
+// alertStateSeries is the persisted state of one active alert, mirroring the
+// ALERTS_FOR_STATE series Prometheus writes to its local TSDB for the same
+// purpose.
+type alertStateSeries struct {
+	Labels map[string]string `json:"labels"`
+	// ActiveAt is the time at which the alert started being active in Unix
+	// seconds, i.e. the value of the ALERTS_FOR_STATE series.
+	ActiveAt int64 `json:"activeAt"`
+	// Timestamp is the time at which the alert was last seen active in Unix
+	// milliseconds.
+	Timestamp int64 `json:"timestamp"`
+}
+
+// alertStateStore persists the state of active alerts to a local file and
+// serves the last persisted state as the ALERTS_FOR_STATE series through
+// which the rule managers restore the 'for' state of alerts on startup.
+// Without it, restarts reset all pending alerts and delay notifications by
+// their full 'for' duration.
+type alertStateStore struct {
+	logger log.Logger
+	path   string
+	// The state loaded on startup. It is only read by the rule managers during
+	// their initial restore and not updated by later snapshots.
+	series []alertStateSeries
+}
+
+// newAlertStateStore returns a store persisting alert state to the file at
+// the given path. A missing or unreadable file is logged and treated as empty
+// so a fresh deployment starts cleanly.
+func newAlertStateStore(logger log.Logger, path string) *alertStateStore {
+	s := &alertStateStore{logger: logger, path: path}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s
+	} else if err != nil {
+		level.Error(logger).Log("msg", "Reading alert state file failed", "file", path, "err", err)
+		return s
+	}
+	if err := json.Unmarshal(b, &s.series); err != nil {
+		level.Error(logger).Log("msg", "Corrupt alert state file, starting with empty state", "file", path, "err", err)
+		s.series = nil
+	}
+	return s
+}
+
+// Querier returns a querier over the alert state loaded on startup.
+func (s *alertStateStore) Querier(_ context.Context, mint, maxt int64) (storage.Querier, error) {
+	return &alertStateQuerier{series: s.series, mint: mint, maxt: maxt}, nil
+}
+
+// run persists the active alerts of the given rule managers until the context
+// is canceled, with a final snapshot on shutdown.
+func (s *alertStateStore) run(ctx context.Context, managers ...*rules.Manager) error {
+	ticker := time.NewTicker(alertStateSnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.snapshot(managers...); err != nil {
+				level.Error(s.logger).Log("msg", "Writing final alert state snapshot failed", "err", err)
+			}
+			return nil
+		case <-ticker.C:
+			if err := s.snapshot(managers...); err != nil {
+				level.Error(s.logger).Log("msg", "Writing alert state snapshot failed", "err", err)
+			}
+		}
+	}
+}
+
+// snapshot writes the current state of all active alerts of the given rule
+// managers to the state file.
+func (s *alertStateStore) snapshot(managers ...*rules.Manager) error {
+	var series []alertStateSeries
+	now := timestamp.FromTime(time.Now())
+
+	for _, m := range managers {
+		for _, g := range m.RuleGroups() {
+			for _, r := range g.Rules() {
+				ar, ok := r.(*rules.AlertingRule)
+				if !ok {
+					continue
+				}
+				ar.ForEachActiveAlert(func(a *rules.Alert) {
+					if a.State != rules.StatePending && a.State != rules.StateFiring {
+						return
+					}
+					// Construct the same labels as the ALERTS_FOR_STATE sample
+					// the rule emits, which the restore queries match against.
+					lb := labels.NewBuilder(a.Labels)
+					lb.Set(labels.MetricName, "ALERTS_FOR_STATE")
+					lb.Set(labels.AlertName, ar.Name())
+
+					series = append(series, alertStateSeries{
+						Labels:    lb.Labels().Map(),
+						ActiveAt:  a.ActiveAt.Unix(),
+						Timestamp: now,
+					})
+				})
+			}
+		}
+	}
+	b, err := json.Marshal(series)
+	if err != nil {
+		return errors.Wrap(err, "marshal alert state")
+	}
+	// Write through a rename so a crash mid-write cannot corrupt the last
+	// good state.
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.Wrap(err, "write alert state file")
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// alertStateQuerier serves persisted alert state as series.
+type alertStateQuerier struct {
+	// storage.LabelQuerier satisfies the interface. Calling related methods will result in panic.
+	storage.LabelQuerier
+	series     []alertStateSeries
+	mint, maxt int64
+}
+
+// Select returns the persisted series matching the given label matchers whose
+// last observation falls into the queried time range. The range check ensures
+// state older than the configured outage tolerance is not restored.
+func (q *alertStateQuerier) Select(_ bool, _ *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	var m promql.Matrix
+Outer:
+	for _, s := range q.series {
+		if s.Timestamp < q.mint || s.Timestamp > q.maxt {
+			continue
+		}
+		for _, matcher := range matchers {
+			if !matcher.Matches(s.Labels[matcher.Name]) {
+				continue Outer
+			}
+		}
+		m = append(m, promql.Series{
+			Metric: labels.FromMap(s.Labels),
+			Points: []promql.Point{{T: s.Timestamp, V: float64(s.ActiveAt)}},
+		})
+	}
+	return newListSeriesSet(m, nil, nil)
+}
+
+func (q *alertStateQuerier) Close() error {
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+)
+
+const (
+	// The interval at which heartbeat samples are exported and the measured
+	// ingestion delay is refreshed.
+	heartbeatInterval = 30 * time.Second
+	// Metric name of the heartbeat series. The sample value is the wall-clock
+	// time at which the sample was handed to the exporter, so the delay can
+	// be computed from the queried value alone.
+	heartbeatMetric = "rule_evaluator_heartbeat_timestamp_seconds"
+)
+
+// ingestionDelayTracker measures how long samples written to Cloud Monitoring
+// take to become readable through the query API. It periodically exports a
+// heartbeat series carrying its emission time as value and queries it back.
+// The measured delay is applied as an offset to the evaluation timestamp of
+// rule queries, so alerts do not flap on data that has not landed yet.
+type ingestionDelayTracker struct {
+	logger      log.Logger
+	destination storage.Appendable
+	query       rules.QueryFunc
+	// The heartbeat series is scoped by instance so concurrent
+	// rule-evaluators in the same metrics scope do not interfere.
+	instance  string
+	maxOffset time.Duration
+
+	mtx   sync.Mutex
+	delay time.Duration
+
+	delayMetric prometheus.Gauge
+}
+
+func newIngestionDelayTracker(logger log.Logger, reg prometheus.Registerer, destination storage.Appendable, query rules.QueryFunc, instance string, maxOffset time.Duration) *ingestionDelayTracker {
+	t := &ingestionDelayTracker{
+		logger:      logger,
+		destination: destination,
+		query:       query,
+		instance:    instance,
+		maxOffset:   maxOffset,
+		delayMetric: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "rule_evaluator_ingestion_delay_seconds",
+			Help: "Measured delay until exported samples become readable through the query API.",
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(t.delayMetric)
+	}
+	return t
+}
+
+// offset returns the evaluation offset to apply to rule queries, i.e. the
+// last measured ingestion delay bounded by the configured maximum.
+func (t *ingestionDelayTracker) offset() time.Duration {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.delay > t.maxOffset {
+		return t.maxOffset
+	}
+	return t.delay
+}
+
+// wrap returns a QueryFunc that evaluates queries at the timestamp shifted
+// back by the current offset. The shift only applies to the query; recorded
+// samples and alerts keep the original evaluation timestamp.
+func (t *ingestionDelayTracker) wrap(qf rules.QueryFunc) rules.QueryFunc {
+	return func(ctx context.Context, q string, ts time.Time) (promql.Vector, error) {
+		return qf(ctx, q, ts.Add(-t.offset()))
+	}
+}
+
+// run exports heartbeat samples and refreshes the measured delay until the
+// context is cancelled.
+func (t *ingestionDelayTracker) run(ctx context.Context) {
+	tick := time.NewTicker(heartbeatInterval)
+	defer tick.Stop()
+
+	for {
+		if err := t.emit(ctx); err != nil {
+			level.Warn(t.logger).Log("msg", "exporting heartbeat sample failed", "err", err)
+		}
+		if err := t.measure(ctx); err != nil {
+			level.Warn(t.logger).Log("msg", "measuring ingestion delay failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (t *ingestionDelayTracker) emit(ctx context.Context) error {
+	now := time.Now()
+	app := t.destination.Appender(ctx)
+	lset := labels.FromStrings(
+		labels.MetricName, heartbeatMetric,
+		"job", "rule-evaluator",
+		"instance", t.instance,
+	)
+	if _, err := app.Append(0, lset, now.UnixMilli(), float64(now.UnixMilli())/1000); err != nil {
+		return err
+	}
+	return app.Commit()
+}
+
+func (t *ingestionDelayTracker) measure(ctx context.Context) error {
+	now := time.Now()
+	q := fmt.Sprintf("max(%s{instance=%q})", heartbeatMetric, t.instance)
+
+	vec, err := t.query(ctx, q, now)
+	if err != nil {
+		return err
+	}
+	if len(vec) == 0 {
+		// No heartbeat landed yet, e.g. right after startup. Keep the last
+		// measured delay rather than jumping to an extreme in either
+		// direction.
+		return nil
+	}
+	// The value is the emission time of the newest readable heartbeat, so the
+	// delay is bounded by its age. The measurement overestimates by up to one
+	// heartbeat interval of quantization, which errs on the safe side.
+	delay := now.Sub(time.UnixMilli(int64(vec[0].V * 1000)))
+	if delay < 0 {
+		delay = 0
+	}
+	t.mtx.Lock()
+	t.delay = delay
+	t.mtx.Unlock()
+
+	t.delayMetric.Set(delay.Seconds())
+	return nil
+}
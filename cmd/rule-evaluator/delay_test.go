@@ -0,0 +1,75 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/promql"
+)
+
+func TestIngestionDelayTracker(t *testing.T) {
+	// Report a heartbeat that landed 90 seconds ago.
+	query := func(ctx context.Context, q string, ts time.Time) (promql.Vector, error) {
+		return promql.Vector{
+			{Point: promql.Point{V: float64(ts.Add(-90*time.Second).UnixMilli()) / 1000}},
+		}, nil
+	}
+	tracker := newIngestionDelayTracker(log.NewNopLogger(), nil, nil, query, "test-instance", 2*time.Minute)
+
+	if got := tracker.offset(); got != 0 {
+		t.Fatalf("expected zero offset before first measurement, got %v", got)
+	}
+	if err := tracker.measure(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := tracker.offset(); got < 89*time.Second || got > 91*time.Second {
+		t.Fatalf("expected offset of about 90s, got %v", got)
+	}
+	// The offset must be bounded by the configured maximum.
+	tracker.maxOffset = time.Minute
+	if got := tracker.offset(); got != time.Minute {
+		t.Fatalf("expected offset clamped to 1m, got %v", got)
+	}
+
+	// The wrapped query function must shift the evaluation timestamp back by
+	// the offset.
+	now := time.Now()
+	var gotTS time.Time
+	qf := tracker.wrap(func(ctx context.Context, q string, ts time.Time) (promql.Vector, error) {
+		gotTS = ts
+		return nil, nil
+	})
+	if _, err := qf(context.Background(), "up", now); err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(-time.Minute); !gotTS.Equal(want) {
+		t.Fatalf("expected query timestamp %v, got %v", want, gotTS)
+	}
+
+	// An empty query result keeps the previous measurement.
+	tracker.query = func(ctx context.Context, q string, ts time.Time) (promql.Vector, error) {
+		return nil, nil
+	}
+	if err := tracker.measure(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := tracker.offset(); got != time.Minute {
+		t.Fatalf("expected offset to remain 1m, got %v", got)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/prometheus/promql"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// localCollectorRefreshInterval bounds how often the set of collector pods
+// is re-discovered from the Kubernetes API.
+const localCollectorRefreshInterval = 30 * time.Second
+
+// localCollectorQuerier evaluates queries against the local storage of all
+// running collector pods and merges the per-pod results. It backs rule groups
+// marked as local, whose data has not been exported to Cloud Monitoring and
+// thus only exists distributed across the collectors.
+type localCollectorQuerier struct {
+	logger    log.Logger
+	namespace string
+	selector  string
+	port      int
+
+	mtx         sync.Mutex
+	client      kubernetes.Interface
+	apis        []v1.API
+	lastRefresh time.Time
+}
+
+func newLocalCollectorQuerier(logger log.Logger, namespace, selector string, port int) *localCollectorQuerier {
+	return &localCollectorQuerier{
+		logger:    logger,
+		namespace: namespace,
+		selector:  selector,
+		port:      port,
+	}
+}
+
+// refresh returns query clients for all running collector pods, re-listing
+// them from the Kubernetes API at most every localCollectorRefreshInterval.
+func (q *localCollectorQuerier) refresh(ctx context.Context) ([]v1.API, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if time.Since(q.lastRefresh) < localCollectorRefreshInterval {
+		return q.apis, nil
+	}
+	// The Kubernetes client is only initialized on first use so that local
+	// rule groups merely fail to evaluate rather than crashing the whole
+	// rule-evaluator when it runs outside of a cluster.
+	if q.client == nil {
+		cfg, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "local rule evaluation requires in-cluster Kubernetes credentials")
+		}
+		client, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "build Kubernetes clientset")
+		}
+		q.client = client
+	}
+	pods, err := q.client.CoreV1().Pods(q.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: q.selector,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list collector pods")
+	}
+	var apis []v1.API
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		client, err := api.NewClient(api.Config{
+			Address: fmt.Sprintf("http://%s:%d", pod.Status.PodIP, q.port),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "create query client for collector pod %q", pod.Name)
+		}
+		apis = append(apis, v1.NewAPI(client))
+	}
+	q.apis = apis
+	q.lastRefresh = time.Now()
+
+	return apis, nil
+}
+
+// queryFunc implements rules.QueryFunc by fanning the query out to all
+// collector pods and concatenating the result vectors. Since each series is
+// scraped by exactly one collector, the partial results are disjoint unless
+// a query aggregates away per-target labels. That cannot be computed
+// correctly across independent collectors, so duplicate output series are
+// reported as an error rather than silently deduplicated.
+func (q *localCollectorQuerier) queryFunc(ctx context.Context, qs string, t time.Time) (promql.Vector, error) {
+	apis, err := q.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		result promql.Vector
+		seen   = map[string]struct{}{}
+	)
+	for _, a := range apis {
+		v, warnings, err := QueryFunc(ctx, qs, t, a)
+		if len(warnings) > 0 {
+			level.Warn(q.logger).Log("msg", "Querying collector returned warnings", "warn", warnings)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "execute query against collector")
+		}
+		vec, ok := v.(promql.Vector)
+		if !ok {
+			return nil, errors.Errorf("Error querying collector, Expected type vector response. Actual type %v", v.Type())
+		}
+		for _, s := range vec {
+			key := s.Metric.String()
+			if _, ok := seen[key]; ok {
+				return nil, errors.Errorf("series %s returned by multiple collectors, local rules must preserve per-target labels such as instance", s.Metric)
+			}
+			seen[key] = struct{}{}
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
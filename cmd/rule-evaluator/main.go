@@ -16,7 +16,9 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
@@ -29,6 +31,8 @@ import (
 	"cloud.google.com/go/compute/metadata"
 	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
 	exportsetup "github.com/GoogleCloudPlatform/prometheus-engine/pkg/export/setup"
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/logging"
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
@@ -100,15 +104,48 @@ func main() {
 	queryCredentialsFile := a.Flag("query.credentials-file", "Credentials file for OAuth2 authentication with --query.target-url.").
 		Default("").String()
 
+	localCollectorNamespace := a.Flag("query.local.collector-namespace", "Namespace in which collector pods are discovered for evaluating local rule groups.").
+		Default("gmp-system").String()
+
+	localCollectorSelector := a.Flag("query.local.collector-selector", "Label selector of the collector pods to which queries of local rule groups are fanned out.").
+		Default("app.kubernetes.io/name=collector").String()
+
+	localCollectorPort := a.Flag("query.local.collector-port", "Port on which collector pods serve the Prometheus query API.").
+		Default("19090").Int()
+
 	listenAddress := a.Flag("web.listen-address", "The address to listen on for HTTP requests.").
 		Default(":9091").String()
 
+	webConfigFile := a.Flag("web.config", "Path to a web configuration file enabling TLS and basic authentication on the web endpoints.").
+		Default("").String()
+
 	configFile := a.Flag("config.file", "Prometheus configuration file path.").
 		Default("prometheus.yml").String()
 
 	a.Flag("alertmanager.notification-queue-capacity", "The capacity of the queue for pending Alertmanager notifications.").
 		Default("10000").IntVar(&notifierOptions.QueueCapacity)
 
+	alertStateFile := a.Flag("rules.alert.state-file", "File to persist active alert state to so that restarts do not reset pending alerts and delay notifications by their full 'for' duration. Empty disables persistence.").
+		Default("").String()
+
+	outageTolerance := a.Flag("rules.alert.for-outage-tolerance", "Max time to tolerate rule-evaluator outage for restoring 'for' state of alert.").
+		Default("1h").Duration()
+
+	forGracePeriod := a.Flag("rules.alert.for-grace-period", "Minimum duration between alert and restored 'for' state. This is maintained only for alerts with configured 'for' time greater than grace period.").
+		Default("10m").Duration()
+
+	maxEvalOffset := a.Flag("rules.max-evaluation-offset", "Upper bound for the dynamic evaluation offset derived from the measured Cloud Monitoring ingestion delay. Rule queries are shifted back by the measured delay up to this bound so they do not evaluate against data that has not landed yet. 0 disables delay measurement and offsetting.").
+		Default("3m").Duration()
+
+	customMetricsFile := a.Flag("export.custom-metrics-file", "JSON file containing a list of metric names that are exported under the custom metric type prefix instead of the default prefix. Empty disables custom export.").
+		Default("").String()
+
+	logLevel := a.Flag("log.level", logging.LevelFlagHelp).
+		Default("info").String()
+
+	logFormat := a.Flag("log.format", logging.FormatFlagHelp).
+		Default("logfmt").String()
+
 	extraArgs, err := exportsetup.ExtraArgs()
 	if err != nil {
 		level.Error(logger).Log("msg", "Error parsing commandline arguments", "err", err)
@@ -121,6 +158,13 @@ func main() {
 		os.Exit(2)
 	}
 
+	// Replace the bootstrap logger with one configured via the logging flags.
+	logger, err = logging.NewLogger(*logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid logging flags:", err)
+		os.Exit(2)
+	}
+
 	if *projectID == "" {
 		level.Error(logger).Log("msg", "no --query.project-id was specified or could be derived from the environment")
 		os.Exit(2)
@@ -194,6 +238,29 @@ func main() {
 		}
 		return vec, nil
 	}
+	// Deduplicate repeated and concurrent identical queries within an
+	// evaluation cycle to reduce the number of calls against the GCM API.
+	cachedQueryFunc := newQueryCache(reg).wrap(queryFunc)
+
+	// Shift rule queries back by the measured ingestion delay so they do not
+	// evaluate against data that has not landed in Cloud Monitoring yet. The
+	// offset is applied outside the cache so identical shifted queries still
+	// deduplicate. Local rule groups query the collectors directly and are
+	// not affected by ingestion delay.
+	evalQueryFunc := cachedQueryFunc
+	var delayTracker *ingestionDelayTracker
+	if *maxEvalOffset > 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			level.Error(logger).Log("msg", "Looking up hostname failed", "err", err)
+			os.Exit(1)
+		}
+		delayTracker = newIngestionDelayTracker(
+			log.With(logger, "component", "ingestion delay"),
+			reg, destination, queryFunc, hostname, *maxEvalOffset,
+		)
+		evalQueryFunc = delayTracker.wrap(cachedQueryFunc)
+	}
 
 	discoveryManager := discovery.NewManager(ctxDiscover, log.With(logger, "component", "discovery manager notify"), discovery.Name("notify"))
 	notificationManager := notifier.NewManager(&notifierOptions, log.With(logger, "component", "notifier"))
@@ -202,15 +269,51 @@ func main() {
 		api: v1api,
 	}
 
+	// If enabled, 'for' state of alerts is restored from a local state file
+	// rather than from Cloud Monitoring, which does not reliably serve the
+	// internal ALERTS_FOR_STATE series.
+	var restoreQueryable storage.Queryable = externalStorage
+	var alertState *alertStateStore
+	if *alertStateFile != "" {
+		alertState = newAlertStateStore(log.With(logger, "component", "alert state"), *alertStateFile)
+		restoreQueryable = alertState
+	}
+
+	// The group metrics are shared between both rule managers as they can only
+	// be registered once.
+	groupMetrics := rules.NewGroupMetrics(reg)
+
 	ruleManager := rules.NewManager(&rules.ManagerOptions{
-		ExternalURL: generatorURL,
-		QueryFunc:   queryFunc,
-		Context:     ctxRuleManger,
-		Appendable:  destination,
-		Queryable:   externalStorage,
-		Logger:      logger,
-		NotifyFunc:  sendAlerts(notificationManager, generatorURL.String()),
-		Metrics:     rules.NewGroupMetrics(reg),
+		ExternalURL:     generatorURL,
+		QueryFunc:       evalQueryFunc,
+		Context:         ctxRuleManger,
+		Appendable:      destination,
+		Queryable:       restoreQueryable,
+		Logger:          logger,
+		NotifyFunc:      sendAlerts(notificationManager, generatorURL.String()),
+		Metrics:         groupMetrics,
+		OutageTolerance: *outageTolerance,
+		ForGracePeriod:  *forGracePeriod,
+	})
+
+	// A second rule manager evaluates local rule groups directly against the
+	// in-cluster collectors rather than Cloud Monitoring. The operator writes
+	// such groups into dedicated rule files marked by a filename prefix.
+	localQuerier := newLocalCollectorQuerier(
+		log.With(logger, "component", "local query"),
+		*localCollectorNamespace, *localCollectorSelector, *localCollectorPort,
+	)
+	localRuleManager := rules.NewManager(&rules.ManagerOptions{
+		ExternalURL:     generatorURL,
+		QueryFunc:       localQuerier.queryFunc,
+		Context:         ctxRuleManger,
+		Appendable:      destination,
+		Queryable:       restoreQueryable,
+		Logger:          log.With(logger, "component", "local rules"),
+		NotifyFunc:      sendAlerts(notificationManager, generatorURL.String()),
+		Metrics:         groupMetrics,
+		OutageTolerance: *outageTolerance,
+		ForGracePeriod:  *forGracePeriod,
 	})
 
 	reloaders := []reloader{
@@ -220,6 +323,19 @@ func main() {
 		}, {
 			name:     "exporter",
 			reloader: destination.ApplyConfig,
+		}, {
+			name: "custom_metrics",
+			reloader: func(*config.Config) error {
+				if *customMetricsFile == "" {
+					return nil
+				}
+				names, err := readCustomMetrics(*customMetricsFile)
+				if err != nil {
+					return err
+				}
+				exporter.SetCustomMetrics(names)
+				return nil
+			},
 		}, {
 			name: "notify_sd",
 			reloader: func(cfg *config.Config) error {
@@ -232,21 +348,39 @@ func main() {
 		}, {
 			name: "rules",
 			reloader: func(cfg *config.Config) error {
-				// Get all rule files matching the configuration paths.
-				var files []string
+				// Get all rule files matching the configuration paths. Files
+				// carrying the local prefix hold rule groups that are
+				// evaluated against the collectors instead of Cloud
+				// Monitoring and go to the dedicated rule manager.
+				var files, localFiles []string
 				for _, pat := range cfg.RuleFiles {
 					fs, err := filepath.Glob(pat)
 					if fs == nil || err != nil {
 						return errors.Errorf("Error retrieving rule file: %s", pat)
 					}
-					files = append(files, fs...)
+					for _, f := range fs {
+						if strings.HasPrefix(filepath.Base(f), operator.LocalRuleFilePrefix) {
+							localFiles = append(localFiles, f)
+						} else {
+							files = append(files, f)
+						}
+					}
 				}
-				return ruleManager.Update(
+				if err := ruleManager.Update(
 					time.Duration(cfg.GlobalConfig.EvaluationInterval),
 					files,
 					cfg.GlobalConfig.ExternalLabels,
 					"",
 					nil,
+				); err != nil {
+					return err
+				}
+				return localRuleManager.Update(
+					time.Duration(cfg.GlobalConfig.EvaluationInterval),
+					localFiles,
+					cfg.GlobalConfig.ExternalLabels,
+					"",
+					nil,
 				)
 			},
 		},
@@ -286,6 +420,24 @@ func main() {
 			ruleManager.Stop()
 		})
 	}
+	{
+		// Local rule manager.
+		g.Add(func() error {
+			localRuleManager.Run()
+			return nil
+		}, func(error) {
+			localRuleManager.Stop()
+		})
+	}
+	if alertState != nil {
+		// Alert state persistence.
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return alertState.run(ctx, ruleManager, localRuleManager)
+		}, func(error) {
+			cancel()
+		})
+	}
 	{
 		// Notifier.
 		g.Add(func() error {
@@ -324,13 +476,38 @@ func main() {
 			cancel()
 		})
 	}
+	if delayTracker != nil {
+		// Ingestion delay measurement.
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			delayTracker.run(ctx)
+			return nil
+		}, func(error) {
+			cancel()
+		})
+	}
 	reloadCh := make(chan chan error)
 	{
 		// Web Server.
-		server := &http.Server{Addr: *listenAddress}
+		webCfg, err := loadWebConfig(*webConfigFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "Loading web config failed", "err", err)
+			os.Exit(1)
+		}
+		tlsCfg, err := webCfg.tlsServerConfig()
+		if err != nil {
+			level.Error(logger).Log("msg", "Building TLS config failed", "err", err)
+			os.Exit(1)
+		}
+		mux := http.NewServeMux()
+		server := &http.Server{
+			Addr:      *listenAddress,
+			Handler:   webCfg.authenticate(mux),
+			TLSConfig: tlsCfg,
+		}
 
-		http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
-		http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+		mux.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
 			if r.Method == "POST" {
 				rc := make(chan error)
 				reloadCh <- rc
@@ -341,15 +518,20 @@ func main() {
 				http.Error(w, "Only POST requests allowed.", http.StatusMethodNotAllowed)
 			}
 		})
-		http.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
+		mux.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 		})
-		http.HandleFunc("/-/ready", func(w http.ResponseWriter, r *http.Request) {
+		mux.HandleFunc("/-/ready", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			fmt.Fprintf(w, "rule-evaluator is Ready.\n")
 		})
 		g.Add(func() error {
-			level.Info(logger).Log("msg", "Starting web server", "listen", *listenAddress)
+			level.Info(logger).Log("msg", "Starting web server", "listen", *listenAddress, "tls", webCfg.tlsEnabled())
+			if webCfg.tlsEnabled() {
+				// Certificates are loaded from the configured files per
+				// handshake via the TLS config.
+				return server.ListenAndServeTLS("", "")
+			}
 			return server.ListenAndServe()
 		}, func(err error) {
 			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
@@ -443,6 +625,23 @@ type reloader struct {
 	reloader func(*config.Config) error
 }
 
+// readCustomMetrics reads the list of metric names exported under the custom
+// metric type prefix from the given JSON file. A missing file is treated as
+// an empty list so that disabling custom export resets previous state.
+func readCustomMetrics(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "read custom metrics file")
+	}
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return nil, errors.Wrapf(err, "parse custom metrics file %q", path)
+	}
+	return names, nil
+}
+
 // reloadConfig applies the configuration files.
 func reloadConfig(filename string, logger log.Logger, rls ...reloader) (err error) {
 	start := time.Now()
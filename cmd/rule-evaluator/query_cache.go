@@ -0,0 +1,147 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+)
+
+var (
+	queryCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "rule_evaluator_query_cache_hits_total",
+		Help: "Number of rule queries answered from the evaluation-local query cache.",
+	})
+	queryCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "rule_evaluator_query_cache_misses_total",
+		Help: "Number of rule queries that were executed against the backing storage.",
+	})
+)
+
+// queryCacheMaxAge bounds how long cached query results are retained. Rules
+// only re-evaluate an expression at the same timestamp within a single
+// evaluation cycle, so results are useless well before this age.
+const queryCacheMaxAge = 5 * time.Minute
+
+// queryCacheKey identifies a query result by the literal expression and the
+// evaluation timestamp.
+type queryCacheKey struct {
+	query string
+	ts    int64
+}
+
+type queryCacheEntry struct {
+	// Closed once the result fields are populated. Concurrent lookups for
+	// the same key block on it so that duplicate queries coalesce into a
+	// single backend call.
+	done chan struct{}
+
+	value   promql.Vector
+	err     error
+	created time.Time
+}
+
+// queryCache deduplicates identical queries evaluated at the same timestamp.
+// Large rule sets commonly repeat the same subexpressions across alerting and
+// recording rules of a group, each of which would otherwise issue a separate
+// call against the backing Cloud Monitoring API.
+type queryCache struct {
+	mtx       sync.Mutex
+	entries   map[queryCacheKey]*queryCacheEntry
+	lastPrune time.Time
+}
+
+func newQueryCache(reg prometheus.Registerer) *queryCache {
+	if reg != nil {
+		reg.MustRegister(queryCacheHits, queryCacheMisses)
+	}
+	return &queryCache{
+		entries:   map[queryCacheKey]*queryCacheEntry{},
+		lastPrune: time.Now(),
+	}
+}
+
+// wrap returns a QueryFunc that serves repeated queries for the same
+// expression and timestamp from the cache and coalesces concurrent ones.
+func (c *queryCache) wrap(qf rules.QueryFunc) rules.QueryFunc {
+	return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+		key := queryCacheKey{query: q, ts: t.UnixNano()}
+
+		c.mtx.Lock()
+		if e, ok := c.entries[key]; ok {
+			c.mtx.Unlock()
+			queryCacheHits.Inc()
+
+			select {
+			case <-e.done:
+				return copyVector(e.value), e.err
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		e := &queryCacheEntry{done: make(chan struct{}), created: time.Now()}
+		c.entries[key] = e
+		c.prune()
+		c.mtx.Unlock()
+		queryCacheMisses.Inc()
+
+		e.value, e.err = qf(ctx, q, t)
+		if e.err != nil {
+			// Don't serve errors to future lookups so transient failures
+			// are retried. Callers already waiting share the result.
+			c.mtx.Lock()
+			delete(c.entries, key)
+			c.mtx.Unlock()
+		}
+		close(e.done)
+		return copyVector(e.value), e.err
+	}
+}
+
+// copyVector returns a shallow per-caller copy of a cached result. Rules
+// overwrite sample metrics of the vector they evaluate in place, which must
+// not leak into the cached result other callers receive.
+func copyVector(v promql.Vector) promql.Vector {
+	if v == nil {
+		return nil
+	}
+	return append(promql.Vector(nil), v...)
+}
+
+// prune drops entries beyond the maximum age. Must be called with the mutex
+// held. It only does a full sweep once per interval to keep lookups cheap.
+func (c *queryCache) prune() {
+	now := time.Now()
+	if now.Sub(c.lastPrune) < queryCacheMaxAge {
+		return
+	}
+	c.lastPrune = now
+	for key, e := range c.entries {
+		select {
+		case <-e.done:
+		default:
+			// Keep in-flight entries regardless of age.
+			continue
+		}
+		if now.Sub(e.created) > queryCacheMaxAge {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+)
+
+func TestQueryCacheDeduplicates(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		calls int
+	)
+	qf := newQueryCache(nil).wrap(func(ctx context.Context, q string, ts time.Time) (promql.Vector, error) {
+		mtx.Lock()
+		calls++
+		mtx.Unlock()
+		return promql.Vector{{Point: promql.Point{V: 1}}}, nil
+	})
+	ts := time.Unix(100, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := qf(context.Background(), "up", ts)
+			if err != nil {
+				t.Error(err)
+			}
+			if len(v) != 1 || v[0].V != 1 {
+				t.Errorf("unexpected result %v", v)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected 1 backend call for identical queries, got %d", calls)
+	}
+	// A different timestamp or expression must miss the cache.
+	if _, err := qf(context.Background(), "up", ts.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qf(context.Background(), "down", ts); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected cache misses for different timestamp and query, got %d calls", calls)
+	}
+}
+
+func TestQueryCacheIsolatesCallers(t *testing.T) {
+	// Two recording rules sharing an expression get their results from the
+	// same cache entry. Rule evaluation overwrites the metric of each sample
+	// in place, which must not corrupt the result the other rule sees.
+	qf := newQueryCache(nil).wrap(func(ctx context.Context, q string, ts time.Time) (promql.Vector, error) {
+		return promql.Vector{{
+			Metric: labels.FromStrings(labels.MetricName, "up", "job", "test"),
+			Point:  promql.Point{V: 1},
+		}}, nil
+	})
+	expr, err := parser.ParseExpr("up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Unix(100, 0)
+
+	for _, name := range []string{"first:up", "second:up"} {
+		rule := rules.NewRecordingRule(name, expr, nil)
+		v, err := rule.Eval(context.Background(), ts, qf, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(v) != 1 {
+			t.Fatalf("expected 1 sample for rule %s, got %v", name, v)
+		}
+		if got := v[0].Metric.Get(labels.MetricName); got != name {
+			t.Errorf("expected metric name %q, got %q", name, got)
+		}
+	}
+}
+
+func TestQueryCacheDoesNotCacheErrors(t *testing.T) {
+	var calls int
+	qf := newQueryCache(nil).wrap(func(ctx context.Context, q string, ts time.Time) (promql.Vector, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("transient failure")
+		}
+		return promql.Vector{}, nil
+	})
+	ts := time.Unix(100, 0)
+
+	if _, err := qf(context.Background(), "up", ts); err == nil {
+		t.Fatal("expected error from first query")
+	}
+	// The failed result must not be served from the cache.
+	if _, err := qf(context.Background(), "up", ts); err != nil {
+		t.Fatalf("expected retry to succeed, got %s", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 backend calls, got %d", calls)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// webConfig configures TLS and authentication of the rule-evaluator's web
+// endpoints. It is a subset of the Prometheus web configuration file format
+// so existing Secrets can be reused.
+type webConfig struct {
+	TLSConfig webTLSConfig `yaml:"tls_server_config"`
+	// Usernames mapped to the hex-encoded SHA-256 digest of their password.
+	// Requests must authenticate via basic auth if any user is configured.
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+}
+
+type webTLSConfig struct {
+	// Paths of the serving certificate and key. Both must be set to enable
+	// TLS.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// Path of a CA certificate against which client certificates are
+	// verified if set.
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// loadWebConfig reads and validates the web configuration file at the given
+// path. An empty path yields a config with TLS and authentication disabled.
+func loadWebConfig(path string) (*webConfig, error) {
+	cfg := &webConfig{}
+	if path == "" {
+		return cfg, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read web config file")
+	}
+	if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+		return nil, errors.Wrap(err, "parse web config file")
+	}
+	if (cfg.TLSConfig.CertFile == "") != (cfg.TLSConfig.KeyFile == "") {
+		return nil, errors.New("TLS cert_file and key_file must be set together")
+	}
+	if cfg.TLSConfig.ClientCAFile != "" && cfg.TLSConfig.CertFile == "" {
+		return nil, errors.New("client_ca_file requires cert_file and key_file to be set")
+	}
+	for user, hash := range cfg.BasicAuthUsers {
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+			return nil, errors.Errorf("password for user %q must be a hex-encoded SHA-256 digest", user)
+		}
+	}
+	return cfg, nil
+}
+
+// tlsEnabled reports whether a serving certificate is configured.
+func (cfg *webConfig) tlsEnabled() bool {
+	return cfg.TLSConfig.CertFile != ""
+}
+
+// tlsServerConfig builds the TLS configuration of the web server. It returns
+// nil if TLS is disabled.
+func (cfg *webConfig) tlsServerConfig() (*tls.Config, error) {
+	if !cfg.tlsEnabled() {
+		return nil, nil
+	}
+	// The certificate is loaded on each handshake so rotated Secret mounts
+	// are picked up without a restart.
+	tlsCfg := &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(cfg.TLSConfig.CertFile, cfg.TLSConfig.KeyFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "load TLS key pair")
+			}
+			return &cert, nil
+		},
+	}
+	if cfg.TLSConfig.ClientCAFile != "" {
+		b, err := ioutil.ReadFile(cfg.TLSConfig.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read client CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("no client CA certificates parsed")
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
+
+// authenticate wraps the handler with basic authentication if users are
+// configured and passes requests through unchanged otherwise.
+func (cfg *webConfig) authenticate(next http.Handler) http.Handler {
+	if len(cfg.BasicAuthUsers) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if ok {
+			digest := sha256.Sum256([]byte(pass))
+			want, exists := cfg.BasicAuthUsers[user]
+			// Compare digests of equal length in constant time. The dummy
+			// comparison for unknown users keeps timing independent of user
+			// existence.
+			wantDigest, _ := hex.DecodeString(want)
+			if !exists {
+				wantDigest = make([]byte, sha256.Size)
+			}
+			if subtle.ConstantTimeCompare(digest[:], wantDigest) == 1 && exists {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="rule-evaluator"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
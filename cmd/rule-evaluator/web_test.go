@@ -0,0 +1,102 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadWebConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(content string) string {
+		path := filepath.Join(dir, "web.yaml")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	cfg, err := loadWebConfig("")
+	if err != nil {
+		t.Fatalf("unexpected error for empty path: %s", err)
+	}
+	if cfg.tlsEnabled() || len(cfg.BasicAuthUsers) > 0 {
+		t.Fatalf("expected disabled TLS and auth for empty path")
+	}
+
+	digest := sha256.Sum256([]byte("secret"))
+	cfg, err = loadWebConfig(write("basic_auth_users:\n  admin: " + hex.EncodeToString(digest[:]) + "\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(cfg.BasicAuthUsers) != 1 {
+		t.Fatalf("expected one configured user, got %d", len(cfg.BasicAuthUsers))
+	}
+
+	if _, err := loadWebConfig(write("basic_auth_users:\n  admin: not-a-digest\n")); err == nil {
+		t.Fatalf("expected error for malformed password digest")
+	}
+	if _, err := loadWebConfig(write("tls_server_config:\n  cert_file: /etc/tls/crt\n")); err == nil {
+		t.Fatalf("expected error for cert without key")
+	}
+}
+
+func TestWebConfigAuthenticate(t *testing.T) {
+	digest := sha256.Sum256([]byte("secret"))
+	cfg := &webConfig{
+		BasicAuthUsers: map[string]string{"admin": hex.EncodeToString(digest[:])},
+	}
+	handler := cfg.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		doc        string
+		user, pass string
+		setAuth    bool
+		want       int
+	}{
+		{doc: "no credentials", want: http.StatusUnauthorized},
+		{doc: "wrong password", user: "admin", pass: "wrong", setAuth: true, want: http.StatusUnauthorized},
+		{doc: "unknown user", user: "eve", pass: "secret", setAuth: true, want: http.StatusUnauthorized},
+		{doc: "valid credentials", user: "admin", pass: "secret", setAuth: true, want: http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if c.setAuth {
+				req.SetBasicAuth(c.user, c.pass)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != c.want {
+				t.Fatalf("expected status %d, got %d", c.want, rec.Code)
+			}
+		})
+	}
+}
@@ -35,5 +35,10 @@ do
 done
 kubectl --context kind-kind apply -f ${SCRIPT_ROOT}/manifests/rule-evaluator.yaml
 
+# The test suite serves a fake GCM backend on the kind docker network gateway,
+# which is routable from pods inside the cluster. This lets the full suite,
+# including metric validation, run without a GCP project.
+FAKE_GCM_IP=$(docker network inspect -f '{{(index .IPAM.Config 0).Gateway}}' kind)
+
 echo ">>> executing gmp e2e tests"
-go test -v ${SCRIPT_ROOT}/pkg/operator/e2e -args -project-id=test-proj -cluster=test-cluster -location=test-loc -skip-gcm
+go test -v ${SCRIPT_ROOT}/pkg/operator/e2e -args -project-id=test-proj -cluster=test-cluster -location=test-loc -fake-gcm-addr=${FAKE_GCM_IP}:8086
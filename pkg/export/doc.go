@@ -0,0 +1,34 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package export converts Prometheus samples into Cloud Monitoring time
+// series and sends them to the Google Cloud Monitoring API. It backs the
+// collectors and the rule-evaluator of Managed Service for Prometheus and
+// can be embedded into third-party agents that produce Prometheus data.
+//
+// The exported identifiers of this package form a stable API under semantic
+// versioning of this module. Breaking changes to them only happen in major
+// releases and are called out in the release notes.
+//
+// A typical embedding creates an Exporter with New, provides external labels
+// and filtering through ApplyConfig, injects a label lookup for the series
+// references of its storage with SetLabelsByIDFunc, and then feeds samples
+// to Export while Run handles batching and sending in the background.
+//
+// Behavior can be extended without forking through the extension points in
+// ExporterOpts: Lease bounds exported data to an owned time range for
+// high-availability setups, SampleTransformer adapts or filters converted
+// samples before sending, and MetricTypeMapper overrides the metric type
+// naming scheme.
+package export
@@ -126,9 +126,15 @@ const (
 	// Time after an accumulating batch is flushed to GCM. This avoids data being
 	// held indefinititely if not enough new data flows in to fill up the batch.
 	batchDelayMax = 50 * time.Millisecond
+	// Time for which pending data is still flushed after the exporter has been
+	// asked to shut down. Remaining data is dropped and in-flight requests are
+	// aborted once the timeout expires.
+	drainTimeout = 15 * time.Second
 
 	// Prefix for GCM metric.
 	MetricTypePrefix = "prometheus.googleapis.com"
+	// Prefix under which metrics marked for custom export are written to GCM.
+	CustomMetricTypePrefix = "custom.googleapis.com/prometheus"
 )
 
 // Supported gRPC compression formats.
@@ -174,6 +180,15 @@ type ExporterOpts struct {
 	// If unset, data is always sent.
 	Lease Lease
 
+	// Hooks applied in order to every converted sample before it is enqueued
+	// for sending. If unset, samples are sent unmodified.
+	SampleTransformers []SampleTransformer
+
+	// Custom mapping of Prometheus metric names to GCM metric types that
+	// takes precedence over the default mapping under MetricTypePrefix.
+	// If unset, the default mapping applies to all metrics.
+	MetricTypeMapper MetricTypeMapper
+
 	// Request URL and body for generating an alternative GCE token source.
 	// This allows metrics to be exported to an alternative project.
 	TokenURL  string
@@ -202,6 +217,27 @@ type Lease interface {
 	OnLeaderChange(func())
 }
 
+// SampleTransformer modifies converted time series before the exporter
+// enqueues them for sending. Implementations must be safe for concurrent use.
+type SampleTransformer interface {
+	// TransformSample may modify the given time series and return it, return
+	// a replacement, or return nil to drop the sample. The nested metric and
+	// resource fields are shared across all samples of a series and must be
+	// replaced rather than modified in place.
+	TransformSample(*monitoring_pb.TimeSeries) *monitoring_pb.TimeSeries
+}
+
+// MetricTypeMapper determines the GCM metric type the series of a Prometheus
+// metric are written under. Implementations must be safe for concurrent use
+// and must consistently return the same result for a given name as the
+// mapping is cached per series.
+type MetricTypeMapper interface {
+	// MetricType returns the GCM metric type for the given Prometheus metric
+	// name. Returning an empty string applies the default mapping under the
+	// configured metric type prefix.
+	MetricType(metricName string) string
+}
+
 // alwaysLease is a lease that is always held.
 type alwaysLease struct{}
 
@@ -303,7 +339,7 @@ func New(logger log.Logger, reg prometheus.Registerer, opts ExporterOpts) (*Expo
 		shards:               make([]*shard, shardCount),
 		warnedUntypedMetrics: map[string]struct{}{},
 	}
-	e.seriesCache = newSeriesCache(logger, reg, opts.MetricTypePrefix, opts.Matchers)
+	e.seriesCache = newSeriesCache(logger, reg, opts.MetricTypePrefix, opts.MetricTypeMapper, opts.Matchers)
 
 	// Whenever the lease is lost, clear the series cache so we don't start off of out-of-range
 	// reset timestamps when we gain the lease again.
@@ -369,6 +405,15 @@ func (e *Exporter) ApplyConfig(cfg *config.Config) (err error) {
 	return nil
 }
 
+// SetCustomMetrics sets the metric names that are written under the
+// custom.googleapis.com prefix instead of the default metric type prefix.
+// Cached series conversions of affected metrics are invalidated on change.
+func (e *Exporter) SetCustomMetrics(names []string) {
+	if e.seriesCache.setCustomMetrics(names) {
+		e.seriesCache.forceRefresh()
+	}
+}
+
 // SetLabelsByIDFunc injects a function that can be used to retrieve a label set
 // based on a series ID we got through exported sample records.
 // Must be called before any call to Export is made.
@@ -415,9 +460,19 @@ func (e *Exporter) Export(metadata MetadataFunc, batch []record.RefSample) {
 			continue
 		}
 		for _, s := range samples {
+			proto := s.proto
+			for _, t := range e.opts.SampleTransformers {
+				if proto = t.TransformSample(proto); proto == nil {
+					samplesDropped.WithLabelValues("transformer").Inc()
+					break
+				}
+			}
+			if proto == nil {
+				continue
+			}
 			// Only enqueue samples for within our HA range.
-			if sampleInRange(s.proto, start, end) {
-				e.enqueue(s.hash, s.proto)
+			if sampleInRange(proto, start, end) {
+				e.enqueue(s.hash, proto)
 			} else {
 				samplesDropped.WithLabelValues("not-in-ha-range").Inc()
 			}
@@ -499,6 +554,13 @@ func (e *Exporter) Run(ctx context.Context) error {
 
 	curBatch := newBatch(e.logger, e.opts.BatchSize)
 
+	// Requests are sent with a context detached from the run context so that
+	// terminating the exporter does not abort batches that are already in
+	// flight. Sends are bounded by their own timeout and by the drain timeout
+	// on shutdown instead.
+	sendCtx, cancelSend := context.WithCancel(context.Background())
+	defer cancelSend()
+
 	// Send the currently accumulated batch to GCM asynchronously.
 	send := func() {
 		// Send the batch and once it completed, trigger next to process remaining data in the
@@ -510,7 +572,7 @@ func (e *Exporter) Run(ctx context.Context) error {
 			// We could only trigger if we didn't fully empty shards in this batch.
 			// Benchmarking showed no beneficial impact of this optimization.
 			e.triggerNext()
-		}(ctx, curBatch)
+		}(sendCtx, curBatch)
 
 		// Reset state for new batch.
 		stopTimer()
@@ -521,12 +583,12 @@ func (e *Exporter) Run(ctx context.Context) error {
 
 	for {
 		select {
-		// NOTE(freinartz): we will terminate once context is cancelled and not flush remaining
-		// buffered data. In-flight requests will be aborted as well.
-		// This is fine once we persist data submitted via Export() but for now there may be some
-		// data loss on shutdown.
+		// Once the context is cancelled, flush buffered data and wait for
+		// in-flight requests rather than dropping them. Shutdowns are routinely
+		// triggered by rollouts and configuration reloads and must not lose the
+		// samples accumulated since the last send.
 		case <-ctx.Done():
-			return nil
+			return e.drain(sendCtx, curBatch)
 		// This is activated for each new sample that arrives
 		case <-e.nextc:
 			sendIterations.Inc()
@@ -557,6 +619,56 @@ func (e *Exporter) Run(ctx context.Context) error {
 	}
 }
 
+// drain flushes all data buffered in the shards as well as the given pending
+// batch. It returns once all data was sent or the drain timeout expired, after
+// which remaining data is dropped and in-flight requests are aborted by the
+// caller cancelling the send context.
+func (e *Exporter) drain(sendCtx context.Context, curBatch *batch) error {
+	timeout := time.NewTimer(drainTimeout)
+	defer timeout.Stop()
+
+	// Shards that were pending with an in-flight request when the drain began
+	// become fillable again once their request completes. Poll them at the
+	// regular batch delay until everything is flushed.
+	tick := time.NewTicker(batchDelayMax)
+	defer tick.Stop()
+
+	for {
+		drained := true
+		for _, shard := range e.shards {
+			shard.fill(curBatch)
+			if curBatch.full() {
+				b := curBatch
+				curBatch = newBatch(e.logger, e.opts.BatchSize)
+				go b.send(sendCtx, e.metricClient.CreateTimeSeries)
+			}
+			if !shard.drained() {
+				drained = false
+			}
+		}
+		if !curBatch.empty() {
+			b := curBatch
+			curBatch = newBatch(e.logger, e.opts.BatchSize)
+			go b.send(sendCtx, e.metricClient.CreateTimeSeries)
+			drained = false
+		}
+		if drained {
+			return nil
+		}
+		select {
+		case <-timeout.C:
+			dropped := 0
+			for _, shard := range e.shards {
+				dropped += shard.size()
+			}
+			samplesDropped.WithLabelValues("drain-timeout").Add(float64(dropped))
+			level.Warn(e.logger).Log("msg", "draining pending data on shutdown timed out", "dropped_samples", dropped)
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
 // CtxKey is a dedicated type for keys of context-embedded values propagated
 // with the scrape context.
 type ctxKey int
@@ -324,6 +324,44 @@ func TestExporter_wrapMetadata(t *testing.T) {
 	}
 }
 
+// dropNegativeTransformer drops samples with a negative value.
+type dropNegativeTransformer struct{}
+
+func (dropNegativeTransformer) TransformSample(s *monitoring_pb.TimeSeries) *monitoring_pb.TimeSeries {
+	if s.Points[0].Value.GetDoubleValue() < 0 {
+		return nil
+	}
+	return s
+}
+
+func TestExporter_sampleTransformer(t *testing.T) {
+	e, err := New(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)), nil, ExporterOpts{
+		DisableAuth:        true,
+		SampleTransformers: []SampleTransformer{dropNegativeTransformer{}},
+	})
+	if err != nil {
+		t.Fatalf("Creating Exporter failed: %s", err)
+	}
+	e.SetLabelsByIDFunc(func(i storage.SeriesRef) labels.Labels {
+		return labels.FromStrings("project_id", "test", "location", "test")
+	})
+
+	e.Export(nil, []record.RefSample{
+		{Ref: 1, T: 1000, V: 1},
+		{Ref: 1, T: 2000, V: -1},
+		{Ref: 1, T: 3000, V: 2},
+	})
+
+	// The dropped sample must not have been enqueued into any shard.
+	total := 0
+	for _, shard := range e.shards {
+		total += shard.size()
+	}
+	if want := 2; total != want {
+		t.Fatalf("got %d enqueued samples, want %d", total, want)
+	}
+}
+
 type testMetricService struct {
 	monitoring_pb.MetricServiceServer // Inherit all interface methods
 	samples                           []*monitoring_pb.TimeSeries
@@ -388,3 +426,69 @@ func TestExporter_drainBacklog(t *testing.T) {
 		t.Fatalf("got %d, want %d", got, want)
 	}
 }
+
+func TestExporter_drainOnShutdown(t *testing.T) {
+	var (
+		srv          = grpc.NewServer()
+		listener     = bufconn.Listen(1e6)
+		metricServer = &testMetricService{}
+	)
+	monitoring_pb.RegisterMetricServiceServer(srv, metricServer)
+
+	go srv.Serve(listener)
+	defer srv.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bufDialer := func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}
+	metricClient, err := monitoring.NewMetricClient(context.Background(),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+		option.WithGRPCDialOption(grpc.WithContextDialer(bufDialer)),
+	)
+	if err != nil {
+		t.Fatalf("Creating metric client failed: %s", err)
+	}
+
+	e, err := New(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)), nil, ExporterOpts{DisableAuth: true})
+	if err != nil {
+		t.Fatalf("Creating Exporter failed: %s", err)
+	}
+	e.metricClient = metricClient
+
+	e.SetLabelsByIDFunc(func(i storage.SeriesRef) labels.Labels {
+		return labels.FromStrings("project_id", "test", "location", "test")
+	})
+
+	// Fill a single shard with samples.
+	for i := 0; i < 10; i++ {
+		e.Export(nil, []record.RefSample{
+			{Ref: 1, T: int64(i), V: float64(i)},
+		})
+	}
+
+	runDone := make(chan error)
+	go func() {
+		runDone <- e.Run(ctx)
+	}()
+	// Terminate immediately. The exporter must flush the buffered samples
+	// before returning rather than dropping them.
+	cancel()
+
+	select {
+	case err := <-runDone:
+		if err != nil {
+			t.Fatalf("Run failed: %s", err)
+		}
+	case <-time.After(drainTimeout):
+		t.Fatal("Run did not return within the drain timeout")
+	}
+	// As all samples belong to the same series, they must have been flushed
+	// in separate sequential batches.
+	if got, want := len(metricServer.samples), 10; got != want {
+		t.Fatalf("got %d samples after drain, want %d", got, want)
+	}
+}
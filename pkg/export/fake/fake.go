@@ -0,0 +1,261 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake provides an in-memory implementation of the Cloud Monitoring
+// metric service for hermetic end-to-end tests and local development.
+// Collectors and the rule-evaluator can be pointed at it via their
+// --export.endpoint flag (with authentication disabled).
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	empty_pb "google.golang.org/protobuf/types/known/emptypb"
+
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// maxTimeSeriesPerRequest is the limit Cloud Monitoring enforces on the
+// number of time series in a single CreateTimeSeries request.
+const maxTimeSeriesPerRequest = 200
+
+// MetricServer is an in-memory fake of the Cloud Monitoring metric service.
+// It accepts CreateTimeSeries writes with validation semantics close to those
+// of the real service and serves them back through ListTimeSeries with
+// support for the equality filters used throughout this repository.
+//
+// The zero value is not usable, use NewMetricServer.
+type MetricServer struct {
+	monitoring_pb.UnimplementedMetricServiceServer
+
+	mtx    sync.Mutex
+	series map[string]*monitoring_pb.TimeSeries
+}
+
+// NewMetricServer returns a MetricServer with empty storage.
+func NewMetricServer() *MetricServer {
+	return &MetricServer{
+		series: map[string]*monitoring_pb.TimeSeries{},
+	}
+}
+
+// Serve registers the fake on a new gRPC server and serves it on the given
+// listener until the context is canceled.
+func (s *MetricServer) Serve(ctx context.Context, lis net.Listener) error {
+	srv := grpc.NewServer()
+	monitoring_pb.RegisterMetricServiceServer(srv, s)
+
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+	return srv.Serve(lis)
+}
+
+// CreateTimeSeries writes the given time series to the in-memory storage.
+// Like the real service, series that pass validation are written even if
+// others in the same request are rejected.
+func (s *MetricServer) CreateTimeSeries(ctx context.Context, req *monitoring_pb.CreateTimeSeriesRequest) (*empty_pb.Empty, error) {
+	if len(req.TimeSeries) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "request contains no time series")
+	}
+	if len(req.TimeSeries) > maxTimeSeriesPerRequest {
+		return nil, status.Errorf(codes.InvalidArgument, "request contains %d time series, maximum is %d", len(req.TimeSeries), maxTimeSeriesPerRequest)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var errs []string
+
+	for i, ts := range req.TimeSeries {
+		if len(ts.Points) != 1 {
+			errs = append(errs, fmt.Sprintf("time series %d: must contain exactly one point, got %d", i, len(ts.Points)))
+			continue
+		}
+		key := seriesKey(ts)
+		stored, ok := s.series[key]
+		if !ok {
+			stored = &monitoring_pb.TimeSeries{
+				Metric:     ts.Metric,
+				Resource:   ts.Resource,
+				MetricKind: ts.MetricKind,
+				ValueType:  ts.ValueType,
+			}
+			s.series[key] = stored
+		}
+		point := ts.Points[0]
+		if len(stored.Points) > 0 {
+			last := stored.Points[len(stored.Points)-1].Interval.EndTime.AsTime()
+			if !point.Interval.EndTime.AsTime().After(last) {
+				errs = append(errs, fmt.Sprintf("time series %d: points must be written in order", i))
+				continue
+			}
+		}
+		stored.Points = append(stored.Points, point)
+	}
+	if len(errs) > 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "%d of %d time series could not be written: %s", len(errs), len(req.TimeSeries), strings.Join(errs, "; "))
+	}
+	return &empty_pb.Empty{}, nil
+}
+
+// ListTimeSeries returns all stored series matching the request's filter with
+// their points restricted to the request's interval. Points are returned in
+// descending time order, as the real service does. Pagination is not
+// implemented, all results are returned in a single response.
+func (s *MetricServer) ListTimeSeries(ctx context.Context, req *monitoring_pb.ListTimeSeriesRequest) (*monitoring_pb.ListTimeSeriesResponse, error) {
+	matchers, err := parseFilter(req.Filter)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.Interval == nil || req.Interval.EndTime == nil {
+		return nil, status.Error(codes.InvalidArgument, "interval with end time is required")
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var resp monitoring_pb.ListTimeSeriesResponse
+
+	// Iterate over sorted keys for deterministic result order.
+	keys := make([]string, 0, len(s.series))
+	for key := range s.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		ts := s.series[key]
+		if !seriesMatches(ts, matchers) {
+			continue
+		}
+		result := &monitoring_pb.TimeSeries{
+			Metric:     ts.Metric,
+			Resource:   ts.Resource,
+			MetricKind: ts.MetricKind,
+			ValueType:  ts.ValueType,
+		}
+		for i := len(ts.Points) - 1; i >= 0; i-- {
+			if pointInInterval(ts.Points[i], req.Interval) {
+				result.Points = append(result.Points, ts.Points[i])
+			}
+		}
+		if len(result.Points) > 0 {
+			resp.TimeSeries = append(resp.TimeSeries, result)
+		}
+	}
+	return &resp, nil
+}
+
+// filterMatcher is a single equality clause of a ListTimeSeries filter.
+type filterMatcher struct {
+	path  string
+	value string
+}
+
+// andSeparator splits filter clauses, which may be separated by arbitrary
+// whitespace including newlines.
+var andSeparator = regexp.MustCompile(`\s+AND\s+`)
+
+// parseFilter parses a monitoring filter consisting of equality clauses
+// joined by AND, which covers the filters this repository issues. More
+// complex expressions are rejected.
+func parseFilter(filter string) ([]filterMatcher, error) {
+	var matchers []filterMatcher
+
+	for _, clause := range andSeparator.Split(strings.TrimSpace(filter), -1) {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		parts := strings.SplitN(clause, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid filter clause %q", clause)
+		}
+		value := strings.TrimSpace(parts[1])
+		if !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) || len(value) < 2 {
+			return nil, fmt.Errorf("expected quoted value in filter clause %q", clause)
+		}
+		matchers = append(matchers, filterMatcher{
+			path:  strings.TrimSpace(parts[0]),
+			value: value[1 : len(value)-1],
+		})
+	}
+	return matchers, nil
+}
+
+// seriesMatches checks all filter matchers against the series. The service
+// accepts both "label" and "labels" in field paths, which we reproduce here.
+func seriesMatches(ts *monitoring_pb.TimeSeries, matchers []filterMatcher) bool {
+	for _, m := range matchers {
+		var got string
+
+		switch {
+		case m.path == "metric.type":
+			got = ts.Metric.GetType()
+		case m.path == "resource.type":
+			got = ts.Resource.GetType()
+		case strings.HasPrefix(m.path, "metric.labels.") || strings.HasPrefix(m.path, "metric.label."):
+			got = ts.Metric.GetLabels()[m.path[strings.LastIndex(m.path, ".")+1:]]
+		case strings.HasPrefix(m.path, "resource.labels.") || strings.HasPrefix(m.path, "resource.label."):
+			got = ts.Resource.GetLabels()[m.path[strings.LastIndex(m.path, ".")+1:]]
+		default:
+			return false
+		}
+		if got != m.value {
+			return false
+		}
+	}
+	return true
+}
+
+func pointInInterval(p *monitoring_pb.Point, iv *monitoring_pb.TimeInterval) bool {
+	t := p.Interval.EndTime.AsTime()
+	if iv.StartTime != nil && t.Before(iv.StartTime.AsTime()) {
+		return false
+	}
+	return !t.After(iv.EndTime.AsTime())
+}
+
+// seriesKey uniquely identifies a time series by its metric and resource.
+func seriesKey(ts *monitoring_pb.TimeSeries) string {
+	var sb strings.Builder
+
+	sb.WriteString(ts.Metric.GetType())
+	writeSortedLabels(&sb, ts.Metric.GetLabels())
+	sb.WriteString(ts.Resource.GetType())
+	writeSortedLabels(&sb, ts.Resource.GetLabels())
+	return sb.String()
+}
+
+func writeSortedLabels(sb *strings.Builder, lset map[string]string) {
+	keys := make([]string, 0, len(lset))
+	for k := range lset {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(sb, "\x00%s\x00%s", k, lset[k])
+	}
+	sb.WriteString("\xff")
+}
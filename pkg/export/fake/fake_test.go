@@ -0,0 +1,130 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"testing"
+
+	timestamp_pb "github.com/golang/protobuf/ptypes/timestamp"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testSeries(job string, seconds int64, v float64) *monitoring_pb.TimeSeries {
+	return &monitoring_pb.TimeSeries{
+		Metric: &metric_pb.Metric{
+			Type:   "prometheus.googleapis.com/up/gauge",
+			Labels: map[string]string{"external_key": "external_val"},
+		},
+		Resource: &monitoredres_pb.MonitoredResource{
+			Type: "prometheus_target",
+			Labels: map[string]string{
+				"project_id": "test-proj",
+				"job":        job,
+			},
+		},
+		Points: []*monitoring_pb.Point{{
+			Interval: &monitoring_pb.TimeInterval{
+				EndTime: &timestamp_pb.Timestamp{Seconds: seconds},
+			},
+			Value: &monitoring_pb.TypedValue{
+				Value: &monitoring_pb.TypedValue_DoubleValue{DoubleValue: v},
+			},
+		}},
+	}
+}
+
+func TestCreateTimeSeriesOrdering(t *testing.T) {
+	ctx := context.Background()
+	srv := NewMetricServer()
+
+	for _, seconds := range []int64{100, 200} {
+		_, err := srv.CreateTimeSeries(ctx, &monitoring_pb.CreateTimeSeriesRequest{
+			Name:       "projects/test-proj",
+			TimeSeries: []*monitoring_pb.TimeSeries{testSeries("job1", seconds, 1)},
+		})
+		if err != nil {
+			t.Fatalf("write point at %d: %s", seconds, err)
+		}
+	}
+	// Writing at or before the last end timestamp must be rejected.
+	for _, seconds := range []int64{200, 150} {
+		_, err := srv.CreateTimeSeries(ctx, &monitoring_pb.CreateTimeSeriesRequest{
+			Name:       "projects/test-proj",
+			TimeSeries: []*monitoring_pb.TimeSeries{testSeries("job1", seconds, 1)},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("expected InvalidArgument for write at %d, got %v", seconds, err)
+		}
+	}
+}
+
+func TestListTimeSeriesFilter(t *testing.T) {
+	ctx := context.Background()
+	srv := NewMetricServer()
+
+	_, err := srv.CreateTimeSeries(ctx, &monitoring_pb.CreateTimeSeriesRequest{
+		Name: "projects/test-proj",
+		TimeSeries: []*monitoring_pb.TimeSeries{
+			testSeries("job1", 100, 1),
+			testSeries("job2", 100, 2),
+		},
+	})
+	if err != nil {
+		t.Fatalf("write series: %s", err)
+	}
+	resp, err := srv.ListTimeSeries(ctx, &monitoring_pb.ListTimeSeriesRequest{
+		Name: "projects/test-proj",
+		Filter: `
+		resource.type = "prometheus_target" AND
+		resource.labels.project_id = "test-proj" AND
+		resource.label.job = "job1" AND
+		metric.type = "prometheus.googleapis.com/up/gauge" AND
+		metric.labels.external_key = "external_val"
+		`,
+		Interval: &monitoring_pb.TimeInterval{
+			StartTime: &timestamp_pb.Timestamp{Seconds: 50},
+			EndTime:   &timestamp_pb.Timestamp{Seconds: 150},
+		},
+	})
+	if err != nil {
+		t.Fatalf("list series: %s", err)
+	}
+	if len(resp.TimeSeries) != 1 {
+		t.Fatalf("expected exactly one series, got %d", len(resp.TimeSeries))
+	}
+	if job := resp.TimeSeries[0].Resource.Labels["job"]; job != "job1" {
+		t.Fatalf("unexpected job label %q", job)
+	}
+	// An interval not covering any points must produce no results.
+	resp, err = srv.ListTimeSeries(ctx, &monitoring_pb.ListTimeSeriesRequest{
+		Name:   "projects/test-proj",
+		Filter: `resource.labels.job = "job1"`,
+		Interval: &monitoring_pb.TimeInterval{
+			StartTime: &timestamp_pb.Timestamp{Seconds: 150},
+			EndTime:   &timestamp_pb.Timestamp{Seconds: 250},
+		},
+	})
+	if err != nil {
+		t.Fatalf("list series: %s", err)
+	}
+	if len(resp.TimeSeries) != 0 {
+		t.Fatalf("expected no series, got %d", len(resp.TimeSeries))
+	}
+}
@@ -64,6 +64,14 @@ type seriesCache struct {
 
 	// Prefix under which metrics are written to GCM.
 	metricTypePrefix string
+	// Optional custom mapping of metric names to GCM metric types that takes
+	// precedence over the default mapping under the prefix.
+	typeMapper MetricTypeMapper
+
+	// Guards the set of metric names written under the custom metric type
+	// prefix, which may be updated at runtime through configuration changes.
+	customMtx     sync.RWMutex
+	customMetrics map[string]struct{}
 }
 
 type seriesCacheEntry struct {
@@ -136,6 +144,7 @@ func newSeriesCache(
 	logger log.Logger,
 	reg prometheus.Registerer,
 	metricTypePrefix string,
+	typeMapper MetricTypeMapper,
 	matchers Matchers,
 ) *seriesCache {
 	if logger == nil {
@@ -148,6 +157,7 @@ func newSeriesCache(
 		entries:          map[storage.SeriesRef]*seriesCacheEntry{},
 		matchers:         matchers,
 		metricTypePrefix: metricTypePrefix,
+		typeMapper:       typeMapper,
 	}
 }
 
@@ -299,12 +309,51 @@ func (c *seriesCache) getResetAdjusted(ref storage.SeriesRef, t int64, v float64
 // is to be treated as a counter or gauge at query time, the secondarySuffix is set to "counter"
 // for the counter variant, and left empty for the gauge variant.
 func (c *seriesCache) getMetricType(name string, suffix, secondarySuffix gcmMetricSuffix) string {
+	if c.typeMapper != nil {
+		if t := c.typeMapper.MetricType(name); t != "" {
+			return t
+		}
+	}
+	c.customMtx.RLock()
+	_, custom := c.customMetrics[name]
+	c.customMtx.RUnlock()
+	if custom {
+		// Custom metric types do not encode the Prometheus type as a suffix and
+		// must not contain colons, which are replaced by underscores.
+		return fmt.Sprintf("%s/%s", CustomMetricTypePrefix, strings.ReplaceAll(name, ":", "_"))
+	}
 	if secondarySuffix == gcmMetricSuffixNone {
 		return fmt.Sprintf("%s/%s/%s", c.metricTypePrefix, name, suffix)
 	}
 	return fmt.Sprintf("%s/%s/%s:%s", c.metricTypePrefix, name, suffix, secondarySuffix)
 }
 
+// setCustomMetrics sets the metric names written under the custom metric type
+// prefix. It returns whether the set changed from its previous state.
+func (c *seriesCache) setCustomMetrics(names []string) bool {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+	c.customMtx.Lock()
+	defer c.customMtx.Unlock()
+
+	if len(set) == len(c.customMetrics) {
+		same := true
+		for name := range set {
+			if _, ok := c.customMetrics[name]; !ok {
+				same = false
+				break
+			}
+		}
+		if same {
+			return false
+		}
+	}
+	c.customMetrics = set
+	return true
+}
+
 // Metric name suffixes used by various Prometheus metric types.
 type metricSuffix string
 
@@ -151,8 +151,46 @@ func TestExtractResource(t *testing.T) {
 	}
 }
 
+func TestSeriesCache_getMetricType(t *testing.T) {
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil, nil)
+
+	if want, got := "prometheus.googleapis.com/metric_name/gauge", cache.getMetricType("metric_name", gcmMetricSuffixGauge, gcmMetricSuffixNone); got != want {
+		t.Errorf("expected metric type %q but got %q", want, got)
+	}
+	if !cache.setCustomMetrics([]string{"job:metric_name:rate5m"}) {
+		t.Error("expected custom metric set to report a change")
+	}
+	if cache.setCustomMetrics([]string{"job:metric_name:rate5m"}) {
+		t.Error("expected unchanged custom metric set to report no change")
+	}
+	// Custom metrics drop the type suffix and have colons replaced.
+	if want, got := "custom.googleapis.com/prometheus/job_metric_name_rate5m", cache.getMetricType("job:metric_name:rate5m", gcmMetricSuffixGauge, gcmMetricSuffixNone); got != want {
+		t.Errorf("expected metric type %q but got %q", want, got)
+	}
+	// Metrics not in the set are unaffected.
+	if want, got := "prometheus.googleapis.com/metric_name/gauge", cache.getMetricType("metric_name", gcmMetricSuffixGauge, gcmMetricSuffixNone); got != want {
+		t.Errorf("expected metric type %q but got %q", want, got)
+	}
+	// A custom type mapper takes precedence over all default mappings, an
+	// empty result falls through to them.
+	cache.typeMapper = testTypeMapper{"metric_name": "example.com/custom/type"}
+	if want, got := "example.com/custom/type", cache.getMetricType("metric_name", gcmMetricSuffixGauge, gcmMetricSuffixNone); got != want {
+		t.Errorf("expected metric type %q but got %q", want, got)
+	}
+	if want, got := "custom.googleapis.com/prometheus/job_metric_name_rate5m", cache.getMetricType("job:metric_name:rate5m", gcmMetricSuffixGauge, gcmMetricSuffixNone); got != want {
+		t.Errorf("expected metric type %q but got %q", want, got)
+	}
+}
+
+// testTypeMapper maps metric names to fixed metric types.
+type testTypeMapper map[string]string
+
+func (m testTypeMapper) MetricType(name string) string {
+	return m[name]
+}
+
 func TestSeriesCache_garbageCollect(t *testing.T) {
-	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil, nil)
 	// Always return empty labels. This will cause cache entries to be added but not populated,
 	// which we don't need to test garbage collection.
 	cache.getLabelsByRef = func(storage.SeriesRef) labels.Labels { return nil }
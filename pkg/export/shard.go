@@ -101,6 +101,21 @@ func (s *shard) fill(batch *batch) (took, remaining int) {
 	return n, s.queue.length()
 }
 
+// drained returns whether the shard holds no more data and has no in-flight
+// request.
+func (s *shard) drained() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return !s.pending && s.queue.length() == 0
+}
+
+// size returns the number of samples currently queued in the shard.
+func (s *shard) size() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.queue.length()
+}
+
 func (s *shard) setPending(b bool) {
 	// This case should never happen in our usage of shards unless there is a bug.
 	if s.pending == b {
@@ -95,13 +95,24 @@ func (s *Storage) Appender(ctx context.Context) storage.Appender {
 	}
 }
 
+// AppenderWithMetadata returns an Appender whose Commit exports the buffered
+// samples with the given metadata instead of defaulting all series to gauges.
+func (s *Storage) AppenderWithMetadata(metadata MetadataFunc) storage.Appender {
+	return &storageAppender{
+		storage:  s,
+		metadata: metadata,
+		samples:  make([]record.RefSample, 0, 64),
+	}
+}
+
 type storageAppender struct {
 	// Make sure all Appender methods are implemented at compile time. Panics
 	// are expected and intended if a method is used unexpectedly.
 	storage.Appender
 
-	storage *Storage
-	samples []record.RefSample
+	storage  *Storage
+	metadata MetadataFunc
+	samples  []record.RefSample
 }
 
 func (a *storageAppender) Append(_ storage.SeriesRef, lset labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
@@ -118,12 +129,16 @@ func (a *storageAppender) Append(_ storage.SeriesRef, lset labels.Labels, t int6
 }
 
 func (a *storageAppender) Commit() error {
-	// This method is used to export rule results. It's generally safe to assume that
-	// they are of type gauge. Thus we pass in a metadata func that always returns the
-	// gauge type.
+	// Without explicit metadata this method is used to export rule results. It's
+	// generally safe to assume that they are of type gauge. Thus we default to a
+	// metadata func that always returns the gauge type.
 	// In the future we may want to populate the help text with information on the rule
 	// that produced the metric.
-	a.storage.exporter.Export(gaugeMetadata, a.samples)
+	metadata := a.metadata
+	if metadata == nil {
+		metadata = gaugeMetadata
+	}
+	a.storage.exporter.Export(metadata, a.samples)
 
 	// After export is complete, we can clear the labels again.
 	a.storage.clearLabels(a.samples)
@@ -1197,7 +1197,7 @@ func TestSampleBuilder(t *testing.T) {
 
 	for i, c := range cases {
 		t.Run(fmt.Sprintf("%d: %s", i, c.doc), func(t *testing.T) {
-			cache := newSeriesCache(nil, nil, MetricTypePrefix, c.matchers)
+			cache := newSeriesCache(nil, nil, MetricTypePrefix, nil, c.matchers)
 			// Fake lookup into TSDB.
 			cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
 				return c.series[ref]
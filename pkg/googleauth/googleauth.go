@@ -0,0 +1,244 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package googleauth mints Google-signed tokens that authorize scrapes of
+// targets behind IAM, such as Cloud Run sidecars or endpoints protected by
+// Identity-Aware Proxy.
+//
+// The operator and the config-reloader coordinate through file names alone:
+// the operator generates scrape configurations whose credentials file encodes
+// the token type and audience in its name, and the config-reloader scans the
+// configurations and keeps a fresh token in each referenced file.
+package googleauth
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// TokenDirectory is the directory inside collector pods in which the
+// config-reloader places the token files referenced by generated scrape
+// configurations.
+const TokenDirectory = "/etc/gmp-tokens"
+
+// Types of tokens that can be attached to scrape requests.
+const (
+	// TokenTypeID is an OpenID Connect identity token for a configured audience.
+	TokenTypeID = "id"
+	// TokenTypeAccess is an OAuth2 access token with cloud-platform scope.
+	TokenTypeAccess = "access"
+)
+
+const (
+	tokenSuffix        = ".token"
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// TokenFilepath returns the path of the token file for the given token type
+// and audience within TokenDirectory. The file name encodes both inputs so
+// that the config-reloader can mint matching tokens based on the scrape
+// configuration alone.
+func TokenFilepath(typ, audience string) string {
+	name := typ + "-" + base64.RawURLEncoding.EncodeToString([]byte(audience)) + tokenSuffix
+	return path.Join(TokenDirectory, name)
+}
+
+// tokenFileRegexp matches token file paths as produced by TokenFilepath when
+// scanning configuration files.
+var tokenFileRegexp = regexp.MustCompile(
+	regexp.QuoteMeta(TokenDirectory) + `/(?:` + TokenTypeID + `|` + TokenTypeAccess + `)-[A-Za-z0-9_-]*\` + tokenSuffix)
+
+// parseTokenFilename decodes the token type and audience from a file name
+// produced by TokenFilepath.
+func parseTokenFilename(name string) (typ, audience string, err error) {
+	name = strings.TrimSuffix(name, tokenSuffix)
+	i := strings.Index(name, "-")
+	if i < 0 {
+		return "", "", errors.Errorf("invalid token file name %q", name)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(name[i+1:])
+	if err != nil {
+		return "", "", errors.Wrapf(err, "invalid audience encoding in token file name %q", name)
+	}
+	return name[:i], string(b), nil
+}
+
+// source mints tokens of one type and audience for the collector's service
+// account, relying on Application Default Credentials, i.e. the metadata
+// server under Workload Identity.
+type source struct {
+	typ, audience string
+	access        oauth2.TokenSource
+}
+
+func (s *source) token(ctx context.Context) (string, error) {
+	switch s.typ {
+	case TokenTypeID:
+		// The metadata server mints identity tokens for the service account of
+		// the pod and serves cached tokens on repeated requests.
+		return metadata.Get("instance/service-accounts/default/identity?audience=" + url.QueryEscape(s.audience))
+	case TokenTypeAccess:
+		if s.access == nil {
+			ts, err := google.DefaultTokenSource(ctx, cloudPlatformScope)
+			if err != nil {
+				return "", errors.Wrap(err, "create token source")
+			}
+			// The token source caches tokens until shortly before expiry.
+			s.access = ts
+		}
+		tok, err := s.access.Token()
+		if err != nil {
+			return "", errors.Wrap(err, "fetch access token")
+		}
+		return tok.AccessToken, nil
+	}
+	return "", errors.Errorf("unexpected token type %q", s.typ)
+}
+
+// Refresher keeps the token files referenced by a set of Prometheus
+// configuration files up to date in a directory. Referenced files are
+// determined by rescanning the configurations for paths within
+// TokenDirectory, so newly added scrape configurations are picked up without
+// restarts and tokens for dropped configurations are removed again.
+type Refresher struct {
+	logger      log.Logger
+	dir         string
+	configFiles []string
+	sources     map[string]*source
+	// Seam for tests, which cannot reach a metadata server.
+	mint func(ctx context.Context, typ, audience string) (string, error)
+}
+
+// NewRefresher returns a refresher maintaining token files in the given
+// directory for tokens referenced by the given configuration files.
+func NewRefresher(logger log.Logger, dir string, configFiles []string) *Refresher {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	r := &Refresher{
+		logger:      logger,
+		dir:         dir,
+		configFiles: configFiles,
+		sources:     map[string]*source{},
+	}
+	r.mint = r.mintToken
+	return r
+}
+
+func (r *Refresher) mintToken(ctx context.Context, typ, audience string) (string, error) {
+	key := typ + "/" + audience
+	src, ok := r.sources[key]
+	if !ok {
+		src = &source{typ: typ, audience: audience}
+		r.sources[key] = src
+	}
+	return src.token(ctx)
+}
+
+// Run refreshes all referenced token files at the given interval until the
+// context is canceled. Identity and access tokens are valid for an hour, so
+// intervals of a few minutes leave plenty of headroom. The interval also
+// bounds how quickly tokens for new scrape configurations become available.
+func (r *Refresher) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh writes one fresh token file per referenced token and removes token
+// files that are no longer referenced. Tokens that cannot be minted are
+// logged and retried on the next refresh; their previous token file stays in
+// place meanwhile so scrapes keep working until it expires.
+func (r *Refresher) refresh(ctx context.Context) {
+	refs := r.referencedTokens()
+
+	for name := range refs {
+		typ, audience, err := parseTokenFilename(name)
+		if err != nil {
+			level.Error(r.logger).Log("msg", "skipping invalid token file name", "file", name, "err", err)
+			continue
+		}
+		tok, err := r.mint(ctx, typ, audience)
+		if err != nil {
+			level.Error(r.logger).Log("msg", "minting token failed", "file", name, "err", err)
+			continue
+		}
+		if err := writeFileAtomic(filepath.Join(r.dir, name), tok); err != nil {
+			level.Error(r.logger).Log("msg", "writing token file failed", "file", name, "err", err)
+		}
+	}
+	// Remove token files of scrape configurations that no longer exist.
+	entries, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		level.Error(r.logger).Log("msg", "listing token directory failed", "err", err)
+		return
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), tokenSuffix) && !refs[e.Name()] {
+			if err := os.Remove(filepath.Join(r.dir, e.Name())); err != nil {
+				level.Error(r.logger).Log("msg", "removing stale token file failed", "file", e.Name(), "err", err)
+			}
+		}
+	}
+}
+
+// referencedTokens returns the names of all token files referenced by the
+// configuration files.
+func (r *Refresher) referencedTokens() map[string]bool {
+	refs := map[string]bool{}
+	for _, cf := range r.configFiles {
+		b, err := ioutil.ReadFile(cf)
+		if err != nil {
+			// Configuration files may not have been written yet on startup.
+			level.Warn(r.logger).Log("msg", "reading config file failed", "file", cf, "err", err)
+			continue
+		}
+		for _, p := range tokenFileRegexp.FindAllString(string(b), -1) {
+			refs[path.Base(p)] = true
+		}
+	}
+	return refs
+}
+
+// writeFileAtomic writes the token through a rename so that readers never
+// observe a partially written file.
+func writeFileAtomic(fn, token string) error {
+	tmp := fn + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(token), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package googleauth
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenFilepathRoundTrip(t *testing.T) {
+	p := TokenFilepath(TokenTypeID, "https://svc.example.run.app")
+	if !tokenFileRegexp.MatchString(p) {
+		t.Fatalf("token file path %q does not match scan expression", p)
+	}
+	typ, audience, err := parseTokenFilename(path.Base(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != TokenTypeID || audience != "https://svc.example.run.app" {
+		t.Fatalf("unexpected parse result %q/%q", typ, audience)
+	}
+
+	if _, _, err := parseTokenFilename("garbage"); err == nil {
+		t.Fatal("expected error for invalid token file name")
+	}
+}
+
+func TestRefresherRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := fmt.Sprintf(`scrape_configs:
+- job_name: a
+  authorization:
+    credentials_file: %s
+- job_name: b
+  authorization:
+    credentials_file: %s
+`, TokenFilepath(TokenTypeID, "https://svc.example.run.app"), TokenFilepath(TokenTypeAccess, ""))
+
+	cfgFile := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(cfgFile, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A token file that is no longer referenced by the config must be removed.
+	stale := path.Base(TokenFilepath(TokenTypeID, "https://old.example.run.app"))
+	if err := ioutil.WriteFile(filepath.Join(dir, stale), []byte("expired"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRefresher(nil, dir, []string{cfgFile})
+	r.mint = func(_ context.Context, typ, audience string) (string, error) {
+		return typ + ":" + audience, nil
+	}
+	r.refresh(context.Background())
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, path.Base(TokenFilepath(TokenTypeID, "https://svc.example.run.app"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := TokenTypeID + ":https://svc.example.run.app"; string(b) != want {
+		t.Fatalf("unexpected token %q, want %q", b, want)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, path.Base(TokenFilepath(TokenTypeAccess, ""))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := TokenTypeAccess + ":"; string(b) != want {
+		t.Fatalf("unexpected token %q, want %q", b, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, stale)); !os.IsNotExist(err) {
+		t.Fatalf("expected stale token file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging provides the shared logger setup for the project's binaries.
+package logging
+
+import (
+	"os"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// Flag help texts shared by the binaries registering the logging flags.
+const (
+	LevelFlagHelp  = "Log level, one of: debug, info, warn, error."
+	FormatFlagHelp = "Log format, one of: logfmt, json."
+)
+
+// NewLogger returns a logger writing to stderr at the given level ("debug",
+// "info", "warn", "error") in the given format ("logfmt", "json").
+func NewLogger(lvl, format string) (log.Logger, error) {
+	var logger log.Logger
+	switch format {
+	case "", "logfmt":
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	case "json":
+		logger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	default:
+		return nil, errors.Errorf("unknown log format %q, expected one of: logfmt, json", format)
+	}
+	var opt level.Option
+	switch lvl {
+	case "debug":
+		opt = level.AllowDebug()
+	case "", "info":
+		opt = level.AllowInfo()
+	case "warn":
+		opt = level.AllowWarn()
+	case "error":
+		opt = level.AllowError()
+	default:
+		return nil, errors.Errorf("unknown log level %q, expected one of: debug, info, warn, error", lvl)
+	}
+	logger = level.NewFilter(logger, opt)
+	logger = log.With(logger, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller)
+	return logger, nil
+}
@@ -0,0 +1,365 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	prommodel "github.com/prometheus/common/model"
+	"golang.org/x/oauth2/google"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/rules"
+)
+
+const (
+	// alertPolicyAPIEndpoint is the base URL of the Cloud Monitoring API
+	// version serving alerting policies.
+	alertPolicyAPIEndpoint = "https://monitoring.googleapis.com/v3"
+
+	// alertPolicyOwnerLabel is the user label on managed alerting policies
+	// identifying the rules resource they were compiled from.
+	alertPolicyOwnerLabel = "gmp_rules"
+	// alertPolicyKeyLabel is the user label on managed alerting policies
+	// identifying the individual alerting rule within the owning resource.
+	alertPolicyKeyLabel = "gmp_rule_key"
+)
+
+// alertPolicySource is a rules resource that opted into alerting policy
+// export, along with the label set its expressions are scoped by.
+type alertPolicySource struct {
+	obj  client.Object
+	kind string
+	spec *monitoringv1.RulesSpec
+	lset map[string]string
+}
+
+// ensureAlertPolicies compiles the alerting rules of all rules resources that
+// opt in through spec.alertPolicies into Cloud Monitoring alerting policies.
+// Policies of alerting rules that were removed from a resource are deleted
+// again. Deleting the whole resource or disabling the export leaves existing
+// policies in place as the operator no longer knows about them.
+func (r *rulesReconciler) ensureAlertPolicies(ctx context.Context, projectID, location, cluster string) error {
+	logger, _ := logr.FromContext(ctx)
+
+	var sources []alertPolicySource
+
+	var rulesList monitoringv1.RulesList
+	if err := r.client.List(ctx, &rulesList); err != nil {
+		return errors.Wrap(err, "list rules")
+	}
+	for i := range rulesList.Items {
+		rs := &rulesList.Items[i]
+		if rs.Spec.AlertPolicies == nil || !r.opts.namespaceAllowed(rs.Namespace) {
+			continue
+		}
+		sources = append(sources, alertPolicySource{
+			obj: rs, kind: "Rules", spec: &rs.Spec,
+			lset: map[string]string{
+				export.KeyProjectID: projectID,
+				export.KeyLocation:  location,
+				export.KeyCluster:   cluster,
+				export.KeyNamespace: rs.Namespace,
+			},
+		})
+	}
+	var clusterRulesList monitoringv1.ClusterRulesList
+	if err := r.client.List(ctx, &clusterRulesList); err != nil {
+		return errors.Wrap(err, "list cluster rules")
+	}
+	for i := range clusterRulesList.Items {
+		rs := &clusterRulesList.Items[i]
+		if rs.Spec.AlertPolicies == nil {
+			continue
+		}
+		sources = append(sources, alertPolicySource{
+			obj: rs, kind: "ClusterRules", spec: &rs.Spec,
+			lset: map[string]string{
+				export.KeyProjectID: projectID,
+				export.KeyLocation:  location,
+				export.KeyCluster:   cluster,
+			},
+		})
+	}
+	var globalRulesList monitoringv1.GlobalRulesList
+	if err := r.client.List(ctx, &globalRulesList); err != nil {
+		return errors.Wrap(err, "list global rules")
+	}
+	for i := range globalRulesList.Items {
+		rs := &globalRulesList.Items[i]
+		if rs.Spec.AlertPolicies == nil {
+			continue
+		}
+		sources = append(sources, alertPolicySource{obj: rs, kind: "GlobalRules", spec: &rs.Spec})
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+
+	tokenSource, err := google.DefaultTokenSource(ctx, monitoringTokenScope)
+	if err != nil {
+		return errors.Wrap(err, "find default GCP credentials")
+	}
+	token, err := tokenSource.Token()
+	if err != nil {
+		return errors.Wrap(err, "mint access token")
+	}
+
+	// Sync all sources and retry through the first error so one broken
+	// resource does not block the others.
+	var firstErr error
+	for _, src := range sources {
+		if err := r.syncAlertPolicies(ctx, token.AccessToken, projectID, src); err != nil {
+			logger.Error(err, "syncing alerting policies failed", "kind", src.kind, "namespace", src.obj.GetNamespace(), "name", src.obj.GetName())
+			r.recorder.Eventf(src.obj, corev1.EventTypeWarning, monitoringv1.ReasonAlertPolicySyncError, "syncing alerting policies failed: %s", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// syncAlertPolicies reconciles the alerting policies compiled from a single
+// rules resource against those existing in Cloud Monitoring.
+func (r *rulesReconciler) syncAlertPolicies(ctx context.Context, token, defaultProjectID string, src alertPolicySource) error {
+	projectID := src.spec.AlertPolicies.ProjectID
+	if projectID == "" {
+		projectID = defaultProjectID
+	}
+	owner := alertPolicyOwner(src.kind, src.obj)
+
+	desired, err := desiredAlertPolicies(owner, src.spec, src.lset)
+	if err != nil {
+		return err
+	}
+	existing, err := listAlertPolicies(ctx, token, projectID, owner)
+	if err != nil {
+		return errors.Wrap(err, "list alerting policies")
+	}
+
+	for key, policy := range desired {
+		prev, ok := existing[key]
+		if !ok {
+			path := fmt.Sprintf("projects/%s/alertPolicies", projectID)
+			if _, err := monitoringAPI(ctx, http.MethodPost, alertPolicyAPIEndpoint, path, token, policy); err != nil {
+				return errors.Wrapf(err, "create alerting policy %q", policy["displayName"])
+			}
+			continue
+		}
+		if alertPolicyUpToDate(prev, policy) {
+			continue
+		}
+		name, _ := prev["name"].(string)
+		policy["name"] = name
+		path := fmt.Sprintf("%s?updateMask=%s", name, url.QueryEscape("displayName,combiner,conditions,notificationChannels"))
+		if _, err := monitoringAPI(ctx, http.MethodPatch, alertPolicyAPIEndpoint, path, token, policy); err != nil {
+			return errors.Wrapf(err, "update alerting policy %q", name)
+		}
+	}
+	// Delete policies of alerting rules that no longer exist in the resource.
+	for key, prev := range existing {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		name, _ := prev["name"].(string)
+		if _, err := monitoringAPI(ctx, http.MethodDelete, alertPolicyAPIEndpoint, name, token, nil); err != nil {
+			return errors.Wrapf(err, "delete alerting policy %q", name)
+		}
+	}
+	return nil
+}
+
+// alertPolicyOwner returns the value of the owner label identifying the given
+// rules resource, within the length and character limits of policy labels.
+func alertPolicyOwner(kind string, obj metav1.Object) string {
+	owner := strings.ToLower(kind)
+	if ns := obj.GetNamespace(); ns != "" {
+		owner += "__" + ns
+	}
+	owner += "__" + obj.GetName()
+	if len(owner) > 63 {
+		owner = fmt.Sprintf("%x", sha256.Sum256([]byte(owner)))[:32]
+	}
+	return owner
+}
+
+// desiredAlertPolicies compiles the alerting rules of the resource into
+// alerting policy objects with PromQL conditions, keyed by the value of their
+// key label. Expressions are scoped by the same label set as the generated
+// rule files so both alerting paths act on the same data. Local rule groups
+// are scoped as well since the policies always evaluate in Cloud Monitoring.
+func desiredAlertPolicies(owner string, spec *monitoringv1.RulesSpec, lset map[string]string) (map[string]map[string]interface{}, error) {
+	rs, err := rules.FromAPIRules(spec.Groups)
+	if err != nil {
+		return nil, errors.Wrap(err, "converting rules failed")
+	}
+	if len(lset) > 0 {
+		if err := rules.Scope(&rs, lset); err != nil {
+			return nil, errors.Wrap(err, "isolating rules failed")
+		}
+	}
+	policies := map[string]map[string]interface{}{}
+	keyCount := map[string]int{}
+
+	for _, g := range rs.Groups {
+		for _, rl := range g.Rules {
+			alert := rl.Alert.Value
+			if alert == "" {
+				continue
+			}
+			// Alert names may repeat within a group with different label
+			// sets, so an ordinal disambiguates the key and display name.
+			displayName := fmt.Sprintf("%s/%s", g.Name, alert)
+			n := keyCount[displayName]
+			keyCount[displayName]++
+			key := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s/%d", displayName, n))))[:32]
+			if n > 0 {
+				displayName = fmt.Sprintf("%s (%d)", displayName, n)
+			}
+
+			cond := map[string]interface{}{
+				"query":              rl.Expr.Value,
+				"evaluationInterval": protoDuration(g.Interval),
+				"ruleGroup":          g.Name,
+				"alertRule":          alert,
+			}
+			if rl.For > 0 {
+				cond["duration"] = protoDuration(rl.For)
+			}
+			if len(rl.Labels) > 0 {
+				cond["labels"] = rl.Labels
+			}
+			policy := map[string]interface{}{
+				"displayName": displayName,
+				"combiner":    "OR",
+				"conditions": []interface{}{
+					map[string]interface{}{
+						"displayName":                      alert,
+						"conditionPrometheusQueryLanguage": cond,
+					},
+				},
+				"userLabels": map[string]interface{}{
+					alertPolicyOwnerLabel: owner,
+					alertPolicyKeyLabel:   key,
+				},
+			}
+			if len(spec.AlertPolicies.NotificationChannels) > 0 {
+				policy["notificationChannels"] = spec.AlertPolicies.NotificationChannels
+			}
+			policies[key] = policy
+		}
+	}
+	return policies, nil
+}
+
+// protoDuration formats a duration in the whole-second representation the
+// Cloud Monitoring API uses.
+func protoDuration(d prommodel.Duration) string {
+	return fmt.Sprintf("%ds", int64(time.Duration(d)/time.Second))
+}
+
+// listAlertPolicies returns the existing alerting policies owned by the given
+// rules resource, keyed by the value of their key label.
+func listAlertPolicies(ctx context.Context, token, projectID, owner string) (map[string]map[string]interface{}, error) {
+	filter := fmt.Sprintf("user_labels.%s=%q", alertPolicyOwnerLabel, owner)
+	basePath := fmt.Sprintf("projects/%s/alertPolicies?filter=%s", projectID, url.QueryEscape(filter))
+
+	policies := map[string]map[string]interface{}{}
+	var pageToken string
+	for {
+		path := basePath
+		if pageToken != "" {
+			path += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+		resp, err := monitoringAPI(ctx, http.MethodGet, alertPolicyAPIEndpoint, path, token, nil)
+		if err != nil {
+			return nil, err
+		}
+		list, _ := resp["alertPolicies"].([]interface{})
+		for _, p := range list {
+			policy, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			labels, _ := policy["userLabels"].(map[string]interface{})
+			if key, ok := labels[alertPolicyKeyLabel].(string); ok {
+				policies[key] = policy
+			}
+		}
+		pageToken, _ = resp["nextPageToken"].(string)
+		if pageToken == "" {
+			return policies, nil
+		}
+	}
+}
+
+// alertPolicyUpToDate reports whether the existing policy matches the desired
+// one. Only fields set in the desired policy are compared so server-side
+// defaults of unset fields do not cause perpetual updates.
+func alertPolicyUpToDate(existing, desired map[string]interface{}) bool {
+	// Round-trip the desired policy through JSON so nested values have the
+	// same generic types as the decoded API response.
+	b, err := json.Marshal(desired)
+	if err != nil {
+		return false
+	}
+	var norm map[string]interface{}
+	if err := json.Unmarshal(b, &norm); err != nil {
+		return false
+	}
+	for _, field := range []string{"displayName", "combiner", "notificationChannels"} {
+		if v, ok := norm[field]; ok && !reflect.DeepEqual(v, existing[field]) {
+			return false
+		}
+	}
+	prevConds, _ := existing["conditions"].([]interface{})
+	conds, _ := norm["conditions"].([]interface{})
+	if len(prevConds) != len(conds) {
+		return false
+	}
+	for i, c := range conds {
+		cond, _ := c.(map[string]interface{})
+		prevCond, _ := prevConds[i].(map[string]interface{})
+		if prevCond == nil || cond["displayName"] != prevCond["displayName"] {
+			return false
+		}
+		pql, _ := cond["conditionPrometheusQueryLanguage"].(map[string]interface{})
+		prevPQL, _ := prevCond["conditionPrometheusQueryLanguage"].(map[string]interface{})
+		if prevPQL == nil {
+			return false
+		}
+		for field, v := range pql {
+			if !reflect.DeepEqual(v, prevPQL[field]) {
+				return false
+			}
+		}
+	}
+	return true
+}
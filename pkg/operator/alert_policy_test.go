@@ -0,0 +1,116 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestDesiredAlertPolicies(t *testing.T) {
+	spec := &monitoringv1.RulesSpec{
+		Groups: []monitoringv1.RuleGroup{{
+			Name:     "test-group",
+			Interval: "30s",
+			Rules: []monitoringv1.Rule{
+				{
+					Alert:  "HighErrors",
+					Expr:   `rate(errors_total[5m]) > 0.5`,
+					For:    "2m",
+					Labels: map[string]string{"severity": "page"},
+				},
+				{
+					Record: "errors:rate5m",
+					Expr:   `rate(errors_total[5m])`,
+				},
+			},
+		}},
+		AlertPolicies: &monitoringv1.AlertPolicyExport{
+			NotificationChannels: []string{"projects/p/notificationChannels/123"},
+		},
+	}
+	policies, err := desiredAlertPolicies("rules__ns__name", spec, map[string]string{
+		"project_id": "test-project",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The recording rule must not produce a policy.
+	if len(policies) != 1 {
+		t.Fatalf("expected 1 policy, got %d", len(policies))
+	}
+	for key, policy := range policies {
+		if policy["displayName"] != "test-group/HighErrors" {
+			t.Errorf("unexpected display name %q", policy["displayName"])
+		}
+		labels := policy["userLabels"].(map[string]interface{})
+		if labels[alertPolicyKeyLabel] != key {
+			t.Errorf("key label %q does not match policy key %q", labels[alertPolicyKeyLabel], key)
+		}
+		cond := policy["conditions"].([]interface{})[0].(map[string]interface{})
+		pql := cond["conditionPrometheusQueryLanguage"].(map[string]interface{})
+		// The expression must be scoped like the generated rule files.
+		if q := pql["query"].(string); !strings.Contains(q, `project_id="test-project"`) {
+			t.Errorf("expected scoped query, got %q", q)
+		}
+		if pql["duration"] != "120s" || pql["evaluationInterval"] != "30s" {
+			t.Errorf("unexpected durations %q/%q", pql["duration"], pql["evaluationInterval"])
+		}
+	}
+}
+
+func TestAlertPolicyUpToDate(t *testing.T) {
+	spec := &monitoringv1.RulesSpec{
+		Groups: []monitoringv1.RuleGroup{{
+			Name:     "test-group",
+			Interval: "30s",
+			Rules:    []monitoringv1.Rule{{Alert: "HighErrors", Expr: "vector(1)", For: "2m"}},
+		}},
+		AlertPolicies: &monitoringv1.AlertPolicyExport{},
+	}
+	policies, err := desiredAlertPolicies("owner", spec, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var desired map[string]interface{}
+	for _, p := range policies {
+		desired = p
+	}
+	// Simulate the API response for the same policy, including server-set
+	// fields that must not trigger an update.
+	b, err := json.Marshal(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var existing map[string]interface{}
+	if err := json.Unmarshal(b, &existing); err != nil {
+		t.Fatal(err)
+	}
+	existing["name"] = "projects/p/alertPolicies/123"
+	existing["conditions"].([]interface{})[0].(map[string]interface{})["name"] = "projects/p/alertPolicies/123/conditions/456"
+
+	if !alertPolicyUpToDate(existing, desired) {
+		t.Error("expected policy with extra server-set fields to be up to date")
+	}
+
+	changed := existing["conditions"].([]interface{})[0].(map[string]interface{})["conditionPrometheusQueryLanguage"].(map[string]interface{})
+	changed["query"] = "vector(0)"
+	if alertPolicyUpToDate(existing, desired) {
+		t.Error("expected policy with changed query to need an update")
+	}
+}
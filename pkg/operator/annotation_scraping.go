@@ -0,0 +1,113 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/config"
+	prommodel "github.com/prometheus/common/model"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
+	discoverykube "github.com/prometheus/prometheus/discovery/kubernetes"
+	"github.com/prometheus/prometheus/model/relabel"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// makeAnnotationScrapeConfigs generates the scrape job for pods carrying the
+// conventional prometheus.io/scrape annotation. The job follows the widely
+// adopted relabeling recipe for annotation-based discovery: the port, path,
+// and scheme annotations override the discovered target where present. Pods
+// are discovered like regular workload targets, so each collector only
+// scrapes the annotated pods on its own node.
+func makeAnnotationScrapeConfigs(cfg *monitoringv1.AnnotationScraping) ([]*promconfig.ScrapeConfig, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	interval, err := prommodel.ParseDuration(cfg.Interval)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid scrape interval")
+	}
+	discoveryCfgs := discovery.Configs{
+		&discoverykube.SDConfig{
+			HTTPClientConfig:   config.DefaultHTTPClientConfig,
+			Role:               discoverykube.RolePod,
+			NamespaceDiscovery: discoverykube.NamespaceDiscovery{Names: cfg.Namespaces},
+			// Drop all potential targets not on the same node as the collector.
+			Selectors: []discoverykube.SelectorConfig{
+				{
+					Role:  discoverykube.RolePod,
+					Field: fmt.Sprintf("spec.nodeName=$(%s)", monitoringv1.EnvVarNodeName),
+				},
+			},
+		},
+	}
+	relabelCfgs := []*relabel.Config{
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_annotation_prometheus_io_scrape"},
+			Regex:        relabel.MustNewRegexp("true"),
+		},
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_annotation_prometheus_io_scheme"},
+			Regex:        relabel.MustNewRegexp("(https?)"),
+			TargetLabel:  "__scheme__",
+		},
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_annotation_prometheus_io_path"},
+			Regex:        relabel.MustNewRegexp("(.+)"),
+			TargetLabel:  "__metrics_path__",
+		},
+		// Where a port annotation is present, redirect all target candidates of
+		// the pod to the annotated port, collapsing them into a single target.
+		// Otherwise every declared container port is scraped, per convention.
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__address__", "__meta_kubernetes_pod_annotation_prometheus_io_port"},
+			Regex:        relabel.MustNewRegexp(`([^:]+)(?::\d+)?;(\d+)`),
+			Replacement:  "$1:$2",
+			TargetLabel:  "__address__",
+		},
+		{
+			Action:      relabel.Replace,
+			Replacement: "annotations",
+			TargetLabel: "job",
+		},
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_namespace"},
+			TargetLabel:  "namespace",
+		},
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_name"},
+			TargetLabel:  "pod",
+		},
+	}
+	return []*promconfig.ScrapeConfig{
+		{
+			JobName:                 "annotations/metrics",
+			ServiceDiscoveryConfigs: discoveryCfgs,
+			ScrapeInterval:          interval,
+			MetricsPath:             "/metrics",
+			RelabelConfigs:          relabelCfgs,
+			SampleLimit:             uint(cfg.SampleLimit),
+		},
+	}, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"github.com/pkg/errors"
+	prommodel "github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery"
+)
+
+func init() {
+	discovery.RegisterConfig(&HTTPSDConfig{})
+}
+
+// HTTPSDConfig is a minimal version of Prometheus's HTTP service discovery
+// configuration, which is not part of the vendored discovery packages. It
+// only carries the fields the operator generates and exists solely so
+// generated configs marshal into the http_sd_configs field the collector's
+// full implementation interprets.
+// +k8s:deepcopy-gen=false
+type HTTPSDConfig struct {
+	// URL from which targets are fetched.
+	URL string `yaml:"url"`
+	// Interval at which the target list is refetched.
+	RefreshInterval prommodel.Duration `yaml:"refresh_interval,omitempty"`
+}
+
+// Name implements the discovery.Config interface.
+func (*HTTPSDConfig) Name() string { return "http" }
+
+// NewDiscoverer implements the discovery.Config interface. The operator only
+// generates configuration and never instantiates discovery from it.
+func (*HTTPSDConfig) NewDiscoverer(discovery.DiscovererOptions) (discovery.Discoverer, error) {
+	return nil, errors.New("HTTP service discovery is not implemented in the operator")
+}
@@ -75,6 +75,16 @@ func OperatorConfigResource() metav1.GroupVersionResource {
 	}
 }
 
+// CollectionOverrideResource returns a CollectionOverride GroupVersionResource.
+// This can be used to enforce API types.
+func CollectionOverrideResource() metav1.GroupVersionResource {
+	return metav1.GroupVersionResource{
+		Group:    monitoring.GroupName,
+		Version:  Version,
+		Resource: "collectionoverrides",
+	}
+}
+
 // GlobalRulesResource returns a GlobalRules GroupVersionResource.
 // This can be used to enforce API types.
 func GlobalRulesResource() metav1.GroupVersionResource {
@@ -120,6 +130,14 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&GlobalRulesList{},
 		&OperatorConfig{},
 		&OperatorConfigList{},
+		&CollectionOverride{},
+		&CollectionOverrideList{},
+		&GrafanaDatasourceSync{},
+		&GrafanaDatasourceSyncList{},
+		&Dashboard{},
+		&DashboardList{},
+		&ClusterStaticMonitoring{},
+		&ClusterStaticMonitoringList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
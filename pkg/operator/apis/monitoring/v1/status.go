@@ -0,0 +1,112 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types used in the status of the monitoring CRDs.
+const (
+	// ConfigurationCreateSuccess indicates that the configuration generated
+	// from the monitoring resource was created successfully.
+	ConfigurationCreateSuccess = "ConfigurationCreateSuccess"
+	// NoTargetCollision indicates that the monitoring resource does not select
+	// pods and ports that another monitoring resource may also select, which
+	// would cause duplicate series and write conflicts.
+	NoTargetCollision = "NoTargetCollision"
+	// ReconcileSuccess indicates that all resources the operator derives from
+	// the resource were applied successfully.
+	ReconcileSuccess = "ReconcileSuccess"
+	// AlertmanagerConfigValid indicates that the provided Alertmanager
+	// configuration could be loaded. While it is false, the managed
+	// Alertmanager keeps serving the last valid configuration.
+	AlertmanagerConfigValid = "AlertmanagerConfigValid"
+)
+
+// Reasons used in the status conditions of the monitoring CRDs.
+const (
+	ReasonConfigurationCreated = "ConfigurationCreated"
+	ReasonValidationError      = "ValidationError"
+	ReasonScrapeConfigError    = "ScrapeConfigError"
+	ReasonRuleGenerationError  = "RuleGenerationError"
+	ReasonAlertPolicySyncError = "AlertPolicySyncError"
+	ReasonNoCollision          = "NoCollision"
+	ReasonTargetCollision      = "TargetCollision"
+	ReasonReconciled           = "Reconciled"
+	ReasonReconcileError       = "ReconcileError"
+	ReasonConfigValid          = "ConfigValid"
+	ReasonConfigInvalid        = "ConfigInvalid"
+)
+
+var errInvalidCond = fmt.Errorf("condition needs 'Type', 'Status', and 'Reason' fields set")
+
+// MonitoringStatus is the standardized status shared across the monitoring
+// CRDs. Conditions follow the metav1.Condition conventions, including per
+// condition observed generations, so generic tooling such as kstatus or Argo
+// health checks can assess resource state.
+type MonitoringStatus struct {
+	// The generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Represents the latest available observations of the resource's state.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// SetMonitoringCondition merges the given condition into the status. It
+// reports whether the status changed in a way that must be written back,
+// which is the case if the resource generation changed since the last
+// update, the condition is new, or its status transitioned.
+// LastTransitionTime is carried over from the previous condition unless the
+// status transitioned.
+func (s *MonitoringStatus) SetMonitoringCondition(gen int64, now metav1.Time, cond metav1.Condition) (bool, error) {
+	if cond.Type == "" || cond.Status == "" || cond.Reason == "" {
+		return false, errInvalidCond
+	}
+	change := s.ObservedGeneration != gen
+
+	cond.ObservedGeneration = gen
+	cond.LastTransitionTime = now
+
+	found := false
+	for i, c := range s.Conditions {
+		if c.Type != cond.Type {
+			continue
+		}
+		found = true
+		if c.Status == cond.Status {
+			cond.LastTransitionTime = c.LastTransitionTime
+		} else {
+			change = true
+		}
+		s.Conditions[i] = cond
+	}
+	if !found {
+		s.Conditions = append(s.Conditions, cond)
+		change = true
+	}
+	if change {
+		s.ObservedGeneration = gen
+		// Sort conditions by type to produce a deterministic status.
+		sort.Slice(s.Conditions, func(i, j int) bool {
+			return s.Conditions[i].Type < s.Conditions[j].Type
+		})
+	}
+	return change, nil
+}
@@ -16,10 +16,14 @@ package v1
 
 import (
 	"fmt"
+	"net"
 	"net/url"
+	"path"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/config"
@@ -27,24 +31,23 @@ import (
 	promconfig "github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/discovery"
 	discoverykube "github.com/prometheus/prometheus/discovery/kubernetes"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
 	"github.com/prometheus/prometheus/model/relabel"
 	yaml "gopkg.in/yaml.v2"
-	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
-)
-
-var (
-	errInvalidCond = fmt.Errorf("condition needs both 'Type' and 'Status' fields set")
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/googleauth"
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/scrapeguard"
 )
 
 // OperatorConfig defines configuration of the gmp-operator.
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
 // +kubebuilder:storageversion
 type OperatorConfig struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -56,6 +59,22 @@ type OperatorConfig struct {
 	// ManagedAlertmanager holds information for configuring the managed instance of Alertmanager.
 	// +kubebuilder:default={configSecret: {name: alertmanager, key: alertmanager.yaml}}
 	ManagedAlertmanager *ManagedAlertmanagerSpec `json:"managedAlertmanager,omitempty"`
+	// ManagedPushGateway holds information for configuring the optional managed
+	// push-gateway for metrics pushed by ephemeral workloads such as Jobs and CronJobs.
+	ManagedPushGateway *PushGatewaySpec `json:"managedPushGateway,omitempty"`
+	// ManagedExporter holds information for configuring the optional standalone
+	// exporter that tails the write-ahead log of a self-managed Prometheus
+	// server and exports its samples to GCM.
+	ManagedExporter *ExporterSidecarSpec `json:"managedExporter,omitempty"`
+	// ManagedOTLPReceiver holds information for configuring the optional managed
+	// OTLP receiver for metrics pushed by OpenTelemetry-instrumented applications.
+	ManagedOTLPReceiver *OTLPReceiverSpec `json:"managedOTLPReceiver,omitempty"`
+	// Proxy specifies egress proxy and trusted CA settings that the operator
+	// injects into all pods it manages, including its own.
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+	// Most recently observed status of the operator's reconciliation.
+	// +optional
+	Status MonitoringStatus `json:"status,omitempty"`
 }
 
 // OperatorConfigList is a list of OperatorConfigs.
@@ -66,6 +85,46 @@ type OperatorConfigList struct {
 	Items           []OperatorConfig `json:"items"`
 }
 
+// CollectionOverride adjusts collection defaults for the namespace it is
+// created in. It allows teams to tune collection of their own workloads
+// without requiring write access to the cluster-scoped OperatorConfig.
+// Settings in the OperatorConfig, such as namespace budgets, take precedence
+// over overrides.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:storageversion
+type CollectionOverride struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Specification of collection overrides for the namespace.
+	Spec CollectionOverrideSpec `json:"spec"`
+}
+
+// CollectionOverrideList is a list of CollectionOverrides.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type CollectionOverrideList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CollectionOverride `json:"items"`
+}
+
+// CollectionOverrideSpec adjusts how data from PodMonitorings in the
+// override's namespace is collected. ClusterPodMonitorings and
+// operator-managed scrape targets are not affected.
+type CollectionOverrideSpec struct {
+	// ScrapeInterval replaces the scrape interval of all scrape jobs generated
+	// from PodMonitorings in the namespace. Scrape timeouts exceeding the new
+	// interval are reduced to it.
+	ScrapeInterval string `json:"scrapeInterval,omitempty"`
+	// ExternalLabels are attached to all data scraped in the namespace. Labels
+	// the managed collection relies on (project_id, location, cluster,
+	// namespace, job, instance) as well as external labels set in the
+	// OperatorConfig cannot be overridden.
+	ExternalLabels map[string]string `json:"externalLabels,omitempty"`
+	// Filter limits which data scraped in the namespace is retained.
+	Filter ExportFilters `json:"filter,omitempty"`
+}
+
 // RuleEvaluatorSpec defines configuration for deploying rule-evaluator.
 type RuleEvaluatorSpec struct {
 	// ExternalLabels specifies external labels that are attached to any rule
@@ -79,6 +138,16 @@ type RuleEvaluatorSpec struct {
 	// The base URL used for the generator URL in the alert notification payload.
 	// Should point to an instance of a query frontend that gives access to queryProjectID.
 	GeneratorURL string `json:"generatorUrl,omitempty"`
+	// QueryEndpoint is the base URL of the GCM API rules are evaluated
+	// against. If empty, the global https://monitoring.googleapis.com endpoint
+	// is used. Set a regional endpoint, e.g.
+	// https://us-central1-monitoring.googleapis.com, to satisfy data-residency
+	// requirements or reduce cross-region latency.
+	QueryEndpoint string `json:"queryEndpoint,omitempty"`
+	// ExportEndpoint is the GCM API endpoint rule results are sent to, in
+	// host:port form. If empty, the global monitoring.googleapis.com:443
+	// endpoint is used.
+	ExportEndpoint string `json:"exportEndpoint,omitempty"`
 	// Alerting contains how the rule-evaluator configures alerting.
 	Alerting AlertingSpec `json:"alerting,omitempty"`
 	// A reference to GCP service account credentials with which the rule
@@ -88,6 +157,9 @@ type RuleEvaluatorSpec struct {
 	// Within GKE, this can typically be left empty if the compute default
 	// service account has the required permissions.
 	Credentials *v1.SecretKeySelector `json:"credentials,omitempty"`
+	// ExtraMounts lists additional Secrets and ConfigMaps from the operator
+	// namespace that are mounted into the rule-evaluator pods.
+	ExtraMounts []ExtraMount `json:"extraMounts,omitempty"`
 }
 
 // CollectionSpec specifies how the operator configures collection of metric data.
@@ -106,19 +178,215 @@ type CollectionSpec struct {
 	Credentials *v1.SecretKeySelector `json:"credentials,omitempty"`
 	// Configuration to scrape the metric endpoints of the Kubelets.
 	KubeletScraping *KubeletScraping `json:"kubeletScraping,omitempty"`
+	// Configuration to scrape the metric endpoints the control plane exposes
+	// within the cluster.
+	ControlPlaneScraping *ControlPlaneScraping `json:"controlPlaneScraping,omitempty"`
+	// Configuration for a kube-state-metrics instance the operator deploys
+	// and scrapes alongside the collectors.
+	KubeStateMetrics *KubeStateMetricsSpec `json:"kubeStateMetrics,omitempty"`
+	// Configuration for a node-exporter DaemonSet the operator deploys and
+	// scrapes alongside the collectors.
+	NodeExporter *NodeExporterSpec `json:"nodeExporter,omitempty"`
+	// Configuration to scrape the merged metrics endpoints of Istio sidecar
+	// proxies.
+	IstioSidecarScraping *IstioSidecarScraping `json:"istioSidecarScraping,omitempty"`
+	// Configuration for a DCGM exporter DaemonSet the operator deploys on
+	// GPU nodes and scrapes alongside the collectors.
+	DCGMExporter *DCGMExporterSpec `json:"dcgmExporter,omitempty"`
+	// Configuration to scrape all pods carrying the conventional
+	// prometheus.io/scrape annotations without requiring a PodMonitoring.
+	AnnotationScraping *AnnotationScraping `json:"annotationScraping,omitempty"`
+	// LocalStorage bounds the local short-term storage of the collectors,
+	// which only buffers collected data transiently for export.
+	LocalStorage *LocalStorageSpec `json:"localStorage,omitempty"`
 	// Compression enables compression of metrics collection data
 	Compression CompressionType `json:"compression,omitempty"`
+	// RemoteWrite enables writing all collected data, or the subset selected by
+	// the filter, to an additional user-run Prometheus-compatible endpoint
+	// alongside the export to Cloud Monitoring, e.g. during migration periods.
+	RemoteWrite *RemoteWriteSpec `json:"remoteWrite,omitempty"`
+	// CredentialVolumes lists volumes provided by the Secrets Store CSI driver
+	// that are mounted into the collector pods. Scrape configurations may
+	// reference credential files below the mount paths, allowing credentials
+	// to come from external secret providers instead of Kubernetes Secrets.
+	CredentialVolumes []CredentialVolume `json:"credentialVolumes,omitempty"`
+	// ExtraMounts lists additional Secrets and ConfigMaps from the operator
+	// namespace that are mounted into the collector pods, e.g. custom CA
+	// bundles, proxy certificates, or auth files referenced by scrape
+	// configurations.
+	ExtraMounts []ExtraMount `json:"extraMounts,omitempty"`
+	// NamespaceBudgets constrains ingestion from individual target namespaces.
+	NamespaceBudgets []NamespaceBudget `json:"namespaceBudgets,omitempty"`
+	// ExportEndpoint is the GCM API endpoint collected metric data is sent to,
+	// in host:port form. If empty, the global monitoring.googleapis.com:443
+	// endpoint is used. Set a regional endpoint, e.g.
+	// us-central1-monitoring.googleapis.com:443, to satisfy data-residency
+	// requirements or reduce cross-region latency.
+	ExportEndpoint string `json:"exportEndpoint,omitempty"`
+}
+
+// NamespaceBudget defines an ingestion budget for a single target namespace.
+type NamespaceBudget struct {
+	// Namespace the budget applies to.
+	Namespace string `json:"namespace"`
+	// SampleLimit caps the number of samples a single scrape of any target in
+	// the namespace may return. Scrapes exceeding the limit fail entirely.
+	// It is applied as the sample limit of all scrape jobs generated from
+	// PodMonitorings in the namespace. ClusterPodMonitorings are not subject
+	// to namespace budgets.
+	SampleLimit uint64 `json:"sampleLimit,omitempty"`
+	// MaxSeries caps the number of active series of the namespace across all
+	// collectors. Exceeding it does not drop data but is surfaced through the
+	// prometheus_engine_operator_namespace_series_over_budget metric, which
+	// alerting rules can act on.
+	MaxSeries int64 `json:"maxSeries,omitempty"`
+}
+
+// CredentialVolume describes a single Secrets Store CSI volume mounted into
+// the collector pods.
+type CredentialVolume struct {
+	// Name of the volume. Must be unique within the spec.
+	Name string `json:"name"`
+	// Name of the SecretProviderClass in the operator namespace that
+	// describes the secrets to mount.
+	SecretProviderClass string `json:"secretProviderClass"`
+	// Path the volume is mounted under. Defaults to
+	// "/etc/secrets-store/<name>".
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// ExtraMount describes a single additional Secret or ConfigMap volume
+// mounted into a managed workload.
+type ExtraMount struct {
+	// Name of the volume. Must be unique within the spec.
+	Name string `json:"name"`
+	// Name of a Secret in the operator namespace to mount. Exactly one of
+	// secret and configMap must be set.
+	Secret string `json:"secret,omitempty"`
+	// Name of a ConfigMap in the operator namespace to mount. Exactly one of
+	// secret and configMap must be set.
+	ConfigMap string `json:"configMap,omitempty"`
+	// Path the volume is mounted under. Defaults to "/etc/gmp-mounts/<name>".
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// RemoteWriteSpec configures mirroring collected data to a Prometheus-compatible
+// remote-write endpoint.
+type RemoteWriteSpec struct {
+	// The URL of the endpoint to send samples to.
+	URL string `json:"url"`
+	// Filter limits which metric data is sent, using the same selector format
+	// as export filters. Negated matchers are not supported. If empty, all
+	// data is sent.
+	Filter ExportFilters `json:"filter,omitempty"`
 }
 
 // +kubebuilder:validation:Enum=none;gzip
 type CompressionType string
 
+// LocalStorageSpec bounds the local TSDB and WAL of the collectors. Local
+// data is only needed until it has been exported to Cloud Monitoring, so
+// tight bounds prevent disk pressure on busy nodes. Old data is deleted
+// automatically once a bound is exceeded.
+type LocalStorageSpec struct {
+	// Retention is the maximum age of locally stored data, e.g. "30m". Must
+	// be a valid Prometheus duration. If empty, the retention configured in
+	// the collector manifest applies.
+	Retention string `json:"retention,omitempty"`
+	// RetentionSize is the maximum total size of locally stored data, e.g.
+	// "512MB". Supported units are B, KB, MB, GB, TB, PB, and EB. If empty,
+	// the size is not bounded.
+	RetentionSize string `json:"retentionSize,omitempty"`
+}
+
 // KubeletScraping allows enabling scraping of the Kubelets' metric endpoints.
 type KubeletScraping struct {
 	// The interval at which the metric endpoints are scraped.
 	Interval string `json:"interval"`
 }
 
+// KubeStateMetricsSpec configures a kube-state-metrics instance that the
+// operator deploys at a pinned version and with bounded resources, replacing
+// the hand-rolled installations most users wire up themselves today.
+type KubeStateMetricsSpec struct {
+	// The interval at which kube-state-metrics is scraped.
+	Interval string `json:"interval"`
+	// A list of regular expressions for the names of the metrics to collect.
+	// If empty, a curated allowlist of the most commonly used metrics is
+	// applied. kube-state-metrics exposes a metric per object, so widening
+	// the list on large clusters directly increases ingestion costs.
+	MetricAllowlist []string `json:"metricAllowlist,omitempty"`
+}
+
+// NodeExporterSpec configures a node-exporter DaemonSet that the operator
+// deploys at a pinned version and upgrades with its own releases. Only a
+// curated, cost-conscious set of hardware and OS collectors is enabled by
+// default.
+type NodeExporterSpec struct {
+	// The interval at which node-exporter is scraped.
+	Interval string `json:"interval"`
+	// The node-exporter collectors to enable. All other collectors are
+	// disabled. If empty, a curated default set covering CPU, memory, disk,
+	// filesystem, network, and load metrics is enabled.
+	EnabledCollectors []string `json:"enabledCollectors,omitempty"`
+}
+
+// AnnotationScraping allows enabling scraping of all pods that carry the
+// conventional prometheus.io/scrape annotation, honoring the port, path, and
+// scheme annotations. It is intended for clusters migrating wholesale from
+// annotation-based setups; new deployments should prefer PodMonitorings,
+// which provide per-workload scrape settings and status reporting.
+type AnnotationScraping struct {
+	// The interval at which annotated pods are scraped.
+	Interval string `json:"interval"`
+	// The namespaces in which annotated pods are discovered. If empty, pods
+	// are discovered across all namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// SampleLimit caps the number of samples a single scrape of an annotated
+	// pod may return. Scrapes exceeding the limit fail entirely, bounding the
+	// ingestion cost a single workload can cause by adding the annotation.
+	SampleLimit uint64 `json:"sampleLimit,omitempty"`
+}
+
+// DCGMExporterSpec configures a DCGM exporter DaemonSet that the operator
+// deploys at a pinned version on nodes with attached accelerators, exposing
+// NVIDIA GPU utilization, memory, temperature, and error metrics.
+type DCGMExporterSpec struct {
+	// The interval at which the DCGM exporter is scraped.
+	Interval string `json:"interval"`
+	// A list of regular expressions for the names of the metrics to collect.
+	// If empty, a curated allowlist of the most commonly used GPU metrics is
+	// applied. DCGM exposes a metric per GPU, so widening the list on large
+	// accelerator pools directly increases ingestion costs.
+	MetricAllowlist []string `json:"metricAllowlist,omitempty"`
+}
+
+// IstioSidecarScraping allows enabling scraping of the merged metrics
+// endpoints of Istio sidecar proxies. Injected pods are discovered through
+// the status annotation the sidecar injector sets, so no PodMonitoring with
+// hand-written port and relabeling configuration is required. The sidecars
+// serve application and Envoy metrics merged on the pilot-agent endpoint.
+type IstioSidecarScraping struct {
+	// The interval at which the metric endpoints are scraped.
+	Interval string `json:"interval"`
+}
+
+// ControlPlaneScraping allows enabling scraping of the metric endpoints the
+// control plane exposes within the cluster. On GKE this covers the Kubernetes
+// API server, which is reachable through the `kubernetes` service in the
+// default namespace. The resulting targets follow the same label conventions
+// as the control plane metrics GKE provides natively, so dashboards do not
+// need to distinguish between the two sources.
+type ControlPlaneScraping struct {
+	// The interval at which the metric endpoints are scraped.
+	Interval string `json:"interval"`
+	// A list of Prometheus time series matchers. If non-empty, only series
+	// matching at least one of the matchers are collected. The API server
+	// exposes a large number of series, so restricting them is recommended
+	// to control costs.
+	MatchOneOf []string `json:"matchOneOf,omitempty"`
+}
+
 // ExportFilters provides mechanisms to filter the scraped data that's sent to GMP.
 type ExportFilters struct {
 	// A list Prometheus time series matchers. Every time series must match at least one
@@ -143,6 +411,63 @@ type ManagedAlertmanagerSpec struct {
 	ConfigSecret *v1.SecretKeySelector `json:"configSecret,omitempty"`
 }
 
+// PushGatewaySpec holds configuration information for the managed push-gateway.
+type PushGatewaySpec struct {
+	// Enabled scales the push-gateway Deployment up. While disabled the
+	// Deployment is kept at zero replicas.
+	Enabled bool `json:"enabled,omitempty"`
+	// TTL after which a metric group that received no further pushes is
+	// cleaned up, e.g. "30m". Defaults to the push-gateway's built-in default.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// ExporterSidecarSpec holds configuration for the optional standalone exporter
+// Deployment, which runs the export-sidecar binary against a self-managed
+// Prometheus server whose storage volume it shares.
+type ExporterSidecarSpec struct {
+	// Enabled scales the exporter Deployment up. While disabled the
+	// Deployment is kept at zero replicas.
+	Enabled bool `json:"enabled,omitempty"`
+	// StoragePath is the Prometheus TSDB storage path, as mounted into the
+	// exporter pod, whose write-ahead log is tailed.
+	StoragePath string `json:"storagePath,omitempty"`
+	// Endpoint is the base URL of the Prometheus server's API used for metric
+	// metadata lookup, e.g. "http://prometheus:9090".
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// OTLPReceiverSpec holds configuration for the optional managed OTLP receiver
+// Deployment, which accepts pushed OTLP metrics over HTTP and exports them to
+// GCM through the same pipeline as scraped data.
+type OTLPReceiverSpec struct {
+	// Enabled scales the otlp-receiver Deployment up. While disabled the
+	// Deployment is kept at zero replicas.
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// ProxyConfig specifies the egress proxy environment and additional trusted
+// CA certificates for the pods managed by the operator, for clusters whose
+// outbound traffic must pass through an HTTP proxy.
+type ProxyConfig struct {
+	// HTTPProxy is the proxy URL set as the HTTP_PROXY environment variable
+	// in the managed pods.
+	HTTPProxy string `json:"httpProxy,omitempty"`
+	// HTTPSProxy is the proxy URL set as the HTTPS_PROXY environment variable
+	// in the managed pods. Defaults to the value of HTTPProxy.
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	// NoProxy is a comma-separated list of hosts and CIDRs that are reached
+	// directly, set as the NO_PROXY environment variable in the managed pods.
+	// It should generally include the cluster-internal service and pod
+	// networks and the metadata server.
+	NoProxy string `json:"noProxy,omitempty"`
+	// TrustedCA references a ConfigMap key in the operator namespace holding
+	// a PEM bundle of additional trusted CA certificates, e.g. the proxy's
+	// certificate authority. The bundle is mounted into the managed pods and
+	// replaces the system roots via SSL_CERT_FILE, so any public CAs the
+	// components rely on must be part of the bundle as well.
+	TrustedCA *v1.ConfigMapKeySelector `json:"trustedCA,omitempty"`
+}
+
 // AlertmanagerEndpoints defines a selection of a single Endpoints object
 // containing alertmanager IPs to fire alerts against.
 type AlertmanagerEndpoints struct {
@@ -200,11 +525,36 @@ type SecretOrConfigMap struct {
 	ConfigMap *v1.ConfigMapKeySelector `json:"configMap,omitempty"`
 }
 
+// SecretsDir is the directory under which the operator makes Secret and
+// ConfigMap data referenced by monitoring resources available to the managed
+// components.
+const SecretsDir = "/etc/secrets"
+
+// PathForSelector returns the filename under which the operator distributes
+// the data referenced by the selector to the managed components. The name
+// encodes the source kind, namespace, name, and key to avoid collisions of
+// like keys across resources.
+func PathForSelector(namespace string, scm *SecretOrConfigMap) string {
+	if scm == nil {
+		return ""
+	}
+	if scm.ConfigMap != nil {
+		return fmt.Sprintf("%s_%s_%s_%s", "configmap", namespace, scm.ConfigMap.Name, scm.ConfigMap.Key)
+	}
+	if scm.Secret != nil {
+		return fmt.Sprintf("%s_%s_%s_%s", "secret", namespace, scm.Secret.Name, scm.Secret.Key)
+	}
+	return ""
+}
+
 // PodMonitoring defines monitoring for a set of pods.
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:shortName=pmon
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="ConfigurationCreateSuccess")].status`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
 type PodMonitoring struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -228,9 +578,11 @@ type PodMonitoringList struct {
 // +genclient
 // +genclient:nonNamespaced
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
-// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:resource:scope=Cluster,shortName=cpmon
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="ConfigurationCreateSuccess")].status`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
 type ClusterPodMonitoring struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -256,7 +608,7 @@ func (cm *ClusterPodMonitoring) ValidateCreate() error {
 	}
 	// TODO(freinartz): extract validator into dedicated object (like defaulter). For now using
 	// example values has no adverse effects.
-	_, err := cm.ScrapeConfigs("test_project", "test_location", "test_cluster")
+	_, err := cm.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace")
 	return err
 }
 
@@ -270,9 +622,12 @@ func (cm *ClusterPodMonitoring) ValidateDelete() error {
 	return nil
 }
 
-func (cm *ClusterPodMonitoring) ScrapeConfigs(projectID, location, cluster string) (res []*promconfig.ScrapeConfig, err error) {
+func (cm *ClusterPodMonitoring) ScrapeConfigs(projectID, location, cluster, pubNamespace string) (res []*promconfig.ScrapeConfig, err error) {
+	if err := validateEndpointInstanceNaming(cm.Spec.Endpoints); err != nil {
+		return nil, err
+	}
 	for i := range cm.Spec.Endpoints {
-		c, err := cm.endpointScrapeConfig(i, projectID, location, cluster)
+		c, err := cm.endpointScrapeConfig(i, projectID, location, cluster, pubNamespace)
 		if err != nil {
 			return nil, errors.Wrapf(err, "invalid definition for endpoint with index %d", i)
 		}
@@ -287,7 +642,7 @@ func (pm *PodMonitoring) ValidateCreate() error {
 	}
 	// TODO(freinartz): extract validator into dedicated object (like defaulter). For now using
 	// example values has no adverse effects.
-	_, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster")
+	_, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace")
 	return err
 }
 
@@ -302,9 +657,12 @@ func (pm *PodMonitoring) ValidateDelete() error {
 }
 
 // ScrapeConfigs generated Prometheus scrape configs for the PodMonitoring.
-func (pm *PodMonitoring) ScrapeConfigs(projectID, location, cluster string) (res []*promconfig.ScrapeConfig, err error) {
+func (pm *PodMonitoring) ScrapeConfigs(projectID, location, cluster, pubNamespace string) (res []*promconfig.ScrapeConfig, err error) {
+	if err := validateEndpointInstanceNaming(pm.Spec.Endpoints); err != nil {
+		return nil, err
+	}
 	for i := range pm.Spec.Endpoints {
-		c, err := pm.endpointScrapeConfig(i, projectID, location, cluster)
+		c, err := pm.endpointScrapeConfig(i, projectID, location, cluster, pubNamespace)
 		if err != nil {
 			return nil, errors.Wrapf(err, "invalid definition for endpoint with index %d", i)
 		}
@@ -313,77 +671,44 @@ func (pm *PodMonitoring) ScrapeConfigs(projectID, location, cluster string) (res
 	return res, nil
 }
 
-// SetPodMonitoringCondition merges the provided PodMonitoring resource to the
-// along with the provided condition iff the resource generation has changed or there
-// is a status condition state transition.
-func (status *PodMonitoringStatus) SetPodMonitoringCondition(gen int64, now metav1.Time, cond *MonitoringCondition) (bool, error) {
-	var (
-		specChanged              = status.ObservedGeneration != gen
-		statusTransition, update bool
-		conds                    = make(map[MonitoringConditionType]*MonitoringCondition)
-	)
-
-	if cond.Type == "" || cond.Status == "" {
-		return update, errInvalidCond
-	}
-
-	// Set up defaults.
-	for _, mc := range NewDefaultConditions(now) {
-		conds[mc.Type] = &mc
-	}
-	// Overwrite with any previous state.
-	for _, mc := range status.Conditions {
-		conds[mc.Type] = &mc
-	}
-
-	// Set some timestamp defaults if unspecified.
-	cond.LastUpdateTime = now
-
-	// Check if the condition results in a transition of status state.
-	if old := conds[cond.Type]; old.Status == cond.Status {
-		cond.LastTransitionTime = old.LastTransitionTime
-	} else {
-		cond.LastTransitionTime = cond.LastUpdateTime
-		statusTransition = true
-	}
-
-	// Set condition.
-	conds[cond.Type] = cond
-
-	// Only update status if the spec has changed (indicated by Generation field) or
-	// if this update transitions status state.
-	if specChanged || statusTransition {
-		update = true
-		status.ObservedGeneration = gen
-		status.Conditions = status.Conditions[:0]
-		for _, c := range conds {
-			status.Conditions = append(status.Conditions, *c)
-		}
-	}
-
-	return update, nil
-}
-
 // Environment variable for the current node that needs to be interpolated in generated
 // scrape configurations for a PodMonitoring resource.
 const EnvVarNodeName = "NODE_NAME"
 
-func (pm *PodMonitoring) endpointScrapeConfig(index int, projectID, location, cluster string) (*promconfig.ScrapeConfig, error) {
-	relabelCfgs := []*relabel.Config{
-		// Filter targets by namespace of the PodMonitoring configuration.
-		{
-			Action:       relabel.Keep,
-			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_namespace"},
-			Regex:        relabel.MustNewRegexp(pm.Namespace),
-		},
+// AnnotationScrapePriority optionally assigns a scrape priority to all
+// endpoints of a PodMonitoring or ClusterPodMonitoring resource. If memory
+// shedding is enabled on the collectors, scrape jobs are skipped in ascending
+// priority order under memory pressure. The value must be an integer.
+// Deprecated in favor of the priority field of the respective spec, which
+// takes precedence if both are set.
+const AnnotationScrapePriority = "monitoring.googleapis.com/scrape-priority"
+
+// scrapePriority returns the resource's scrape priority from the spec field,
+// falling back to the legacy annotation.
+func scrapePriority(specPriority int32, annotations map[string]string) (int, error) {
+	if specPriority != 0 {
+		return int(specPriority), nil
+	}
+	s, ok := annotations[AnnotationScrapePriority]
+	if !ok || s == "" {
+		return 0, nil
+	}
+	p, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.Wrapf(err, "scrape priority %q must be an integer", s)
 	}
+	return p, nil
+}
 
+func (pm *PodMonitoring) endpointScrapeConfig(index int, projectID, location, cluster, pubNamespace string) (*promconfig.ScrapeConfig, error) {
+	// Targets are restricted to the namespace of the PodMonitoring configuration
+	// through namespaced service discovery.
+	//
 	// Filter targets that belong to selected pods.
-	selectors, err := relabelingsForSelector(pm.Spec.Selector)
+	relabelCfgs, err := relabelingsForSelector(pm.Spec.Selector)
 	if err != nil {
 		return nil, err
 	}
-	relabelCfgs = append(relabelCfgs, selectors...)
 
 	metadataLabels := map[string]struct{}{}
 	// The metadata list must be always set in general but we allow the null case
@@ -404,22 +729,44 @@ func (pm *PodMonitoring) endpointScrapeConfig(index int, projectID, location, cl
 		SourceLabels: prommodel.LabelNames{"__meta_kubernetes_namespace"},
 		TargetLabel:  "namespace",
 	})
+	jobName, err := exportedJobName(pm.Name, pm.Spec.JobName)
+	if err != nil {
+		return nil, err
+	}
 	relabelCfgs = append(relabelCfgs, &relabel.Config{
 		Action:      relabel.Replace,
-		Replacement: pm.Name,
+		Replacement: jobName,
 		TargetLabel: "job",
 	})
+	priority, err := scrapePriority(pm.Spec.Priority, pm.Annotations)
+	if err != nil {
+		return nil, err
+	}
 
 	return endpointScrapeConfig(
 		fmt.Sprintf("PodMonitoring/%s/%s", pm.Namespace, pm.Name),
-		projectID, location, cluster,
+		projectID, location, cluster, pubNamespace,
 		pm.Spec.Endpoints[index],
 		relabelCfgs,
 		pm.Spec.TargetLabels.FromPod,
 		pm.Spec.Limits,
+		[]string{pm.Namespace},
+		priority,
 	)
 }
 
+// exportedJobName returns the value of the exported job label, i.e. the
+// resource name unless an explicit override was configured.
+func exportedJobName(resourceName, override string) (string, error) {
+	if override == "" {
+		return resourceName, nil
+	}
+	if !prommodel.LabelValue(override).IsValid() {
+		return "", errors.Errorf("job name %q is not a valid label value", override)
+	}
+	return override, nil
+}
+
 // relabelingsForSelector generates a sequence of relabeling rules that implement
 // the label selector for the meta labels produced by the Kubernetes service discovery.
 func relabelingsForSelector(selector metav1.LabelSelector) ([]*relabel.Config, error) {
@@ -485,15 +832,105 @@ func relabelingsForSelector(selector metav1.LabelSelector) ([]*relabel.Config, e
 	return relabelCfgs, nil
 }
 
-func endpointScrapeConfig(id, projectID, location, cluster string, ep ScrapeEndpoint, relabelCfgs []*relabel.Config, podLabels []LabelMapping, limits *ScrapeLimits) (*promconfig.ScrapeConfig, error) {
+// relabelingsForInstance generates the relabeling rules deriving the primary
+// identifier of the instance label into the temporary __tmp_instance label,
+// from which the final instance label including the port is built.
+// By default the pod name is used as it provides a better user experience on
+// dashboards which template on the instance label and expect it to have
+// meaningful value, such as common node exporter dashboards. Pods controlled
+// by a DaemonSet use the node name instead.
+func relabelingsForInstance(naming string) ([]*relabel.Config, error) {
+	switch naming {
+	case "", "default":
+		return []*relabel.Config{
+			{
+				Action:       relabel.Replace,
+				SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_name"},
+				TargetLabel:  "__tmp_instance",
+			},
+			{
+				Action:       relabel.Replace,
+				SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_controller_kind", "__meta_kubernetes_pod_node_name"},
+				Regex:        relabel.MustNewRegexp(`DaemonSet;(.*)`),
+				TargetLabel:  "__tmp_instance",
+				Replacement:  "$1",
+			},
+		}, nil
+	case "pod":
+		return []*relabel.Config{{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_name"},
+			TargetLabel:  "__tmp_instance",
+		}}, nil
+	case "node":
+		return []*relabel.Config{{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_node_name"},
+			TargetLabel:  "__tmp_instance",
+		}}, nil
+	case "podIP":
+		return []*relabel.Config{{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_ip"},
+			TargetLabel:  "__tmp_instance",
+		}}, nil
+	}
+	return nil, errors.Errorf("instance naming %q not allowed, must be one of %v", naming, []string{"default", "pod", "node", "podIP"})
+}
+
+// instanceNamingsMayCollide reports whether two instance naming settings may
+// derive the same instance value for targets of the same pod and port.
+func instanceNamingsMayCollide(a, b string) bool {
+	if a == "" {
+		a = "default"
+	}
+	if b == "" {
+		b = "default"
+	}
+	if a == b {
+		return true
+	}
+	// The default derivation uses either the pod or the node name, so it
+	// overlaps with both explicit settings.
+	return a == "default" && b != "podIP" || b == "default" && a != "podIP"
+}
+
+// validateEndpointInstanceNaming returns an error if two endpoints of the same
+// resource may derive identical instance labels. As they also share the job
+// label, such endpoints would produce write conflicts against Cloud Monitoring.
+func validateEndpointInstanceNaming(eps []ScrapeEndpoint) error {
+	for i := range eps {
+		for j := i + 1; j < len(eps); j++ {
+			if eps[i].Port != eps[j].Port {
+				continue
+			}
+			// Colliding endpoints on the same port predate the naming
+			// setting, e.g. scraping different paths of one port. Only
+			// reject combinations involving an explicit setting.
+			if eps[i].InstanceNaming == "" && eps[j].InstanceNaming == "" {
+				continue
+			}
+			if instanceNamingsMayCollide(eps[i].InstanceNaming, eps[j].InstanceNaming) {
+				return errors.Errorf("endpoints %d and %d may derive the same instance label for port %q", i, j, eps[i].Port.String())
+			}
+		}
+	}
+	return nil
+}
+
+func endpointScrapeConfig(id, projectID, location, cluster, pubNamespace string, ep ScrapeEndpoint, relabelCfgs []*relabel.Config, podLabels []LabelMapping, limits *ScrapeLimits, namespaces []string, priority int) (*promconfig.ScrapeConfig, error) {
 	// Configure how Prometheus talks to the Kubernetes API server to discover targets.
-	// This configuration is the same for all scrape jobs (esp. selectors).
-	// This ensures that Prometheus can reuse the underlying client and caches, which reduces
-	// load on the Kubernetes API server.
+	// This configuration is identical for all scrape jobs of the same scope (esp. selectors),
+	// which ensures that Prometheus can reuse the underlying client and caches. An empty
+	// namespace list discovers across all namespaces.
 	discoveryCfgs := discovery.Configs{
 		&discoverykube.SDConfig{
 			HTTPClientConfig: config.DefaultHTTPClientConfig,
 			Role:             discoverykube.RolePod,
+			// Restrict discovery to the namespaces of the originating resource. Watching
+			// individual namespaces rather than filtering a cluster-wide watch through
+			// relabeling reduces fan-out on the API server in large clusters.
+			NamespaceDiscovery: discoverykube.NamespaceDiscovery{Names: namespaces},
 			// Drop all potential targets not the same node as the collector. The $(NODE_NAME) variable
 			// is interpolated by the config reloader sidecar before the config reaches the Prometheus collector.
 			// Doing it through selectors rather than relabeling should substantially reduce the client and
@@ -524,28 +961,62 @@ func endpointScrapeConfig(id, projectID, location, cluster string, ep ScrapeEndp
 			TargetLabel: "cluster",
 			Replacement: cluster,
 		},
-		// Use the pod name as the primary identifier in the instance label. Unless the pod
-		// is controlled by a DaemonSet, in which case the node name will be used.
-		// This provides a better user experience on dashboards which template on the instance label
-		// and expect it to have meaningful value, such as common node exporter dashboards.
-		//
-		// Save the value in a temporary label and use it further down.
-		&relabel.Config{
-			Action:       relabel.Replace,
-			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_name"},
-			TargetLabel:  "__tmp_instance",
-		},
-		&relabel.Config{
-			Action:       relabel.Replace,
-			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_controller_kind", "__meta_kubernetes_pod_node_name"},
-			Regex:        relabel.MustNewRegexp(`DaemonSet;(.*)`),
-			TargetLabel:  "__tmp_instance",
-			Replacement:  "$1",
-		},
 	)
 
+	// Derive the primary identifier in the instance label per the endpoint's
+	// naming setting. Save the value in a temporary label and use it further down.
+	instanceCfgs, err := relabelingsForInstance(ep.InstanceNaming)
+	if err != nil {
+		return nil, err
+	}
+	relabelCfgs = append(relabelCfgs, instanceCfgs...)
+
 	// Filter targets by the configured port.
-	if ep.Port.StrVal != "" {
+	if ep.FromAnnotations {
+		if ep.Port.StrVal != "" || ep.Port.IntVal != 0 {
+			return nil, errors.New("port must not be set if fromAnnotations is enabled")
+		}
+		if ep.Container != "" {
+			return nil, errors.New("container may not be set if fromAnnotations is enabled")
+		}
+		// Only pods declaring their scrape port through the conventional
+		// annotation produce targets.
+		relabelCfgs = append(relabelCfgs, &relabel.Config{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_annotation_prometheus_io_port"},
+			Regex:        relabel.MustNewRegexp("(.+)"),
+		})
+		// As for numeric ports, collapse the target candidates generated per
+		// declared container port into a single target per pod, addressed
+		// through the annotated port. The container label must remain empty
+		// for the outputs to be identical.
+		relabelCfgs = append(relabelCfgs, &relabel.Config{
+			Action: relabel.LabelDrop,
+			Regex:  relabel.MustNewRegexp("container"),
+		})
+		relabelCfgs = append(relabelCfgs, &relabel.Config{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__tmp_instance", "__meta_kubernetes_pod_annotation_prometheus_io_port"},
+			Regex:        relabel.MustNewRegexp("(.+);(.+)"),
+			Replacement:  "$1:$2",
+			TargetLabel:  "instance",
+		})
+		relabelCfgs = append(relabelCfgs, &relabel.Config{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_ip", "__meta_kubernetes_pod_annotation_prometheus_io_port"},
+			Regex:        relabel.MustNewRegexp("(.+);(.+)"),
+			Replacement:  "$1:$2",
+			TargetLabel:  "__address__",
+		})
+		// Where present, the path annotation overrides the path configured on
+		// the endpoint.
+		relabelCfgs = append(relabelCfgs, &relabel.Config{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_annotation_prometheus_io_path"},
+			Regex:        relabel.MustNewRegexp("(.+)"),
+			TargetLabel:  "__metrics_path__",
+		})
+	} else if ep.Port.StrVal != "" {
 		portValue, err := relabel.NewRegexp(ep.Port.StrVal)
 		if err != nil {
 			return nil, errors.Wrapf(err, "invalid port name %q", ep.Port)
@@ -555,6 +1026,20 @@ func endpointScrapeConfig(id, projectID, location, cluster string, ep ScrapeEndp
 			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_container_port_name"},
 			Regex:        portValue,
 		})
+		// Named ports are matched across all containers of the pod. If multiple
+		// containers declare ports with the same name, the container field
+		// disambiguates which one to scrape.
+		if ep.Container != "" {
+			containerValue, err := relabel.NewRegexp(ep.Container)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid container name %q", ep.Container)
+			}
+			relabelCfgs = append(relabelCfgs, &relabel.Config{
+				Action:       relabel.Keep,
+				SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_container_name"},
+				Regex:        containerValue,
+			})
+		}
 		// The instance label being the pod name would be ideal UX-wise. But we cannot be certain
 		// that multiple metrics endpoints on a pod don't expose metrics with the same name. Thus
 		// we have to disambiguate along the port as well.
@@ -566,6 +1051,11 @@ func endpointScrapeConfig(id, projectID, location, cluster string, ep ScrapeEndp
 			TargetLabel:  "instance",
 		})
 	} else if ep.Port.IntVal != 0 {
+		// Numeric ports produce a single merged target per pod with no
+		// container association, so restricting to a container cannot work.
+		if ep.Container != "" {
+			return nil, errors.New("container may only be set if the port is referenced by name")
+		}
 		// Prometheus generates a target candidate for each declared port in a pod.
 		// If a container in a pod has no declared port, a single target candidate is generated for
 		// that container.
@@ -653,11 +1143,49 @@ func endpointScrapeConfig(id, projectID, location, cluster string, ep ScrapeEndp
 		// Initialize from default as encode/decode does not work correctly with the type definition.
 		httpCfg.ProxyURL.URL = proxyURL
 	}
+	if ep.GoogleIAMAuth != nil {
+		credentialsFile, err := ep.GoogleIAMAuth.credentialsFile()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid Google IAM authorization")
+		}
+		httpCfg.Authorization = &config.Authorization{
+			Type:            "Bearer",
+			CredentialsFile: credentialsFile,
+		}
+	}
+	if ep.TLS != nil {
+		// The referenced data is copied into the collector secret by the
+		// operator and mounted at well-known paths.
+		tlsCfg := config.TLSConfig{
+			InsecureSkipVerify: ep.TLS.InsecureSkipVerify,
+			ServerName:         ep.TLS.ServerName,
+		}
+		if ep.TLS.CA != nil {
+			tlsCfg.CAFile = path.Join(SecretsDir, PathForSelector(pubNamespace, ep.TLS.CA))
+		}
+		if ep.TLS.Cert != nil {
+			tlsCfg.CertFile = path.Join(SecretsDir, PathForSelector(pubNamespace, ep.TLS.Cert))
+		}
+		if ep.TLS.KeySecret != nil {
+			tlsCfg.KeyFile = path.Join(SecretsDir, PathForSelector(pubNamespace, &SecretOrConfigMap{Secret: ep.TLS.KeySecret}))
+		}
+		httpCfg.TLSConfig = tlsCfg
+	}
+
+	// Generate a job name to make it easy to track what generated the scrape configuration.
+	// The actual job label attached to its metrics is overwritten via relabeling.
+	jobName := fmt.Sprintf("%s/%s", id, &ep.Port)
+	if ep.FromAnnotations {
+		jobName = fmt.Sprintf("%s/annotations", id)
+	}
+	if priority != 0 {
+		// Encode the priority into the job name so the collector's scrape
+		// guard can recover it without a separate configuration channel.
+		jobName = scrapeguard.AppendPriority(jobName, priority)
+	}
 
 	scrapeCfg := &promconfig.ScrapeConfig{
-		// Generate a job name to make it easy to track what generated the scrape configuration.
-		// The actual job label attached to its metrics is overwritten via relabeling.
-		JobName:                 fmt.Sprintf("%s/%s", id, &ep.Port),
+		JobName:                 jobName,
 		ServiceDiscoveryConfigs: discoveryCfgs,
 		MetricsPath:             metricsPath,
 		Scheme:                  ep.Scheme,
@@ -721,7 +1249,7 @@ func relabelingsForMetadata(keys map[string]struct{}) (res []*relabel.Config) {
 	return res
 }
 
-func (cm *ClusterPodMonitoring) endpointScrapeConfig(index int, projectID, location, cluster string) (*promconfig.ScrapeConfig, error) {
+func (cm *ClusterPodMonitoring) endpointScrapeConfig(index int, projectID, location, cluster, pubNamespace string) (*promconfig.ScrapeConfig, error) {
 	// Filter targets that belong to selected pods.
 	relabelCfgs, err := relabelingsForSelector(cm.Spec.Selector)
 	if err != nil {
@@ -745,19 +1273,29 @@ func (cm *ClusterPodMonitoring) endpointScrapeConfig(index int, projectID, locat
 	}
 	relabelCfgs = append(relabelCfgs, relabelingsForMetadata(metadataLabels)...)
 
+	jobName, err := exportedJobName(cm.Name, cm.Spec.JobName)
+	if err != nil {
+		return nil, err
+	}
 	relabelCfgs = append(relabelCfgs, &relabel.Config{
 		Action:      relabel.Replace,
-		Replacement: cm.Name,
+		Replacement: jobName,
 		TargetLabel: "job",
 	})
+	priority, err := scrapePriority(cm.Spec.Priority, cm.Annotations)
+	if err != nil {
+		return nil, err
+	}
 
 	return endpointScrapeConfig(
 		fmt.Sprintf("ClusterPodMonitoring/%s", cm.Name),
-		projectID, location, cluster,
+		projectID, location, cluster, pubNamespace,
 		cm.Spec.Endpoints[index],
 		relabelCfgs,
 		cm.Spec.TargetLabels.FromPod,
 		cm.Spec.Limits,
+		nil,
+		priority,
 	)
 }
 
@@ -898,6 +1436,19 @@ type PodMonitoringSpec struct {
 	TargetLabels TargetLabels `json:"targetLabels,omitempty"`
 	// Limits to apply at scrape time.
 	Limits *ScrapeLimits `json:"limits,omitempty"`
+	// JobName overrides the value of the exported job label, which defaults
+	// to the name of the PodMonitoring. Can be set to keep continuity with
+	// job names that dashboards and alerts relied on before migrating to
+	// managed collection. Distinct resources with the same job label may
+	// write to the same series, so overrides should remain unique within
+	// the monitored project.
+	JobName string `json:"jobName,omitempty"`
+	// Priority ranks the monitoring configuration relative to others, with
+	// higher values being more important. Collectors preserve scrapes for
+	// higher priority resources preferentially when shedding load under
+	// memory pressure, and configuration rollouts treat failing scrapes of
+	// resources with a positive priority as blocking. Defaults to 0.
+	Priority int32 `json:"priority,omitempty"`
 }
 
 // ScrapeLimits limits applied to scraped targets.
@@ -929,14 +1480,40 @@ type ClusterPodMonitoringSpec struct {
 	TargetLabels TargetLabels `json:"targetLabels,omitempty"`
 	// Limits to apply at scrape time.
 	Limits *ScrapeLimits `json:"limits,omitempty"`
+	// JobName overrides the value of the exported job label, which defaults
+	// to the name of the ClusterPodMonitoring. Can be set to keep continuity
+	// with job names that dashboards and alerts relied on before migrating to
+	// managed collection. Distinct resources with the same job label may
+	// write to the same series, so overrides should remain unique within
+	// the monitored project.
+	JobName string `json:"jobName,omitempty"`
+	// Priority ranks the monitoring configuration relative to others, with
+	// higher values being more important. Collectors preserve scrapes for
+	// higher priority resources preferentially when shedding load under
+	// memory pressure, and configuration rollouts treat failing scrapes of
+	// resources with a positive priority as blocking. Defaults to 0.
+	Priority int32 `json:"priority,omitempty"`
 }
 
 // ScrapeEndpoint specifies a Prometheus metrics endpoint to scrape.
 type ScrapeEndpoint struct {
-	// Name or number of the port to scrape.
+	// Name or number of the port to scrape. A named port is matched against
+	// the declared ports of all containers of the pod, including init
+	// containers that run as native sidecars.
 	// The container metadata label is only populated if the port is referenced by name
 	// because port numbers are not unique across containers.
+	// Must be empty if fromAnnotations is enabled.
 	Port intstr.IntOrString `json:"port"`
+	// FromAnnotations resolves the scrape port and path from the conventional
+	// prometheus.io/port and prometheus.io/path pod annotations instead of the
+	// port and path fields, easing migration from annotation-based scraping.
+	// Selected pods without a port annotation are not scraped. Where the path
+	// annotation is absent, the endpoint's path applies.
+	FromAnnotations bool `json:"fromAnnotations,omitempty"`
+	// Name of the container exposing the scraped port. Only needed as
+	// disambiguation when multiple containers of the pod declare ports with
+	// the same name. May only be set if the port is referenced by name.
+	Container string `json:"container,omitempty"`
 	// Protocol scheme to use to scrape.
 	Scheme string `json:"scheme,omitempty"`
 	// HTTP path to scrape metrics from. Defaults to "/metrics".
@@ -955,6 +1532,67 @@ type ScrapeEndpoint struct {
 	// instance, or __address__) are not permitted. The labelmap action is not permitted
 	// in general.
 	MetricRelabeling []RelabelingRule `json:"metricRelabeling,omitempty"`
+	// InstanceNaming selects how the instance label of scraped targets is
+	// derived, suffixed with the scraped port in all cases. Must be one of:
+	//
+	//  - "default" (or unset): the pod name, or the node name for pods
+	//    controlled by a DaemonSet.
+	//  - "pod": the pod name, also for DaemonSet pods.
+	//  - "node": the node name. Only suitable for workloads running at most
+	//    one selected pod per node, as the instance label must remain unique
+	//    within a scrape job.
+	//  - "podIP": the pod IP.
+	//
+	// Overriding the default preserves instance label continuity when
+	// migrating from self-managed Prometheus.
+	InstanceNaming string `json:"instanceNaming,omitempty"`
+	// GoogleIAMAuth attaches a Google-signed token of the collector's service
+	// account to scrape requests. Use for targets that require
+	// IAM-authenticated access, such as Cloud Run sidecars or endpoints
+	// behind Identity-Aware Proxy.
+	GoogleIAMAuth *GoogleIAMAuth `json:"googleIAMAuth,omitempty"`
+	// TLS settings for scrapes of this endpoint. Certificates and keys are
+	// read from Secrets and ConfigMaps in the public namespace, from where
+	// the operator distributes them to the collectors.
+	TLS *TLSConfig `json:"tls,omitempty"`
+}
+
+// GoogleIAMAuth specifies scrape authorization with Google-signed tokens,
+// minted for the Kubernetes service account of the collector, which Workload
+// Identity maps onto a Google service account.
+type GoogleIAMAuth struct {
+	// Type of the attached token. Must be "id" for an OpenID Connect identity
+	// token or "access" for an OAuth2 access token with cloud-platform scope.
+	// Defaults to "id".
+	Type string `json:"type,omitempty"`
+	// Audience identity tokens are minted for, typically the URL of the
+	// scraped service. Required for identity tokens and must be empty for
+	// access tokens.
+	Audience string `json:"audience,omitempty"`
+}
+
+// credentialsFile validates the configuration and returns the path of the
+// file from which the collector reads the attached token. The file name
+// encodes token type and audience, based on which the config-reloader sidecar
+// keeps a fresh token in place.
+func (a *GoogleIAMAuth) credentialsFile() (string, error) {
+	typ := a.Type
+	if typ == "" {
+		typ = googleauth.TokenTypeID
+	}
+	switch typ {
+	case googleauth.TokenTypeID:
+		if a.Audience == "" {
+			return "", errors.Errorf("audience is required for token type %q", typ)
+		}
+	case googleauth.TokenTypeAccess:
+		if a.Audience != "" {
+			return "", errors.Errorf("audience must be empty for token type %q", typ)
+		}
+	default:
+		return "", errors.Errorf("invalid token type %q, must be %q or %q", typ, googleauth.TokenTypeID, googleauth.TokenTypeAccess)
+	}
+	return googleauth.TokenFilepath(typ, a.Audience), nil
 }
 
 // TargetLabels configures labels for the discovered Prometheus targets.
@@ -1008,52 +1646,7 @@ type RelabelingRule struct {
 
 // PodMonitoringStatus holds status information of a PodMonitoring resource.
 type PodMonitoringStatus struct {
-	// The generation observed by the controller.
-	// +optional
-	ObservedGeneration int64 `json:"observedGeneration"`
-	// Represents the latest available observations of a podmonitor's current state.
-	Conditions []MonitoringCondition `json:"conditions,omitempty"`
-}
-
-// MonitoringConditionType is the type of MonitoringCondition.
-type MonitoringConditionType string
-
-const (
-	// ConfigurationCreateSuccess indicates that the config generated from the
-	// monitoring resource was created successfully.
-	ConfigurationCreateSuccess MonitoringConditionType = "ConfigurationCreateSuccess"
-)
-
-// MonitoringCondition describes a condition of a PodMonitoring.
-type MonitoringCondition struct {
-	Type MonitoringConditionType `json:"type"`
-	// Status of the condition, one of True, False, Unknown.
-	Status corev1.ConditionStatus `json:"status"`
-	// The last time this condition was updated.
-	// +optional
-	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
-	// Last time the condition transitioned from one status to another.
-	// +optional
-	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
-	// The reason for the condition's last transition.
-	// +optional
-	Reason string `json:"reason,omitempty"`
-	// A human-readable message indicating details about the transition.
-	// +optional
-	Message string `json:"message,omitempty"`
-}
-
-// NewDefaultConditions returns a list of default conditions for at the given
-// time for a `PodMonitoringStatus` if never explicitly set.
-func NewDefaultConditions(now metav1.Time) []MonitoringCondition {
-	return []MonitoringCondition{
-		{
-			Type:               ConfigurationCreateSuccess,
-			Status:             corev1.ConditionUnknown,
-			LastUpdateTime:     now,
-			LastTransitionTime: now,
-		},
-	}
+	MonitoringStatus `json:",inline"`
 }
 
 // Rules defines Prometheus alerting and recording rules that are scoped
@@ -1066,6 +1659,8 @@ func NewDefaultConditions(now metav1.Time) []MonitoringCondition {
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="ConfigurationCreateSuccess")].status`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
 type Rules struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -1093,9 +1688,11 @@ type RulesList struct {
 // +genclient
 // +genclient:nonNamespaced
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
-// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:resource:scope=Cluster,shortName=crules
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="ConfigurationCreateSuccess")].status`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
 type ClusterRules struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -1122,9 +1719,11 @@ type ClusterRulesList struct {
 // +genclient
 // +genclient:nonNamespaced
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
-// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:resource:scope=Cluster,shortName=grules
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="ConfigurationCreateSuccess")].status`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
 type GlobalRules struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -1147,6 +1746,31 @@ type GlobalRulesList struct {
 type RulesSpec struct {
 	// A list of Prometheus rule groups.
 	Groups []RuleGroup `json:"groups"`
+	// AlertPolicies enables compiling the alerting rules of this resource
+	// additionally into Cloud Monitoring alerting policies, so alerts fire
+	// through Cloud Monitoring notification channels alongside or instead of
+	// the configured Alertmanager.
+	AlertPolicies *AlertPolicyExport `json:"alertPolicies,omitempty"`
+	// ExportCustomMetrics exports the series recorded by this resource under
+	// the custom.googleapis.com metric prefix instead of
+	// prometheus.googleapis.com, for tooling such as Cloud Monitoring SLO
+	// burn-rate alerting that does not accept Prometheus metric types.
+	// Descriptors are managed by Cloud Monitoring on first write and colons
+	// in recorded metric names are replaced by underscores in the metric type.
+	ExportCustomMetrics bool `json:"exportCustomMetrics,omitempty"`
+}
+
+// AlertPolicyExport configures compiling alerting rules into Cloud Monitoring
+// alerting policies. Policies are written with the credentials of the
+// operator, which must be permitted to edit alerting policies in the target
+// project.
+type AlertPolicyExport struct {
+	// The Google Cloud project in which alerting policies are created.
+	// Defaults to the project the operator sends collected metrics to.
+	ProjectID string `json:"projectID,omitempty"`
+	// Notification channels to attach to all created policies, given as full
+	// resource names, e.g. "projects/gmp-test/notificationChannels/123".
+	NotificationChannels []string `json:"notificationChannels,omitempty"`
 }
 
 // RuleGroup declares rules in the Prometheus format:
@@ -1156,6 +1780,22 @@ type RuleGroup struct {
 	Name string `json:"name"`
 	// The interval at which to evaluate the rules. Must be a valid Prometheus duration.
 	Interval string `json:"interval"`
+	// Evaluate the rules of this group against the data of the in-cluster
+	// collectors instead of Cloud Monitoring. Local evaluation acts on
+	// freshly scraped data before it is exported, enabling low-latency
+	// alerting even when ingestion lags. The data of all collectors is
+	// federated at query time, so expressions must preserve per-target
+	// labels like instance in aggregations to remain unambiguous.
+	Local bool `json:"local,omitempty"`
+	// Names of other groups of this resource whose rules must be evaluated
+	// before those of this group. Groups connected through dependsOn are
+	// merged into a single generated group, so all their rules are evaluated
+	// sequentially at one timestamp per interval. Use it for recording rules
+	// that feed other recording rules, where independently scheduled groups
+	// would produce inconsistent results due to ingestion lag. All connected
+	// groups must declare the same interval and local setting, and
+	// dependencies must not form a cycle.
+	DependsOn []string `json:"dependsOn,omitempty"`
 	// A list of rules that are executed sequentially as part of this group.
 	Rules []Rule `json:"rules"`
 }
@@ -1183,7 +1823,378 @@ type Rule struct {
 
 // RulesStatus contains status information for a Rules resource.
 type RulesStatus struct {
-	// TODO: add status information.
+	MonitoringStatus `json:",inline"`
+}
+
+// GrafanaDatasourceSync defines a set of Grafana datasources for which the
+// operator maintains OAuth access tokens, rotating them in-cluster before they
+// expire. This permits Grafana instances without access to GCP credentials to
+// query the Prometheus frontend.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type GrafanaDatasourceSync struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Specification of datasources to keep authenticated.
+	Spec GrafanaDatasourceSyncSpec `json:"spec"`
+	// Most recently observed sync status per datasource.
+	Status GrafanaDatasourceSyncStatus `json:"status,omitempty"`
+}
+
+// GrafanaDatasourceSyncList is a list of GrafanaDatasourceSyncs.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type GrafanaDatasourceSyncList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GrafanaDatasourceSync `json:"items"`
+}
+
+// GrafanaDatasourceSyncSpec describes the Grafana instance and datasources to
+// maintain access tokens for.
+type GrafanaDatasourceSyncSpec struct {
+	// Endpoint of the Grafana API, e.g. "http://grafana.monitoring.svc:3000".
+	GrafanaEndpoint string `json:"grafanaEndpoint"`
+	// A reference to a secret key containing a Grafana service account token
+	// or API key with permission to update datasources.
+	GrafanaSecret *v1.SecretKeySelector `json:"grafanaSecret"`
+	// The datasources to maintain access tokens for.
+	Datasources []GrafanaDatasource `json:"datasources"`
+}
+
+// GrafanaDatasource identifies a single Grafana datasource and the credentials
+// with which its access token is minted.
+type GrafanaDatasource struct {
+	// The UID of the datasource within Grafana.
+	UID string `json:"uid"`
+	// OAuth scopes requested for the access token. Defaults to the Cloud
+	// Monitoring read scope.
+	Scopes []string `json:"scopes,omitempty"`
+	// A reference to GCP service account credentials with which access tokens
+	// are minted. It needs metric read permissions against the queried project.
+	// If left empty, the operator's own credentials are used, which allows
+	// different datasources to use service accounts of different projects.
+	Credentials *v1.SecretKeySelector `json:"credentials,omitempty"`
+}
+
+// GrafanaDatasourceSyncStatus holds status information of a
+// GrafanaDatasourceSync resource.
+type GrafanaDatasourceSyncStatus struct {
+	// The generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Sync status for each configured datasource.
+	Datasources []GrafanaDatasourceStatus `json:"datasources,omitempty"`
+}
+
+// GrafanaDatasourceStatus describes the sync status of a single datasource.
+type GrafanaDatasourceStatus struct {
+	// The UID of the datasource within Grafana.
+	UID string `json:"uid"`
+	// The last time a token was successfully written to the datasource.
+	// +optional
+	LastSyncTime metav1.Time `json:"lastSyncTime,omitempty"`
+	// The expiry time of the most recently written token.
+	// +optional
+	TokenExpireTime metav1.Time `json:"tokenExpireTime,omitempty"`
+	// A human-readable message of the last sync error, if any.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Dashboard defines a Cloud Monitoring dashboard that the operator creates
+// and keeps in sync through the Cloud Monitoring dashboards API. It allows
+// versioning dashboards in the cluster next to the monitoring resources
+// producing the displayed data.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+type Dashboard struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Specification of the dashboard to provision.
+	Spec DashboardSpec `json:"spec"`
+	// Most recently observed status of the resource.
+	// +optional
+	Status DashboardStatus `json:"status"`
+}
+
+// DashboardList is a list of Dashboards.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DashboardList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Dashboard `json:"items"`
+}
+
+// DashboardSpec describes a Cloud Monitoring dashboard to provision.
+type DashboardSpec struct {
+	// The GCP project to create the dashboard in. Defaults to the project
+	// the operator sends collected metrics to.
+	// +optional
+	ProjectID string `json:"projectID,omitempty"`
+	// Human-readable name shown in the Cloud Monitoring dashboard overview.
+	DisplayName string `json:"displayName"`
+	// JSON definition of the dashboard contents as accepted by the
+	// projects.dashboards API. The name, displayName, and etag fields are
+	// managed by the operator and must be left unset.
+	JSON string `json:"json"`
+	// A reference to GCP service account credentials with which the dashboard
+	// is written. They need dashboard edit permissions against the target
+	// project. If left empty, the operator's own credentials are used.
+	// +optional
+	Credentials *v1.SecretKeySelector `json:"credentials,omitempty"`
+}
+
+// DashboardStatus holds status information of a Dashboard resource.
+type DashboardStatus struct {
+	MonitoringStatus `json:",inline"`
+	// The full resource name of the dashboard within Cloud Monitoring, e.g.
+	// "projects/123/dashboards/e3a0f...". Set once the dashboard has been
+	// created.
+	// +optional
+	DashboardName string `json:"dashboardName,omitempty"`
+}
+
+// ClusterStaticMonitoring defines monitoring for scrape targets outside the
+// cluster. Targets are either addressed statically or discovered through
+// Google Cloud APIs, so hybrid workloads such as GCE instances or Cloud Run
+// services can be scraped by the in-cluster collectors.
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope=Cluster,shortName=csmon
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="ConfigurationCreateSuccess")].status`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
+type ClusterStaticMonitoring struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Specification of external targets to scrape.
+	Spec ClusterStaticMonitoringSpec `json:"spec"`
+	// Most recently observed status of the resource.
+	// +optional
+	Status MonitoringStatus `json:"status"`
+}
+
+// ClusterStaticMonitoringList is a list of ClusterStaticMonitorings.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterStaticMonitoringList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterStaticMonitoring `json:"items"`
+}
+
+// ClusterStaticMonitoringSpec contains specification parameters for
+// ClusterStaticMonitoring.
+type ClusterStaticMonitoringSpec struct {
+	// Statically addressed scrape targets.
+	// +optional
+	StaticTargets []StaticTarget `json:"staticTargets,omitempty"`
+	// Targets discovered through Google Cloud APIs. Discovery runs in the
+	// operator, which serves the results to the collectors through
+	// Prometheus's HTTP service discovery protocol.
+	// +optional
+	GoogleCloud *GoogleCloudDiscovery `json:"googleCloud,omitempty"`
+	// Protocol scheme to use to scrape. Defaults to "http". Targets discovered
+	// through Google Cloud APIs may override it per target, e.g. Cloud Run
+	// services are always scraped via HTTPS.
+	// +optional
+	Scheme string `json:"scheme,omitempty"`
+	// HTTP path to scrape metrics from. Defaults to "/metrics".
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Interval at which to scrape metrics. Must be a valid Prometheus duration.
+	Interval string `json:"interval"`
+	// Timeout for metrics scrapes. Must be a valid Prometheus duration.
+	// Must not be larger than the scrape interval.
+	// +optional
+	Timeout string `json:"timeout,omitempty"`
+	// Limits to apply at scrape time.
+	// +optional
+	Limits *ScrapeLimits `json:"limits,omitempty"`
+}
+
+// StaticTarget is a statically addressed scrape target.
+type StaticTarget struct {
+	// Address of the target of the form "<host>:<port>".
+	Address string `json:"address"`
+	// Labels set on all series scraped from the target. Labels that collide
+	// with protected target labels (project_id, location, cluster, namespace,
+	// job, instance) are ignored.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// GoogleCloudDiscovery configures discovery of scrape targets through Google
+// Cloud APIs.
+type GoogleCloudDiscovery struct {
+	// GCE instances to discover as scrape targets.
+	// +optional
+	GCEInstances []GCEInstanceDiscovery `json:"gceInstances,omitempty"`
+	// Cloud Run services to discover as scrape targets.
+	// +optional
+	CloudRunServices []CloudRunDiscovery `json:"cloudRunServices,omitempty"`
+	// A reference to GCP service account credentials with which the discovery
+	// APIs are queried. They need read permissions against the target
+	// projects. If left empty, the operator's own credentials are used.
+	// +optional
+	Credentials *v1.SecretKeySelector `json:"credentials,omitempty"`
+}
+
+// GCEInstanceDiscovery discovers GCE instances as scrape targets.
+type GCEInstanceDiscovery struct {
+	// The GCP project to discover instances in. Defaults to the project the
+	// operator sends collected metrics to.
+	// +optional
+	ProjectID string `json:"projectID,omitempty"`
+	// The zones to discover instances in.
+	Zones []string `json:"zones"`
+	// Only instances carrying all given instance labels with the given values
+	// are discovered.
+	// +optional
+	LabelFilters map[string]string `json:"labelFilters,omitempty"`
+	// Port on the discovered instances to scrape.
+	Port int32 `json:"port"`
+}
+
+// CloudRunDiscovery discovers Cloud Run services as scrape targets.
+type CloudRunDiscovery struct {
+	// The GCP project to discover services in. Defaults to the project the
+	// operator sends collected metrics to.
+	// +optional
+	ProjectID string `json:"projectID,omitempty"`
+	// The region to discover services in.
+	Region string `json:"region"`
+}
+
+// ScrapeConfigs generates Prometheus scrape configs for the
+// ClusterStaticMonitoring. External targets are cluster-global, so all
+// generated jobs are pinned to the collector on the given scraper node to
+// avoid redundant scrapes by the entire fleet. Targets discovered through
+// Google Cloud APIs are served by the operator at the given HTTP service
+// discovery URL.
+func (sm *ClusterStaticMonitoring) ScrapeConfigs(projectID, location, cluster, httpSDURL, scraperNode string) ([]*promconfig.ScrapeConfig, error) {
+	if scraperNode == "" {
+		// No collectors are running yet. Generate no jobs rather than jobs
+		// that are scraped everywhere; the next reconcile picks them up.
+		return nil, nil
+	}
+	interval, err := prommodel.ParseDuration(sm.Spec.Interval)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid scrape interval")
+	}
+	var timeout prommodel.Duration
+	if sm.Spec.Timeout != "" {
+		timeout, err = prommodel.ParseDuration(sm.Spec.Timeout)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid scrape timeout")
+		}
+		if timeout > interval {
+			return nil, errors.Errorf("scrape timeout %v must not be greater than scrape interval %v", timeout, interval)
+		}
+	}
+	metricsPath := "/metrics"
+	if sm.Spec.Path != "" {
+		metricsPath = sm.Spec.Path
+	}
+	scheme := "http"
+	if sm.Spec.Scheme != "" {
+		scheme = sm.Spec.Scheme
+	}
+	relabelCfgs := []*relabel.Config{
+		// Force target labels so they cannot be overwritten by metric labels.
+		{
+			Action:      relabel.Replace,
+			TargetLabel: "project_id",
+			Replacement: projectID,
+		},
+		{
+			Action:      relabel.Replace,
+			TargetLabel: "location",
+			Replacement: location,
+		},
+		{
+			Action:      relabel.Replace,
+			TargetLabel: "cluster",
+			Replacement: cluster,
+		},
+		{
+			Action:      relabel.Replace,
+			TargetLabel: "job",
+			Replacement: sm.Name,
+		},
+		// Each collector interpolates $(NODE_NAME) with its own node through
+		// the config reloader. Keeping the targets only on the elected node
+		// ensures each external target is scraped exactly once.
+		{
+			Action:      relabel.Replace,
+			Replacement: fmt.Sprintf("$(%s)", EnvVarNodeName),
+			TargetLabel: "__tmp_static_scraper_node",
+		},
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__tmp_static_scraper_node"},
+			Regex:        relabel.MustNewRegexp(regexp.QuoteMeta(scraperNode)),
+		},
+	}
+	newScrapeConfig := func(suffix string, discoveryCfgs discovery.Configs) *promconfig.ScrapeConfig {
+		sc := &promconfig.ScrapeConfig{
+			JobName:                 fmt.Sprintf("ClusterStaticMonitoring/%s/%s", sm.Name, suffix),
+			ServiceDiscoveryConfigs: discoveryCfgs,
+			ScrapeInterval:          interval,
+			ScrapeTimeout:           timeout,
+			Scheme:                  scheme,
+			MetricsPath:             metricsPath,
+			RelabelConfigs:          relabelCfgs,
+		}
+		if sm.Spec.Limits != nil {
+			sc.SampleLimit = uint(sm.Spec.Limits.Samples)
+			sc.LabelLimit = uint(sm.Spec.Limits.Labels)
+			sc.LabelNameLengthLimit = uint(sm.Spec.Limits.LabelNameLength)
+			sc.LabelValueLengthLimit = uint(sm.Spec.Limits.LabelValueLength)
+		}
+		return sc
+	}
+	var res []*promconfig.ScrapeConfig
+
+	if len(sm.Spec.StaticTargets) > 0 {
+		var groups discovery.StaticConfig
+		for _, t := range sm.Spec.StaticTargets {
+			if _, _, err := net.SplitHostPort(t.Address); err != nil {
+				return nil, errors.Wrapf(err, "invalid static target address %q", t.Address)
+			}
+			lset := prommodel.LabelSet{}
+			for k, v := range t.Labels {
+				lset[sanitizeLabelName(k)] = prommodel.LabelValue(v)
+			}
+			groups = append(groups, &targetgroup.Group{
+				Targets: []prommodel.LabelSet{
+					{prommodel.AddressLabel: prommodel.LabelValue(t.Address)},
+				},
+				Labels: lset,
+			})
+		}
+		res = append(res, newScrapeConfig("static", discovery.Configs{groups}))
+	}
+	if sm.Spec.GoogleCloud != nil {
+		for _, gce := range sm.Spec.GoogleCloud.GCEInstances {
+			if len(gce.Zones) == 0 {
+				return nil, errors.New("GCE instance discovery requires at least one zone")
+			}
+			if gce.Port == 0 {
+				return nil, errors.New("GCE instance discovery requires a port")
+			}
+		}
+		res = append(res, newScrapeConfig("googlecloud", discovery.Configs{
+			&HTTPSDConfig{
+				URL:             httpSDURL,
+				RefreshInterval: prommodel.Duration(time.Minute),
+			},
+		}))
+	}
+	return res, nil
 }
 
 var invalidLabelCharRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
@@ -15,20 +15,22 @@
 package v1
 
 import (
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
 	"time"
 
-	corev1 "k8s.io/api/core/v1"
-
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	prommodel "github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/relabel"
 	yaml "gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/scrapeguard"
 )
 
 func TestValidatePodMonitoringCommon(t *testing.T) {
@@ -67,6 +69,26 @@ func TestValidatePodMonitoringCommon(t *testing.T) {
 			},
 			fail:        true,
 			errContains: "port must be set",
+		}, {
+			desc: "container with named port",
+			eps: []ScrapeEndpoint{
+				{
+					Port:      intstr.FromString("web"),
+					Container: "sidecar",
+					Interval:  "10s",
+				},
+			},
+		}, {
+			desc: "container with numeric port",
+			eps: []ScrapeEndpoint{
+				{
+					Port:      intstr.FromInt(8080),
+					Container: "sidecar",
+					Interval:  "10s",
+				},
+			},
+			fail:        true,
+			errContains: "container may only be set if the port is referenced by name",
 		}, {
 			desc: "scrape interval missing",
 			eps: []ScrapeEndpoint{
@@ -551,7 +573,7 @@ func TestPodMonitoring_ScrapeConfig(t *testing.T) {
 			},
 		},
 	}
-	scrapeCfgs, err := pmon.ScrapeConfigs("test_project", "test_location", "test_cluster")
+	scrapeCfgs, err := pmon.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -577,9 +599,6 @@ label_value_length_limit: 4
 follow_redirects: true
 enable_http2: true
 relabel_configs:
-- source_labels: [__meta_kubernetes_namespace]
-  regex: ns1
-  action: keep
 - source_labels: [__meta_kubernetes_namespace]
   target_label: namespace
   action: replace
@@ -633,6 +652,10 @@ kubernetes_sd_configs:
   kubeconfig_file: ""
   follow_redirects: true
   enable_http2: true
+  namespaces:
+    own_namespace: false
+    names:
+    - ns1
   selectors:
   - role: pod
     field: spec.nodeName=$(NODE_NAME)
@@ -650,9 +673,6 @@ proxy_url: http://foo.bar/test
 follow_redirects: true
 enable_http2: true
 relabel_configs:
-- source_labels: [__meta_kubernetes_namespace]
-  regex: ns1
-  action: keep
 - source_labels: [__meta_kubernetes_namespace]
   target_label: namespace
   action: replace
@@ -697,6 +717,10 @@ kubernetes_sd_configs:
   kubeconfig_file: ""
   follow_redirects: true
   enable_http2: true
+  namespaces:
+    own_namespace: false
+    names:
+    - ns1
   selectors:
   - role: pod
     field: spec.nodeName=$(NODE_NAME)
@@ -761,7 +785,7 @@ func TestClusterPodMonitoring_ScrapeConfig(t *testing.T) {
 			},
 		},
 	}
-	scrapeCfgs, err := pmon.ScrapeConfigs("test_project", "test_location", "test_cluster")
+	scrapeCfgs, err := pmon.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -911,35 +935,37 @@ kubernetes_sd_configs:
 	}
 }
 
-func TestSetPodMonitoringCondition(t *testing.T) {
+func TestSetMonitoringCondition(t *testing.T) {
 	var (
 		before = metav1.NewTime(time.Unix(1234, 0))
 		now    = metav1.NewTime(time.Unix(5678, 0))
 	)
 	cases := []struct {
 		doc        string
-		cond       *MonitoringCondition
+		cond       metav1.Condition
 		generation int64
 		now        metav1.Time
-		curr, want *PodMonitoringStatus
+		curr, want *MonitoringStatus
 		change     bool
 	}{
 		{
 			doc:  "no previous status",
-			curr: &PodMonitoringStatus{},
-			cond: &MonitoringCondition{
+			curr: &MonitoringStatus{},
+			cond: metav1.Condition{
 				Type:   ConfigurationCreateSuccess,
-				Status: corev1.ConditionTrue,
+				Status: metav1.ConditionTrue,
+				Reason: ReasonConfigurationCreated,
 			},
 			generation: 1,
 			now:        now,
-			want: &PodMonitoringStatus{
+			want: &MonitoringStatus{
 				ObservedGeneration: 1,
-				Conditions: []MonitoringCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               ConfigurationCreateSuccess,
-						Status:             corev1.ConditionTrue,
-						LastUpdateTime:     now,
+						Status:             metav1.ConditionTrue,
+						Reason:             ReasonConfigurationCreated,
+						ObservedGeneration: 1,
 						LastTransitionTime: now,
 					},
 				},
@@ -948,30 +974,33 @@ func TestSetPodMonitoringCondition(t *testing.T) {
 		},
 		{
 			doc: "matching previous status - prevent cycle",
-			curr: &PodMonitoringStatus{
+			curr: &MonitoringStatus{
 				ObservedGeneration: 1,
-				Conditions: []MonitoringCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               ConfigurationCreateSuccess,
-						Status:             corev1.ConditionTrue,
-						LastUpdateTime:     before,
+						Status:             metav1.ConditionTrue,
+						Reason:             ReasonConfigurationCreated,
+						ObservedGeneration: 1,
 						LastTransitionTime: before,
 					},
 				},
 			},
-			cond: &MonitoringCondition{
+			cond: metav1.Condition{
 				Type:   ConfigurationCreateSuccess,
-				Status: corev1.ConditionTrue,
+				Status: metav1.ConditionTrue,
+				Reason: ReasonConfigurationCreated,
 			},
 			generation: 1,
 			now:        now,
-			want: &PodMonitoringStatus{
+			want: &MonitoringStatus{
 				ObservedGeneration: 1,
-				Conditions: []MonitoringCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               ConfigurationCreateSuccess,
-						Status:             corev1.ConditionTrue,
-						LastUpdateTime:     before,
+						Status:             metav1.ConditionTrue,
+						Reason:             ReasonConfigurationCreated,
+						ObservedGeneration: 1,
 						LastTransitionTime: before,
 					},
 				},
@@ -980,30 +1009,33 @@ func TestSetPodMonitoringCondition(t *testing.T) {
 		},
 		{
 			doc: "success to success transition due to spec change",
-			curr: &PodMonitoringStatus{
+			curr: &MonitoringStatus{
 				ObservedGeneration: 1,
-				Conditions: []MonitoringCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               ConfigurationCreateSuccess,
-						Status:             corev1.ConditionTrue,
-						LastUpdateTime:     before,
+						Status:             metav1.ConditionTrue,
+						Reason:             ReasonConfigurationCreated,
+						ObservedGeneration: 1,
 						LastTransitionTime: before,
 					},
 				},
 			},
-			cond: &MonitoringCondition{
+			cond: metav1.Condition{
 				Type:   ConfigurationCreateSuccess,
-				Status: corev1.ConditionTrue,
+				Status: metav1.ConditionTrue,
+				Reason: ReasonConfigurationCreated,
 			},
 			generation: 2,
 			now:        now,
-			want: &PodMonitoringStatus{
+			want: &MonitoringStatus{
 				ObservedGeneration: 2,
-				Conditions: []MonitoringCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               ConfigurationCreateSuccess,
-						Status:             corev1.ConditionTrue,
-						LastUpdateTime:     now,
+						Status:             metav1.ConditionTrue,
+						Reason:             ReasonConfigurationCreated,
+						ObservedGeneration: 2,
 						LastTransitionTime: before,
 					},
 				},
@@ -1012,30 +1044,33 @@ func TestSetPodMonitoringCondition(t *testing.T) {
 		},
 		{
 			doc: "failure to success transition due to spec fix",
-			curr: &PodMonitoringStatus{
+			curr: &MonitoringStatus{
 				ObservedGeneration: 1,
-				Conditions: []MonitoringCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               ConfigurationCreateSuccess,
-						Status:             corev1.ConditionFalse,
-						LastUpdateTime:     before,
+						Status:             metav1.ConditionFalse,
+						Reason:             ReasonScrapeConfigError,
+						ObservedGeneration: 1,
 						LastTransitionTime: before,
 					},
 				},
 			},
-			cond: &MonitoringCondition{
+			cond: metav1.Condition{
 				Type:   ConfigurationCreateSuccess,
-				Status: corev1.ConditionTrue,
+				Status: metav1.ConditionTrue,
+				Reason: ReasonConfigurationCreated,
 			},
 			generation: 2,
 			now:        now,
-			want: &PodMonitoringStatus{
+			want: &MonitoringStatus{
 				ObservedGeneration: 2,
-				Conditions: []MonitoringCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               ConfigurationCreateSuccess,
-						Status:             corev1.ConditionTrue,
-						LastUpdateTime:     now,
+						Status:             metav1.ConditionTrue,
+						Reason:             ReasonConfigurationCreated,
+						ObservedGeneration: 2,
 						LastTransitionTime: now,
 					},
 				},
@@ -1044,32 +1079,79 @@ func TestSetPodMonitoringCondition(t *testing.T) {
 		},
 		{
 			doc: "success to failure transition due to status update",
-			curr: &PodMonitoringStatus{
+			curr: &MonitoringStatus{
 				ObservedGeneration: 1,
-				Conditions: []MonitoringCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               ConfigurationCreateSuccess,
-						Status:             corev1.ConditionTrue,
-						LastUpdateTime:     before,
+						Status:             metav1.ConditionTrue,
+						Reason:             ReasonConfigurationCreated,
+						ObservedGeneration: 1,
 						LastTransitionTime: before,
 					},
 				},
 			},
-			cond: &MonitoringCondition{
+			cond: metav1.Condition{
+				Type:    ConfigurationCreateSuccess,
+				Status:  metav1.ConditionFalse,
+				Reason:  ReasonScrapeConfigError,
+				Message: "scrape config error",
+			},
+			generation: 1,
+			now:        now,
+			want: &MonitoringStatus{
+				ObservedGeneration: 1,
+				Conditions: []metav1.Condition{
+					{
+						Type:               ConfigurationCreateSuccess,
+						Status:             metav1.ConditionFalse,
+						Reason:             ReasonScrapeConfigError,
+						Message:            "scrape config error",
+						ObservedGeneration: 1,
+						LastTransitionTime: now,
+					},
+				},
+			},
+			change: true,
+		},
+		{
+			doc: "new condition type is added alongside existing ones",
+			curr: &MonitoringStatus{
+				ObservedGeneration: 1,
+				Conditions: []metav1.Condition{
+					{
+						Type:               NoTargetCollision,
+						Status:             metav1.ConditionTrue,
+						Reason:             ReasonNoCollision,
+						ObservedGeneration: 1,
+						LastTransitionTime: before,
+					},
+				},
+			},
+			cond: metav1.Condition{
 				Type:   ConfigurationCreateSuccess,
-				Status: corev1.ConditionFalse,
+				Status: metav1.ConditionTrue,
+				Reason: ReasonConfigurationCreated,
 			},
 			generation: 1,
 			now:        now,
-			want: &PodMonitoringStatus{
+			want: &MonitoringStatus{
 				ObservedGeneration: 1,
-				Conditions: []MonitoringCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               ConfigurationCreateSuccess,
-						Status:             corev1.ConditionFalse,
-						LastUpdateTime:     now,
+						Status:             metav1.ConditionTrue,
+						Reason:             ReasonConfigurationCreated,
+						ObservedGeneration: 1,
 						LastTransitionTime: now,
 					},
+					{
+						Type:               NoTargetCollision,
+						Status:             metav1.ConditionTrue,
+						Reason:             ReasonNoCollision,
+						ObservedGeneration: 1,
+						LastTransitionTime: before,
+					},
 				},
 			},
 			change: true,
@@ -1078,12 +1160,11 @@ func TestSetPodMonitoringCondition(t *testing.T) {
 	for _, c := range cases {
 		t.Run(c.doc, func(t *testing.T) {
 			got := c.curr
-			change, err := got.SetPodMonitoringCondition(c.generation, c.now, c.cond)
+			change, err := got.SetMonitoringCondition(c.generation, c.now, c.cond)
 			if err != nil {
-				t.Fatalf("set podmonitoring condition: %s", err)
+				t.Fatalf("set monitoring condition: %s", err)
 			}
 
-			// Get resolved podmonitorings.
 			if change != c.change {
 				t.Errorf("unexpected change")
 			} else if diff := cmp.Diff(got, c.want); diff != "" {
@@ -1091,4 +1172,266 @@ func TestSetPodMonitoringCondition(t *testing.T) {
 			}
 		})
 	}
+
+	s := &MonitoringStatus{}
+	if _, err := s.SetMonitoringCondition(1, now, metav1.Condition{Type: ConfigurationCreateSuccess, Status: metav1.ConditionTrue}); err == nil {
+		t.Errorf("expected error for condition without reason")
+	}
+}
+
+func TestExportedJobName(t *testing.T) {
+	pm := &PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "name1"},
+		Spec: PodMonitoringSpec{
+			Endpoints: []ScrapeEndpoint{{Port: intstr.FromString("web"), Interval: "10s"}},
+			JobName:   "legacy-job",
+		},
+	}
+	scrapeCfgs, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, rc := range scrapeCfgs[0].RelabelConfigs {
+		if rc.TargetLabel == "job" {
+			found = true
+			if rc.Replacement != "legacy-job" {
+				t.Errorf("expected job replacement %q, got %q", "legacy-job", rc.Replacement)
+			}
+		}
+	}
+	if !found {
+		t.Error("no job relabeling rule found")
+	}
+
+	pm.Spec.JobName = "bad\xc5job"
+	if err := pm.ValidateCreate(); err == nil {
+		t.Error("expected invalid job name to fail validation")
+	}
+}
+
+func TestEndpointInstanceNaming(t *testing.T) {
+	pm := &PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "name1"},
+		Spec: PodMonitoringSpec{
+			Endpoints: []ScrapeEndpoint{{Port: intstr.FromString("web"), Interval: "10s", InstanceNaming: "podIP"}},
+		},
+	}
+	scrapeCfgs, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, rc := range scrapeCfgs[0].RelabelConfigs {
+		if rc.TargetLabel == "__tmp_instance" {
+			found = true
+			if want := (prommodel.LabelNames{"__meta_kubernetes_pod_ip"}); !reflect.DeepEqual(rc.SourceLabels, want) {
+				t.Errorf("expected instance source labels %v, got %v", want, rc.SourceLabels)
+			}
+		}
+	}
+	if !found {
+		t.Error("no instance relabeling rule found")
+	}
+
+	pm.Spec.Endpoints[0].InstanceNaming = "hostname"
+	if err := pm.ValidateCreate(); err == nil {
+		t.Error("expected unknown instance naming to fail validation")
+	}
+
+	pm.Spec.Endpoints = []ScrapeEndpoint{
+		{Port: intstr.FromString("web"), Interval: "10s", InstanceNaming: "node"},
+		{Port: intstr.FromString("web"), Interval: "10s"},
+	}
+	if err := pm.ValidateCreate(); err == nil {
+		t.Error("expected colliding instance naming to fail validation")
+	}
+	pm.Spec.Endpoints[1].InstanceNaming = "podIP"
+	if err := pm.ValidateCreate(); err != nil {
+		t.Errorf("expected disjoint instance naming to validate, got %s", err)
+	}
+}
+
+func TestEndpointFromAnnotations(t *testing.T) {
+	pm := &PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "name1"},
+		Spec: PodMonitoringSpec{
+			Endpoints: []ScrapeEndpoint{{FromAnnotations: true, Interval: "10s"}},
+		},
+	}
+	scrapeCfgs, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "PodMonitoring/ns1/name1/annotations"; scrapeCfgs[0].JobName != want {
+		t.Errorf("expected job name %q, got %q", want, scrapeCfgs[0].JobName)
+	}
+	var gotAddress, gotPath bool
+	for _, rc := range scrapeCfgs[0].RelabelConfigs {
+		switch rc.TargetLabel {
+		case "__address__":
+			gotAddress = true
+			want := prommodel.LabelNames{"__meta_kubernetes_pod_ip", "__meta_kubernetes_pod_annotation_prometheus_io_port"}
+			if !reflect.DeepEqual(rc.SourceLabels, want) {
+				t.Errorf("expected address source labels %v, got %v", want, rc.SourceLabels)
+			}
+		case "__metrics_path__":
+			gotPath = true
+			want := prommodel.LabelNames{"__meta_kubernetes_pod_annotation_prometheus_io_path"}
+			if !reflect.DeepEqual(rc.SourceLabels, want) {
+				t.Errorf("expected path source labels %v, got %v", want, rc.SourceLabels)
+			}
+		}
+	}
+	if !gotAddress {
+		t.Error("no address relabeling rule found")
+	}
+	if !gotPath {
+		t.Error("no metrics path relabeling rule found")
+	}
+
+	pm.Spec.Endpoints[0].Port = intstr.FromString("web")
+	if _, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace"); err == nil {
+		t.Error("expected port with fromAnnotations to fail")
+	}
+	pm.Spec.Endpoints[0].Port = intstr.IntOrString{}
+	pm.Spec.Endpoints[0].Container = "app"
+	if _, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace"); err == nil {
+		t.Error("expected container with fromAnnotations to fail")
+	}
+}
+
+func TestGoogleIAMAuth(t *testing.T) {
+	pm := &PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "name1"},
+		Spec: PodMonitoringSpec{
+			Endpoints: []ScrapeEndpoint{{
+				Port:          intstr.FromString("web"),
+				Interval:      "10s",
+				GoogleIAMAuth: &GoogleIAMAuth{Audience: "https://svc.example.run.app"},
+			}},
+		},
+	}
+	scrapeCfgs, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := scrapeCfgs[0].HTTPClientConfig.Authorization
+	if auth == nil {
+		t.Fatal("expected authorization section in scrape config")
+	}
+	if auth.Type != "Bearer" {
+		t.Errorf("expected authorization type Bearer, got %q", auth.Type)
+	}
+	if !strings.HasPrefix(auth.CredentialsFile, "/etc/gmp-tokens/id-") {
+		t.Errorf("unexpected credentials file %q", auth.CredentialsFile)
+	}
+
+	pm.Spec.Endpoints[0].GoogleIAMAuth = &GoogleIAMAuth{Type: "access", Audience: "https://svc.example.run.app"}
+	if err := pm.ValidateCreate(); err == nil {
+		t.Error("expected audience with access token type to fail validation")
+	}
+	pm.Spec.Endpoints[0].GoogleIAMAuth = &GoogleIAMAuth{Type: "bearer"}
+	if err := pm.ValidateCreate(); err == nil {
+		t.Error("expected unknown token type to fail validation")
+	}
+	pm.Spec.Endpoints[0].GoogleIAMAuth = &GoogleIAMAuth{}
+	if err := pm.ValidateCreate(); err == nil {
+		t.Error("expected identity token without audience to fail validation")
+	}
+}
+
+func TestScrapePriorityAnnotation(t *testing.T) {
+	pm := &PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "ns1",
+			Name:        "name1",
+			Annotations: map[string]string{AnnotationScrapePriority: "7"},
+		},
+		Spec: PodMonitoringSpec{
+			Endpoints: []ScrapeEndpoint{{
+				Port:     intstr.FromString("web"),
+				Interval: "10s",
+			}},
+		},
+	}
+	scrapeCfgs, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "PodMonitoring/ns1/name1/web/priority=7"; scrapeCfgs[0].JobName != want {
+		t.Errorf("expected job name %q, got %q", want, scrapeCfgs[0].JobName)
+	}
+	if got := scrapeguard.ParsePriority(scrapeCfgs[0].JobName); got != 7 {
+		t.Errorf("expected priority 7 recovered from job name, got %d", got)
+	}
+
+	// The spec field takes precedence over the legacy annotation.
+	pm.Spec.Priority = 9
+	scrapeCfgs, err = pm.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scrapeguard.ParsePriority(scrapeCfgs[0].JobName); got != 9 {
+		t.Errorf("expected spec priority 9 to take precedence, got %d", got)
+	}
+
+	pm.Spec.Priority = 0
+	pm.Annotations[AnnotationScrapePriority] = "high"
+	if _, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster", "test_public_namespace"); err == nil {
+		t.Error("expected non-integer scrape priority to fail")
+	}
+}
+
+func TestPodMonitoring_EndpointTLS(t *testing.T) {
+	pm := &PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns1",
+			Name:      "name1",
+		},
+		Spec: PodMonitoringSpec{
+			Endpoints: []ScrapeEndpoint{{
+				Port:     intstr.FromString("web"),
+				Interval: "10s",
+				Scheme:   "https",
+				TLS: &TLSConfig{
+					CA: &SecretOrConfigMap{
+						ConfigMap: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "ca-bundle"},
+							Key:                  "ca.crt",
+						},
+					},
+					Cert: &SecretOrConfigMap{
+						Secret: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "client-tls"},
+							Key:                  "tls.crt",
+						},
+					},
+					KeySecret: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "client-tls"},
+						Key:                  "tls.key",
+					},
+					ServerName: "svc.example.com",
+				},
+			}},
+		},
+	}
+	scrapeCfgs, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster", "gmp-public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsCfg := scrapeCfgs[0].HTTPClientConfig.TLSConfig
+
+	if want := "/etc/secrets/configmap_gmp-public_ca-bundle_ca.crt"; tlsCfg.CAFile != want {
+		t.Errorf("expected CA file %q, got %q", want, tlsCfg.CAFile)
+	}
+	if want := "/etc/secrets/secret_gmp-public_client-tls_tls.crt"; tlsCfg.CertFile != want {
+		t.Errorf("expected cert file %q, got %q", want, tlsCfg.CertFile)
+	}
+	if want := "/etc/secrets/secret_gmp-public_client-tls_tls.key"; tlsCfg.KeyFile != want {
+		t.Errorf("expected key file %q, got %q", want, tlsCfg.KeyFile)
+	}
+	if tlsCfg.ServerName != "svc.example.com" {
+		t.Errorf("expected server name to be preserved, got %q", tlsCfg.ServerName)
+	}
 }
@@ -21,9 +21,31 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AlertPolicyExport) DeepCopyInto(out *AlertPolicyExport) {
+	*out = *in
+	if in.NotificationChannels != nil {
+		in, out := &in.NotificationChannels, &out.NotificationChannels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AlertPolicyExport.
+func (in *AlertPolicyExport) DeepCopy() *AlertPolicyExport {
+	if in == nil {
+		return nil
+	}
+	out := new(AlertPolicyExport)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AlertingSpec) DeepCopyInto(out *AlertingSpec) {
 	*out = *in
@@ -74,6 +96,27 @@ func (in *AlertmanagerEndpoints) DeepCopy() *AlertmanagerEndpoints {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnnotationScraping) DeepCopyInto(out *AnnotationScraping) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnnotationScraping.
+func (in *AnnotationScraping) DeepCopy() *AnnotationScraping {
+	if in == nil {
+		return nil
+	}
+	out := new(AnnotationScraping)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Authorization) DeepCopyInto(out *Authorization) {
 	*out = *in
@@ -95,6 +138,22 @@ func (in *Authorization) DeepCopy() *Authorization {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudRunDiscovery) DeepCopyInto(out *CloudRunDiscovery) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudRunDiscovery.
+func (in *CloudRunDiscovery) DeepCopy() *CloudRunDiscovery {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudRunDiscovery)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterPodMonitoring) DeepCopyInto(out *ClusterPodMonitoring) {
 	*out = *in
@@ -138,76 +197,796 @@ func (in *ClusterPodMonitoringList) DeepCopyInto(out *ClusterPodMonitoringList)
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPodMonitoringList.
-func (in *ClusterPodMonitoringList) DeepCopy() *ClusterPodMonitoringList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPodMonitoringList.
+func (in *ClusterPodMonitoringList) DeepCopy() *ClusterPodMonitoringList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPodMonitoringList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPodMonitoringList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPodMonitoringSpec) DeepCopyInto(out *ClusterPodMonitoringSpec) {
+	*out = *in
+	in.Selector.DeepCopyInto(&out.Selector)
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]ScrapeEndpoint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.TargetLabels.DeepCopyInto(&out.TargetLabels)
+	if in.Limits != nil {
+		in, out := &in.Limits, &out.Limits
+		*out = new(ScrapeLimits)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPodMonitoringSpec.
+func (in *ClusterPodMonitoringSpec) DeepCopy() *ClusterPodMonitoringSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPodMonitoringSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterRules) DeepCopyInto(out *ClusterRules) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRules.
+func (in *ClusterRules) DeepCopy() *ClusterRules {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterRules)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterRules) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterRulesList) DeepCopyInto(out *ClusterRulesList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterRules, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRulesList.
+func (in *ClusterRulesList) DeepCopy() *ClusterRulesList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterRulesList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterRulesList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterStaticMonitoring) DeepCopyInto(out *ClusterStaticMonitoring) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStaticMonitoring.
+func (in *ClusterStaticMonitoring) DeepCopy() *ClusterStaticMonitoring {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterStaticMonitoring)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterStaticMonitoring) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterStaticMonitoringList) DeepCopyInto(out *ClusterStaticMonitoringList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterStaticMonitoring, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStaticMonitoringList.
+func (in *ClusterStaticMonitoringList) DeepCopy() *ClusterStaticMonitoringList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterStaticMonitoringList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterStaticMonitoringList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterStaticMonitoringSpec) DeepCopyInto(out *ClusterStaticMonitoringSpec) {
+	*out = *in
+	if in.StaticTargets != nil {
+		in, out := &in.StaticTargets, &out.StaticTargets
+		*out = make([]StaticTarget, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.GoogleCloud != nil {
+		in, out := &in.GoogleCloud, &out.GoogleCloud
+		*out = new(GoogleCloudDiscovery)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Limits != nil {
+		in, out := &in.Limits, &out.Limits
+		*out = new(ScrapeLimits)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStaticMonitoringSpec.
+func (in *ClusterStaticMonitoringSpec) DeepCopy() *ClusterStaticMonitoringSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterStaticMonitoringSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CollectionOverride) DeepCopyInto(out *CollectionOverride) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CollectionOverride.
+func (in *CollectionOverride) DeepCopy() *CollectionOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(CollectionOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CollectionOverride) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CollectionOverrideList) DeepCopyInto(out *CollectionOverrideList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CollectionOverride, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CollectionOverrideList.
+func (in *CollectionOverrideList) DeepCopy() *CollectionOverrideList {
+	if in == nil {
+		return nil
+	}
+	out := new(CollectionOverrideList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CollectionOverrideList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CollectionOverrideSpec) DeepCopyInto(out *CollectionOverrideSpec) {
+	*out = *in
+	if in.ExternalLabels != nil {
+		in, out := &in.ExternalLabels, &out.ExternalLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Filter.DeepCopyInto(&out.Filter)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CollectionOverrideSpec.
+func (in *CollectionOverrideSpec) DeepCopy() *CollectionOverrideSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CollectionOverrideSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CollectionSpec) DeepCopyInto(out *CollectionSpec) {
+	*out = *in
+	if in.ExternalLabels != nil {
+		in, out := &in.ExternalLabels, &out.ExternalLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Filter.DeepCopyInto(&out.Filter)
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KubeletScraping != nil {
+		in, out := &in.KubeletScraping, &out.KubeletScraping
+		*out = new(KubeletScraping)
+		**out = **in
+	}
+	if in.ControlPlaneScraping != nil {
+		in, out := &in.ControlPlaneScraping, &out.ControlPlaneScraping
+		*out = new(ControlPlaneScraping)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KubeStateMetrics != nil {
+		in, out := &in.KubeStateMetrics, &out.KubeStateMetrics
+		*out = new(KubeStateMetricsSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeExporter != nil {
+		in, out := &in.NodeExporter, &out.NodeExporter
+		*out = new(NodeExporterSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IstioSidecarScraping != nil {
+		in, out := &in.IstioSidecarScraping, &out.IstioSidecarScraping
+		*out = new(IstioSidecarScraping)
+		**out = **in
+	}
+	if in.DCGMExporter != nil {
+		in, out := &in.DCGMExporter, &out.DCGMExporter
+		*out = new(DCGMExporterSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AnnotationScraping != nil {
+		in, out := &in.AnnotationScraping, &out.AnnotationScraping
+		*out = new(AnnotationScraping)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LocalStorage != nil {
+		in, out := &in.LocalStorage, &out.LocalStorage
+		*out = new(LocalStorageSpec)
+		**out = **in
+	}
+	if in.RemoteWrite != nil {
+		in, out := &in.RemoteWrite, &out.RemoteWrite
+		*out = new(RemoteWriteSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CredentialVolumes != nil {
+		in, out := &in.CredentialVolumes, &out.CredentialVolumes
+		*out = make([]CredentialVolume, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExtraMounts != nil {
+		in, out := &in.ExtraMounts, &out.ExtraMounts
+		*out = make([]ExtraMount, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceBudgets != nil {
+		in, out := &in.NamespaceBudgets, &out.NamespaceBudgets
+		*out = make([]NamespaceBudget, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CollectionSpec.
+func (in *CollectionSpec) DeepCopy() *CollectionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CollectionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControlPlaneScraping) DeepCopyInto(out *ControlPlaneScraping) {
+	*out = *in
+	if in.MatchOneOf != nil {
+		in, out := &in.MatchOneOf, &out.MatchOneOf
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControlPlaneScraping.
+func (in *ControlPlaneScraping) DeepCopy() *ControlPlaneScraping {
+	if in == nil {
+		return nil
+	}
+	out := new(ControlPlaneScraping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialVolume) DeepCopyInto(out *CredentialVolume) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialVolume.
+func (in *CredentialVolume) DeepCopy() *CredentialVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialVolume)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DCGMExporterSpec) DeepCopyInto(out *DCGMExporterSpec) {
+	*out = *in
+	if in.MetricAllowlist != nil {
+		in, out := &in.MetricAllowlist, &out.MetricAllowlist
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DCGMExporterSpec.
+func (in *DCGMExporterSpec) DeepCopy() *DCGMExporterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DCGMExporterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Dashboard) DeepCopyInto(out *Dashboard) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Dashboard.
+func (in *Dashboard) DeepCopy() *Dashboard {
+	if in == nil {
+		return nil
+	}
+	out := new(Dashboard)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Dashboard) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DashboardList) DeepCopyInto(out *DashboardList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Dashboard, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DashboardList.
+func (in *DashboardList) DeepCopy() *DashboardList {
+	if in == nil {
+		return nil
+	}
+	out := new(DashboardList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DashboardList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DashboardSpec) DeepCopyInto(out *DashboardSpec) {
+	*out = *in
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DashboardSpec.
+func (in *DashboardSpec) DeepCopy() *DashboardSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DashboardSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DashboardStatus) DeepCopyInto(out *DashboardStatus) {
+	*out = *in
+	in.MonitoringStatus.DeepCopyInto(&out.MonitoringStatus)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DashboardStatus.
+func (in *DashboardStatus) DeepCopy() *DashboardStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DashboardStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExportFilters) DeepCopyInto(out *ExportFilters) {
+	*out = *in
+	if in.MatchOneOf != nil {
+		in, out := &in.MatchOneOf, &out.MatchOneOf
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExportFilters.
+func (in *ExportFilters) DeepCopy() *ExportFilters {
+	if in == nil {
+		return nil
+	}
+	out := new(ExportFilters)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExporterSidecarSpec) DeepCopyInto(out *ExporterSidecarSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExporterSidecarSpec.
+func (in *ExporterSidecarSpec) DeepCopy() *ExporterSidecarSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ExporterSidecarSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExtraMount) DeepCopyInto(out *ExtraMount) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtraMount.
+func (in *ExtraMount) DeepCopy() *ExtraMount {
+	if in == nil {
+		return nil
+	}
+	out := new(ExtraMount)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCEInstanceDiscovery) DeepCopyInto(out *GCEInstanceDiscovery) {
+	*out = *in
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LabelFilters != nil {
+		in, out := &in.LabelFilters, &out.LabelFilters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCEInstanceDiscovery.
+func (in *GCEInstanceDiscovery) DeepCopy() *GCEInstanceDiscovery {
+	if in == nil {
+		return nil
+	}
+	out := new(GCEInstanceDiscovery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GlobalRules) DeepCopyInto(out *GlobalRules) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GlobalRules.
+func (in *GlobalRules) DeepCopy() *GlobalRules {
+	if in == nil {
+		return nil
+	}
+	out := new(GlobalRules)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *GlobalRules) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GlobalRulesList) DeepCopyInto(out *GlobalRulesList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]GlobalRules, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GlobalRulesList.
+func (in *GlobalRulesList) DeepCopy() *GlobalRulesList {
+	if in == nil {
+		return nil
+	}
+	out := new(GlobalRulesList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *GlobalRulesList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleCloudDiscovery) DeepCopyInto(out *GoogleCloudDiscovery) {
+	*out = *in
+	if in.GCEInstances != nil {
+		in, out := &in.GCEInstances, &out.GCEInstances
+		*out = make([]GCEInstanceDiscovery, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CloudRunServices != nil {
+		in, out := &in.CloudRunServices, &out.CloudRunServices
+		*out = make([]CloudRunDiscovery, len(*in))
+		copy(*out, *in)
+	}
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleCloudDiscovery.
+func (in *GoogleCloudDiscovery) DeepCopy() *GoogleCloudDiscovery {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleCloudDiscovery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GoogleIAMAuth) DeepCopyInto(out *GoogleIAMAuth) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GoogleIAMAuth.
+func (in *GoogleIAMAuth) DeepCopy() *GoogleIAMAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(GoogleIAMAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GrafanaDatasource) DeepCopyInto(out *GrafanaDatasource) {
+	*out = *in
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GrafanaDatasource.
+func (in *GrafanaDatasource) DeepCopy() *GrafanaDatasource {
 	if in == nil {
 		return nil
 	}
-	out := new(ClusterPodMonitoringList)
+	out := new(GrafanaDatasource)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *ClusterPodMonitoringList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ClusterPodMonitoringSpec) DeepCopyInto(out *ClusterPodMonitoringSpec) {
+func (in *GrafanaDatasourceStatus) DeepCopyInto(out *GrafanaDatasourceStatus) {
 	*out = *in
-	in.Selector.DeepCopyInto(&out.Selector)
-	if in.Endpoints != nil {
-		in, out := &in.Endpoints, &out.Endpoints
-		*out = make([]ScrapeEndpoint, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-	in.TargetLabels.DeepCopyInto(&out.TargetLabels)
-	if in.Limits != nil {
-		in, out := &in.Limits, &out.Limits
-		*out = new(ScrapeLimits)
-		**out = **in
-	}
+	in.LastSyncTime.DeepCopyInto(&out.LastSyncTime)
+	in.TokenExpireTime.DeepCopyInto(&out.TokenExpireTime)
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPodMonitoringSpec.
-func (in *ClusterPodMonitoringSpec) DeepCopy() *ClusterPodMonitoringSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GrafanaDatasourceStatus.
+func (in *GrafanaDatasourceStatus) DeepCopy() *GrafanaDatasourceStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(ClusterPodMonitoringSpec)
+	out := new(GrafanaDatasourceStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ClusterRules) DeepCopyInto(out *ClusterRules) {
+func (in *GrafanaDatasourceSync) DeepCopyInto(out *GrafanaDatasourceSync) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRules.
-func (in *ClusterRules) DeepCopy() *ClusterRules {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GrafanaDatasourceSync.
+func (in *GrafanaDatasourceSync) DeepCopy() *GrafanaDatasourceSync {
 	if in == nil {
 		return nil
 	}
-	out := new(ClusterRules)
+	out := new(GrafanaDatasourceSync)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *ClusterRules) DeepCopyObject() runtime.Object {
+func (in *GrafanaDatasourceSync) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -215,13 +994,13 @@ func (in *ClusterRules) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ClusterRulesList) DeepCopyInto(out *ClusterRulesList) {
+func (in *GrafanaDatasourceSyncList) DeepCopyInto(out *GrafanaDatasourceSyncList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]ClusterRules, len(*in))
+		*out = make([]GrafanaDatasourceSync, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -229,18 +1008,18 @@ func (in *ClusterRulesList) DeepCopyInto(out *ClusterRulesList) {
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRulesList.
-func (in *ClusterRulesList) DeepCopy() *ClusterRulesList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GrafanaDatasourceSyncList.
+func (in *GrafanaDatasourceSyncList) DeepCopy() *GrafanaDatasourceSyncList {
 	if in == nil {
 		return nil
 	}
-	out := new(ClusterRulesList)
+	out := new(GrafanaDatasourceSyncList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *ClusterRulesList) DeepCopyObject() runtime.Object {
+func (in *GrafanaDatasourceSyncList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -248,121 +1027,93 @@ func (in *ClusterRulesList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CollectionSpec) DeepCopyInto(out *CollectionSpec) {
+func (in *GrafanaDatasourceSyncSpec) DeepCopyInto(out *GrafanaDatasourceSyncSpec) {
 	*out = *in
-	if in.ExternalLabels != nil {
-		in, out := &in.ExternalLabels, &out.ExternalLabels
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
-	}
-	in.Filter.DeepCopyInto(&out.Filter)
-	if in.Credentials != nil {
-		in, out := &in.Credentials, &out.Credentials
+	if in.GrafanaSecret != nil {
+		in, out := &in.GrafanaSecret, &out.GrafanaSecret
 		*out = new(corev1.SecretKeySelector)
 		(*in).DeepCopyInto(*out)
 	}
-	if in.KubeletScraping != nil {
-		in, out := &in.KubeletScraping, &out.KubeletScraping
-		*out = new(KubeletScraping)
-		**out = **in
+	if in.Datasources != nil {
+		in, out := &in.Datasources, &out.Datasources
+		*out = make([]GrafanaDatasource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CollectionSpec.
-func (in *CollectionSpec) DeepCopy() *CollectionSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GrafanaDatasourceSyncSpec.
+func (in *GrafanaDatasourceSyncSpec) DeepCopy() *GrafanaDatasourceSyncSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(CollectionSpec)
+	out := new(GrafanaDatasourceSyncSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ExportFilters) DeepCopyInto(out *ExportFilters) {
+func (in *GrafanaDatasourceSyncStatus) DeepCopyInto(out *GrafanaDatasourceSyncStatus) {
 	*out = *in
-	if in.MatchOneOf != nil {
-		in, out := &in.MatchOneOf, &out.MatchOneOf
-		*out = make([]string, len(*in))
-		copy(*out, *in)
+	if in.Datasources != nil {
+		in, out := &in.Datasources, &out.Datasources
+		*out = make([]GrafanaDatasourceStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExportFilters.
-func (in *ExportFilters) DeepCopy() *ExportFilters {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GrafanaDatasourceSyncStatus.
+func (in *GrafanaDatasourceSyncStatus) DeepCopy() *GrafanaDatasourceSyncStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(ExportFilters)
+	out := new(GrafanaDatasourceSyncStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GlobalRules) DeepCopyInto(out *GlobalRules) {
+func (in *IstioSidecarScraping) DeepCopyInto(out *IstioSidecarScraping) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GlobalRules.
-func (in *GlobalRules) DeepCopy() *GlobalRules {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IstioSidecarScraping.
+func (in *IstioSidecarScraping) DeepCopy() *IstioSidecarScraping {
 	if in == nil {
 		return nil
 	}
-	out := new(GlobalRules)
+	out := new(IstioSidecarScraping)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *GlobalRules) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GlobalRulesList) DeepCopyInto(out *GlobalRulesList) {
+func (in *KubeStateMetricsSpec) DeepCopyInto(out *KubeStateMetricsSpec) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]GlobalRules, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.MetricAllowlist != nil {
+		in, out := &in.MetricAllowlist, &out.MetricAllowlist
+		*out = make([]string, len(*in))
+		copy(*out, *in)
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GlobalRulesList.
-func (in *GlobalRulesList) DeepCopy() *GlobalRulesList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeStateMetricsSpec.
+func (in *KubeStateMetricsSpec) DeepCopy() *KubeStateMetricsSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(GlobalRulesList)
+	out := new(KubeStateMetricsSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *GlobalRulesList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubeletScraping) DeepCopyInto(out *KubeletScraping) {
 	*out = *in
@@ -395,6 +1146,22 @@ func (in *LabelMapping) DeepCopy() *LabelMapping {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalStorageSpec) DeepCopyInto(out *LocalStorageSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalStorageSpec.
+func (in *LocalStorageSpec) DeepCopy() *LocalStorageSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalStorageSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManagedAlertmanagerSpec) DeepCopyInto(out *ManagedAlertmanagerSpec) {
 	*out = *in
@@ -417,19 +1184,77 @@ func (in *ManagedAlertmanagerSpec) DeepCopy() *ManagedAlertmanagerSpec {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MonitoringCondition) DeepCopyInto(out *MonitoringCondition) {
+func (in *MonitoringStatus) DeepCopyInto(out *MonitoringStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MonitoringStatus.
+func (in *MonitoringStatus) DeepCopy() *MonitoringStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MonitoringStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceBudget) DeepCopyInto(out *NamespaceBudget) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceBudget.
+func (in *NamespaceBudget) DeepCopy() *NamespaceBudget {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceBudget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeExporterSpec) DeepCopyInto(out *NodeExporterSpec) {
+	*out = *in
+	if in.EnabledCollectors != nil {
+		in, out := &in.EnabledCollectors, &out.EnabledCollectors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeExporterSpec.
+func (in *NodeExporterSpec) DeepCopy() *NodeExporterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeExporterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OTLPReceiverSpec) DeepCopyInto(out *OTLPReceiverSpec) {
 	*out = *in
-	in.LastUpdateTime.DeepCopyInto(&out.LastUpdateTime)
-	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MonitoringCondition.
-func (in *MonitoringCondition) DeepCopy() *MonitoringCondition {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OTLPReceiverSpec.
+func (in *OTLPReceiverSpec) DeepCopy() *OTLPReceiverSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(MonitoringCondition)
+	out := new(OTLPReceiverSpec)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -446,6 +1271,27 @@ func (in *OperatorConfig) DeepCopyInto(out *OperatorConfig) {
 		*out = new(ManagedAlertmanagerSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ManagedPushGateway != nil {
+		in, out := &in.ManagedPushGateway, &out.ManagedPushGateway
+		*out = new(PushGatewaySpec)
+		**out = **in
+	}
+	if in.ManagedExporter != nil {
+		in, out := &in.ManagedExporter, &out.ManagedExporter
+		*out = new(ExporterSidecarSpec)
+		**out = **in
+	}
+	if in.ManagedOTLPReceiver != nil {
+		in, out := &in.ManagedOTLPReceiver, &out.ManagedOTLPReceiver
+		*out = new(OTLPReceiverSpec)
+		**out = **in
+	}
+	if in.Proxy != nil {
+		in, out := &in.Proxy, &out.Proxy
+		*out = new(ProxyConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -594,13 +1440,7 @@ func (in *PodMonitoringSpec) DeepCopy() *PodMonitoringSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodMonitoringStatus) DeepCopyInto(out *PodMonitoringStatus) {
 	*out = *in
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]MonitoringCondition, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
+	in.MonitoringStatus.DeepCopyInto(&out.MonitoringStatus)
 	return
 }
 
@@ -614,6 +1454,43 @@ func (in *PodMonitoringStatus) DeepCopy() *PodMonitoringStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyConfig) DeepCopyInto(out *ProxyConfig) {
+	*out = *in
+	if in.TrustedCA != nil {
+		in, out := &in.TrustedCA, &out.TrustedCA
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyConfig.
+func (in *ProxyConfig) DeepCopy() *ProxyConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PushGatewaySpec) DeepCopyInto(out *PushGatewaySpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushGatewaySpec.
+func (in *PushGatewaySpec) DeepCopy() *PushGatewaySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PushGatewaySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RelabelingRule) DeepCopyInto(out *RelabelingRule) {
 	*out = *in
@@ -635,6 +1512,23 @@ func (in *RelabelingRule) DeepCopy() *RelabelingRule {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RemoteWriteSpec) DeepCopyInto(out *RemoteWriteSpec) {
+	*out = *in
+	in.Filter.DeepCopyInto(&out.Filter)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RemoteWriteSpec.
+func (in *RemoteWriteSpec) DeepCopy() *RemoteWriteSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RemoteWriteSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Rule) DeepCopyInto(out *Rule) {
 	*out = *in
@@ -681,6 +1575,11 @@ func (in *RuleEvaluatorSpec) DeepCopyInto(out *RuleEvaluatorSpec) {
 		*out = new(corev1.SecretKeySelector)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ExtraMounts != nil {
+		in, out := &in.ExtraMounts, &out.ExtraMounts
+		*out = make([]ExtraMount, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -697,6 +1596,11 @@ func (in *RuleEvaluatorSpec) DeepCopy() *RuleEvaluatorSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RuleGroup) DeepCopyInto(out *RuleGroup) {
 	*out = *in
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Rules != nil {
 		in, out := &in.Rules, &out.Rules
 		*out = make([]Rule, len(*in))
@@ -723,7 +1627,7 @@ func (in *Rules) DeepCopyInto(out *Rules) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -788,6 +1692,11 @@ func (in *RulesSpec) DeepCopyInto(out *RulesSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.AlertPolicies != nil {
+		in, out := &in.AlertPolicies, &out.AlertPolicies
+		*out = new(AlertPolicyExport)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -804,6 +1713,7 @@ func (in *RulesSpec) DeepCopy() *RulesSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RulesStatus) DeepCopyInto(out *RulesStatus) {
 	*out = *in
+	in.MonitoringStatus.DeepCopyInto(&out.MonitoringStatus)
 	return
 }
 
@@ -843,6 +1753,16 @@ func (in *ScrapeEndpoint) DeepCopyInto(out *ScrapeEndpoint) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.GoogleIAMAuth != nil {
+		in, out := &in.GoogleIAMAuth, &out.GoogleIAMAuth
+		*out = new(GoogleIAMAuth)
+		**out = **in
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(TLSConfig)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -898,6 +1818,29 @@ func (in *SecretOrConfigMap) DeepCopy() *SecretOrConfigMap {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticTarget) DeepCopyInto(out *StaticTarget) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticTarget.
+func (in *StaticTarget) DeepCopy() *StaticTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TLSConfig) DeepCopyInto(out *TLSConfig) {
 	*out = *in
@@ -0,0 +1,85 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// applyObject reconciles the given object with server-side apply under the
+// operator's field manager. Unlike an update, fields that are not part of the
+// given object, e.g. labels added by other controllers on generated workloads,
+// are left untouched and remain owned by whoever set them.
+//
+// Conflicts with fields owned by other managers are first reported through the
+// logger and then resolved in the operator's favor. They regularly occur when
+// taking ownership of fields that a previous operator version wrote with plain
+// updates, and the operator must own the fields it generates to reconcile them.
+func applyObject(ctx context.Context, c client.Client, obj client.Object, opts ...client.PatchOption) error {
+	logger, _ := logr.FromContext(ctx)
+
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return errors.Wrap(err, "determine object kind")
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	// The apply payload must not contain fields the server populates.
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+
+	opts = append([]client.PatchOption{client.FieldOwner(NameOperator)}, opts...)
+
+	err = c.Patch(ctx, obj, client.Apply, opts...)
+	if !apierrors.IsConflict(err) {
+		return err
+	}
+	logger.Info("overriding field ownership conflict on apply",
+		"kind", gvk.Kind, "namespace", obj.GetNamespace(), "name", obj.GetName(), "conflict", err.Error())
+
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+	return c.Patch(ctx, obj, client.Apply, append(opts, client.ForceOwnership)...)
+}
+
+// maxDiffEventLen bounds the diff included in emitted events, which must stay
+// well below the size limit on event messages. The full diff is logged.
+const maxDiffEventLen = 1024
+
+// podTemplateDiff returns a human-readable diff between the live and updated
+// pod template of a managed workload, or an empty string if nothing changed.
+// Any non-empty diff implies a rollout of the workload's pods.
+func podTemplateDiff(live, updated corev1.PodTemplateSpec) string {
+	return cmp.Diff(live, updated, cmp.Comparer(func(a, b resource.Quantity) bool {
+		return a.Cmp(b) == 0
+	}))
+}
+
+// truncateDiff shortens a diff to the length permitted in event messages.
+func truncateDiff(diff string) string {
+	if len(diff) > maxDiffEventLen {
+		return diff[:maxDiffEventLen] + "\n(truncated)"
+	}
+	return diff
+}
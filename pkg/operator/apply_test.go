@@ -0,0 +1,47 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPodTemplateDiff(t *testing.T) {
+	live := corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "evaluator",
+				Env:  []corev1.EnvVar{{Name: "EXTRA_ARGS", Value: "--a"}},
+			}},
+		},
+	}
+	if diff := podTemplateDiff(live, *live.DeepCopy()); diff != "" {
+		t.Errorf("expected empty diff for identical templates, got %s", diff)
+	}
+
+	updated := *live.DeepCopy()
+	updated.Spec.Containers[0].Env[0].Value = "--b"
+	diff := podTemplateDiff(live, updated)
+	if !strings.Contains(diff, "--a") || !strings.Contains(diff, "--b") {
+		t.Errorf("expected diff to contain both env values, got %s", diff)
+	}
+
+	if got := truncateDiff(strings.Repeat("x", 2*maxDiffEventLen)); len(got) > maxDiffEventLen+len("\n(truncated)") {
+		t.Errorf("diff not truncated, got length %d", len(got))
+	}
+}
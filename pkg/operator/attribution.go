@@ -0,0 +1,68 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// AnnotationSourceAttribution is the annotation set on generated ConfigMaps
+// and Secrets that maps each generated entry, i.e. scrape job, rule file, or
+// secret key, to the custom resource it originates from. It allows tracing
+// any part of the generated configuration back to its source object.
+const AnnotationSourceAttribution = "monitoring.googleapis.com/source-attribution"
+
+// SourceRef identifies the custom resource a generated configuration entry
+// originates from.
+type SourceRef struct {
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid,omitempty"`
+	Generation int64     `json:"generation,omitempty"`
+}
+
+func sourceRef(kind string, obj metav1.Object) SourceRef {
+	return SourceRef{
+		Kind:       kind,
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		UID:        obj.GetUID(),
+		Generation: obj.GetGeneration(),
+	}
+}
+
+// sourceAttributionAnnotation encodes the entry-to-source mapping as the
+// value of the attribution annotation.
+func sourceAttributionAnnotation(entries map[string]SourceRef) (string, error) {
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal source attribution")
+	}
+	return string(b), nil
+}
+
+// ParseSourceAttribution decodes the value of the attribution annotation.
+func ParseSourceAttribution(s string) (map[string]SourceRef, error) {
+	entries := map[string]SourceRef{}
+	if err := json.Unmarshal([]byte(s), &entries); err != nil {
+		return nil, errors.Wrap(err, "unmarshal source attribution")
+	}
+	return entries, nil
+}
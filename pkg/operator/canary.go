@@ -0,0 +1,121 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/scrapeguard"
+)
+
+const (
+	// NameCollectorCanary is the name of the optional canary collector DaemonSet
+	// and of the ConfigMap holding the config under canary evaluation.
+	NameCollectorCanary = "collector-canary"
+
+	// annotationConfigHash carries the hash of the generated configuration a
+	// canary ConfigMap holds.
+	annotationConfigHash = "monitoring.googleapis.com/config-hash"
+	// annotationRolloutStart carries the RFC3339 time at which the
+	// configuration under the config-hash annotation was applied to canaries.
+	annotationRolloutStart = "monitoring.googleapis.com/config-rollout-start"
+
+	// canaryHealthyTargetRatio is the minimum fraction of up targets across
+	// canary collectors required to promote a configuration fleet-wide.
+	canaryHealthyTargetRatio = 0.9
+
+	// collectorWebPort is the port of the collector's Prometheus web server,
+	// used to inspect scrape health through the API server's pod proxy.
+	collectorWebPort = 19090
+)
+
+// canaryTargetsResponse mirrors the relevant fields of the Prometheus
+// /api/v1/targets response.
+type canaryTargetsResponse struct {
+	Data struct {
+		ActiveTargets []struct {
+			Health     string `json:"health"`
+			ScrapePool string `json:"scrapePool"`
+		} `json:"activeTargets"`
+	} `json:"data"`
+}
+
+// canaryCollectorsHealthy reports whether the canary collectors scrape their
+// targets successfully. Collectors that are not running yet are ignored; a
+// canary that cannot be reached counts as unhealthy. Without any canary
+// collectors deployed there is nothing to validate against and the
+// configuration is considered safe to promote.
+func canaryCollectorsHealthy(ctx context.Context, kubeClient kubernetes.Interface, namespace string) (bool, error) {
+	logger, _ := logr.FromContext(ctx)
+
+	pods, err := kubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", LabelAppName, NameCollectorCanary),
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "list canary collector pods")
+	}
+	var total, up int
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		b, err := kubeClient.CoreV1().RESTClient().Get().
+			Namespace(namespace).
+			Resource("pods").
+			Name(fmt.Sprintf("%s:%d", pod.Name, collectorWebPort)).
+			SubResource("proxy").
+			Suffix("api/v1/targets").
+			DoRaw(ctx)
+		if err != nil {
+			logger.Error(err, "canary collector unreachable", "pod", pod.Name)
+			return false, nil
+		}
+		var resp canaryTargetsResponse
+		if err := json.Unmarshal(b, &resp); err != nil {
+			return false, errors.Wrapf(err, "decode targets response from pod %q", pod.Name)
+		}
+		for _, t := range resp.Data.ActiveTargets {
+			total++
+			if t.Health == "up" {
+				up++
+			} else if scrapeguard.ParsePriority(t.ScrapePool) > 0 {
+				// Failing scrapes of resources marked as priority always
+				// block promotion, regardless of the overall target health.
+				logger.Info("canary target of prioritized resource unhealthy", "pod", pod.Name, "scrape_pool", t.ScrapePool)
+				return false, nil
+			}
+		}
+	}
+	if total == 0 {
+		return true, nil
+	}
+	return float64(up)/float64(total) >= canaryHealthyTargetRatio, nil
+}
+
+// hashConfig returns a stable hash of the given serialized configuration.
+func hashConfig(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
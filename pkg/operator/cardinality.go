@@ -0,0 +1,268 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// cardinalityReportInterval is the interval at which series counts are
+	// collected from the collectors and the report is regenerated.
+	cardinalityReportInterval = 30 * time.Minute
+
+	// NameCardinalityReport is the name of the ConfigMap holding the latest
+	// cardinality report in the operator namespace.
+	NameCardinalityReport = "cardinality-report"
+	// cardinalityReportKey is the data key of the report within the ConfigMap.
+	cardinalityReportKey = "report.yaml"
+
+	// cardinalityReportTopK caps the number of entries per report section.
+	cardinalityReportTopK = 25
+)
+
+// cardinalityReport ranks metric names, namespaces, and scrape configurations
+// by their active series contribution across all collectors.
+type cardinalityReport struct {
+	// Time at which the report was generated.
+	GeneratedAt metav1.Time `yaml:"generatedAt"`
+	// Number of collector pods that contributed to the report.
+	Collectors int `yaml:"collectors"`
+	// Total number of active series across all collectors.
+	TotalSeries int64 `yaml:"totalSeries"`
+	// Top metric names by series count.
+	Metrics []cardinalityEntry `yaml:"metrics"`
+	// Top target namespaces by series count.
+	Namespaces []cardinalityEntry `yaml:"namespaces"`
+	// Top scrape jobs, i.e. PodMonitoring and ClusterPodMonitoring
+	// configurations, by series count.
+	Jobs []cardinalityEntry `yaml:"jobs"`
+}
+
+type cardinalityEntry struct {
+	Name   string `yaml:"name"`
+	Series int64  `yaml:"series"`
+}
+
+// runCardinalityReports periodically aggregates per-metric, per-namespace,
+// and per-job active series counts from the collectors' local TSDBs and
+// publishes them as a ranked report in a ConfigMap. The report points users
+// at the largest series contributors when reducing metric volume and cost.
+func (o *Operator) runCardinalityReports(ctx context.Context) {
+	kubeClient, err := kubernetes.NewForConfig(o.manager.GetConfig())
+	if err != nil {
+		o.logger.Error(err, "build Kubernetes clientset for cardinality reports")
+		return
+	}
+	ticker := time.NewTicker(cardinalityReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := o.updateCardinalityReport(ctx, kubeClient); err != nil {
+				o.logger.Error(err, "update cardinality report")
+			}
+		}
+	}
+}
+
+func (o *Operator) updateCardinalityReport(ctx context.Context, kubeClient kubernetes.Interface) error {
+	pods, err := kubeClient.CoreV1().Pods(o.opts.OperatorNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", LabelAppName, NameCollector),
+	})
+	if err != nil {
+		return errors.Wrap(err, "list collector pods")
+	}
+	var (
+		report     = cardinalityReport{GeneratedAt: metav1.Now()}
+		metrics    = map[string]int64{}
+		namespaces = map[string]int64{}
+		jobs       = map[string]int64{}
+	)
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		// Count active series per metric name and per job/namespace pair in the
+		// collector's local TSDB. Series that were dropped from the head block
+		// already are not part of the report.
+		byMetric, err := queryCollectorVector(ctx, kubeClient, &pod, `count by (__name__) ({__name__!=""})`)
+		if err != nil {
+			// Unreachable collectors are expected during rollouts. Skip them
+			// rather than failing the whole round.
+			o.logger.V(1).Info("querying collector series counts failed", "pod", pod.Name, "err", err)
+			continue
+		}
+		byTarget, err := queryCollectorVector(ctx, kubeClient, &pod, `count by (job, namespace) ({__name__!=""})`)
+		if err != nil {
+			o.logger.V(1).Info("querying collector series counts failed", "pod", pod.Name, "err", err)
+			continue
+		}
+		for _, s := range byMetric {
+			metrics[s.metric["__name__"]] += int64(s.value)
+			report.TotalSeries += int64(s.value)
+		}
+		for _, s := range byTarget {
+			namespaces[s.metric["namespace"]] += int64(s.value)
+			jobs[s.metric["job"]] += int64(s.value)
+		}
+		report.Collectors++
+	}
+	if err := o.checkNamespaceBudgets(ctx, namespaces); err != nil {
+		o.logger.Error(err, "check namespace budgets")
+	}
+	report.Metrics = rankCardinality(metrics)
+	report.Namespaces = rankCardinality(namespaces)
+	report.Jobs = rankCardinality(jobs)
+
+	b, err := yaml.Marshal(report)
+	if err != nil {
+		return errors.Wrap(err, "marshal cardinality report")
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: o.opts.OperatorNamespace,
+			Name:      NameCardinalityReport,
+		},
+		Data: map[string]string{
+			cardinalityReportKey: string(b),
+		},
+	}
+	_, err = kubeClient.CoreV1().ConfigMaps(o.opts.OperatorNamespace).Update(ctx, cm, metav1.UpdateOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = kubeClient.CoreV1().ConfigMaps(o.opts.OperatorNamespace).Create(ctx, cm, metav1.CreateOptions{})
+	}
+	return errors.Wrap(err, "write cardinality report ConfigMap")
+}
+
+// checkNamespaceBudgets compares the namespaces' active series counts against
+// the budgets configured in the OperatorConfig and exposes the excess per
+// namespace as an operator metric for alerting.
+func (o *Operator) checkNamespaceBudgets(ctx context.Context, seriesByNamespace map[string]int64) error {
+	var config monitoringv1.OperatorConfig
+	err := o.client.Get(ctx, client.ObjectKey{Namespace: o.opts.PublicNamespace, Name: NameOperatorConfig}, &config)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "get operatorconfig")
+	}
+	o.metrics.namespaceSeriesOverBudget.Reset()
+
+	for _, b := range config.Collection.NamespaceBudgets {
+		if b.MaxSeries <= 0 {
+			continue
+		}
+		excess := seriesByNamespace[b.Namespace] - b.MaxSeries
+		if excess < 0 {
+			excess = 0
+		} else if excess > 0 {
+			o.logger.Info("namespace exceeds its series budget",
+				"namespace", b.Namespace, "series", seriesByNamespace[b.Namespace], "budget", b.MaxSeries)
+		}
+		o.metrics.namespaceSeriesOverBudget.WithLabelValues(b.Namespace).Set(float64(excess))
+	}
+	return nil
+}
+
+// rankCardinality turns the aggregated counts into a ranked report section,
+// capped at the top contributors.
+func rankCardinality(counts map[string]int64) []cardinalityEntry {
+	entries := make([]cardinalityEntry, 0, len(counts))
+	for name, series := range counts {
+		entries = append(entries, cardinalityEntry{Name: name, Series: series})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Series != entries[j].Series {
+			return entries[i].Series > entries[j].Series
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if len(entries) > cardinalityReportTopK {
+		entries = entries[:cardinalityReportTopK]
+	}
+	return entries
+}
+
+type vectorSample struct {
+	metric map[string]string
+	value  float64
+}
+
+// queryCollectorVector evaluates an instant query against the Prometheus web
+// endpoint of the given collector pod via the API server's pod proxy and
+// returns the resulting vector.
+func queryCollectorVector(ctx context.Context, kubeClient kubernetes.Interface, pod *corev1.Pod, query string) ([]vectorSample, error) {
+	b, err := kubeClient.CoreV1().RESTClient().Get().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(fmt.Sprintf("%s:%d", pod.Name, collectorWebPort)).
+		SubResource("proxy").
+		Suffix("api/v1/query").
+		Param("query", query).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Status string `json:"status"`
+		Data   struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Metric map[string]string `json:"metric"`
+				Value  []interface{}     `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, errors.Wrap(err, "unmarshal query response")
+	}
+	if resp.Status != "success" || resp.Data.ResultType != "vector" {
+		return nil, errors.Errorf("unexpected query response of status %q and type %q", resp.Status, resp.Data.ResultType)
+	}
+	var samples []vectorSample
+	for _, r := range resp.Data.Result {
+		if len(r.Value) != 2 {
+			return nil, errors.Errorf("unexpected sample value %v", r.Value)
+		}
+		s, ok := r.Value[1].(string)
+		if !ok {
+			return nil, errors.Errorf("unexpected sample value %v", r.Value)
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse sample value")
+		}
+		samples = append(samples, vectorSample{metric: r.Metric, value: v})
+	}
+	return samples, nil
+}
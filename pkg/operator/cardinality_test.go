@@ -0,0 +1,49 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRankCardinality(t *testing.T) {
+	counts := map[string]int64{
+		"up":                  10,
+		"http_requests_total": 1000,
+		"go_goroutines":       10,
+		"process_cpu_seconds": 50,
+	}
+	want := []cardinalityEntry{
+		{Name: "http_requests_total", Series: 1000},
+		{Name: "process_cpu_seconds", Series: 50},
+		// Ties are broken by name for a stable report.
+		{Name: "go_goroutines", Series: 10},
+		{Name: "up", Series: 10},
+	}
+	if diff := cmp.Diff(want, rankCardinality(counts)); diff != "" {
+		t.Fatalf("unexpected ranking (-want, +got): %s", diff)
+	}
+
+	// Sections are capped at the top contributors.
+	for i := 0; i < 2*cardinalityReportTopK; i++ {
+		counts[fmt.Sprintf("metric_%d", i)] = int64(i + 2000)
+	}
+	if got := len(rankCardinality(counts)); got != cardinalityReportTopK {
+		t.Fatalf("expected ranking to be capped at %d entries, got %d", cardinalityReportTopK, got)
+	}
+}
@@ -16,10 +16,15 @@ package operator
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"path"
+	"reflect"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
@@ -30,6 +35,7 @@ import (
 	discoverykube "github.com/prometheus/prometheus/discovery/kubernetes"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/promql/parser"
 	yaml "gopkg.in/yaml.v3"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -37,6 +43,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -49,6 +58,10 @@ import (
 )
 
 func setupCollectionControllers(op *Operator) error {
+	kubeClient, err := kubernetes.NewForConfig(op.manager.GetConfig())
+	if err != nil {
+		return errors.Wrap(err, "build Kubernetes clientset")
+	}
 	// The singleton OperatorConfig is the request object we reconcile against.
 	objRequest := reconcile.Request{
 		NamespacedName: types.NamespacedName{
@@ -66,6 +79,11 @@ func setupCollectionControllers(op *Operator) error {
 		namespace: op.opts.OperatorNamespace,
 		name:      NameCollector,
 	}
+	// Canary collector ConfigMap filter.
+	objFilterCollectorCanary := namespacedNamePredicate{
+		namespace: op.opts.OperatorNamespace,
+		name:      NameCollectorCanary,
+	}
 	// Collector secret.
 	objFilterSecret := namespacedNamePredicate{
 		namespace: op.opts.OperatorNamespace,
@@ -73,7 +91,7 @@ func setupCollectionControllers(op *Operator) error {
 	}
 
 	// Reconcile the generated Prometheus configuration that is used by all collectors.
-	err := ctrl.NewControllerManagedBy(op.manager).
+	err = ctrl.NewControllerManagedBy(op.manager).
 		Named("collector-config").
 		// Filter events without changes for all watches.
 		WithEventFilter(predicate.ResourceVersionChangedPredicate{}).
@@ -95,12 +113,30 @@ func setupCollectionControllers(op *Operator) error {
 			enqueueConst(objRequest),
 			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
 		).
+		// CollectionOverrides adjust the generated config for their namespace.
+		Watches(
+			&source.Kind{Type: &monitoringv1.CollectionOverride{}},
+			enqueueConst(objRequest),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		// Any update to a ClusterStaticMonitoring requires regenerating the config.
+		Watches(
+			&source.Kind{Type: &monitoringv1.ClusterStaticMonitoring{}},
+			enqueueConst(objRequest),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
 		// The configuration we generate for the collectors.
 		Watches(
 			&source.Kind{Type: &corev1.ConfigMap{}},
 			enqueueConst(objRequest),
 			builder.WithPredicates(objFilterCollector),
 		).
+		// The configuration staged on the canary collectors.
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			enqueueConst(objRequest),
+			builder.WithPredicates(objFilterCollectorCanary),
+		).
 		// Detect and undo changes to the daemon set.
 		Watches(
 			&source.Kind{Type: &appsv1.DaemonSet{}},
@@ -114,7 +150,18 @@ func setupCollectionControllers(op *Operator) error {
 			source.NewKindWithCache(&corev1.Secret{}, op.managedNamespacesCache),
 			enqueueConst(objRequest),
 			builder.WithPredicates(objFilterSecret)).
-		Complete(newCollectionReconciler(op.manager.GetClient(), op.opts))
+		// Secrets and ConfigMaps in the public namespace may be referenced by
+		// scrape endpoints. Changes must be propagated into the collector
+		// secret and the generated configuration.
+		Watches(
+			source.NewKindWithCache(&corev1.Secret{}, op.managedNamespacesCache),
+			enqueueConst(objRequest),
+			builder.WithPredicates(predicate.NewPredicateFuncs(secretFilter(op.opts.PublicNamespace)))).
+		Watches(
+			source.NewKindWithCache(&corev1.ConfigMap{}, op.managedNamespacesCache),
+			enqueueConst(objRequest),
+			builder.WithPredicates(predicate.NewPredicateFuncs(configMapFilter(op.opts.PublicNamespace)))).
+		Complete(newCollectionReconciler(op.manager.GetClient(), op.managedNamespacesCache, kubeClient, op.opts, op.metrics, op.manager.GetEventRecorderFor(NameOperator)))
 	if err != nil {
 		return errors.Wrap(err, "create collector config controller")
 	}
@@ -122,21 +169,42 @@ func setupCollectionControllers(op *Operator) error {
 }
 
 type collectionReconciler struct {
-	client        client.Client
+	client client.Client
+	// Reader against the operator and public namespaces for resolving
+	// user-provided Secret and ConfigMap references, which the cache of the
+	// default client does not cover.
+	reader     client.Reader
+	kubeClient kubernetes.Interface
 	opts          Options
+	metrics       *operatorMetrics
+	recorder      record.EventRecorder
 	statusUpdates []client.Object
+	// Cached result of the native sidecar support detection.
+	nativeSidecars *bool
+	// Per-resource cache of rendered scrape configs so unchanged
+	// PodMonitorings are not re-rendered on every reconciliation.
+	scrapeCache *scrapeConfigCache
+	// Last write time per generated config ConfigMap, used to coalesce rapid
+	// config changes into a single write.
+	lastConfigWrite map[string]time.Time
 }
 
-func newCollectionReconciler(c client.Client, opts Options) *collectionReconciler {
+func newCollectionReconciler(c client.Client, reader client.Reader, kubeClient kubernetes.Interface, opts Options, metrics *operatorMetrics, recorder record.EventRecorder) *collectionReconciler {
 	return &collectionReconciler{
-		client: c,
-		opts:   opts,
+		client:          c,
+		reader:          reader,
+		kubeClient:      kubeClient,
+		opts:            opts,
+		metrics:         metrics,
+		recorder:        recorder,
+		scrapeCache:     newScrapeConfigCache(),
+		lastConfigWrite: map[string]time.Time{},
 	}
 }
 
 func (r *collectionReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
 	logger, _ := logr.FromContext(ctx)
-	logger.Info("reconciling collection")
+	logger.WithValues("collection", req.NamespacedName).Info("reconciling collection")
 
 	var config monitoringv1.OperatorConfig
 	// Fetch OperatorConfig if it exists.
@@ -145,16 +213,30 @@ func (r *collectionReconciler) Reconcile(ctx context.Context, req reconcile.Requ
 	} else if err != nil {
 		return reconcile.Result{}, errors.Wrapf(err, "get operatorconfig for incoming: %q", req.String())
 	}
+	if isPaused(&config) {
+		logger.Info("reconciliation paused via annotation")
+		return reconcile.Result{}, nil
+	}
 
-	if err := r.ensureCollectorSecrets(ctx, &config.Collection); err != nil {
+	if err := r.ensureCollectorSecrets(ctx, &config); err != nil {
 		return reconcile.Result{}, errors.Wrap(err, "ensure collector secrets")
 	}
 	// Deploy Prometheus collector as a node agent.
-	if err := r.ensureCollectorDaemonSet(ctx, &config.Collection); err != nil {
+	if err := r.ensureCollectorDaemonSet(ctx, &config); err != nil {
 		return reconcile.Result{}, errors.Wrap(err, "ensure collector daemon set")
 	}
+	if err := r.ensureKubeStateMetrics(ctx, &config.Collection); err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "ensure kube-state-metrics")
+	}
+	if err := r.ensureNodeExporter(ctx, &config.Collection); err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "ensure node-exporter")
+	}
+	if err := r.ensureDCGMExporter(ctx, &config.Collection); err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "ensure dcgm-exporter")
+	}
 
-	if err := r.ensureCollectorConfig(ctx, &config.Collection); err != nil {
+	requeue, err := r.ensureCollectorConfig(ctx, &config)
+	if err != nil {
 		return reconcile.Result{}, errors.Wrap(err, "ensure collector config")
 	}
 
@@ -162,15 +244,18 @@ func (r *collectionReconciler) Reconcile(ctx context.Context, req reconcile.Requ
 	for _, obj := range r.statusUpdates {
 		if err := r.client.Status().Update(ctx, obj); err != nil {
 			logger.Error(err, "update status", "obj", obj)
+			r.metrics.statusUpdateFailures.Inc()
 		}
 	}
 	// Reset status updates for next reconcile loop.
 	r.statusUpdates = r.statusUpdates[:0]
 
-	return reconcile.Result{}, nil
+	return reconcile.Result{RequeueAfter: requeue}, nil
 }
 
-func (r *collectionReconciler) ensureCollectorSecrets(ctx context.Context, spec *monitoringv1.CollectionSpec) error {
+func (r *collectionReconciler) ensureCollectorSecrets(ctx context.Context, config *monitoringv1.OperatorConfig) error {
+	spec := &config.Collection
+
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      CollectionSecretName,
@@ -184,29 +269,90 @@ func (r *collectionReconciler) ensureCollectorSecrets(ctx context.Context, spec
 		},
 		Data: make(map[string][]byte),
 	}
+	attrs := map[string]SourceRef{}
+
 	if spec.Credentials != nil {
 		p := pathForSelector(r.opts.PublicNamespace, &monitoringv1.SecretOrConfigMap{Secret: spec.Credentials})
-		b, err := getSecretKeyBytes(ctx, r.client, r.opts.PublicNamespace, spec.Credentials)
+		b, err := getSecretKeyBytes(ctx, r.reader, r.opts.PublicNamespace, spec.Credentials)
 		if err != nil {
 			return err
 		}
 		secret.Data[p] = b
+		attrs[p] = sourceRef("OperatorConfig", config)
 	}
 
-	if err := r.client.Update(ctx, secret); apierrors.IsNotFound(err) {
-		if err := r.client.Create(ctx, secret); err != nil {
-			return errors.Wrap(err, "create collector secrets")
+	// Copy Secret and ConfigMap data referenced by scrape endpoints so it is
+	// available to the collectors under the paths the generated configuration
+	// points at.
+	var podMons monitoringv1.PodMonitoringList
+	if err := r.client.List(ctx, &podMons); err != nil {
+		return errors.Wrap(err, "failed to list PodMonitorings")
+	}
+	for _, pm := range podMons.Items {
+		pmon := pm
+		if !r.opts.namespaceAllowed(pmon.Namespace) {
+			continue
+		}
+		if err := r.addEndpointReferences(ctx, secret, attrs, pmon.Spec.Endpoints, sourceRef("PodMonitoring", &pmon)); err != nil {
+			return errors.Wrapf(err, "resolve references of PodMonitoring %s/%s", pmon.Namespace, pmon.Name)
+		}
+	}
+	var clusterPodMons monitoringv1.ClusterPodMonitoringList
+	if err := r.client.List(ctx, &clusterPodMons); err != nil {
+		return errors.Wrap(err, "failed to list ClusterPodMonitorings")
+	}
+	for _, cm := range clusterPodMons.Items {
+		cmon := cm
+		if err := r.addEndpointReferences(ctx, secret, attrs, cmon.Spec.Endpoints, sourceRef("ClusterPodMonitoring", &cmon)); err != nil {
+			return errors.Wrapf(err, "resolve references of ClusterPodMonitoring %s", cmon.Name)
+		}
+	}
+
+	if len(attrs) > 0 {
+		a, err := sourceAttributionAnnotation(attrs)
+		if err != nil {
+			return err
+		}
+		secret.Annotations[AnnotationSourceAttribution] = a
+	}
+
+	return errors.Wrap(applyObject(ctx, r.client, secret), "apply collector secrets")
+}
+
+// addEndpointReferences resolves the Secret and ConfigMap references of the
+// given scrape endpoints in the public namespace and copies the data into the
+// collector secret under the paths the generated configuration points at.
+func (r *collectionReconciler) addEndpointReferences(ctx context.Context, secret *corev1.Secret, attrs map[string]SourceRef, eps []monitoringv1.ScrapeEndpoint, ref SourceRef) error {
+	for _, ep := range eps {
+		if ep.TLS == nil {
+			continue
+		}
+		sels := []*monitoringv1.SecretOrConfigMap{ep.TLS.CA, ep.TLS.Cert}
+		if ep.TLS.KeySecret != nil {
+			sels = append(sels, &monitoringv1.SecretOrConfigMap{Secret: ep.TLS.KeySecret})
+		}
+		for _, scm := range sels {
+			if scm == nil {
+				continue
+			}
+			b, err := getSecretOrConfigMapBytes(ctx, r.reader, r.opts.PublicNamespace, scm)
+			if err != nil {
+				return err
+			}
+			p := pathForSelector(r.opts.PublicNamespace, scm)
+			secret.Data[p] = b
+			attrs[p] = ref
 		}
-	} else if err != nil {
-		return errors.Wrap(err, "update collector secrets")
 	}
 	return nil
 }
 
 // ensureCollectorDaemonSet populates the collector DaemonSet with operator-provided values.
-func (r *collectionReconciler) ensureCollectorDaemonSet(ctx context.Context, spec *monitoringv1.CollectionSpec) error {
+func (r *collectionReconciler) ensureCollectorDaemonSet(ctx context.Context, config *monitoringv1.OperatorConfig) error {
 	logger, _ := logr.FromContext(ctx)
 
+	spec := &config.Collection
+
 	var ds appsv1.DaemonSet
 	err := r.client.Get(ctx, client.ObjectKey{Namespace: r.opts.OperatorNamespace, Name: NameCollector}, &ds)
 	// Some users deliberately not want to run the collectors. Only emit a warning but don't cause
@@ -218,6 +364,10 @@ func (r *collectionReconciler) ensureCollectorDaemonSet(ctx context.Context, spe
 	if err != nil {
 		return err
 	}
+	if isPaused(&ds) {
+		logger.Info("collector DaemonSet paused via annotation, skipping update")
+		return nil
+	}
 
 	var projectID, location, cluster = resolveLabels(r.opts, spec.ExternalLabels)
 
@@ -235,27 +385,271 @@ func (r *collectionReconciler) ensureCollectorDaemonSet(ctx context.Context, spe
 		flags = append(flags, fmt.Sprintf("--export.credentials-file=%q", p))
 	}
 
+	// Bound the local storage, which only buffers data until it is exported.
+	// The flags take precedence over the defaults in the collector manifest.
+	if ls := spec.LocalStorage; ls != nil {
+		if ls.Retention != "" {
+			flags = append(flags, fmt.Sprintf("--storage.tsdb.retention.time=%s", ls.Retention))
+		}
+		if ls.RetentionSize != "" {
+			flags = append(flags, fmt.Sprintf("--storage.tsdb.retention.size=%s", ls.RetentionSize))
+		}
+	}
+
 	if len(spec.Compression) > 0 && spec.Compression != "none" {
 		flags = append(flags, fmt.Sprintf("--export.compression=%s", spec.Compression))
 	}
+	if spec.ExportEndpoint != "" {
+		flags = append(flags, fmt.Sprintf("--export.endpoint=%q", spec.ExportEndpoint))
+	}
+
+	patch, err := collectorPodSpecPatch(&ds.Spec.Template.Spec, strings.Join(flags, " "), spec.CredentialVolumes, spec.ExtraMounts, config.Proxy, r.nativeSidecarsSupported(logger))
+	if err != nil {
+		return errors.Wrap(err, "build collector pod spec patch")
+	}
+	// Resolve the patch against the live object with a dry-run first and
+	// report the resulting pod template diff so unexpected collector rollouts
+	// are traceable to the OperatorConfig change that caused them.
+	updated := ds.DeepCopy()
+	if err := r.client.Patch(ctx, updated, client.RawPatch(types.StrategicMergePatchType, patch), client.DryRunAll); err != nil {
+		return errors.Wrap(err, "dry-run collector pod spec patch")
+	}
+	if diff := podTemplateDiff(ds.Spec.Template, updated.Spec.Template); diff != "" {
+		logger.Info("updating collector DaemonSet",
+			"diff", diff, "operatorconfig-generation", config.Generation)
+		r.recorder.Eventf(config, corev1.EventTypeNormal, "WorkloadUpdate",
+			"collector DaemonSet pods change with OperatorConfig generation %d:\n%s", config.Generation, truncateDiff(diff))
+	}
+	return r.client.Patch(ctx, &ds, client.RawPatch(types.StrategicMergePatchType, patch))
+}
+
+// nativeSidecarsSupported reports whether the cluster supports native sidecar
+// containers, i.e. init containers with restart policy Always, which are
+// generally available since Kubernetes 1.29. The result is cached as support
+// does not go away at runtime.
+func (r *collectionReconciler) nativeSidecarsSupported(logger logr.Logger) bool {
+	if r.nativeSidecars != nil {
+		return *r.nativeSidecars
+	}
+	sv, err := r.kubeClient.Discovery().ServerVersion()
+	if err != nil {
+		logger.Error(err, "detecting server version failed, assuming no native sidecar support")
+		return false
+	}
+	v, err := version.ParseGeneric(sv.GitVersion)
+	if err != nil {
+		logger.Error(err, "parsing server version failed, assuming no native sidecar support", "version", sv.GitVersion)
+		return false
+	}
+	supported := v.AtLeast(version.MustParseGeneric("1.29.0"))
+	r.nativeSidecars = &supported
+	return supported
+}
 
-	// Set EXTRA_ARGS envvar in Prometheus container.
-	for i, c := range ds.Spec.Template.Spec.Containers {
+// collectorPodSpecPatch builds a strategic merge patch reconciling the parts
+// of the collector pod template the operator manages. A patch rather than a
+// full update is used so that fields unknown to the vendored Kubernetes API
+// types, notably the restart policy of native sidecar containers, are not
+// stripped from the DaemonSet.
+func collectorPodSpecPatch(podSpec *corev1.PodSpec, extraArgs string, vols []monitoringv1.CredentialVolume, extraMounts []monitoringv1.ExtraMount, proxy *monitoringv1.ProxyConfig, nativeSidecars bool) ([]byte, error) {
+	env := []interface{}{
+		map[string]interface{}{"name": "EXTRA_ARGS", "value": extraArgs},
+	}
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == "prometheus" {
+			env = append(env, proxyEnvPatch(proxy, &podSpec.Containers[i])...)
+		}
+	}
+	prom := map[string]interface{}{
+		"name": "prometheus",
+		"env":  env,
+	}
+
+	// Reconcile the Secrets Store CSI volumes and their mounts in the
+	// Prometheus container. Previously managed entries that are no longer
+	// declared must be deleted explicitly.
+	var (
+		declared = map[string]bool{}
+		mounts   []interface{}
+		volumes  []interface{}
+		readOnly = true
+	)
+	for _, v := range vols {
+		name := credentialVolumePrefix + v.Name
+		declared[name] = true
+
+		mountPath := v.MountPath
+		if mountPath == "" {
+			mountPath = path.Join("/etc/secrets-store", v.Name)
+		}
+		volumes = append(volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				CSI: &corev1.CSIVolumeSource{
+					Driver:   "secrets-store.csi.k8s.io",
+					ReadOnly: &readOnly,
+					VolumeAttributes: map[string]string{
+						"secretProviderClass": v.SecretProviderClass,
+					},
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      name,
+			ReadOnly:  true,
+			MountPath: mountPath,
+		})
+	}
+	for _, m := range extraMounts {
+		vol, mount, err := extraMountVolume(m)
+		if err != nil {
+			return nil, err
+		}
+		declared[vol.Name] = true
+		volumes = append(volumes, vol)
+		mounts = append(mounts, mount)
+	}
+	if vol, mount, ok := proxyCAVolume(proxy); ok {
+		declared[vol.Name] = true
+		volumes = append(volumes, vol)
+		mounts = append(mounts, mount)
+	}
+	for _, v := range podSpec.Volumes {
+		if managedVolumeName(v.Name) && !declared[v.Name] {
+			volumes = append(volumes, map[string]interface{}{"name": v.Name, "$patch": "delete"})
+		}
+	}
+	for _, c := range podSpec.Containers {
 		if c.Name != "prometheus" {
 			continue
 		}
-		var repl []corev1.EnvVar
-
-		for _, ev := range c.Env {
-			if ev.Name != "EXTRA_ARGS" {
-				repl = append(repl, ev)
+		for _, m := range c.VolumeMounts {
+			if managedVolumeName(m.Name) && !declared[m.Name] {
+				mounts = append(mounts, map[string]interface{}{"mountPath": m.MountPath, "$patch": "delete"})
 			}
 		}
-		repl = append(repl, corev1.EnvVar{Name: "EXTRA_ARGS", Value: strings.Join(flags, " ")})
+	}
+	if len(mounts) > 0 {
+		prom["volumeMounts"] = mounts
+	}
+
+	containers := []interface{}{prom}
+	var initContainers []interface{}
+
+	// Find the config-reloader regardless of whether it currently runs as a
+	// regular container or already as a native sidecar.
+	var (
+		reloader     *corev1.Container
+		inContainers bool
+	)
+	for i, c := range podSpec.Containers {
+		if c.Name == "config-reloader" {
+			reloader, inContainers = &podSpec.Containers[i], true
+		}
+	}
+	for i, c := range podSpec.InitContainers {
+		if c.Name == "config-reloader" {
+			reloader = &podSpec.InitContainers[i]
+		}
+	}
+	switch {
+	case reloader == nil:
+		// Pod specs without a config-reloader are left alone.
+	case nativeSidecars:
+		// Run the config-reloader as a native sidecar so the initial
+		// configuration is materialized before Prometheus starts. The entry
+		// is always included so a missing restart policy is repaired.
+		entry, err := containerPatch(reloader)
+		if err != nil {
+			return nil, err
+		}
+		entry["restartPolicy"] = string(corev1.RestartPolicyAlways)
+		initContainers = append(initContainers, entry)
+		if inContainers {
+			containers = append(containers, map[string]interface{}{"name": reloader.Name, "$patch": "delete"})
+		}
+	case !inContainers:
+		// Fall back to a regular container on clusters without native
+		// sidecar support, e.g. after restoring a backup to an older cluster.
+		entry, err := containerPatch(reloader)
+		if err != nil {
+			return nil, err
+		}
+		containers = append(containers, entry)
+		initContainers = append(initContainers, map[string]interface{}{"name": reloader.Name, "$patch": "delete"})
+	}
+
+	specPatch := map[string]interface{}{"containers": containers}
+	if len(initContainers) > 0 {
+		specPatch["initContainers"] = initContainers
+	}
+	if len(volumes) > 0 {
+		specPatch["volumes"] = volumes
+	}
+	return json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": specPatch,
+			},
+		},
+	})
+}
 
-		ds.Spec.Template.Spec.Containers[i].Env = repl
+// containerPatch converts a container into its generic JSON form for
+// embedding in a strategic merge patch.
+func containerPatch(c *corev1.Container) (map[string]interface{}, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal container")
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrap(err, "unmarshal container")
 	}
-	return r.client.Update(ctx, &ds)
+	return m, nil
+}
+
+// Prefix of the names of Secrets Store CSI volumes managed through the
+// OperatorConfig, distinguishing them from the manifest-provided volumes.
+const credentialVolumePrefix = "gmp-credentials-"
+
+// Prefix of the names of extra Secret and ConfigMap volumes managed through
+// the OperatorConfig.
+const extraMountPrefix = "gmp-mount-"
+
+// managedVolumeName reports whether a volume or mount name belongs to the
+// operator-managed entries derived from the OperatorConfig, as opposed to the
+// manifest-provided ones.
+func managedVolumeName(name string) bool {
+	return strings.HasPrefix(name, credentialVolumePrefix) || strings.HasPrefix(name, extraMountPrefix) || name == proxyCAVolumeName
+}
+
+// extraMountVolume translates an ExtraMount into the volume and read-only
+// mount added to the managed workloads.
+func extraMountVolume(m monitoringv1.ExtraMount) (corev1.Volume, corev1.VolumeMount, error) {
+	vol := corev1.Volume{Name: extraMountPrefix + m.Name}
+
+	switch {
+	case m.Secret != "" && m.ConfigMap != "":
+		return vol, corev1.VolumeMount{}, errors.Errorf("extra mount %q: secret and configMap are mutually exclusive", m.Name)
+	case m.Secret != "":
+		vol.Secret = &corev1.SecretVolumeSource{SecretName: m.Secret}
+	case m.ConfigMap != "":
+		vol.ConfigMap = &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: m.ConfigMap},
+		}
+	default:
+		return vol, corev1.VolumeMount{}, errors.Errorf("extra mount %q: either secret or configMap must be set", m.Name)
+	}
+	mountPath := m.MountPath
+	if mountPath == "" {
+		mountPath = path.Join("/etc/gmp-mounts", m.Name)
+	}
+	return vol, corev1.VolumeMount{
+		Name:      vol.Name,
+		ReadOnly:  true,
+		MountPath: mountPath,
+	}, nil
 }
 
 func resolveLabels(opts Options, externalLabels map[string]string) (projectID string, location string, cluster string) {
@@ -280,144 +674,587 @@ func resolveLabels(opts Options, externalLabels map[string]string) (projectID st
 	return
 }
 
-// ensureCollectorConfig generates the collector config and creates or updates it.
-func (r *collectionReconciler) ensureCollectorConfig(ctx context.Context, spec *monitoringv1.CollectionSpec) error {
-	cfg, err := r.makeCollectorConfig(ctx, spec)
+// ensureCollectorConfig generates the collector config and creates or updates
+// it. With canary rollout enabled the new config is first applied to the
+// canary collectors and only promoted fleet-wide after the soak period if the
+// canaries scrape their targets successfully. The returned duration requests a
+// requeue for a pending promotion.
+func (r *collectionReconciler) ensureCollectorConfig(ctx context.Context, config *monitoringv1.OperatorConfig) (time.Duration, error) {
+	logger, _ := logr.FromContext(ctx)
+
+	cfg, attrs, err := r.makeCollectorConfig(ctx, config)
 	if err != nil {
-		return errors.Wrap(err, "generate Prometheus config")
+		return 0, errors.Wrap(err, "generate Prometheus config")
 	}
 	cfgEncoded, err := yaml.Marshal(cfg)
 	if err != nil {
-		return errors.Wrap(err, "marshal Prometheus config")
+		return 0, errors.Wrap(err, "marshal Prometheus config")
+	}
+	// Record which object each scrape job originated from so the generated
+	// config can be traced back to its sources.
+	attribution, err := sourceAttributionAnnotation(attrs)
+	if err != nil {
+		return 0, err
+	}
+	baseAnnotations := map[string]string{
+		AnnotationSourceAttribution: attribution,
 	}
 
+	if !r.opts.CollectorCanary {
+		return r.updateConfig(ctx, NameCollector, baseAnnotations, cfgEncoded)
+	}
+
+	hash := hashConfig(cfgEncoded)
+
+	// Stage the config on the canary collectors first, recording when it was
+	// applied there.
+	var canary corev1.ConfigMap
+	err = r.client.Get(ctx, client.ObjectKey{Namespace: r.opts.OperatorNamespace, Name: NameCollectorCanary}, &canary)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return 0, errors.Wrap(err, "get canary Prometheus config")
+	}
+	if canary.Annotations[annotationConfigHash] != hash {
+		annotations := map[string]string{
+			annotationConfigHash:        hash,
+			annotationRolloutStart:      time.Now().UTC().Format(time.RFC3339),
+			AnnotationSourceAttribution: attribution,
+		}
+		wait, err := r.updateConfig(ctx, NameCollectorCanary, annotations, cfgEncoded)
+		if err != nil {
+			return 0, errors.Wrap(err, "update canary Prometheus config")
+		}
+		if wait > 0 {
+			return wait, nil
+		}
+		logger.Info("staged new collector config on canaries", "hash", hash)
+		return r.opts.CanarySoakDuration, nil
+	}
+
+	// The config is already staged. Promote it once the soak period has passed
+	// and the canaries are healthy.
+	var current corev1.ConfigMap
+	err = r.client.Get(ctx, client.ObjectKey{Namespace: r.opts.OperatorNamespace, Name: NameCollector}, &current)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return 0, errors.Wrap(err, "get Prometheus config")
+	}
+	if current.Data[configFilename] == string(cfgEncoded) {
+		return 0, nil
+	}
+	start, err := time.Parse(time.RFC3339, canary.Annotations[annotationRolloutStart])
+	if err != nil {
+		// Unparseable rollout start, e.g. from manual edits. Restart the soak.
+		start = time.Now().UTC()
+		annotations := map[string]string{
+			annotationConfigHash:        hash,
+			annotationRolloutStart:      start.Format(time.RFC3339),
+			AnnotationSourceAttribution: attribution,
+		}
+		wait, err := r.updateConfig(ctx, NameCollectorCanary, annotations, cfgEncoded)
+		if err != nil {
+			return 0, errors.Wrap(err, "update canary Prometheus config")
+		}
+		if wait > 0 {
+			return wait, nil
+		}
+	}
+	if soakRemaining := r.opts.CanarySoakDuration - time.Since(start); soakRemaining > 0 {
+		return soakRemaining, nil
+	}
+	healthy, err := canaryCollectorsHealthy(ctx, r.kubeClient, r.opts.OperatorNamespace)
+	if err != nil {
+		return 0, errors.Wrap(err, "check canary collector health")
+	}
+	if !healthy {
+		logger.Info("canary collectors unhealthy, delaying config promotion", "hash", hash)
+		return r.opts.CanarySoakDuration, nil
+	}
+	wait, err := r.updateConfig(ctx, NameCollector, baseAnnotations, cfgEncoded)
+	if err != nil {
+		return 0, err
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+	logger.Info("promoted collector config fleet-wide", "hash", hash)
+	return 0, nil
+}
+
+// updateConfig writes the given encoded Prometheus configuration to the named
+// ConfigMap. Writes are skipped if the stored configuration is already
+// identical so collectors watching the ConfigMap don't reload needlessly.
+// Writes shortly after a previous one are deferred to coalesce rapid changes,
+// e.g. from CI redeploying many PodMonitorings, into a single collector
+// reload. The returned duration requests a requeue for a deferred write.
+func (r *collectionReconciler) updateConfig(ctx context.Context, name string, annotations map[string]string, cfgEncoded []byte) (time.Duration, error) {
 	cm := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace: r.opts.OperatorNamespace,
-			Name:      NameCollector,
+			Namespace:   r.opts.OperatorNamespace,
+			Name:        name,
+			Annotations: annotations,
 		},
 		Data: map[string]string{
 			configFilename: string(cfgEncoded),
 		},
 	}
-
+	var existing corev1.ConfigMap
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(cm), &existing); err == nil {
+		if reflect.DeepEqual(existing.Data, cm.Data) && reflect.DeepEqual(existing.Annotations, cm.Annotations) {
+			return 0, nil
+		}
+		if wait := r.opts.ConfigReloadInterval - time.Since(r.lastConfigWrite[name]); wait > 0 {
+			return wait, nil
+		}
+	}
 	if err := r.client.Update(ctx, cm); apierrors.IsNotFound(err) {
 		if err := r.client.Create(ctx, cm); err != nil {
-			return errors.Wrap(err, "create Prometheus config")
+			return 0, errors.Wrap(err, "create Prometheus config")
 		}
 	} else if err != nil {
-		return errors.Wrap(err, "update Prometheus config")
+		return 0, errors.Wrap(err, "update Prometheus config")
+	}
+	r.lastConfigWrite[name] = time.Now()
+	return 0, nil
+}
+
+// validateNamedPorts checks that every endpoint port referenced by name is
+// declared by a container of at least one pod currently selected by the
+// monitoring resource. Named ports only match declared container ports during
+// target discovery, so an undeclared name silently produces an empty target
+// set. An empty namespace matches pods across all namespaces.
+// No error is returned if no pods are selected at all as they may simply not
+// have been created yet.
+func (r *collectionReconciler) validateNamedPorts(ctx context.Context, selector metav1.LabelSelector, namespace string, eps []monitoringv1.ScrapeEndpoint) error {
+	var named []string
+	for _, ep := range eps {
+		if ep.Port.StrVal != "" {
+			named = append(named, ep.Port.StrVal)
+		}
+	}
+	if len(named) == 0 {
+		return nil
+	}
+	sel, err := metav1.LabelSelectorAsSelector(&selector)
+	if err != nil {
+		return errors.Wrap(err, "invalid label selector")
+	}
+	opts := []client.ListOption{client.MatchingLabelsSelector{Selector: sel}}
+	if namespace != "" {
+		opts = append(opts, client.InNamespace(namespace))
+	}
+	var pods corev1.PodList
+	if err := r.client.List(ctx, &pods, opts...); err != nil {
+		return errors.Wrap(err, "failed to list pods")
+	}
+	if len(pods.Items) == 0 {
+		return nil
+	}
+	declared := map[string]bool{}
+	for _, p := range pods.Items {
+		for _, c := range p.Spec.Containers {
+			for _, port := range c.Ports {
+				if port.Name != "" {
+					declared[port.Name] = true
+				}
+			}
+		}
+	}
+	for _, name := range named {
+		if !declared[name] {
+			return errors.Errorf("port %q is not declared by any container of the %d selected pod(s)", name, len(pods.Items))
+		}
 	}
 	return nil
 }
 
-func (r *collectionReconciler) makeCollectorConfig(ctx context.Context, spec *monitoringv1.CollectionSpec) (*promconfig.Config, error) {
+func (r *collectionReconciler) makeCollectorConfig(ctx context.Context, config *monitoringv1.OperatorConfig) (*promconfig.Config, map[string]SourceRef, error) {
 	logger, _ := logr.FromContext(ctx)
 
+	spec := &config.Collection
+
 	cfg := &promconfig.Config{
 		GlobalConfig: promconfig.GlobalConfig{
 			ExternalLabels: labels.FromMap(spec.ExternalLabels),
 		},
 	}
+	// Maps each generated scrape job to the resource it originated from.
+	attrs := map[string]SourceRef{}
 
 	var err error
 	cfg.ScrapeConfigs, err = makeKubeletScrapeConfigs(spec.KubeletScraping)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create kubelet scrape config")
+		return nil, nil, errors.Wrap(err, "failed to create kubelet scrape config")
+	}
+	controlPlaneCfgs, err := r.makeControlPlaneScrapeConfigs(ctx, spec.ControlPlaneScraping)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create control plane scrape config")
+	}
+	cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, controlPlaneCfgs...)
+
+	ksmCfgs, err := makeKubeStateMetricsScrapeConfigs(spec.KubeStateMetrics, r.opts.OperatorNamespace)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create kube-state-metrics scrape config")
+	}
+	cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, ksmCfgs...)
+
+	neCfgs, err := makeNodeExporterScrapeConfigs(spec.NodeExporter, r.opts.OperatorNamespace)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create node-exporter scrape config")
+	}
+	cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, neCfgs...)
+
+	istioCfgs, err := makeIstioSidecarScrapeConfigs(spec.IstioSidecarScraping)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create Istio sidecar scrape config")
+	}
+	cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, istioCfgs...)
+
+	dcgmCfgs, err := makeDCGMExporterScrapeConfigs(spec.DCGMExporter, r.opts.OperatorNamespace)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create dcgm-exporter scrape config")
+	}
+	cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, dcgmCfgs...)
+
+	annotationCfgs, err := makeAnnotationScrapeConfigs(spec.AnnotationScraping)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create annotation scrape config")
+	}
+	cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, annotationCfgs...)
+
+	// The OperatorConfig may not exist yet, in which case kubelet and control
+	// plane scraping are necessarily disabled and there is nothing to attribute.
+	if config.Name != "" {
+		for _, sc := range cfg.ScrapeConfigs {
+			attrs[sc.JobName] = sourceRef("OperatorConfig", config)
+		}
+	}
+
+	// Mirror collected data to an additional remote-write endpoint if configured.
+	if spec.RemoteWrite != nil {
+		rw, err := makeRemoteWriteConfig(spec.RemoteWrite)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to create remote-write config")
+		}
+		cfg.RemoteWriteConfigs = []*promconfig.RemoteWriteConfig{rw}
 	}
 
 	// Generate a separate scrape job for every endpoint in every PodMonitoring.
 	var (
 		podMons        monitoringv1.PodMonitoringList
 		clusterPodMons monitoringv1.ClusterPodMonitoringList
-		cond           *monitoringv1.MonitoringCondition
+		overrideList   monitoringv1.CollectionOverrideList
+		cond           metav1.Condition
 	)
 	if err := r.client.List(ctx, &podMons); err != nil {
-		return nil, errors.Wrap(err, "failed to list PodMonitorings")
+		return nil, nil, errors.Wrap(err, "failed to list PodMonitorings")
+	}
+	if err := r.client.List(ctx, &clusterPodMons); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list ClusterPodMonitorings")
+	}
+	if err := r.client.List(ctx, &overrideList); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list CollectionOverrides")
+	}
+	overrides := collectionOverridesByNamespace(overrideList.Items)
+	collisions := detectTargetCollisions(podMons.Items, clusterPodMons.Items)
+
+	// Namespace ingestion budgets translate into sample limits on all scrape
+	// jobs generated for the respective namespace.
+	budgets := map[string]monitoringv1.NamespaceBudget{}
+	for _, b := range spec.NamespaceBudgets {
+		budgets[b.Namespace] = b
 	}
 
 	var projectID, location, cluster = resolveLabels(r.opts, spec.ExternalLabels)
+	// Rendering inputs besides the resource itself that invalidate cached
+	// scrape configs when they change.
+	renderInputs := strings.Join([]string{projectID, location, cluster, r.opts.PublicNamespace}, "\x00")
+
+	r.scrapeCache.sweepStart()
 
 	// Mark status updates in batch with single timestamp.
 	for _, pm := range podMons.Items {
 		// Reassign so we can safely get a pointer.
 		pmon := pm
 
-		cond = &monitoringv1.MonitoringCondition{
+		if !r.opts.namespaceAllowed(pmon.Namespace) {
+			continue
+		}
+
+		// Without admission webhooks the resource has been neither defaulted nor
+		// validated, so do both now.
+		if r.opts.DisableWebhooks {
+			if err := (&podMonitoringDefaulter{}).Default(ctx, &pmon); err != nil {
+				logger.Error(err, "defaulting PodMonitoring", "namespace", pmon.Namespace, "name", pmon.Name)
+			}
+			if err := pmon.ValidateCreate(); err != nil {
+				msg := "PodMonitoring failed validation"
+				cond = metav1.Condition{
+					Type:    monitoringv1.ConfigurationCreateSuccess,
+					Status:  metav1.ConditionFalse,
+					Reason:  monitoringv1.ReasonValidationError,
+					Message: msg,
+				}
+				logger.Error(err, msg, "namespace", pmon.Namespace, "name", pmon.Name)
+				r.recorder.Eventf(&pmon, corev1.EventTypeWarning, "ValidationError", "%s: %s", msg, err)
+				if change, err := pmon.Status.SetMonitoringCondition(pmon.GetGeneration(), metav1.Now(), cond); err != nil {
+					logger.Error(err, "setting podmonitoring status state")
+				} else if change {
+					r.statusUpdates = append(r.statusUpdates, &pmon)
+				}
+				continue
+			}
+		}
+
+		cond = metav1.Condition{
 			Type:   monitoringv1.ConfigurationCreateSuccess,
-			Status: corev1.ConditionTrue,
+			Status: metav1.ConditionTrue,
+			Reason: monitoringv1.ReasonConfigurationCreated,
 		}
-		cfgs, err := pmon.ScrapeConfigs(projectID, location, cluster)
+		cacheKey := fmt.Sprintf("PodMonitoring/%s/%s", pmon.Namespace, pmon.Name)
+		cfgs, err := r.scrapeCache.get(cacheKey, pmon.Generation, renderInputs, func() ([]*promconfig.ScrapeConfig, error) {
+			return pmon.ScrapeConfigs(projectID, location, cluster, r.opts.PublicNamespace)
+		})
 		if err != nil {
 			msg := "generating scrape config failed for PodMonitoring endpoint"
-			cond = &monitoringv1.MonitoringCondition{
+			cond = metav1.Condition{
 				Type:    monitoringv1.ConfigurationCreateSuccess,
-				Status:  corev1.ConditionFalse,
-				Reason:  "ScrapeConfigError",
+				Status:  metav1.ConditionFalse,
+				Reason:  monitoringv1.ReasonScrapeConfigError,
 				Message: msg,
 			}
 			logger.Error(err, msg, "namespace", pmon.Namespace, "name", pmon.Name)
+			r.metrics.configGenerationFailures.WithLabelValues("PodMonitoring").Inc()
+			// Emit an event so the failure is visible in kubectl describe without
+			// searching operator logs.
+			r.recorder.Eventf(&pmon, corev1.EventTypeWarning, "ScrapeConfigError", "%s: %s", msg, err)
 			continue
 		}
+		// Apply the namespace's collection override before the namespace
+		// budget so that limits set in the OperatorConfig stay authoritative.
+		if ov, ok := overrides[pmon.Namespace]; ok {
+			if err := applyCollectionOverride(cfgs, ov, spec.ExternalLabels); err != nil {
+				// The override was validated at admission, so this is unexpected.
+				// Leave the scrape configs untouched rather than dropping them.
+				logger.Error(err, "applying CollectionOverride failed", "namespace", pmon.Namespace)
+			}
+		}
+		if b, ok := budgets[pmon.Namespace]; ok && b.SampleLimit > 0 {
+			for _, sc := range cfgs {
+				sc.SampleLimit = uint(b.SampleLimit)
+			}
+		}
+		// Surface named ports that no selected pod declares, which would
+		// otherwise silently produce an empty target set. The scrape config
+		// is kept in place so scraping starts as soon as matching pods appear.
+		if err := r.validateNamedPorts(ctx, pmon.Spec.Selector, pmon.Namespace, pmon.Spec.Endpoints); err != nil {
+			msg := "PodMonitoring references an unknown port"
+			cond = metav1.Condition{
+				Type:    monitoringv1.ConfigurationCreateSuccess,
+				Status:  metav1.ConditionFalse,
+				Reason:  monitoringv1.ReasonValidationError,
+				Message: err.Error(),
+			}
+			logger.Error(err, msg, "namespace", pmon.Namespace, "name", pmon.Name)
+			r.recorder.Eventf(&pmon, corev1.EventTypeWarning, "ValidationError", "%s: %s", msg, err)
+		}
+		for _, sc := range cfgs {
+			attrs[sc.JobName] = sourceRef("PodMonitoring", &pmon)
+		}
 		cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, cfgs...)
 
-		change, err := pmon.Status.SetPodMonitoringCondition(pmon.GetGeneration(), metav1.Now(), cond)
+		now := metav1.Now()
+		change, err := pmon.Status.SetMonitoringCondition(pmon.GetGeneration(), now, cond)
 		if err != nil {
 			// Log an error but let operator continue to avoid getting stuck
 			// on a potential bad resource.
 			logger.Error(err, "setting podmonitoring status state")
 		}
+		collisionCond := metav1.Condition{
+			Type:   monitoringv1.NoTargetCollision,
+			Status: metav1.ConditionTrue,
+			Reason: monitoringv1.ReasonNoCollision,
+		}
+		if msg, ok := collisions[fmt.Sprintf("PodMonitoring/%s/%s", pmon.Namespace, pmon.Name)]; ok {
+			collisionCond = metav1.Condition{
+				Type:    monitoringv1.NoTargetCollision,
+				Status:  metav1.ConditionFalse,
+				Reason:  monitoringv1.ReasonTargetCollision,
+				Message: msg,
+			}
+			r.recorder.Eventf(&pmon, corev1.EventTypeWarning, "TargetCollision", "%s", msg)
+		}
+		if cchange, err := pmon.Status.SetMonitoringCondition(pmon.GetGeneration(), now, collisionCond); err != nil {
+			logger.Error(err, "setting podmonitoring status state")
+		} else if cchange {
+			change = true
+		}
 
 		if change {
 			r.statusUpdates = append(r.statusUpdates, &pmon)
 		}
 	}
 
-	if err := r.client.List(ctx, &clusterPodMons); err != nil {
-		return nil, errors.Wrap(err, "failed to list ClusterPodMonitorings")
-	}
-
 	// Mark status updates in batch with single timestamp.
 	for _, cm := range clusterPodMons.Items {
 		// Reassign so we can safely get a pointer.
 		cmon := cm
 
-		cond = &monitoringv1.MonitoringCondition{
+		if r.opts.DisableWebhooks {
+			if err := (&clusterPodMonitoringDefaulter{}).Default(ctx, &cmon); err != nil {
+				logger.Error(err, "defaulting ClusterPodMonitoring", "name", cmon.Name)
+			}
+			if err := cmon.ValidateCreate(); err != nil {
+				msg := "ClusterPodMonitoring failed validation"
+				cond = metav1.Condition{
+					Type:    monitoringv1.ConfigurationCreateSuccess,
+					Status:  metav1.ConditionFalse,
+					Reason:  monitoringv1.ReasonValidationError,
+					Message: msg,
+				}
+				logger.Error(err, msg, "name", cmon.Name)
+				r.recorder.Eventf(&cmon, corev1.EventTypeWarning, "ValidationError", "%s: %s", msg, err)
+				if change, err := cmon.Status.SetMonitoringCondition(cmon.GetGeneration(), metav1.Now(), cond); err != nil {
+					logger.Error(err, "setting podmonitoring status state")
+				} else if change {
+					r.statusUpdates = append(r.statusUpdates, &cmon)
+				}
+				continue
+			}
+		}
+
+		cond = metav1.Condition{
 			Type:   monitoringv1.ConfigurationCreateSuccess,
-			Status: corev1.ConditionTrue,
+			Status: metav1.ConditionTrue,
+			Reason: monitoringv1.ReasonConfigurationCreated,
 		}
-		cfgs, err := cmon.ScrapeConfigs(projectID, location, cluster)
+		cacheKey := fmt.Sprintf("ClusterPodMonitoring/%s", cmon.Name)
+		cfgs, err := r.scrapeCache.get(cacheKey, cmon.Generation, renderInputs, func() ([]*promconfig.ScrapeConfig, error) {
+			return cmon.ScrapeConfigs(projectID, location, cluster, r.opts.PublicNamespace)
+		})
 		if err != nil {
 			msg := "generating scrape config failed for PodMonitoring endpoint"
-			cond = &monitoringv1.MonitoringCondition{
+			cond = metav1.Condition{
 				Type:    monitoringv1.ConfigurationCreateSuccess,
-				Status:  corev1.ConditionFalse,
-				Reason:  "ScrapeConfigError",
+				Status:  metav1.ConditionFalse,
+				Reason:  monitoringv1.ReasonScrapeConfigError,
 				Message: msg,
 			}
 			logger.Error(err, msg, "namespace", cmon.Namespace, "name", cmon.Name)
+			r.metrics.configGenerationFailures.WithLabelValues("ClusterPodMonitoring").Inc()
+			r.recorder.Eventf(&cmon, corev1.EventTypeWarning, "ScrapeConfigError", "%s: %s", msg, err)
 			continue
 		}
+		if err := r.validateNamedPorts(ctx, cmon.Spec.Selector, "", cmon.Spec.Endpoints); err != nil {
+			msg := "ClusterPodMonitoring references an unknown port"
+			cond = metav1.Condition{
+				Type:    monitoringv1.ConfigurationCreateSuccess,
+				Status:  metav1.ConditionFalse,
+				Reason:  monitoringv1.ReasonValidationError,
+				Message: err.Error(),
+			}
+			logger.Error(err, msg, "name", cmon.Name)
+			r.recorder.Eventf(&cmon, corev1.EventTypeWarning, "ValidationError", "%s: %s", msg, err)
+		}
+		for _, sc := range cfgs {
+			attrs[sc.JobName] = sourceRef("ClusterPodMonitoring", &cmon)
+		}
 		cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, cfgs...)
 
-		change, err := cmon.Status.SetPodMonitoringCondition(cmon.GetGeneration(), metav1.Now(), cond)
+		now := metav1.Now()
+		change, err := cmon.Status.SetMonitoringCondition(cmon.GetGeneration(), now, cond)
 		if err != nil {
 			// Log an error but let operator continue to avoid getting stuck
 			// on a potential bad resource.
 			logger.Error(err, "setting podmonitoring status state")
 		}
+		collisionCond := metav1.Condition{
+			Type:   monitoringv1.NoTargetCollision,
+			Status: metav1.ConditionTrue,
+			Reason: monitoringv1.ReasonNoCollision,
+		}
+		if msg, ok := collisions[fmt.Sprintf("ClusterPodMonitoring/%s", cmon.Name)]; ok {
+			collisionCond = metav1.Condition{
+				Type:    monitoringv1.NoTargetCollision,
+				Status:  metav1.ConditionFalse,
+				Reason:  monitoringv1.ReasonTargetCollision,
+				Message: msg,
+			}
+			r.recorder.Eventf(&cmon, corev1.EventTypeWarning, "TargetCollision", "%s", msg)
+		}
+		if cchange, err := cmon.Status.SetMonitoringCondition(cmon.GetGeneration(), now, collisionCond); err != nil {
+			logger.Error(err, "setting podmonitoring status state")
+		} else if cchange {
+			change = true
+		}
 
 		if change {
 			r.statusUpdates = append(r.statusUpdates, &cmon)
 		}
 	}
 
+	// Generate scrape jobs for external targets declared in
+	// ClusterStaticMonitorings.
+	var staticMons monitoringv1.ClusterStaticMonitoringList
+	if err := r.client.List(ctx, &staticMons); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list ClusterStaticMonitorings")
+	}
+	var scraperNode string
+	if len(staticMons.Items) > 0 {
+		// External targets are cluster-global like the control plane ones, so
+		// reuse the same election to scrape each target exactly once.
+		scraperNode, err = r.electControlPlaneScraper(ctx)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "elect external target scraper")
+		}
+	}
+	for _, sm := range staticMons.Items {
+		// Reassign so we can safely get a pointer.
+		smon := sm
+
+		cond = metav1.Condition{
+			Type:   monitoringv1.ConfigurationCreateSuccess,
+			Status: metav1.ConditionTrue,
+			Reason: monitoringv1.ReasonConfigurationCreated,
+		}
+		httpSDURL := fmt.Sprintf("http://%s.%s.svc:%d/discovery/%s", NameOperator, r.opts.OperatorNamespace, googleCloudSDPort, smon.Name)
+		cacheKey := fmt.Sprintf("ClusterStaticMonitoring/%s", smon.Name)
+		staticInputs := strings.Join([]string{renderInputs, httpSDURL, scraperNode}, "\x00")
+		cfgs, err := r.scrapeCache.get(cacheKey, smon.Generation, staticInputs, func() ([]*promconfig.ScrapeConfig, error) {
+			return smon.ScrapeConfigs(projectID, location, cluster, httpSDURL, scraperNode)
+		})
+		if err != nil {
+			msg := "generating scrape config failed for ClusterStaticMonitoring"
+			cond = metav1.Condition{
+				Type:    monitoringv1.ConfigurationCreateSuccess,
+				Status:  metav1.ConditionFalse,
+				Reason:  monitoringv1.ReasonScrapeConfigError,
+				Message: msg,
+			}
+			logger.Error(err, msg, "name", smon.Name)
+			r.metrics.configGenerationFailures.WithLabelValues("ClusterStaticMonitoring").Inc()
+			r.recorder.Eventf(&smon, corev1.EventTypeWarning, "ScrapeConfigError", "%s: %s", msg, err)
+			continue
+		}
+		for _, sc := range cfgs {
+			attrs[sc.JobName] = sourceRef("ClusterStaticMonitoring", &smon)
+		}
+		cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, cfgs...)
+
+		if change, err := smon.Status.SetMonitoringCondition(smon.GetGeneration(), metav1.Now(), cond); err != nil {
+			logger.Error(err, "setting clusterstaticmonitoring status state")
+		} else if change {
+			r.statusUpdates = append(r.statusUpdates, &smon)
+		}
+	}
+
+	// Drop cache entries for deleted resources.
+	r.scrapeCache.sweep()
+
 	// Sort to ensure reproducible configs.
 	sort.Slice(cfg.ScrapeConfigs, func(i, j int) bool {
 		return cfg.ScrapeConfigs[i].JobName < cfg.ScrapeConfigs[j].JobName
 	})
 
-	return cfg, nil
+	return cfg, attrs, nil
 }
 
 type podMonitoringDefaulter struct{}
@@ -444,6 +1281,82 @@ func (d *clusterPodMonitoringDefaulter) Default(ctx context.Context, o runtime.O
 	return nil
 }
 
+// makeRemoteWriteConfig generates the remote_write entry mirroring collected
+// data to a user-run Prometheus-compatible endpoint. The optional filter
+// selectors are translated into write relabel rules: each selector marks the
+// series it matches through a temporary label, which series must carry to be
+// sent. The temporary label is stripped by Prometheus before sending.
+func makeRemoteWriteConfig(spec *monitoringv1.RemoteWriteSpec) (*promconfig.RemoteWriteConfig, error) {
+	u, err := url.Parse(spec.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid remote-write URL %q", spec.URL)
+	}
+	rw := promconfig.DefaultRemoteWriteConfig
+	rw.URL = &config.URL{URL: u}
+
+	if len(spec.Filter.MatchOneOf) == 0 {
+		return &rw, nil
+	}
+	rules, err := selectorKeepRelabels(spec.Filter.MatchOneOf, "__tmp_remote_write_match")
+	if err != nil {
+		return nil, err
+	}
+	rw.WriteRelabelConfigs = rules
+
+	return &rw, nil
+}
+
+// selectorKeepRelabels translates the given series selectors into relabel
+// rules that only keep series matching at least one selector. Each selector
+// marks the series it matches through the given temporary marker label, which
+// series must carry to be kept. The marker label is stripped by Prometheus
+// before the series is stored or sent.
+func selectorKeepRelabels(selectors []string, markerLabel string) ([]*relabel.Config, error) {
+	var rules []*relabel.Config
+
+	for _, selector := range selectors {
+		matchers, err := parser.ParseMetricSelector(selector)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid filter %q", selector)
+		}
+		var (
+			sourceLabels prommodel.LabelNames
+			regexes      []string
+		)
+		for _, m := range matchers {
+			switch m.Type {
+			case labels.MatchEqual:
+				regexes = append(regexes, regexp.QuoteMeta(m.Value))
+			case labels.MatchRegexp:
+				regexes = append(regexes, "(?:"+m.Value+")")
+			default:
+				return nil, errors.Errorf("negated matcher %q in filter %q is not supported", m, selector)
+			}
+			sourceLabels = append(sourceLabels, prommodel.LabelName(m.Name))
+		}
+		re, err := relabel.NewRegexp(strings.Join(regexes, ";"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid filter %q", selector)
+		}
+		rule := relabel.DefaultRelabelConfig
+		rule.SourceLabels = sourceLabels
+		rule.Regex = re
+		rule.TargetLabel = markerLabel
+		rule.Replacement = "true"
+		rules = append(rules, &rule)
+	}
+	keepRegex, err := relabel.NewRegexp("true")
+	if err != nil {
+		return nil, err
+	}
+	keep := relabel.DefaultRelabelConfig
+	keep.SourceLabels = prommodel.LabelNames{prommodel.LabelName(markerLabel)}
+	keep.Regex = keepRegex
+	keep.Action = relabel.Keep
+
+	return append(rules, &keep), nil
+}
+
 func makeKubeletScrapeConfigs(cfg *monitoringv1.KubeletScraping) ([]*promconfig.ScrapeConfig, error) {
 	if cfg == nil {
 		return nil, nil
@@ -540,3 +1453,125 @@ func makeKubeletScrapeConfigs(cfg *monitoringv1.KubeletScraping) ([]*promconfig.
 		},
 	}, nil
 }
+
+// makeControlPlaneScrapeConfigs generates scrape configs for the control plane
+// endpoints reachable within the cluster, i.e. the API server behind the
+// `kubernetes` service in the default namespace. Unlike regular targets, which
+// each collector only scrapes for its own node, the API server is a
+// cluster-global target. A single collector is elected for it by node name so
+// the target is not scraped redundantly by the entire fleet.
+func (r *collectionReconciler) makeControlPlaneScrapeConfigs(ctx context.Context, cfg *monitoringv1.ControlPlaneScraping) ([]*promconfig.ScrapeConfig, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	interval, err := prommodel.ParseDuration(cfg.Interval)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid scrape interval")
+	}
+	node, err := r.electControlPlaneScraper(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if node == "" {
+		// No collectors are running yet. Generate no job rather than one that
+		// is scraped everywhere; the next reconcile picks it up.
+		return nil, nil
+	}
+	discoveryCfgs := discovery.Configs{
+		&discoverykube.SDConfig{
+			HTTPClientConfig:   config.DefaultHTTPClientConfig,
+			Role:               discoverykube.RoleEndpoint,
+			NamespaceDiscovery: discoverykube.NamespaceDiscovery{Names: []string{"default"}},
+			Selectors: []discoverykube.SelectorConfig{
+				{
+					Role:  discoverykube.RoleEndpoint,
+					Field: "metadata.name=kubernetes",
+				},
+			},
+		},
+	}
+	clientCfg := config.HTTPClientConfig{
+		Authorization: &config.Authorization{
+			CredentialsFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+		},
+		TLSConfig: config.TLSConfig{
+			CAFile: "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt",
+			// The endpoint addresses are raw IPs, verify the serving
+			// certificate against the service name instead.
+			ServerName: "kubernetes",
+		},
+	}
+	relabelCfgs := []*relabel.Config{
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_endpoint_port_name"},
+			Regex:        relabel.MustNewRegexp("https"),
+		},
+		// Each collector interpolates $(NODE_NAME) with its own node through
+		// the config reloader. Keeping the target only on the elected node
+		// ensures the API server is scraped exactly once.
+		{
+			Action:      relabel.Replace,
+			Replacement: fmt.Sprintf("$(%s)", monitoringv1.EnvVarNodeName),
+			TargetLabel: "__tmp_control_plane_node",
+		},
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__tmp_control_plane_node"},
+			Regex:        relabel.MustNewRegexp(regexp.QuoteMeta(node)),
+		},
+		// Align job and instance with the label conventions of the control
+		// plane metrics GKE provides natively.
+		{
+			Action:      relabel.Replace,
+			Replacement: "apiserver",
+			TargetLabel: "job",
+		},
+		{
+			Action:      relabel.Replace,
+			Replacement: "kubernetes:https",
+			TargetLabel: "instance",
+		},
+	}
+	var metricRelabelCfgs []*relabel.Config
+	if len(cfg.MatchOneOf) > 0 {
+		metricRelabelCfgs, err = selectorKeepRelabels(cfg.MatchOneOf, "__tmp_control_plane_match")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []*promconfig.ScrapeConfig{
+		{
+			JobName:                 "apiserver/metrics",
+			ServiceDiscoveryConfigs: discoveryCfgs,
+			ScrapeInterval:          interval,
+			Scheme:                  "https",
+			MetricsPath:             "/metrics",
+			HTTPClientConfig:        clientCfg,
+			RelabelConfigs:          relabelCfgs,
+			MetricRelabelConfigs:    metricRelabelCfgs,
+		},
+	}, nil
+}
+
+// electControlPlaneScraper deterministically picks the node whose collector
+// scrapes cluster-global control plane targets. Returns an empty string if no
+// collector is currently running.
+func (r *collectionReconciler) electControlPlaneScraper(ctx context.Context) (string, error) {
+	pods, err := r.kubeClient.CoreV1().Pods(r.opts.OperatorNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", LabelAppName, NameCollector),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "list collector pods")
+	}
+	var node string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.Spec.NodeName == "" {
+			continue
+		}
+		if node == "" || pod.Spec.NodeName < node {
+			node = pod.Spec.NodeName
+		}
+	}
+	return node, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	prommodel "github.com/prometheus/common/model"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/relabel"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// protectedOverrideLabels are target labels the managed collection relies on.
+// CollectionOverrides must not redefine them.
+var protectedOverrideLabels = map[string]bool{
+	export.KeyProjectID: true,
+	export.KeyLocation:  true,
+	export.KeyCluster:   true,
+	export.KeyNamespace: true,
+	"job":               true,
+	"instance":          true,
+}
+
+// collectionOverridesByNamespace indexes the given overrides by namespace. If
+// a namespace contains multiple CollectionOverrides, the one first in name
+// order wins and the others are ignored, keeping the result deterministic.
+func collectionOverridesByNamespace(overrides []monitoringv1.CollectionOverride) map[string]*monitoringv1.CollectionOverrideSpec {
+	sorted := make([]monitoringv1.CollectionOverride, len(overrides))
+	copy(sorted, overrides)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Namespace != sorted[j].Namespace {
+			return sorted[i].Namespace < sorted[j].Namespace
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	res := map[string]*monitoringv1.CollectionOverrideSpec{}
+	for i := range sorted {
+		ov := &sorted[i]
+		if _, ok := res[ov.Namespace]; !ok {
+			res[ov.Namespace] = &ov.Spec
+		}
+	}
+	return res
+}
+
+// applyCollectionOverride adjusts the scrape configs generated from the
+// PodMonitorings of a single namespace according to the namespace's
+// CollectionOverride. Labels reserved by the managed collection or already set
+// as external labels in the OperatorConfig are skipped so the override cannot
+// shadow them.
+func applyCollectionOverride(cfgs []*promconfig.ScrapeConfig, spec *monitoringv1.CollectionOverrideSpec, externalLabels map[string]string) error {
+	var extraRelabels []*relabel.Config
+
+	// Attach the override's external labels to all scraped samples. Sort the
+	// keys so the generated config is deterministic.
+	var keys []string
+	for name := range spec.ExternalLabels {
+		if protectedOverrideLabels[name] {
+			continue
+		}
+		if _, ok := externalLabels[name]; ok {
+			continue
+		}
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		if !prommodel.LabelName(name).IsValid() {
+			return errors.Errorf("invalid external label name %q", name)
+		}
+		extraRelabels = append(extraRelabels, &relabel.Config{
+			Action:      relabel.Replace,
+			TargetLabel: name,
+			Replacement: spec.ExternalLabels[name],
+		})
+	}
+
+	if len(spec.Filter.MatchOneOf) > 0 {
+		rules, err := selectorKeepRelabels(spec.Filter.MatchOneOf, "__tmp_namespace_filter_match")
+		if err != nil {
+			return errors.Wrap(err, "failed to create namespace filter config")
+		}
+		extraRelabels = append(extraRelabels, rules...)
+	}
+
+	var interval prommodel.Duration
+	if spec.ScrapeInterval != "" {
+		var err error
+		interval, err = prommodel.ParseDuration(spec.ScrapeInterval)
+		if err != nil {
+			return errors.Wrap(err, "invalid scrape interval")
+		}
+	}
+
+	for _, sc := range cfgs {
+		if interval > 0 {
+			sc.ScrapeInterval = interval
+			if sc.ScrapeTimeout > interval {
+				sc.ScrapeTimeout = interval
+			}
+		}
+		sc.MetricRelabelConfigs = append(sc.MetricRelabelConfigs, extraRelabels...)
+	}
+	return nil
+}
+
+// collectionOverrideValidator validates CollectionOverrides.
+type collectionOverrideValidator struct{}
+
+func (v *collectionOverrideValidator) ValidateCreate(ctx context.Context, o runtime.Object) error {
+	ov := o.(*monitoringv1.CollectionOverride)
+
+	// Validate against an empty scrape config. This exercises the same code
+	// paths as config generation without requiring actual PodMonitorings.
+	if err := applyCollectionOverride(nil, &ov.Spec, nil); err != nil {
+		return err
+	}
+	for name := range ov.Spec.ExternalLabels {
+		if protectedOverrideLabels[name] {
+			return errors.Errorf("external label %q is reserved by the managed collection and cannot be overridden", name)
+		}
+	}
+	return nil
+}
+
+func (v *collectionOverrideValidator) ValidateUpdate(ctx context.Context, _, o runtime.Object) error {
+	return v.ValidateCreate(ctx, o)
+}
+
+func (v *collectionOverrideValidator) ValidateDelete(ctx context.Context, o runtime.Object) error {
+	return nil
+}
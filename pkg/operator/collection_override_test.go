@@ -0,0 +1,140 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	prommodel "github.com/prometheus/common/model"
+	promconfig "github.com/prometheus/prometheus/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestApplyCollectionOverride(t *testing.T) {
+	mustDuration := func(s string) prommodel.Duration {
+		d, err := prommodel.ParseDuration(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	t.Run("scrape interval", func(t *testing.T) {
+		cfgs := []*promconfig.ScrapeConfig{
+			{JobName: "a", ScrapeInterval: mustDuration("1m"), ScrapeTimeout: mustDuration("30s")},
+			{JobName: "b", ScrapeInterval: mustDuration("10s"), ScrapeTimeout: mustDuration("10s")},
+		}
+		spec := &monitoringv1.CollectionOverrideSpec{ScrapeInterval: "15s"}
+
+		if err := applyCollectionOverride(cfgs, spec, nil); err != nil {
+			t.Fatal(err)
+		}
+		for _, sc := range cfgs {
+			if sc.ScrapeInterval != mustDuration("15s") {
+				t.Errorf("job %q: unexpected scrape interval %v", sc.JobName, sc.ScrapeInterval)
+			}
+		}
+		// The first job's timeout exceeded the new interval and must be capped.
+		if cfgs[0].ScrapeTimeout != mustDuration("15s") {
+			t.Errorf("unexpected scrape timeout %v", cfgs[0].ScrapeTimeout)
+		}
+		if cfgs[1].ScrapeTimeout != mustDuration("10s") {
+			t.Errorf("unexpected scrape timeout %v", cfgs[1].ScrapeTimeout)
+		}
+	})
+
+	t.Run("external labels", func(t *testing.T) {
+		cfgs := []*promconfig.ScrapeConfig{{JobName: "a"}}
+		spec := &monitoringv1.CollectionOverrideSpec{
+			ExternalLabels: map[string]string{
+				"team":       "backend",
+				"env":        "prod",
+				"project_id": "spoofed",  // Reserved, must be skipped.
+				"global":     "conflict", // Set in the OperatorConfig, must be skipped.
+			},
+		}
+		if err := applyCollectionOverride(cfgs, spec, map[string]string{"global": "x"}); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, rc := range cfgs[0].MetricRelabelConfigs {
+			got = append(got, rc.TargetLabel+"="+rc.Replacement)
+		}
+		want := []string{"env=prod", "team=backend"}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("unexpected label relabel configs: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		cfgs := []*promconfig.ScrapeConfig{{JobName: "a"}}
+		spec := &monitoringv1.CollectionOverrideSpec{
+			Filter: monitoringv1.ExportFilters{
+				MatchOneOf: []string{`{__name__=~"foo_.*"}`},
+			},
+		}
+		if err := applyCollectionOverride(cfgs, spec, nil); err != nil {
+			t.Fatal(err)
+		}
+		if len(cfgs[0].MetricRelabelConfigs) == 0 {
+			t.Error("expected filter relabel configs to be appended")
+		}
+	})
+
+	t.Run("invalid interval", func(t *testing.T) {
+		spec := &monitoringv1.CollectionOverrideSpec{ScrapeInterval: "foo"}
+		if err := applyCollectionOverride(nil, spec, nil); err == nil {
+			t.Error("expected error for invalid scrape interval")
+		}
+	})
+
+	t.Run("negated filter", func(t *testing.T) {
+		spec := &monitoringv1.CollectionOverrideSpec{
+			Filter: monitoringv1.ExportFilters{
+				MatchOneOf: []string{`{foo!="bar"}`},
+			},
+		}
+		if err := applyCollectionOverride(nil, spec, nil); err == nil {
+			t.Error("expected error for negated filter matcher")
+		}
+	})
+}
+
+func TestCollectionOverridesByNamespace(t *testing.T) {
+	override := func(ns, name, interval string) monitoringv1.CollectionOverride {
+		return monitoringv1.CollectionOverride{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+			Spec:       monitoringv1.CollectionOverrideSpec{ScrapeInterval: interval},
+		}
+	}
+	res := collectionOverridesByNamespace([]monitoringv1.CollectionOverride{
+		override("ns1", "zz", "1m"),
+		override("ns1", "aa", "30s"),
+		override("ns2", "default", "10s"),
+	})
+	if len(res) != 2 {
+		t.Fatalf("expected 2 namespaces, got %d", len(res))
+	}
+	// The first override in name order wins within a namespace.
+	if res["ns1"].ScrapeInterval != "30s" {
+		t.Errorf("unexpected override for ns1: %v", res["ns1"])
+	}
+	if res["ns2"].ScrapeInterval != "10s" {
+		t.Errorf("unexpected override for ns2: %v", res["ns2"])
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestCollectorPodSpecPatch(t *testing.T) {
+	decode := func(t *testing.T, b []byte) map[string]interface{} {
+		t.Helper()
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		spec, ok := m["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("unexpected patch structure %v", m)
+		}
+		return spec
+	}
+
+	t.Run("native sidecar move", func(t *testing.T) {
+		podSpec := &corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "prometheus"},
+				{Name: "config-reloader", Image: "reloader:v1"},
+			},
+		}
+		b, err := collectorPodSpecPatch(podSpec, "--foo", nil, nil, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec := decode(t, b)
+
+		containers := spec["containers"].([]interface{})
+		if len(containers) != 2 {
+			t.Fatalf("expected 2 container entries, got %v", containers)
+		}
+		if d := containers[1].(map[string]interface{}); d["name"] != "config-reloader" || d["$patch"] != "delete" {
+			t.Errorf("expected config-reloader delete directive, got %v", d)
+		}
+		inits := spec["initContainers"].([]interface{})
+		entry := inits[0].(map[string]interface{})
+		if entry["name"] != "config-reloader" || entry["restartPolicy"] != "Always" {
+			t.Errorf("unexpected init container entry %v", entry)
+		}
+		// The EXTRA_ARGS env var must be set on the prometheus container.
+		prom := containers[0].(map[string]interface{})
+		env := prom["env"].([]interface{})[0].(map[string]interface{})
+		if env["name"] != "EXTRA_ARGS" || env["value"] != "--foo" {
+			t.Errorf("unexpected env entry %v", env)
+		}
+	})
+
+	t.Run("already native sidecar", func(t *testing.T) {
+		podSpec := &corev1.PodSpec{
+			Containers:     []corev1.Container{{Name: "prometheus"}},
+			InitContainers: []corev1.Container{{Name: "config-reloader", Image: "reloader:v1"}},
+		}
+		b, err := collectorPodSpecPatch(podSpec, "", nil, nil, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec := decode(t, b)
+
+		if containers := spec["containers"].([]interface{}); len(containers) != 1 {
+			t.Errorf("expected no container directives besides prometheus, got %v", containers)
+		}
+		entry := spec["initContainers"].([]interface{})[0].(map[string]interface{})
+		if entry["restartPolicy"] != "Always" {
+			t.Errorf("expected restart policy to be enforced, got %v", entry)
+		}
+	})
+
+	t.Run("fallback to regular container", func(t *testing.T) {
+		podSpec := &corev1.PodSpec{
+			Containers:     []corev1.Container{{Name: "prometheus"}},
+			InitContainers: []corev1.Container{{Name: "config-reloader", Image: "reloader:v1"}},
+		}
+		b, err := collectorPodSpecPatch(podSpec, "", nil, nil, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec := decode(t, b)
+
+		containers := spec["containers"].([]interface{})
+		if entry := containers[1].(map[string]interface{}); entry["name"] != "config-reloader" || entry["restartPolicy"] != nil {
+			t.Errorf("unexpected container entry %v", entry)
+		}
+		if d := spec["initContainers"].([]interface{})[0].(map[string]interface{}); d["$patch"] != "delete" {
+			t.Errorf("expected init container delete directive, got %v", d)
+		}
+	})
+
+	t.Run("no move needed", func(t *testing.T) {
+		podSpec := &corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "prometheus"},
+				{Name: "config-reloader"},
+			},
+		}
+		b, err := collectorPodSpecPatch(podSpec, "", nil, nil, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec := decode(t, b)
+
+		if _, ok := spec["initContainers"]; ok {
+			t.Errorf("expected no init container directives, got %v", spec["initContainers"])
+		}
+		if containers := spec["containers"].([]interface{}); len(containers) != 1 {
+			t.Errorf("expected only the prometheus entry, got %v", containers)
+		}
+	})
+
+	t.Run("credential volumes", func(t *testing.T) {
+		podSpec := &corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "prometheus", VolumeMounts: []corev1.VolumeMount{
+					{Name: "gmp-credentials-old", MountPath: "/etc/secrets-store/old"},
+				}},
+				{Name: "config-reloader"},
+			},
+			Volumes: []corev1.Volume{{Name: "gmp-credentials-old"}},
+		}
+		vols := []monitoringv1.CredentialVolume{{Name: "new", SecretProviderClass: "spc"}}
+
+		b, err := collectorPodSpecPatch(podSpec, "", vols, nil, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec := decode(t, b)
+
+		volumes := spec["volumes"].([]interface{})
+		if len(volumes) != 2 {
+			t.Fatalf("expected add and delete volume entries, got %v", volumes)
+		}
+		if add := volumes[0].(map[string]interface{}); add["name"] != "gmp-credentials-new" {
+			t.Errorf("unexpected volume entry %v", add)
+		}
+		if del := volumes[1].(map[string]interface{}); del["name"] != "gmp-credentials-old" || del["$patch"] != "delete" {
+			t.Errorf("expected delete directive for stale volume, got %v", del)
+		}
+		prom := spec["containers"].([]interface{})[0].(map[string]interface{})
+		mounts := prom["volumeMounts"].([]interface{})
+		if len(mounts) != 2 {
+			t.Fatalf("expected add and delete mount entries, got %v", mounts)
+		}
+		if del := mounts[1].(map[string]interface{}); del["mountPath"] != "/etc/secrets-store/old" || del["$patch"] != "delete" {
+			t.Errorf("expected delete directive for stale mount, got %v", del)
+		}
+	})
+
+	t.Run("extra mounts", func(t *testing.T) {
+		podSpec := &corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "prometheus", VolumeMounts: []corev1.VolumeMount{
+					{Name: "gmp-mount-old", MountPath: "/etc/gmp-mounts/old"},
+				}},
+				{Name: "config-reloader"},
+			},
+			Volumes: []corev1.Volume{{Name: "gmp-mount-old"}},
+		}
+		mounts := []monitoringv1.ExtraMount{{Name: "ca", ConfigMap: "proxy-ca"}}
+
+		b, err := collectorPodSpecPatch(podSpec, "", nil, mounts, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec := decode(t, b)
+
+		volumes := spec["volumes"].([]interface{})
+		if len(volumes) != 2 {
+			t.Fatalf("expected add and delete volume entries, got %v", volumes)
+		}
+		if add := volumes[0].(map[string]interface{}); add["name"] != "gmp-mount-ca" {
+			t.Errorf("unexpected volume entry %v", add)
+		}
+		if del := volumes[1].(map[string]interface{}); del["name"] != "gmp-mount-old" || del["$patch"] != "delete" {
+			t.Errorf("expected delete directive for stale volume, got %v", del)
+		}
+		prom := spec["containers"].([]interface{})[0].(map[string]interface{})
+		promMounts := prom["volumeMounts"].([]interface{})
+		if len(promMounts) != 2 {
+			t.Fatalf("expected add and delete mount entries, got %v", promMounts)
+		}
+		if add := promMounts[0].(map[string]interface{}); add["mountPath"] != "/etc/gmp-mounts/ca" {
+			t.Errorf("unexpected mount entry %v", add)
+		}
+
+		if _, _, err := extraMountVolume(monitoringv1.ExtraMount{Name: "bad"}); err == nil {
+			t.Error("expected error for mount without source")
+		}
+		if _, _, err := extraMountVolume(monitoringv1.ExtraMount{Name: "bad", Secret: "a", ConfigMap: "b"}); err == nil {
+			t.Error("expected error for mount with two sources")
+		}
+	})
+
+	t.Run("proxy settings", func(t *testing.T) {
+		podSpec := &corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "prometheus", Env: []corev1.EnvVar{
+					{Name: "NO_PROXY", Value: "old"},
+				}},
+				{Name: "config-reloader"},
+			},
+		}
+		proxy := &monitoringv1.ProxyConfig{
+			HTTPProxy: "http://proxy:3128",
+			TrustedCA: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "proxy-ca"},
+				Key:                  "bundle.pem",
+			},
+		}
+		b, err := collectorPodSpecPatch(podSpec, "", nil, nil, proxy, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec := decode(t, b)
+
+		prom := spec["containers"].([]interface{})[0].(map[string]interface{})
+		got := map[string]interface{}{}
+		for _, e := range prom["env"].([]interface{}) {
+			ev := e.(map[string]interface{})
+			if ev["$patch"] == "delete" {
+				got[ev["name"].(string)] = "<deleted>"
+			} else {
+				got[ev["name"].(string)] = ev["value"]
+			}
+		}
+		want := map[string]interface{}{
+			"EXTRA_ARGS":    "",
+			"HTTP_PROXY":    "http://proxy:3128",
+			"HTTPS_PROXY":   "http://proxy:3128",
+			"NO_PROXY":      "<deleted>",
+			"SSL_CERT_FILE": "/etc/gmp-proxy/ca.crt",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected env entries %v, want %v", got, want)
+		}
+		volumes := spec["volumes"].([]interface{})
+		if len(volumes) != 1 || volumes[0].(map[string]interface{})["name"] != "gmp-proxy-ca" {
+			t.Errorf("expected trusted CA volume, got %v", volumes)
+		}
+	})
+}
+
+func TestUpdateConfigCoalescesWrites(t *testing.T) {
+	ctx := context.Background()
+	cl := fake.NewClientBuilder().Build()
+	r := newCollectionReconciler(cl, cl, nil, Options{
+		OperatorNamespace:    "gmp-system",
+		ConfigReloadInterval: time.Minute,
+	}, nil, nil)
+
+	// The initial write goes through immediately.
+	wait, err := r.updateConfig(ctx, NameCollector, nil, []byte("cfg1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait != 0 {
+		t.Fatalf("expected immediate write, got wait %v", wait)
+	}
+	// An identical write is a no-op.
+	if wait, err = r.updateConfig(ctx, NameCollector, nil, []byte("cfg1")); err != nil {
+		t.Fatal(err)
+	} else if wait != 0 {
+		t.Fatalf("expected no-op write, got wait %v", wait)
+	}
+	// A change right after the previous write is deferred.
+	if wait, err = r.updateConfig(ctx, NameCollector, nil, []byte("cfg2")); err != nil {
+		t.Fatal(err)
+	} else if wait <= 0 {
+		t.Fatal("expected deferred write")
+	}
+	var cm corev1.ConfigMap
+	if err := cl.Get(ctx, client.ObjectKey{Namespace: "gmp-system", Name: NameCollector}, &cm); err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data[configFilename] != "cfg1" {
+		t.Fatalf("expected deferred write to leave config unchanged, got %q", cm.Data[configFilename])
+	}
+	// Once the interval has passed, the coalesced change is written.
+	r.lastConfigWrite[NameCollector] = time.Now().Add(-2 * time.Minute)
+	if wait, err = r.updateConfig(ctx, NameCollector, nil, []byte("cfg2")); err != nil {
+		t.Fatal(err)
+	} else if wait != 0 {
+		t.Fatalf("expected immediate write, got wait %v", wait)
+	}
+	if err := cl.Get(ctx, client.ObjectKey{Namespace: "gmp-system", Name: NameCollector}, &cm); err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data[configFilename] != "cfg2" {
+		t.Fatalf("expected config to be updated, got %q", cm.Data[configFilename])
+	}
+}
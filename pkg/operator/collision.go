@@ -0,0 +1,115 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// scrapeTargetSet describes the pods and ports a monitoring resource selects,
+// used to detect monitoring resources that may scrape the same targets.
+type scrapeTargetSet struct {
+	// Description of the resource, e.g. "PodMonitoring/ns/name".
+	id string
+	// Namespace the resource selects pods in, empty for all namespaces.
+	namespace string
+	selector  metav1.LabelSelector
+	ports     map[string]bool
+}
+
+// detectTargetCollisions returns, per monitoring resource, a description of
+// another monitoring resource that may select the same pods and ports. Such
+// overlap causes duplicate series and write conflicts against Cloud Monitoring
+// that otherwise only show up as silent sample drops.
+// Selector overlap is approximated conservatively: selectors count as
+// overlapping unless their label requirements are provably disjoint.
+func detectTargetCollisions(podMons []monitoringv1.PodMonitoring, clusterPodMons []monitoringv1.ClusterPodMonitoring) map[string]string {
+	var sets []scrapeTargetSet
+	for i := range podMons {
+		pm := &podMons[i]
+		sets = append(sets, scrapeTargetSet{
+			id:        fmt.Sprintf("PodMonitoring/%s/%s", pm.Namespace, pm.Name),
+			namespace: pm.Namespace,
+			selector:  pm.Spec.Selector,
+			ports:     endpointPorts(pm.Spec.Endpoints),
+		})
+	}
+	for i := range clusterPodMons {
+		cm := &clusterPodMons[i]
+		sets = append(sets, scrapeTargetSet{
+			id:       fmt.Sprintf("ClusterPodMonitoring/%s", cm.Name),
+			selector: cm.Spec.Selector,
+			ports:    endpointPorts(cm.Spec.Endpoints),
+		})
+	}
+
+	collisions := map[string]string{}
+	for i := range sets {
+		for j := i + 1; j < len(sets); j++ {
+			a, b := &sets[i], &sets[j]
+			if a.namespace != "" && b.namespace != "" && a.namespace != b.namespace {
+				continue
+			}
+			port, ok := sharedPort(a.ports, b.ports)
+			if !ok {
+				continue
+			}
+			if !selectorsMayOverlap(a.selector, b.selector) {
+				continue
+			}
+			if _, ok := collisions[a.id]; !ok {
+				collisions[a.id] = fmt.Sprintf("may select the same targets as %s on port %q", b.id, port)
+			}
+			if _, ok := collisions[b.id]; !ok {
+				collisions[b.id] = fmt.Sprintf("may select the same targets as %s on port %q", a.id, port)
+			}
+		}
+	}
+	return collisions
+}
+
+func endpointPorts(eps []monitoringv1.ScrapeEndpoint) map[string]bool {
+	ports := map[string]bool{}
+	for _, ep := range eps {
+		ports[ep.Port.String()] = true
+	}
+	return ports
+}
+
+func sharedPort(a, b map[string]bool) (string, bool) {
+	for p := range a {
+		if b[p] {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// selectorsMayOverlap reports whether the two label selectors may match the
+// same pods. It only proves disjointness through conflicting equality
+// requirements; selectors using match expressions are conservatively treated
+// as overlapping.
+func selectorsMayOverlap(a, b metav1.LabelSelector) bool {
+	for k, v := range a.MatchLabels {
+		if w, ok := b.MatchLabels[k]; ok && v != w {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestDetectTargetCollisions(t *testing.T) {
+	podMon := func(ns, name string, labels map[string]string, port string) monitoringv1.PodMonitoring {
+		return monitoringv1.PodMonitoring{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+			Spec: monitoringv1.PodMonitoringSpec{
+				Selector:  metav1.LabelSelector{MatchLabels: labels},
+				Endpoints: []monitoringv1.ScrapeEndpoint{{Port: intstr.FromString(port)}},
+			},
+		}
+	}
+	clusterPodMon := func(name string, labels map[string]string, port string) monitoringv1.ClusterPodMonitoring {
+		return monitoringv1.ClusterPodMonitoring{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: monitoringv1.ClusterPodMonitoringSpec{
+				Selector:  metav1.LabelSelector{MatchLabels: labels},
+				Endpoints: []monitoringv1.ScrapeEndpoint{{Port: intstr.FromString(port)}},
+			},
+		}
+	}
+	cases := []struct {
+		doc            string
+		podMons        []monitoringv1.PodMonitoring
+		clusterPodMons []monitoringv1.ClusterPodMonitoring
+		want           []string
+	}{
+		{
+			doc: "same namespace, same selector, same port",
+			podMons: []monitoringv1.PodMonitoring{
+				podMon("ns1", "a", map[string]string{"app": "x"}, "metrics"),
+				podMon("ns1", "b", map[string]string{"app": "x"}, "metrics"),
+			},
+			want: []string{"PodMonitoring/ns1/a", "PodMonitoring/ns1/b"},
+		},
+		{
+			doc: "different namespaces do not collide",
+			podMons: []monitoringv1.PodMonitoring{
+				podMon("ns1", "a", map[string]string{"app": "x"}, "metrics"),
+				podMon("ns2", "b", map[string]string{"app": "x"}, "metrics"),
+			},
+		},
+		{
+			doc: "different ports do not collide",
+			podMons: []monitoringv1.PodMonitoring{
+				podMon("ns1", "a", map[string]string{"app": "x"}, "metrics"),
+				podMon("ns1", "b", map[string]string{"app": "x"}, "telemetry"),
+			},
+		},
+		{
+			doc: "conflicting selectors do not collide",
+			podMons: []monitoringv1.PodMonitoring{
+				podMon("ns1", "a", map[string]string{"app": "x"}, "metrics"),
+				podMon("ns1", "b", map[string]string{"app": "y"}, "metrics"),
+			},
+		},
+		{
+			doc: "cluster-wide monitoring overlaps namespaced one",
+			podMons: []monitoringv1.PodMonitoring{
+				podMon("ns1", "a", map[string]string{"app": "x"}, "metrics"),
+			},
+			clusterPodMons: []monitoringv1.ClusterPodMonitoring{
+				clusterPodMon("c", map[string]string{"tier": "backend"}, "metrics"),
+			},
+			want: []string{"PodMonitoring/ns1/a", "ClusterPodMonitoring/c"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			got := detectTargetCollisions(c.podMons, c.clusterPodMons)
+			if len(got) != len(c.want) {
+				t.Fatalf("expected collisions for %v, got %v", c.want, got)
+			}
+			for _, id := range c.want {
+				if _, ok := got[id]; !ok {
+					t.Errorf("expected collision for %q, got %v", id, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// AnnotationTranslationReport is set on PodMonitorings generated from
+// prometheus-operator resources and lists source fields that could not be
+// translated.
+const AnnotationTranslationReport = "monitoring.googleapis.com/translation-report"
+
+// annotationGeneratedFrom records the prometheus-operator resource a generated
+// PodMonitoring was translated from.
+const annotationGeneratedFrom = "monitoring.googleapis.com/generated-from"
+
+var (
+	podMonitorGVK     = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PodMonitor"}
+	serviceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+)
+
+// setupPrometheusOperatorControllers registers controllers that translate
+// prometheus-operator PodMonitor and ServiceMonitor resources into
+// PodMonitorings, easing migration from kube-prometheus setups and Helm charts
+// that ship ServiceMonitors. The prometheus-operator types are handled as
+// unstructured objects to avoid a dependency on its API module.
+func setupPrometheusOperatorControllers(op *Operator) error {
+	for _, gvk := range []schema.GroupVersionKind{podMonitorGVK, serviceMonitorGVK} {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+
+		err := ctrl.NewControllerManagedBy(op.manager).
+			Named("prometheus-operator-" + strings.ToLower(gvk.Kind)).
+			WithEventFilter(predicate.ResourceVersionChangedPredicate{}).
+			For(obj).
+			Complete(&prometheusOperatorReconciler{
+				client:   op.manager.GetClient(),
+				opts:     op.opts,
+				kind:     gvk.Kind,
+				recorder: op.manager.GetEventRecorderFor(NameOperator),
+			})
+		if err != nil {
+			return errors.Wrapf(err, "create %s controller", gvk.Kind)
+		}
+	}
+	return nil
+}
+
+// prometheusOperatorCRDsInstalled reports whether the prometheus-operator
+// monitoring CRDs that the compatibility controllers watch exist in the cluster.
+func (o *Operator) prometheusOperatorCRDsInstalled(ctx context.Context) (bool, error) {
+	for _, name := range []string{"podmonitors.monitoring.coreos.com", "servicemonitors.monitoring.coreos.com"} {
+		var crd unstructured.Unstructured
+		crd.SetGroupVersionKind(schema.GroupVersionKind{
+			Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition",
+		})
+		err := o.client.Get(ctx, types.NamespacedName{Name: name}, &crd)
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+type prometheusOperatorReconciler struct {
+	client   client.Client
+	opts     Options
+	kind     string
+	recorder record.EventRecorder
+}
+
+func (r *prometheusOperatorReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	logger, _ := logr.FromContext(ctx)
+	logger.Info("reconciling prometheus-operator resource", "kind", r.kind)
+
+	if !r.opts.namespaceAllowed(req.Namespace) {
+		return reconcile.Result{}, nil
+	}
+	obj := &unstructured.Unstructured{}
+	if r.kind == "PodMonitor" {
+		obj.SetGroupVersionKind(podMonitorGVK)
+	} else {
+		obj.SetGroupVersionKind(serviceMonitorGVK)
+	}
+	if err := r.client.Get(ctx, req.NamespacedName, obj); apierrors.IsNotFound(err) {
+		// The generated PodMonitoring is garbage-collected via its owner reference.
+		return reconcile.Result{}, nil
+	} else if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "get %s", r.kind)
+	}
+
+	pmon, report, err := translateMonitor(obj, r.kind)
+	if err != nil {
+		r.recorder.Eventf(obj, corev1.EventTypeWarning, "TranslationError", "translating to PodMonitoring failed: %s", err)
+		return reconcile.Result{}, nil
+	}
+	if len(report) > 0 {
+		sort.Strings(report)
+		pmon.Annotations[AnnotationTranslationReport] = strings.Join(report, "; ")
+		r.recorder.Eventf(obj, corev1.EventTypeWarning, "TranslationIncomplete",
+			"fields not translated to PodMonitoring: %s", strings.Join(report, "; "))
+	}
+
+	if err := r.client.Update(ctx, pmon); apierrors.IsNotFound(err) {
+		if err := r.client.Create(ctx, pmon); err != nil {
+			return reconcile.Result{}, errors.Wrap(err, "create PodMonitoring")
+		}
+	} else if err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "update PodMonitoring")
+	}
+	return reconcile.Result{}, nil
+}
+
+// compatMonitorSpec captures the subset of the prometheus-operator PodMonitor
+// and ServiceMonitor specs relevant for translation. Raw messages stand in for
+// structures that have no GMP equivalent and are only checked for presence.
+type compatMonitorSpec struct {
+	JobLabel            string               `json:"jobLabel,omitempty"`
+	Selector            metav1.LabelSelector `json:"selector"`
+	PodMetricsEndpoints []compatEndpoint     `json:"podMetricsEndpoints,omitempty"`
+	Endpoints           []compatEndpoint     `json:"endpoints,omitempty"`
+	NamespaceSelector   struct {
+		Any        bool     `json:"any,omitempty"`
+		MatchNames []string `json:"matchNames,omitempty"`
+	} `json:"namespaceSelector,omitempty"`
+	SampleLimit     uint64          `json:"sampleLimit,omitempty"`
+	LabelLimit      uint64          `json:"labelLimit,omitempty"`
+	TargetLabels    []string        `json:"targetLabels,omitempty"`
+	PodTargetLabels []string        `json:"podTargetLabels,omitempty"`
+	TargetLimit     json.RawMessage `json:"targetLimit,omitempty"`
+	AttachMetadata  json.RawMessage `json:"attachMetadata,omitempty"`
+}
+
+type compatEndpoint struct {
+	Port              string                        `json:"port,omitempty"`
+	TargetPort        *intstr.IntOrString           `json:"targetPort,omitempty"`
+	Path              string                        `json:"path,omitempty"`
+	Scheme            string                        `json:"scheme,omitempty"`
+	Params            map[string][]string           `json:"params,omitempty"`
+	Interval          string                        `json:"interval,omitempty"`
+	ScrapeTimeout     string                        `json:"scrapeTimeout,omitempty"`
+	ProxyURL          string                        `json:"proxyUrl,omitempty"`
+	HonorLabels       bool                          `json:"honorLabels,omitempty"`
+	HonorTimestamps   *bool                         `json:"honorTimestamps,omitempty"`
+	MetricRelabelings []monitoringv1.RelabelingRule `json:"metricRelabelings,omitempty"`
+	Relabelings       json.RawMessage               `json:"relabelings,omitempty"`
+	BasicAuth         json.RawMessage               `json:"basicAuth,omitempty"`
+	TLSConfig         json.RawMessage               `json:"tlsConfig,omitempty"`
+	BearerTokenFile   string                        `json:"bearerTokenFile,omitempty"`
+	BearerTokenSecret json.RawMessage               `json:"bearerTokenSecret,omitempty"`
+	Authorization     json.RawMessage               `json:"authorization,omitempty"`
+	OAuth2            json.RawMessage               `json:"oauth2,omitempty"`
+	FollowRedirects   *bool                         `json:"followRedirects,omitempty"`
+	EnableHTTP2       *bool                         `json:"enableHttp2,omitempty"`
+}
+
+// translateMonitor converts a prometheus-operator PodMonitor or ServiceMonitor
+// into a PodMonitoring in the same namespace, returning a report of source
+// fields that have no equivalent.
+func translateMonitor(obj *unstructured.Unstructured, kind string) (*monitoringv1.PodMonitoring, []string, error) {
+	specRaw, ok := obj.Object["spec"]
+	if !ok {
+		return nil, nil, errors.New("resource has no spec")
+	}
+	b, err := json.Marshal(specRaw)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "encode spec")
+	}
+	var spec compatMonitorSpec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return nil, nil, errors.Wrap(err, "decode spec")
+	}
+	var report []string
+
+	endpoints := spec.PodMetricsEndpoints
+	if kind == "ServiceMonitor" {
+		endpoints = spec.Endpoints
+		// ServiceMonitors select Services. The translation applies the label
+		// selector to pods directly, which works for the common case of services
+		// sharing their selector labels with their pods.
+		report = append(report, "ServiceMonitor target discovery is approximated by selecting pods with the service's labels")
+	}
+	if spec.NamespaceSelector.Any || len(spec.NamespaceSelector.MatchNames) > 0 {
+		report = append(report, "spec.namespaceSelector: cross-namespace selection is not translated")
+	}
+	if spec.JobLabel != "" {
+		report = append(report, "spec.jobLabel: the job label is always set to the PodMonitoring name")
+	}
+	if len(spec.TargetLabels) > 0 {
+		report = append(report, "spec.targetLabels: service labels cannot be mapped to target labels")
+	}
+	if spec.AttachMetadata != nil {
+		report = append(report, "spec.attachMetadata: not supported")
+	}
+	if spec.TargetLimit != nil {
+		report = append(report, "spec.targetLimit: not supported")
+	}
+
+	pmon := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+			Annotations: map[string]string{
+				annotationGeneratedFrom: fmt.Sprintf("%s/%s/%s", kind, obj.GetNamespace(), obj.GetName()),
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetObjectKind().GroupVersionKind().Kind,
+				Name:       obj.GetName(),
+				UID:        obj.GetUID(),
+			}},
+		},
+		Spec: monitoringv1.PodMonitoringSpec{
+			Selector: spec.Selector,
+		},
+	}
+	if spec.SampleLimit > 0 || spec.LabelLimit > 0 {
+		pmon.Spec.Limits = &monitoringv1.ScrapeLimits{
+			Samples: spec.SampleLimit,
+			Labels:  spec.LabelLimit,
+		}
+	}
+	for _, label := range spec.PodTargetLabels {
+		pmon.Spec.TargetLabels.FromPod = append(pmon.Spec.TargetLabels.FromPod, monitoringv1.LabelMapping{From: label})
+	}
+
+	for i, ep := range endpoints {
+		out := monitoringv1.ScrapeEndpoint{
+			Scheme:           ep.Scheme,
+			Path:             ep.Path,
+			Params:           ep.Params,
+			ProxyURL:         ep.ProxyURL,
+			Interval:         ep.Interval,
+			Timeout:          ep.ScrapeTimeout,
+			MetricRelabeling: ep.MetricRelabelings,
+		}
+		switch {
+		case ep.Port != "":
+			out.Port = intstr.FromString(ep.Port)
+		case ep.TargetPort != nil:
+			out.Port = *ep.TargetPort
+		default:
+			return nil, nil, errors.Errorf("endpoint %d has no port", i)
+		}
+		prefix := fmt.Sprintf("endpoint %d: ", i)
+		if ep.HonorLabels {
+			report = append(report, prefix+"honorLabels: scraped labels never override protected target labels")
+		}
+		if ep.HonorTimestamps != nil && !*ep.HonorTimestamps {
+			report = append(report, prefix+"honorTimestamps: not configurable")
+		}
+		if ep.Relabelings != nil {
+			report = append(report, prefix+"relabelings: target relabeling is not supported")
+		}
+		if ep.BasicAuth != nil {
+			report = append(report, prefix+"basicAuth: not supported")
+		}
+		if ep.TLSConfig != nil {
+			report = append(report, prefix+"tlsConfig: not supported")
+		}
+		if ep.BearerTokenFile != "" || ep.BearerTokenSecret != nil {
+			report = append(report, prefix+"bearerToken: not supported")
+		}
+		if ep.Authorization != nil {
+			report = append(report, prefix+"authorization: not supported")
+		}
+		if ep.OAuth2 != nil {
+			report = append(report, prefix+"oauth2: not supported")
+		}
+		pmon.Spec.Endpoints = append(pmon.Spec.Endpoints, out)
+	}
+	return pmon, report, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// seriesPerTarget is the assumed number of active series an average scrape
+// target exposes. It is deliberately rough: the estimate exists to catch
+// selectors that match orders of magnitude more targets than intended, not to
+// predict billing.
+const seriesPerTarget = 500
+
+// podMonitoringAdmission validates PodMonitoring objects and augments the
+// admission response with a warning if the selector and endpoints are
+// estimated to produce an excessive number of series.
+type podMonitoringAdmission struct {
+	kubeClient kubernetes.Interface
+	opts       Options
+	decoder    *admission.Decoder
+}
+
+func (a *podMonitoringAdmission) InjectDecoder(d *admission.Decoder) error {
+	a.decoder = d
+	return nil
+}
+
+func (a *podMonitoringAdmission) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation == admissionv1.Delete {
+		return admission.Allowed("")
+	}
+	var pm monitoringv1.PodMonitoring
+	if err := a.decoder.Decode(req, &pm); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	switch req.Operation {
+	case admissionv1.Create:
+		if err := pm.ValidateCreate(); err != nil {
+			return admission.Denied(err.Error())
+		}
+	case admissionv1.Update:
+		old := &monitoringv1.PodMonitoring{}
+		if err := a.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if err := pm.ValidateUpdate(old); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+	warnings := estimateCostWarnings(ctx, a.kubeClient, a.opts, pm.Namespace, pm.Spec.Selector, len(pm.Spec.Endpoints))
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// clusterPodMonitoringAdmission is the equivalent of podMonitoringAdmission
+// for the cluster-scoped resource. The cost estimate considers pods across
+// all namespaces.
+type clusterPodMonitoringAdmission struct {
+	kubeClient kubernetes.Interface
+	opts       Options
+	decoder    *admission.Decoder
+}
+
+func (a *clusterPodMonitoringAdmission) InjectDecoder(d *admission.Decoder) error {
+	a.decoder = d
+	return nil
+}
+
+func (a *clusterPodMonitoringAdmission) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation == admissionv1.Delete {
+		return admission.Allowed("")
+	}
+	var cm monitoringv1.ClusterPodMonitoring
+	if err := a.decoder.Decode(req, &cm); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	switch req.Operation {
+	case admissionv1.Create:
+		if err := cm.ValidateCreate(); err != nil {
+			return admission.Denied(err.Error())
+		}
+	case admissionv1.Update:
+		old := &monitoringv1.ClusterPodMonitoring{}
+		if err := a.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if err := cm.ValidateUpdate(old); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+	warnings := estimateCostWarnings(ctx, a.kubeClient, a.opts, metav1.NamespaceAll, cm.Spec.Selector, len(cm.Spec.Endpoints))
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// estimateCostWarnings estimates the number of active series the given
+// selector and endpoint count will produce based on the currently running
+// pods and returns an admission warning if it exceeds the configured
+// threshold. The estimate is best-effort: discovery errors never block
+// admission.
+func estimateCostWarnings(ctx context.Context, kubeClient kubernetes.Interface, opts Options, namespace string, selector metav1.LabelSelector, endpoints int) []string {
+	logger, _ := logr.FromContext(ctx)
+
+	if opts.SeriesWarnThreshold <= 0 {
+		return nil
+	}
+	sel, err := metav1.LabelSelectorAsSelector(&selector)
+	if err != nil {
+		// Invalid selectors are caught by regular validation.
+		return nil
+	}
+	pods, err := kubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		logger.Error(err, "listing pods for series estimate failed", "namespace", namespace)
+		return nil
+	}
+	var targets int
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			targets++
+		}
+	}
+	targets *= endpoints
+	estimate := targets * seriesPerTarget
+	if estimate <= opts.SeriesWarnThreshold {
+		return nil
+	}
+	return []string{fmt.Sprintf(
+		"selector currently matches %d scrape targets, estimated at roughly %d active series (warning threshold %d); consider narrowing the selector or filtering metrics",
+		targets, estimate, opts.SeriesWarnThreshold,
+	)}
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// ensureCRDs installs or updates the CustomResourceDefinitions found in the
+// configured manifest directory. Managing CRDs within the operator removes the
+// out-of-band installation step and prevents version skew between the operator
+// and its CRDs on upgrades.
+func (o *Operator) ensureCRDs(ctx context.Context) error {
+	if o.opts.CRDsDir == "" {
+		return nil
+	}
+	files, err := ioutil.ReadDir(o.opts.CRDsDir)
+	if err != nil {
+		return errors.Wrap(err, "read CRDs directory")
+	}
+	for _, fi := range files {
+		if fi.IsDir() || (!strings.HasSuffix(fi.Name(), ".yaml") && !strings.HasSuffix(fi.Name(), ".yml")) {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(o.opts.CRDsDir, fi.Name()))
+		if err != nil {
+			return errors.Wrapf(err, "read manifest %q", fi.Name())
+		}
+		// Manifest files may bundle multiple resources. Skip all documents that
+		// are not CustomResourceDefinitions.
+		for _, doc := range strings.Split(string(b), "\n---") {
+			var crd apiextensionsv1.CustomResourceDefinition
+			if err := yaml.Unmarshal([]byte(doc), &crd); err != nil {
+				continue
+			}
+			if crd.Kind != "CustomResourceDefinition" || !strings.HasSuffix(crd.Name, ".monitoring.googleapis.com") {
+				continue
+			}
+			if err := o.applyCRD(ctx, &crd); err != nil {
+				return errors.Wrapf(err, "apply CRD %q", crd.Name)
+			}
+			o.logger.Info("ensured CustomResourceDefinition", "name", crd.Name)
+		}
+	}
+	return nil
+}
+
+func (o *Operator) applyCRD(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) error {
+	var current apiextensionsv1.CustomResourceDefinition
+	err := o.client.Get(ctx, types.NamespacedName{Name: crd.Name}, &current)
+	if apierrors.IsNotFound(err) {
+		return o.client.Create(ctx, crd)
+	} else if err != nil {
+		return err
+	}
+	crd.ResourceVersion = current.ResourceVersion
+	return o.client.Update(ctx, crd)
+}
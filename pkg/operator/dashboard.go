@@ -0,0 +1,254 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// dashboardAPIEndpoint is the base URL of the Cloud Monitoring
+	// dashboards API.
+	dashboardAPIEndpoint = "https://monitoring.googleapis.com/v1"
+
+	// monitoringTokenScope is the OAuth scope requested for writing
+	// dashboards and alerting policies.
+	monitoringTokenScope = "https://www.googleapis.com/auth/monitoring"
+)
+
+// setupDashboardControllers registers the controller that provisions Cloud
+// Monitoring dashboards declared in Dashboard resources.
+func setupDashboardControllers(op *Operator) error {
+	err := ctrl.NewControllerManagedBy(op.manager).
+		Named("dashboard").
+		For(
+			&monitoringv1.Dashboard{},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Complete(newDashboardReconciler(op.manager.GetClient(), op.opts))
+	if err != nil {
+		return errors.Wrap(err, "create dashboard controller")
+	}
+	return nil
+}
+
+type dashboardReconciler struct {
+	client client.Client
+	opts   Options
+}
+
+func newDashboardReconciler(c client.Client, opts Options) *dashboardReconciler {
+	return &dashboardReconciler{
+		client: c,
+		opts:   opts,
+	}
+}
+
+func (r *dashboardReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	logger, _ := logr.FromContext(ctx)
+	logger.WithValues("dashboard", req.NamespacedName).Info("reconciling dashboard")
+
+	var d monitoringv1.Dashboard
+	if err := r.client.Get(ctx, req.NamespacedName, &d); apierrors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	} else if err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "get dashboard")
+	}
+	if isPaused(&d) {
+		logger.Info("reconciliation paused via annotation")
+		return reconcile.Result{}, nil
+	}
+	name, syncErr := r.syncDashboard(ctx, &d)
+
+	cond := metav1.Condition{
+		Type:   monitoringv1.ReconcileSuccess,
+		Status: metav1.ConditionTrue,
+		Reason: monitoringv1.ReasonReconciled,
+	}
+	if syncErr != nil {
+		cond = metav1.Condition{
+			Type:    monitoringv1.ReconcileSuccess,
+			Status:  metav1.ConditionFalse,
+			Reason:  monitoringv1.ReasonReconcileError,
+			Message: syncErr.Error(),
+		}
+	}
+	change, err := d.Status.SetMonitoringCondition(d.Generation, metav1.Now(), cond)
+	if err != nil {
+		logger.Error(err, "setting dashboard status state")
+	}
+	if name != "" && name != d.Status.DashboardName {
+		d.Status.DashboardName = name
+		change = true
+	}
+	if change {
+		if err := r.client.Status().Update(ctx, &d); err != nil {
+			return reconcile.Result{}, errors.Wrap(err, "update dashboard status")
+		}
+	}
+	return reconcile.Result{}, syncErr
+}
+
+// syncDashboard creates the dashboard in Cloud Monitoring or updates it in
+// place if it was created by a previous reconciliation. It returns the full
+// resource name of the dashboard.
+func (r *dashboardReconciler) syncDashboard(ctx context.Context, d *monitoringv1.Dashboard) (string, error) {
+	projectID := d.Spec.ProjectID
+	if projectID == "" {
+		projectID = r.opts.ProjectID
+	}
+	var contents map[string]interface{}
+	if err := json.Unmarshal([]byte(d.Spec.JSON), &contents); err != nil {
+		return "", errors.Wrap(err, "invalid dashboard JSON")
+	}
+	for _, f := range []string{"name", "displayName", "etag"} {
+		if _, ok := contents[f]; ok {
+			return "", errors.Errorf("dashboard JSON must not set the %q field", f)
+		}
+	}
+	contents["displayName"] = d.Spec.DisplayName
+
+	token, err := r.accessToken(ctx, d)
+	if err != nil {
+		return "", err
+	}
+	// Update in place if the dashboard was created before. A deleted
+	// dashboard is transparently recreated.
+	if d.Status.DashboardName != "" {
+		existing, err := monitoringAPI(ctx, http.MethodGet, dashboardAPIEndpoint, d.Status.DashboardName, token, nil)
+		if err == nil {
+			contents["name"] = d.Status.DashboardName
+			contents["etag"] = existing["etag"]
+			if _, err := monitoringAPI(ctx, http.MethodPatch, dashboardAPIEndpoint, d.Status.DashboardName, token, contents); err != nil {
+				return d.Status.DashboardName, errors.Wrap(err, "update dashboard")
+			}
+			return d.Status.DashboardName, nil
+		}
+		var apiErr *monitoringAPIError
+		if !errors.As(err, &apiErr) || apiErr.status != http.StatusNotFound {
+			return d.Status.DashboardName, errors.Wrap(err, "fetch dashboard")
+		}
+	}
+	created, err := monitoringAPI(ctx, http.MethodPost, dashboardAPIEndpoint, fmt.Sprintf("projects/%s/dashboards", projectID), token, contents)
+	if err != nil {
+		return "", errors.Wrap(err, "create dashboard")
+	}
+	name, ok := created["name"].(string)
+	if !ok {
+		return "", errors.New("created dashboard has no name")
+	}
+	return name, nil
+}
+
+// accessToken mints an OAuth access token with which the dashboard is
+// written, using the credentials configured in the resource or the operator's
+// own ones.
+func (r *dashboardReconciler) accessToken(ctx context.Context, d *monitoringv1.Dashboard) (string, error) {
+	var tokenSource oauth2.TokenSource
+
+	if d.Spec.Credentials != nil {
+		b, err := getSecretKeyBytes(ctx, r.client, d.Namespace, d.Spec.Credentials)
+		if err != nil {
+			return "", err
+		}
+		creds, err := google.CredentialsFromJSON(ctx, b, monitoringTokenScope)
+		if err != nil {
+			return "", errors.Wrap(err, "parse GCP service account credentials")
+		}
+		tokenSource = creds.TokenSource
+	} else {
+		var err error
+		tokenSource, err = google.DefaultTokenSource(ctx, monitoringTokenScope)
+		if err != nil {
+			return "", errors.Wrap(err, "find default GCP credentials")
+		}
+	}
+	token, err := tokenSource.Token()
+	if err != nil {
+		return "", errors.Wrap(err, "mint access token")
+	}
+	return token.AccessToken, nil
+}
+
+// monitoringAPIError is returned for Cloud Monitoring API requests that
+// failed with a non-2xx status code.
+type monitoringAPIError struct {
+	status int
+	body   string
+}
+
+func (e *monitoringAPIError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s", e.status, e.body)
+}
+
+// monitoringAPI issues a JSON request against the Cloud Monitoring API
+// endpoint and decodes the response object.
+func monitoringAPI(ctx context.Context, method, endpoint, path, token string, body map[string]interface{}) (map[string]interface{}, error) {
+	var reqBody *bytes.Buffer
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal request body")
+		}
+		reqBody = bytes.NewBuffer(b)
+	} else {
+		reqBody = &bytes.Buffer{}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", endpoint, path), reqBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "create request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, &monitoringAPIError{status: resp.StatusCode, body: strings.TrimSpace(string(b))}
+	}
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "decode response")
+	}
+	return result, nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/config"
+	prommodel "github.com/prometheus/common/model"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
+	discoverykube "github.com/prometheus/prometheus/discovery/kubernetes"
+	"github.com/prometheus/prometheus/model/relabel"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// NameDCGMExporter is the name of the managed DCGM exporter DaemonSet.
+	NameDCGMExporter = "dcgm-exporter"
+	// Pinned image the managed DCGM exporter runs at. Upgraded deliberately
+	// with operator releases rather than tracking upstream.
+	imageDCGMExporter = "nvcr.io/nvidia/k8s/dcgm-exporter:2.4.6-2.6.10-ubuntu20.04"
+
+	dcgmExporterPort     = 9400
+	dcgmExporterPortName = "metrics"
+
+	// Node label GKE sets on nodes with attached accelerators, used to
+	// restrict the DaemonSet to GPU nodes.
+	gkeAcceleratorLabel = "cloud.google.com/gke-accelerator"
+)
+
+// defaultDCGMMetricAllowlist is the curated set of DCGM metrics collected when
+// the DCGMExporterSpec does not specify its own allowlist. It covers the
+// utilization, memory, temperature, power, and error metrics GPU dashboards
+// and alerts typically build on. DCGM exposes a metric per GPU, so widening
+// the list on large accelerator pools directly increases ingestion costs.
+var defaultDCGMMetricAllowlist = []string{
+	"DCGM_FI_DEV_GPU_UTIL",
+	"DCGM_FI_DEV_MEM_COPY_UTIL",
+	"DCGM_FI_DEV_FB_USED",
+	"DCGM_FI_DEV_FB_FREE",
+	"DCGM_FI_DEV_GPU_TEMP",
+	"DCGM_FI_DEV_MEMORY_TEMP",
+	"DCGM_FI_DEV_POWER_USAGE",
+	"DCGM_FI_DEV_SM_CLOCK",
+	"DCGM_FI_DEV_MEM_CLOCK",
+	"DCGM_FI_DEV_XID_ERRORS",
+}
+
+// ensureDCGMExporter creates, updates, or removes the managed DCGM exporter
+// DaemonSet according to the OperatorConfig.
+func (r *collectionReconciler) ensureDCGMExporter(ctx context.Context, spec *monitoringv1.CollectionSpec) error {
+	if spec.DCGMExporter == nil {
+		// Clean up a previously managed instance if the toggle was removed.
+		ds := &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: r.opts.OperatorNamespace,
+				Name:      NameDCGMExporter,
+			},
+		}
+		if err := r.client.Delete(ctx, ds); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrap(err, "delete dcgm-exporter daemon set")
+		}
+		return nil
+	}
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.opts.OperatorNamespace,
+			Name:      NameDCGMExporter,
+			Labels: map[string]string{
+				LabelAppName: NameDCGMExporter,
+			},
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					LabelAppName: NameDCGMExporter,
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						LabelAppName: NameDCGMExporter,
+					},
+				},
+				Spec: corev1.PodSpec{
+					// Only run on nodes with attached accelerators and
+					// tolerate the taint GPU nodes typically carry.
+					Affinity: &corev1.Affinity{
+						NodeAffinity: &corev1.NodeAffinity{
+							RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+								NodeSelectorTerms: []corev1.NodeSelectorTerm{
+									{
+										MatchExpressions: []corev1.NodeSelectorRequirement{
+											{Key: gkeAcceleratorLabel, Operator: corev1.NodeSelectorOpExists},
+										},
+									},
+								},
+							},
+						},
+					},
+					Tolerations: []corev1.Toleration{
+						{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  NameDCGMExporter,
+							Image: imageDCGMExporter,
+							Env: []corev1.EnvVar{
+								{Name: "DCGM_EXPORTER_LISTEN", Value: fmt.Sprintf(":%d", dcgmExporterPort)},
+							},
+							Ports: []corev1.ContainerPort{
+								{Name: dcgmExporterPortName, ContainerPort: dcgmExporterPort},
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("20m"),
+									corev1.ResourceMemory: resource.MustParse("64Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("256Mi"),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := r.client.Update(ctx, ds); apierrors.IsNotFound(err) {
+		if err := r.client.Create(ctx, ds); err != nil {
+			return errors.Wrap(err, "create dcgm-exporter daemon set")
+		}
+	} else if err != nil {
+		return errors.Wrap(err, "update dcgm-exporter daemon set")
+	}
+	return nil
+}
+
+// makeDCGMExporterScrapeConfigs generates the scrape job for the managed DCGM
+// exporter pods. The pods are discovered like regular workload targets, so
+// each collector only scrapes the DCGM exporter on its own node, and the
+// job is a no-op on nodes without accelerators.
+func makeDCGMExporterScrapeConfigs(cfg *monitoringv1.DCGMExporterSpec, operatorNamespace string) ([]*promconfig.ScrapeConfig, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	interval, err := prommodel.ParseDuration(cfg.Interval)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid scrape interval")
+	}
+	allowlist := cfg.MetricAllowlist
+	if len(allowlist) == 0 {
+		allowlist = defaultDCGMMetricAllowlist
+	}
+	discoveryCfgs := discovery.Configs{
+		&discoverykube.SDConfig{
+			HTTPClientConfig:   config.DefaultHTTPClientConfig,
+			Role:               discoverykube.RolePod,
+			NamespaceDiscovery: discoverykube.NamespaceDiscovery{Names: []string{operatorNamespace}},
+			// Drop all potential targets not on the same node as the collector.
+			Selectors: []discoverykube.SelectorConfig{
+				{
+					Role:  discoverykube.RolePod,
+					Field: fmt.Sprintf("spec.nodeName=$(%s)", monitoringv1.EnvVarNodeName),
+				},
+			},
+		},
+	}
+	relabelCfgs := []*relabel.Config{
+		// Select by the sanitized form of the app.kubernetes.io/name label.
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_label_app_kubernetes_io_name"},
+			Regex:        relabel.MustNewRegexp(NameDCGMExporter),
+		},
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_container_port_name"},
+			Regex:        relabel.MustNewRegexp(dcgmExporterPortName),
+		},
+		{
+			Action:      relabel.Replace,
+			Replacement: NameDCGMExporter,
+			TargetLabel: "job",
+		},
+		// Use the node name as instance like the node-exporter job does, keeping
+		// GPU metrics joinable with other node-level metrics.
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_node_name"},
+			TargetLabel:  "instance",
+			Replacement:  "$1:" + dcgmExporterPortName,
+		},
+	}
+	return []*promconfig.ScrapeConfig{
+		{
+			JobName:                 "dcgm-exporter/metrics",
+			ServiceDiscoveryConfigs: discoveryCfgs,
+			ScrapeInterval:          interval,
+			MetricsPath:             "/metrics",
+			RelabelConfigs:          relabelCfgs,
+			MetricRelabelConfigs: []*relabel.Config{
+				{
+					Action:       relabel.Keep,
+					SourceLabels: prommodel.LabelNames{"__name__"},
+					Regex:        relabel.MustNewRegexp(strings.Join(allowlist, "|")),
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kyaml "sigs.k8s.io/yaml"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator"
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// webhookAlert is a single alert of an Alertmanager webhook notification.
+type webhookAlert struct {
+	Status string            `json:"status"`
+	Labels map[string]string `json:"labels"`
+}
+
+// webhookMessage mirrors the relevant fields of the payload Alertmanager
+// sends to webhook receivers.
+type webhookMessage struct {
+	Alerts []webhookAlert `json:"alerts"`
+}
+
+// webhookReceiver is a fake webhook notification endpoint recording all
+// alerts it was notified about.
+type webhookReceiver struct {
+	mtx    sync.Mutex
+	alerts []webhookAlert
+}
+
+func (w *webhookReceiver) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	var msg webhookMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.mtx.Lock()
+	w.alerts = append(w.alerts, msg.Alerts...)
+	w.mtx.Unlock()
+}
+
+// firing reports whether a firing notification for the given alert name
+// was received.
+func (w *webhookReceiver) firing(alertname string) bool {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for _, a := range w.alerts {
+		if a.Status == "firing" && a.Labels["alertname"] == alertname {
+			return true
+		}
+	}
+	return false
+}
+
+// TestAlertNotification validates the full alerting path: an alerting rule
+// deployed through the Rules CRD must result in a notification delivered by
+// the managed Alertmanager to the configured webhook receiver.
+func TestAlertNotification(t *testing.T) {
+	if alertWebhookAddr == "" {
+		t.Skip("Not running alert notification test, provide --alert-webhook-addr to enable")
+	}
+	tctx := newTestContext(t)
+
+	lis, err := net.Listen("tcp", alertWebhookAddr)
+	if err != nil {
+		t.Fatalf("Listening for alert webhook receiver failed: %s", err)
+	}
+	receiver := &webhookReceiver{}
+	server := &http.Server{Handler: receiver}
+	go server.Serve(lis)
+	t.Cleanup(func() { server.Close() })
+
+	// Route all alerts to the test's webhook receiver. Short group and repeat
+	// timings keep the test fast and resilient against dropped notifications.
+	alertmanagerConfig := fmt.Sprintf(`
+receivers:
+  - name: "webhook"
+    webhook_configs:
+      - url: "http://%s/"
+route:
+  receiver: "webhook"
+  group_wait: 1s
+  group_interval: 5s
+  repeat_interval: 1m
+`, alertWebhookAddr)
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: operator.AlertmanagerPublicSecretName},
+		Data: map[string][]byte{
+			operator.AlertmanagerPublicSecretKey: []byte(alertmanagerConfig),
+		},
+	}
+
+	t.Run("deployed", tctx.subtest(testAlertmanagerDeployed(nil)))
+	t.Run("config set", tctx.subtest(testAlertmanagerConfig(secret, operator.AlertmanagerPublicSecretKey)))
+	t.Run("rule created", tctx.subtest(testCreateAlertingRule))
+	t.Run("notification delivered", tctx.subtest(func(ctx context.Context, t *testContext) {
+		testAlertNotificationDelivered(ctx, t, receiver)
+	}))
+}
+
+// testCreateAlertingRule deploys an always-firing alerting rule through the
+// Rules CRD.
+func testCreateAlertingRule(ctx context.Context, t *testContext) {
+	content := `
+apiVersion: monitoring.googleapis.com/v1alpha1
+kind: Rules
+metadata:
+  name: always-firing
+spec:
+  groups:
+  - name: group-1
+    interval: 5s
+    rules:
+    - alert: AlwaysFiring
+      expr: vector(1)
+      annotations:
+        description: "always firing test alert"
+      labels:
+        flavor: test
+`
+	var rules monitoringv1.Rules
+	if err := kyaml.Unmarshal([]byte(content), &rules); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := t.operatorClient.MonitoringV1().Rules(t.namespace).Create(ctx, &rules, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create alerting rule: %s", err)
+	}
+}
+
+// testAlertNotificationDelivered waits for the webhook receiver to be
+// notified about the firing test alert. Getting there requires the
+// rule-evaluator to load the generated rule file, evaluate the alerting rule
+// against its query backend, and send the alert to the managed Alertmanager,
+// which in turn must dispatch it to the configured receiver.
+func testAlertNotificationDelivered(ctx context.Context, t *testContext, receiver *webhookReceiver) {
+	err := wait.Poll(3*time.Second, 5*time.Minute, func() (bool, error) {
+		if !receiver.firing("AlwaysFiring") {
+			t.Log("No firing notification yet, retrying...")
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("Waiting for alert notification failed: %s", err)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	arv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator"
+)
+
+// TestResilience validates that the managed components recover from
+// disruptions without configuration drift. The guarantees codified here are
+// that killed collector pods resume scraping with an identical configuration,
+// that an operator restart reconciles to the exact state left behind by its
+// predecessor, and that webhook certificates can be rotated while keeping the
+// webhook configurations functional.
+func TestResilience(t *testing.T) {
+	tctx := newTestContext(t)
+
+	t.Run("deployed", tctx.subtest(testCollectorDeployed))
+	t.Run("self-podmonitoring", tctx.subtest(testCollectorSelfPodMonitoring))
+	t.Run("collector pods killed", tctx.subtest(testCollectorPodsKilled))
+	t.Run("operator restarted", tctx.subtest(testOperatorRestart))
+}
+
+// testCollectorPodsKilled deletes all collector pods and verifies that the
+// rescheduled collectors scrape with the previously generated configuration.
+func testCollectorPodsKilled(ctx context.Context, t *testContext) {
+	cfgBefore, err := t.kubeClient.CoreV1().ConfigMaps(t.namespace).Get(ctx, operator.NameCollector, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get collector config: %s", err)
+	}
+
+	err = t.kubeClient.CoreV1().Pods(t.namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", operator.LabelAppName, operator.NameCollector),
+	})
+	if err != nil {
+		t.Fatalf("delete collector pods: %s", err)
+	}
+	t.Log("Waiting for collector pods to be rescheduled")
+
+	err = wait.Poll(3*time.Second, 3*time.Minute, func() (bool, error) {
+		ds, err := t.kubeClient.AppsV1().DaemonSets(t.namespace).Get(ctx, operator.NameCollector, metav1.GetOptions{})
+		if err != nil {
+			return false, errors.Wrap(err, "get collector DaemonSet")
+		}
+		if ds.Status.DesiredNumberScheduled == 0 {
+			return false, nil
+		}
+		if !skipGCM && ds.Status.NumberReady != ds.Status.DesiredNumberScheduled {
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("waiting for collector pods failed: %s", err)
+	}
+
+	// The disruption must not have caused the operator to regenerate a
+	// different configuration.
+	cfgAfter, err := t.kubeClient.CoreV1().ConfigMaps(t.namespace).Get(ctx, operator.NameCollector, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get collector config: %s", err)
+	}
+	if diff := cmp.Diff(cfgBefore.Data, cfgAfter.Data); diff != "" {
+		t.Fatalf("collector config drifted across pod restarts (-before, +after): %s", diff)
+	}
+
+	if !skipGCM {
+		t.Log("Waiting for up metrics of rescheduled collector targets")
+		validateCollectorUpMetrics(ctx, t, "collector-podmon")
+	}
+}
+
+// testOperatorRestart restarts the operator and verifies that the new
+// instance settles on the state left behind by its predecessor: the generated
+// configuration must not change, status conditions must not accumulate, and
+// the webhook configurations must receive a freshly rotated serving
+// certificate.
+func testOperatorRestart(ctx context.Context, t *testContext) {
+	// Create a webhook configuration the operator injects its CA bundle into.
+	// Restarting the operator rotates the self-signed certificates, which must
+	// be reflected in the configuration for the webhooks to remain functional.
+	var (
+		whConfigName = fmt.Sprintf("gmp-operator.%s.monitoring.googleapis.com", t.namespace)
+		policy       = arv1.Ignore // Prevent collisions with other test or real usage
+		sideEffects  = arv1.SideEffectClassNone
+		url          = "https://0.1.2.3/"
+	)
+	vwc := &arv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            whConfigName,
+			OwnerReferences: t.ownerReferences,
+		},
+		Webhooks: []arv1.ValidatingWebhook{
+			{
+				Name:                    "wh1.monitoring.googleapis.com",
+				ClientConfig:            arv1.WebhookClientConfig{URL: &url},
+				FailurePolicy:           &policy,
+				SideEffects:             &sideEffects,
+				AdmissionReviewVersions: []string{"v1"},
+			},
+		},
+	}
+	if _, err := t.kubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Create(ctx, vwc, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var caBundle []byte
+	err := wait.Poll(3*time.Second, 2*time.Minute, func() (bool, error) {
+		vwc, err := t.kubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, whConfigName, metav1.GetOptions{})
+		if err != nil {
+			return false, errors.Wrap(err, "get validatingwebhook configuration")
+		}
+		if len(vwc.Webhooks) != 1 || len(vwc.Webhooks[0].ClientConfig.CABundle) == 0 {
+			return false, nil
+		}
+		caBundle = vwc.Webhooks[0].ClientConfig.CABundle
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("waiting for CA bundle injection failed: %s", err)
+	}
+
+	cfgBefore, err := t.kubeClient.CoreV1().ConfigMaps(t.namespace).Get(ctx, operator.NameCollector, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get collector config: %s", err)
+	}
+
+	if err := t.restartOperator(ctx); err != nil {
+		t.Fatalf("restart operator: %s", err)
+	}
+	t.Log("Waiting for restarted operator to reconcile")
+
+	// The restarted operator generates new self-signed certificates and must
+	// update the CA bundle accordingly.
+	err = wait.Poll(3*time.Second, 3*time.Minute, func() (bool, error) {
+		vwc, err := t.kubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, whConfigName, metav1.GetOptions{})
+		if err != nil {
+			return false, errors.Wrap(err, "get validatingwebhook configuration")
+		}
+		if len(vwc.Webhooks) != 1 || len(vwc.Webhooks[0].ClientConfig.CABundle) == 0 {
+			return false, nil
+		}
+		return !bytes.Equal(caBundle, vwc.Webhooks[0].ClientConfig.CABundle), nil
+	})
+	if err != nil {
+		t.Fatalf("waiting for rotated CA bundle failed: %s", err)
+	}
+
+	// Reconciliation by the new instance must converge on the identical
+	// configuration and must not append duplicate status conditions.
+	err = wait.Poll(3*time.Second, time.Minute, func() (bool, error) {
+		cfgAfter, err := t.kubeClient.CoreV1().ConfigMaps(t.namespace).Get(ctx, operator.NameCollector, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, errors.Wrap(err, "get collector config")
+		}
+		if diff := cmp.Diff(cfgBefore.Data, cfgAfter.Data); diff != "" {
+			return false, errors.Errorf("collector config drifted across operator restart (-before, +after): %s", diff)
+		}
+		pm, err := t.operatorClient.MonitoringV1().PodMonitorings(t.namespace).Get(ctx, "collector-podmon", metav1.GetOptions{})
+		if err != nil {
+			return false, errors.Wrap(err, "get PodMonitoring")
+		}
+		if size := len(pm.Status.Conditions); size > 2 {
+			return false, errors.Errorf("status conditions should be of length 2, but got: %d", size)
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("waiting for consistent state after operator restart failed: %s", err)
+	}
+}
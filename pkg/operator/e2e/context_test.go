@@ -62,9 +62,28 @@ type testContext struct {
 
 	kubeClient     kubernetes.Interface
 	operatorClient clientset.Interface
+
+	// Stops the in-process operator instance. Nil when validating a deployed
+	// operator.
+	stopOperator context.CancelFunc
 }
 
 func newTestContext(t *testing.T) *testContext {
+	tctx := newUnstartedTestContext(t)
+
+	if !deployedOperator {
+		if err := tctx.startOperator(); err != nil {
+			t.Fatalf("starting operator: %s", err)
+		}
+	}
+	return tctx
+}
+
+// newUnstartedTestContext sets up the namespaces and base resources of a test
+// context but does not start the in-process operator. It allows tests to
+// control the operator lifecycle themselves, e.g. to validate upgrades from a
+// previous operator version.
+func newUnstartedTestContext(t *testing.T) *testContext {
 	kubeClient, err := kubernetes.NewForConfig(kubeconfig)
 	if err != nil {
 		t.Fatalf("Build Kubernetes clientset: %s", err)
@@ -74,7 +93,19 @@ func newTestContext(t *testing.T) *testContext {
 		t.Fatalf("Build operator clientset: %s", err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// When validating an operator that is already deployed in the cluster, run
+	// against the static namespaces it watches. Its base resources are part of
+	// the deployment manifests, so nothing is created or torn down here.
+	if deployedOperator {
+		return &testContext{
+			T:              t,
+			namespace:      operator.DefaultOperatorNamespace,
+			pubNamespace:   operator.DefaultPublicNamespace,
+			kubeClient:     kubeClient,
+			operatorClient: operatorClient,
+		}
+	}
+
 	// Create a namespace per test and run. This is to ensure that repeated runs of
 	// tests don't falsify results. Either by old test resources not being cleaned up
 	// (less likely) or metrics observed in GCP being from a previous run (more likely).
@@ -90,14 +121,18 @@ func newTestContext(t *testing.T) *testContext {
 	}
 	// The testing package runs cleanup on a best-effort basis. Thus we have a fallback
 	// cleanup of namespaces in TestMain.
-	t.Cleanup(cancel)
 	t.Cleanup(func() { tctx.cleanupNamespaces() })
 
 	tctx.ownerReferences, err = tctx.createBaseResources(context.TODO())
 	if err != nil {
 		t.Fatalf("create test namespace: %s", err)
 	}
+	return tctx
+}
 
+// startOperator runs a new in-process operator instance against the context's
+// namespaces until the test ends or the operator is restarted.
+func (tctx *testContext) startOperator() error {
 	op, err := operator.New(globalLogger, kubeconfig, prometheus.NewRegistry(), operator.Options{
 		ProjectID:         projectID,
 		Cluster:           cluster,
@@ -107,17 +142,37 @@ func newTestContext(t *testing.T) *testContext {
 		ListenAddr:        ":10250",
 	})
 	if err != nil {
-		t.Fatalf("instantiating operator: %s", err)
+		return errors.Wrap(err, "instantiating operator")
 	}
+	ctx, cancel := context.WithCancel(context.Background())
+	tctx.stopOperator = cancel
+	tctx.Cleanup(cancel)
 
 	go func() {
 		if err := op.Run(ctx); err != nil {
 			// Since we aren't in the main test goroutine we cannot fail with Fatal here.
-			t.Errorf("running operator: %s", err)
+			tctx.Errorf("running operator: %s", err)
 		}
 	}()
+	return nil
+}
 
-	return tctx
+// restartOperator stops the current operator instance and starts a new one,
+// mimicking a crash or rolling update of the operator deployment. When
+// validating a deployed operator its pods are deleted instead, relying on the
+// Deployment controller for the restart.
+func (tctx *testContext) restartOperator(ctx context.Context) error {
+	if deployedOperator {
+		err := tctx.kubeClient.CoreV1().Pods(tctx.namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", operator.LabelAppName, operator.NameOperator),
+		})
+		return errors.Wrap(err, "delete operator pods")
+	}
+	tctx.stopOperator()
+	// Give the stopped instance a moment to release its listening port and
+	// the leader election lease before the new one takes over.
+	time.Sleep(5 * time.Second)
+	return tctx.startOperator()
 }
 
 // createBaseResources creates resources the operator requires to exist already.
@@ -228,6 +283,7 @@ func (tctx *testContext) createBaseResources(ctx context.Context) ([]metav1.Owne
 	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(collectorBytes, nil, nil)
 	collector := obj.(*appsv1.DaemonSet)
 	collector.Namespace = tctx.namespace
+	injectFakeGCMFlags(&collector.Spec.Template.Spec, "prometheus")
 
 	_, err = tctx.kubeClient.AppsV1().DaemonSets(tctx.namespace).Create(ctx, collector, metav1.CreateOptions{})
 	if err != nil {
@@ -241,6 +297,7 @@ func (tctx *testContext) createBaseResources(ctx context.Context) ([]metav1.Owne
 	obj, _, err = scheme.Codecs.UniversalDeserializer().Decode(evaluatorBytes, nil, nil)
 	evaluator := obj.(*appsv1.Deployment)
 	evaluator.Namespace = tctx.namespace
+	injectFakeGCMFlags(&evaluator.Spec.Template.Spec, "evaluator")
 
 	_, err = tctx.kubeClient.AppsV1().Deployments(tctx.namespace).Create(ctx, evaluator, metav1.CreateOptions{})
 	if err != nil {
@@ -281,6 +338,24 @@ func (tctx *testContext) createBaseResources(ctx context.Context) ([]metav1.Owne
 	return ors, nil
 }
 
+// injectFakeGCMFlags points the exporting container of the given pod spec at
+// the fake GCM server run by the test suite. It is a no-op if the fake is not
+// enabled via the --fake-gcm-addr flag.
+func injectFakeGCMFlags(spec *corev1.PodSpec, container string) {
+	if fakeGCMAddr == "" {
+		return
+	}
+	for i, c := range spec.Containers {
+		if c.Name != container {
+			continue
+		}
+		spec.Containers[i].Args = append(c.Args,
+			fmt.Sprintf("--export.endpoint=%s", fakeGCMAddr),
+			"--export.debug.disable-auth",
+		)
+	}
+}
+
 func (tctx *testContext) cleanupNamespaces() {
 	err := tctx.kubeClient.CoreV1().Namespaces().Delete(context.TODO(), tctx.namespace, metav1.DeleteOptions{})
 	if err != nil {
@@ -22,6 +22,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"strings"
@@ -33,9 +34,12 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 	gcmpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	arv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -50,6 +54,7 @@ import (
 	// Blank import required to register GCP auth handlers to talk to GKE clusters.
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export/fake"
 	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator"
 	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
 )
@@ -60,7 +65,13 @@ var (
 	cluster           string
 	location          string
 	skipGCM           bool
+	fakeGCMAddr       string
+	deployedOperator  bool
 	gcpServiceAccount string
+	loadGenImage      string
+	loadGenTargets    int
+	alertWebhookAddr  string
+	upgradeFromImage  string
 )
 
 func TestMain(m *testing.M) {
@@ -68,7 +79,13 @@ func TestMain(m *testing.M) {
 	flag.StringVar(&cluster, "cluster", "", "The name of the Kubernetes cluster that's tested against.")
 	flag.StringVar(&location, "location", "", "The location of the Kubernetes cluster that's tested against.")
 	flag.BoolVar(&skipGCM, "skip-gcm", false, "Skip validating GCM ingested points.")
+	flag.StringVar(&fakeGCMAddr, "fake-gcm-addr", "", "Address to serve an in-process fake of the GCM API on. It must be a local interface that workloads in the cluster can reach. Enables hermetic runs without a GCP project.")
+	flag.BoolVar(&deployedOperator, "deployed-operator", false, "Don't run the operator in-process but validate an operator already deployed in the cluster, including its RBAC and webhook setup. Tests then run against the operator's static namespaces and must not run concurrently with each other.")
 	flag.StringVar(&gcpServiceAccount, "gcp-service-account", "", "Path to GCP service account file for usage by deployed containers.")
+	flag.StringVar(&loadGenImage, "load-gen-image", "", "Image of the synthetic load generator (cmd/loadgen). Enables the load generation test.")
+	flag.IntVar(&loadGenTargets, "load-gen-targets", 2, "Number of load generator replicas to deploy, each serving as one scrape target.")
+	flag.StringVar(&alertWebhookAddr, "alert-webhook-addr", "", "Address to serve a fake alert webhook receiver on. It must be a local interface that the in-cluster Alertmanager can reach. Enables the alert notification test.")
+	flag.StringVar(&upgradeFromImage, "upgrade-from-image", "", "Image of the previous released operator version. Enables the upgrade test.")
 
 	flag.Parse()
 
@@ -79,6 +96,20 @@ func TestMain(m *testing.M) {
 		os.Exit(1)
 	}
 
+	if fakeGCMAddr != "" {
+		lis, err := net.Listen("tcp", fakeGCMAddr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Listening for fake GCM server failed:", err)
+			os.Exit(1)
+		}
+		go func() {
+			if err := fake.NewMetricServer().Serve(context.Background(), lis); err != nil {
+				fmt.Fprintln(os.Stderr, "Fake GCM server failed:", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	go func() {
 		os.Exit(m.Run())
 	}()
@@ -98,6 +129,19 @@ func TestMain(m *testing.M) {
 	}
 }
 
+// newMetricClient returns a client for the GCM API or, if --fake-gcm-addr is
+// set, for the in-process fake serving hermetic test runs.
+func newMetricClient(ctx context.Context) (*gcm.MetricClient, error) {
+	if fakeGCMAddr != "" {
+		return gcm.NewMetricClient(ctx,
+			option.WithEndpoint(fakeGCMAddr),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithInsecure()),
+		)
+	}
+	return gcm.NewMetricClient(ctx)
+}
+
 func TestCollector(t *testing.T) {
 	tctx := newTestContext(t)
 
@@ -403,8 +447,8 @@ func testRuleEvaluatorDeployment(ctx context.Context, t *testContext) {
 		// When not using GCM, we check the available replicas rather than ready ones
 		// as the rule-evaluator's readyness probe does check for connectivity to GCM.
 		if skipGCM {
-			// TODO(pintohutch): stub CTS API during e2e tests to remove
-			// this conditional.
+			// Runs with --fake-gcm-addr don't hit this conditional as the
+			// readiness check succeeds against the fake backend.
 			if *deploy.Spec.Replicas != deploy.Status.UpdatedReplicas {
 				return false, nil
 			}
@@ -607,16 +651,15 @@ func testCollectorDeployed(ctx context.Context, t *testContext) {
 			return false, nil
 		}
 
-		// TODO(pintohutch): run all tests without skipGCM by providing boilerplate
-		// credentials for use in local testing and CI.
-		//
-		// This is necessary for any e2e tests that don't have access to GCP
+		// This conditional remains for e2e tests that don't have access to GCP
 		// credentials. We were getting away with this by running on networks
 		// with access to the GCE metadata server IP to supply them:
 		// https://github.com/googleapis/google-cloud-go/blob/56d81f123b5b4491aaf294042340c35ffcb224a7/compute/metadata/metadata.go#L39
 		// However, running without this access (e.g. on Github Actions) causes
 		// a failure from:
 		// https://cs.opensource.google/go/x/oauth2/+/master:google/default.go;l=155;drc=9780585627b5122c8cc9c6a378ac9861507e7551
+		// Hermetic environments can run all tests against the in-process fake
+		// GCM backend via --fake-gcm-addr instead.
 		if !skipGCM {
 			if ds.Status.NumberReady != ds.Status.DesiredNumberScheduled {
 				return false, nil
@@ -702,16 +745,17 @@ func testCollectorSelfPodMonitoring(ctx context.Context, t *testContext) {
 		// This is not a perfect check as it's possible the get call returns before the operator
 		// would sync again, however it can serve as a valuable guardrail in case sporadic test
 		// failures start happening due to update cycles.
-		if size := len(pm.Status.Conditions); size == 1 {
+		if size := len(pm.Status.Conditions); size == 2 {
 			if resVer == "" {
 				resVer = pm.ResourceVersion
 				return false, nil
 			}
+			// Conditions are sorted by type, ConfigurationCreateSuccess comes first.
 			success := pm.Status.Conditions[0].Type == monitoringv1.ConfigurationCreateSuccess
 			steadyVer := resVer == pm.ResourceVersion
 			return success && steadyVer, nil
-		} else if size > 1 {
-			return false, errors.Errorf("status conditions should be of length 1, but got: %d", size)
+		} else if size > 2 {
+			return false, errors.Errorf("status conditions should be of length 2, but got: %d", size)
 		}
 		return false, nil
 	})
@@ -764,16 +808,17 @@ func testCollectorSelfClusterPodMonitoring(ctx context.Context, t *testContext)
 		// This is not a perfect check as it's possible the get call returns before the operator
 		// would sync again, however it can serve as a valuable guardrail in case sporadic test
 		// failures start happening due to update cycles.
-		if size := len(pm.Status.Conditions); size == 1 {
+		if size := len(pm.Status.Conditions); size == 2 {
 			if resVer == "" {
 				resVer = pm.ResourceVersion
 				return false, nil
 			}
+			// Conditions are sorted by type, ConfigurationCreateSuccess comes first.
 			success := pm.Status.Conditions[0].Type == monitoringv1.ConfigurationCreateSuccess
 			steadyVer := resVer == pm.ResourceVersion
 			return success && steadyVer, nil
-		} else if size > 1 {
-			return false, errors.Errorf("status conditions should be of length 1, but got: %d", size)
+		} else if size > 2 {
+			return false, errors.Errorf("status conditions should be of length 2, but got: %d", size)
 		}
 		return false, nil
 	})
@@ -806,7 +851,7 @@ func validateCollectorUpMetrics(ctx context.Context, t *testContext, job string)
 	}
 
 	// Wait for metric data to show up in Cloud Monitoring.
-	metricClient, err := gcm.NewMetricClient(ctx)
+	metricClient, err := newMetricClient(ctx)
 	if err != nil {
 		t.Fatalf("Create GCM metric client: %s", err)
 	}
@@ -898,7 +943,7 @@ func testCollectorScrapeKubelet(ctx context.Context, t *testContext) {
 	}
 
 	// Wait for metric data to show up in Cloud Monitoring.
-	metricClient, err := gcm.NewMetricClient(ctx)
+	metricClient, err := newMetricClient(ctx)
 	if err != nil {
 		t.Fatalf("Create GCM metric client: %s", err)
 	}
@@ -967,6 +1012,153 @@ func testCollectorScrapeKubelet(ctx context.Context, t *testContext) {
 	}
 }
 
+func TestLoadGeneration(t *testing.T) {
+	if loadGenImage == "" {
+		t.Skip("Not running load generation test, provide --load-gen-image to enable")
+	}
+	tctx := newTestContext(t)
+
+	t.Run("deployed", tctx.subtest(testLoadGenDeployed))
+	if !skipGCM {
+		t.Run("scraped", tctx.subtest(testLoadGenScraped))
+	}
+}
+
+// testLoadGenDeployed deploys the synthetic load generator along with a
+// PodMonitoring selecting it and waits for all replicas to become ready.
+func testLoadGenDeployed(ctx context.Context, t *testContext) {
+	replicas := int32(loadGenTargets)
+
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "loadgen",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "loadgen"},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"app": "loadgen"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "loadgen",
+							Image: loadGenImage,
+							Args: []string{
+								"--metric-families=20",
+								"--series-per-family=50",
+								"--churn-interval=1m",
+							},
+							Ports: []corev1.ContainerPort{
+								{Name: "metrics", ContainerPort: 8080},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	_, err := t.kubeClient.AppsV1().Deployments(t.namespace).Create(ctx, deploy, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("create load generator Deployment: %s", err)
+	}
+
+	podmon := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "loadgen",
+		},
+		Spec: monitoringv1.PodMonitoringSpec{
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "loadgen"},
+			},
+			Endpoints: []monitoringv1.ScrapeEndpoint{
+				{Port: intstr.FromString("metrics"), Interval: "5s"},
+			},
+		},
+	}
+	_, err = t.operatorClient.MonitoringV1().PodMonitorings(t.namespace).Create(ctx, podmon, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("create load generator PodMonitoring: %s", err)
+	}
+	t.Log("Waiting for load generator replicas to become ready")
+
+	err = wait.Poll(3*time.Second, 3*time.Minute, func() (bool, error) {
+		deploy, err := t.kubeClient.AppsV1().Deployments(t.namespace).Get(ctx, "loadgen", metav1.GetOptions{})
+		if err != nil {
+			return false, errors.Errorf("getting Deployment failed: %s", err)
+		}
+		return deploy.Status.ReadyReplicas == replicas, nil
+	})
+	if err != nil {
+		t.Fatalf("unable to validate load generator deployment: %s", err)
+	}
+}
+
+// testLoadGenScraped waits for synthetic series of every load generator
+// target to be queryable from Cloud Monitoring. This exercises the collection
+// and export path under the configured series load.
+func testLoadGenScraped(ctx context.Context, t *testContext) {
+	metricClient, err := newMetricClient(ctx)
+	if err != nil {
+		t.Fatalf("Create GCM metric client: %s", err)
+	}
+	defer metricClient.Close()
+
+	pods, err := t.kubeClient.CoreV1().Pods(t.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=loadgen",
+	})
+	if err != nil {
+		t.Fatalf("List load generator pods: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	// A counter series showing up for each pod implies that the full set of
+	// targets is scraped and exported successfully.
+	for _, pod := range pods.Items {
+		t.Logf("Poll synthetic series for pod %q", pod.Name)
+
+		err = wait.PollImmediateUntil(3*time.Second, func() (bool, error) {
+			now := time.Now()
+
+			iter := metricClient.ListTimeSeries(ctx, &gcmpb.ListTimeSeriesRequest{
+				Name: fmt.Sprintf("projects/%s", projectID),
+				Filter: fmt.Sprintf(`
+				resource.type = "prometheus_target" AND
+				resource.labels.project_id = "%s" AND
+				resource.label.location = "%s" AND
+				resource.labels.cluster = "%s" AND
+				resource.labels.namespace = "%s" AND
+				resource.labels.job = "loadgen" AND
+				resource.labels.instance = "%s:metrics" AND
+				metric.type = "prometheus.googleapis.com/loadgen_counter_000_total/counter"
+				`,
+					projectID, location, cluster, t.namespace, pod.Name,
+				),
+				Interval: &gcmpb.TimeInterval{
+					EndTime:   timestamppb.New(now),
+					StartTime: timestamppb.New(now.Add(-10 * time.Second)),
+				},
+			})
+			_, err := iter.Next()
+			if err == iterator.Done {
+				t.Logf("No data, retrying...")
+				return false, nil
+			} else if err != nil {
+				return false, errors.Wrap(err, "querying metrics failed")
+			}
+			return true, nil
+		}, ctx.Done())
+		if err != nil {
+			t.Fatalf("Waiting for load generator metrics to appear in Cloud Monitoring failed: %s", err)
+		}
+	}
+}
+
 func testRulesGeneration(ctx context.Context, t *testContext) {
 	replace := strings.NewReplacer(
 		"{project_id}", projectID,
@@ -1231,7 +1423,7 @@ func testValidateRuleEvaluationMetrics(ctx context.Context, t *testContext) {
 	}
 
 	// Wait for metric data to show up in Cloud Monitoring.
-	metricClient, err := gcm.NewMetricClient(ctx)
+	metricClient, err := newMetricClient(ctx)
 	if err != nil {
 		t.Fatalf("Create GCM metric client: %s", err)
 	}
@@ -0,0 +1,270 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator"
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// TestOperatorUpgrade validates the upgrade path from the previous released
+// operator to the current build. Resources are created while the previous
+// version manages the cluster. The upgrade must regenerate configuration
+// without drift, leave the collector DaemonSet in place (i.e. not interrupt
+// running scrapes), and accept the pre-existing custom resources unchanged.
+//
+// The CRDs of the previous release are expected to be installed out of band,
+// like for all other tests. They must be forward compatible with the current
+// build, which is part of the compatibility guarantee validated here.
+func TestOperatorUpgrade(t *testing.T) {
+	if upgradeFromImage == "" {
+		t.Skip("Not running upgrade test, provide --upgrade-from-image to enable")
+	}
+	if deployedOperator {
+		t.Skip("Upgrade test cannot run against an already deployed operator")
+	}
+	tctx := newUnstartedTestContext(t)
+
+	t.Run("previous operator deployed", tctx.subtest(testPreviousOperatorDeployed))
+	t.Run("resources created", tctx.subtest(testUpgradeResourcesCreated))
+	t.Run("upgraded", tctx.subtest(testUpgradeToCurrentOperator))
+}
+
+// testPreviousOperatorDeployed deploys the previous released operator version
+// into the test namespace and waits for it to become ready.
+func testPreviousOperatorDeployed(ctx context.Context, t *testContext) {
+	svcAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: operator.NameOperator},
+	}
+	if _, err := t.kubeClient.CoreV1().ServiceAccounts(t.namespace).Create(ctx, svcAccount, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create operator service account: %s", err)
+	}
+
+	// The cluster role is expected to exist already, mirroring the setup of
+	// the collector base resources.
+	const clusterRoleName = operator.DefaultOperatorNamespace + ":" + operator.NameOperator
+
+	roleBinding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: clusterRoleName + ":" + t.namespace,
+			// Tie to the namespace so the binding gets deleted alongside it, even though
+			// it's an cluster-wide resource.
+			OwnerReferences: t.ownerReferences,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     clusterRoleName,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      "ServiceAccount",
+				Namespace: t.namespace,
+				Name:      operator.NameOperator,
+			},
+		},
+	}
+	if _, err := t.kubeClient.RbacV1().ClusterRoleBindings().Create(ctx, roleBinding, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create operator cluster role binding: %s", err)
+	}
+
+	replicas := int32(1)
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: operator.NameOperator,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{operator.LabelAppName: operator.NameOperator},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{operator.LabelAppName: operator.NameOperator},
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: operator.NameOperator,
+					Containers: []corev1.Container{
+						{
+							Name:  "operator",
+							Image: upgradeFromImage,
+							Args: []string{
+								fmt.Sprintf("--operator-namespace=%s", t.namespace),
+								fmt.Sprintf("--public-namespace=%s", t.pubNamespace),
+								fmt.Sprintf("--project-id=%s", projectID),
+								fmt.Sprintf("--location=%s", location),
+								fmt.Sprintf("--cluster=%s", cluster),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if _, err := t.kubeClient.AppsV1().Deployments(t.namespace).Create(ctx, deploy, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create previous operator Deployment: %s", err)
+	}
+	t.Log("Waiting for previous operator to become ready")
+
+	err := wait.Poll(3*time.Second, 3*time.Minute, func() (bool, error) {
+		deploy, err := t.kubeClient.AppsV1().Deployments(t.namespace).Get(ctx, operator.NameOperator, metav1.GetOptions{})
+		if err != nil {
+			return false, errors.Wrap(err, "get operator Deployment")
+		}
+		return deploy.Status.ReadyReplicas == replicas, nil
+	})
+	if err != nil {
+		t.Fatalf("waiting for previous operator failed: %s", err)
+	}
+}
+
+// testUpgradeResourcesCreated creates an OperatorConfig and PodMonitoring
+// under the previous operator version and waits for it to act on them.
+func testUpgradeResourcesCreated(ctx context.Context, t *testContext) {
+	opCfg := &monitoringv1.OperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: operator.NameOperatorConfig,
+		},
+		Collection: monitoringv1.CollectionSpec{
+			ExternalLabels: map[string]string{
+				"external_key": "external_val",
+			},
+		},
+	}
+	if _, err := t.operatorClient.MonitoringV1().OperatorConfigs(t.pubNamespace).Create(ctx, opCfg, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create operatorconfig: %s", err)
+	}
+
+	podmon := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "collector-podmon",
+		},
+		Spec: monitoringv1.PodMonitoringSpec{
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					operator.LabelAppName: operator.NameCollector,
+				},
+			},
+			Endpoints: []monitoringv1.ScrapeEndpoint{
+				{Port: intstr.FromString("prom-metrics"), Interval: "5s"},
+			},
+		},
+	}
+	if _, err := t.operatorClient.MonitoringV1().PodMonitorings(t.namespace).Create(ctx, podmon, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create PodMonitoring: %s", err)
+	}
+	t.Log("Waiting for previous operator to generate configuration")
+
+	err := wait.Poll(3*time.Second, 3*time.Minute, func() (bool, error) {
+		if _, err := t.kubeClient.CoreV1().ConfigMaps(t.namespace).Get(ctx, operator.NameCollector, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, errors.Wrap(err, "get collector config")
+		}
+		ds, err := t.kubeClient.AppsV1().DaemonSets(t.namespace).Get(ctx, operator.NameCollector, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, errors.Wrap(err, "get collector DaemonSet")
+		}
+		return ds.Status.DesiredNumberScheduled > 0, nil
+	})
+	if err != nil {
+		t.Fatalf("waiting for resources of previous operator failed: %s", err)
+	}
+}
+
+// testUpgradeToCurrentOperator removes the previous operator and starts the
+// current build in its place, verifying that configuration is regenerated
+// without drift and that the collector DaemonSet keeps running throughout.
+func testUpgradeToCurrentOperator(ctx context.Context, t *testContext) {
+	cfgBefore, err := t.kubeClient.CoreV1().ConfigMaps(t.namespace).Get(ctx, operator.NameCollector, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get collector config: %s", err)
+	}
+	dsBefore, err := t.kubeClient.AppsV1().DaemonSets(t.namespace).Get(ctx, operator.NameCollector, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get collector DaemonSet: %s", err)
+	}
+
+	if err := t.kubeClient.AppsV1().Deployments(t.namespace).Delete(ctx, operator.NameOperator, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete previous operator Deployment: %s", err)
+	}
+	// Wait for the previous operator to release the leader election lease
+	// before starting the current build.
+	time.Sleep(10 * time.Second)
+
+	if err := t.startOperator(); err != nil {
+		t.Fatalf("starting current operator: %s", err)
+	}
+	t.Log("Waiting for upgraded operator to reconcile")
+
+	var observedGeneration int64
+	err = wait.Poll(3*time.Second, 3*time.Minute, func() (bool, error) {
+		pm, err := t.operatorClient.MonitoringV1().PodMonitorings(t.namespace).Get(ctx, "collector-podmon", metav1.GetOptions{})
+		if err != nil {
+			return false, errors.Wrap(err, "get PodMonitoring")
+		}
+		// The new operator must have processed the pre-existing resource.
+		for _, c := range pm.Status.Conditions {
+			if c.Type == monitoringv1.ConfigurationCreateSuccess && c.Status == metav1.ConditionTrue {
+				observedGeneration = c.ObservedGeneration
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("waiting for PodMonitoring to be accepted by upgraded operator failed: %s", err)
+	}
+	if observedGeneration != 1 {
+		t.Errorf("PodMonitoring resource was modified during upgrade, observed generation %d", observedGeneration)
+	}
+
+	// Scrape configuration semantics must not drift silently across versions:
+	// the regenerated config may differ only if the DaemonSet was updated
+	// alongside it as part of the rollout.
+	cfgAfter, err := t.kubeClient.CoreV1().ConfigMaps(t.namespace).Get(ctx, operator.NameCollector, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get collector config: %s", err)
+	}
+	dsAfter, err := t.kubeClient.AppsV1().DaemonSets(t.namespace).Get(ctx, operator.NameCollector, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get collector DaemonSet: %s", err)
+	}
+	if diff := cmp.Diff(cfgBefore.Data, cfgAfter.Data); diff != "" && dsAfter.Generation == dsBefore.Generation {
+		t.Errorf("collector config drifted across upgrade without DaemonSet update (-before, +after): %s", diff)
+	}
+	// The DaemonSet itself must have survived the upgrade. A recreation would
+	// have interrupted all scrapes at once.
+	if got, want := dsAfter.UID, dsBefore.UID; got != want {
+		t.Errorf("collector DaemonSet was recreated during upgrade, UID changed from %s to %s", want, got)
+	}
+}
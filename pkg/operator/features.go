@@ -0,0 +1,92 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Feature gates for experimental operator capabilities that can be enabled
+// per cluster via the --feature-gates flag before they are on by default.
+const (
+	// FeaturePrometheusOperatorCompat translates prometheus-operator PodMonitor
+	// and ServiceMonitor resources into PodMonitorings.
+	FeaturePrometheusOperatorCompat = "PrometheusOperatorCompat"
+	// FeatureCollectorConfigCanary rolls new collector configuration out to the
+	// canary collectors before fleet-wide promotion.
+	FeatureCollectorConfigCanary = "CollectorConfigCanary"
+	// FeatureScrapeHealthMetrics exports per-PodMonitoring scrape health
+	// summary series through the Cloud Monitoring export pipeline.
+	FeatureScrapeHealthMetrics = "ScrapeHealthMetrics"
+)
+
+// defaultFeatureGates holds all known feature gates with their default state.
+var defaultFeatureGates = map[string]bool{
+	FeaturePrometheusOperatorCompat: false,
+	FeatureCollectorConfigCanary:    false,
+	FeatureScrapeHealthMetrics:      false,
+}
+
+// FeatureGates is a set of named experimental capabilities and whether they
+// are enabled.
+type FeatureGates map[string]bool
+
+// ParseFeatureGates parses a comma-separated list of key=value pairs, e.g.
+// "ScrapeHealthMetrics=true,CollectorConfigCanary=false", against the known
+// feature gates. Omitted gates retain their default state.
+func ParseFeatureGates(s string) (FeatureGates, error) {
+	gates := FeatureGates{}
+	for name, enabled := range defaultFeatureGates {
+		gates[name] = enabled
+	}
+	if s == "" {
+		return gates, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("expected key=value pair, got %q", pair)
+		}
+		name := strings.TrimSpace(parts[0])
+		if _, ok := defaultFeatureGates[name]; !ok {
+			return nil, errors.Errorf("unknown feature gate %q, known gates: %s", name, knownFeatureGates())
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, errors.Errorf("invalid value %q for feature gate %q", parts[1], name)
+		}
+		gates[name] = enabled
+	}
+	return gates, nil
+}
+
+// Enabled reports whether the named feature gate is enabled. Unknown gates are
+// disabled.
+func (f FeatureGates) Enabled(name string) bool {
+	return f[name]
+}
+
+func knownFeatureGates() string {
+	names := make([]string, 0, len(defaultFeatureGates))
+	for name := range defaultFeatureGates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,200 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// gcInterval is the interval of the garbage collection pass over generated
+// resources.
+const gcInterval = 10 * time.Minute
+
+// resyncPeriod is the interval at which all reconciles re-run without change
+// events, repairing drift in managed resources.
+var resyncPeriod = 10 * time.Minute
+
+// runGarbageCollection periodically removes state from generated resources
+// whose source custom resources no longer exist. Reconciles rebuild the
+// generated resources wholesale, but stale entries can survive if source
+// resources disappear while the operator cannot reconcile, e.g. during
+// downtime or while config generation fails. Drift in the generated resources
+// themselves is repaired by the regular reconcile resyncs.
+func (o *Operator) runGarbageCollection(ctx context.Context) {
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := o.collectRuleFiles(ctx); err != nil {
+			o.logger.Error(err, "garbage collecting rule files failed")
+		}
+		if err := o.collectSecretEntries(ctx); err != nil {
+			o.logger.Error(err, "garbage collecting secret entries failed")
+		}
+	}
+}
+
+// collectRuleFiles removes entries from the generated rules ConfigMap that do
+// not belong to an existing Rules, ClusterRules, or GlobalRules resource.
+func (o *Operator) collectRuleFiles(ctx context.Context) error {
+	expected := map[string]bool{"empty.yaml": true}
+
+	var rulesList monitoringv1.RulesList
+	if err := o.client.List(ctx, &rulesList); err != nil {
+		return errors.Wrap(err, "list rules")
+	}
+	for _, rs := range rulesList.Items {
+		expected[fmt.Sprintf("rules__%s__%s.yaml", rs.Namespace, rs.Name)] = true
+	}
+	var clusterRulesList monitoringv1.ClusterRulesList
+	if err := o.client.List(ctx, &clusterRulesList); err != nil {
+		return errors.Wrap(err, "list cluster rules")
+	}
+	for _, rs := range clusterRulesList.Items {
+		expected[fmt.Sprintf("clusterrules__%s.yaml", rs.Name)] = true
+	}
+	var globalRulesList monitoringv1.GlobalRulesList
+	if err := o.client.List(ctx, &globalRulesList); err != nil {
+		return errors.Wrap(err, "list global rules")
+	}
+	for _, rs := range globalRulesList.Items {
+		expected[fmt.Sprintf("globalrules__%s.yaml", rs.Name)] = true
+	}
+
+	var cm corev1.ConfigMap
+	err := o.client.Get(ctx, types.NamespacedName{Namespace: o.opts.OperatorNamespace, Name: NameRulesGenerated}, &cm)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "get generated rules")
+	}
+	var stale []string
+	for f := range cm.Data {
+		if !expected[f] {
+			stale = append(stale, f)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	for _, f := range stale {
+		delete(cm.Data, f)
+	}
+	o.logger.Info("removing stale generated rule files", "files", stale)
+	return o.client.Update(ctx, &cm)
+}
+
+// collectSecretEntries removes entries from the mirrored collection and rules
+// Secrets whose source Secret or ConfigMap no longer exists or no longer has
+// the referenced key.
+func (o *Operator) collectSecretEntries(ctx context.Context) error {
+	if _, err := o.collectSecretEntriesFrom(ctx, CollectionSecretName); err != nil {
+		return err
+	}
+	// The rules secret is sharded across sequentially named Secrets, so walk
+	// the shards until the first one that doesn't exist.
+	for i := 0; ; i++ {
+		found, err := o.collectSecretEntriesFrom(ctx, rulesSecretShardName(i))
+		if err != nil {
+			return err
+		}
+		if !found {
+			return nil
+		}
+	}
+}
+
+// collectSecretEntriesFrom removes orphaned entries from the named mirrored
+// Secret. It reports whether the Secret exists.
+func (o *Operator) collectSecretEntriesFrom(ctx context.Context, name string) (bool, error) {
+	var secret corev1.Secret
+	err := o.client.Get(ctx, types.NamespacedName{Namespace: o.opts.OperatorNamespace, Name: name}, &secret)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "get secret %q", name)
+	}
+	var stale []string
+	for entry := range secret.Data {
+		ok, err := o.secretEntrySourceExists(ctx, entry)
+		if err != nil {
+			return true, errors.Wrapf(err, "check source for entry %q in secret %q", entry, name)
+		}
+		if !ok {
+			stale = append(stale, entry)
+		}
+	}
+	if len(stale) == 0 {
+		return true, nil
+	}
+	for _, entry := range stale {
+		delete(secret.Data, entry)
+	}
+	o.logger.Info("removing orphaned secret entries", "secret", name, "entries", stale)
+	if err := o.client.Update(ctx, &secret); err != nil {
+		return true, errors.Wrapf(err, "update secret %q", name)
+	}
+	return true, nil
+}
+
+// secretEntrySourceExists reports whether the source of a mirrored secret
+// entry, named as produced by pathForSelector, still exists.
+func (o *Operator) secretEntrySourceExists(ctx context.Context, entry string) (bool, error) {
+	parts := strings.SplitN(entry, "_", 4)
+	if len(parts) != 4 {
+		// Not a mirrored entry, leave it alone.
+		return true, nil
+	}
+	kind, namespace, name, key := parts[0], parts[1], parts[2], parts[3]
+
+	switch kind {
+	case "secret":
+		var s corev1.Secret
+		err := o.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &s)
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		_, ok := s.Data[key]
+		return ok, nil
+	case "configmap":
+		var cm corev1.ConfigMap
+		err := o.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &cm)
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		_, ok := cm.Data[key]
+		return ok, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	yaml3 "gopkg.in/yaml.v3"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// GenerateFromFiles renders the collector Prometheus configuration and rule
+// files from the custom resources in the given YAML manifest files and writes
+// the result to w without applying anything to a cluster. This permits
+// reviewing the effective configuration in GitOps workflows and debugging
+// config generation offline.
+func GenerateFromFiles(w io.Writer, opts Options, files ...string) error {
+	if err := opts.defaultAndValidate(logr.Discard()); err != nil {
+		return errors.Wrap(err, "invalid options")
+	}
+	bundle, err := loadResources(files...)
+	if err != nil {
+		return err
+	}
+	var config monitoringv1.OperatorConfig
+	if n := len(bundle.operatorConfigs); n > 0 {
+		config = bundle.operatorConfigs[n-1]
+	}
+
+	projectID, location, cluster := resolveLabels(opts, config.Collection.ExternalLabels)
+
+	// Render the collector configuration equivalent to what the collection
+	// reconciler would write to the collector ConfigMap.
+	cfg := &promconfig.Config{
+		GlobalConfig: promconfig.GlobalConfig{
+			ExternalLabels: labels.FromMap(config.Collection.ExternalLabels),
+		},
+	}
+	cfg.ScrapeConfigs, err = makeKubeletScrapeConfigs(config.Collection.KubeletScraping)
+	if err != nil {
+		return errors.Wrap(err, "failed to create kubelet scrape config")
+	}
+	for i := range bundle.podMons {
+		pm := &bundle.podMons[i]
+		if !opts.namespaceAllowed(pm.Namespace) {
+			continue
+		}
+		cfgs, err := pm.ScrapeConfigs(projectID, location, cluster, opts.PublicNamespace)
+		if err != nil {
+			return errors.Wrapf(err, "generating scrape config failed for PodMonitoring %s/%s", pm.Namespace, pm.Name)
+		}
+		cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, cfgs...)
+	}
+	for i := range bundle.clusterPodMons {
+		cm := &bundle.clusterPodMons[i]
+		cfgs, err := cm.ScrapeConfigs(projectID, location, cluster, opts.PublicNamespace)
+		if err != nil {
+			return errors.Wrapf(err, "generating scrape config failed for ClusterPodMonitoring %s", cm.Name)
+		}
+		cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, cfgs...)
+	}
+	sort.Slice(cfg.ScrapeConfigs, func(i, j int) bool {
+		return cfg.ScrapeConfigs[i].JobName < cfg.ScrapeConfigs[j].JobName
+	})
+
+	cfgEncoded, err := yaml3.Marshal(cfg)
+	if err != nil {
+		return errors.Wrap(err, "marshal Prometheus config")
+	}
+	fmt.Fprintf(w, "# collector configuration (%s)\n%s", configFilename, cfgEncoded)
+
+	// Render the rule files equivalent to the generated rules ConfigMap.
+	for i := range bundle.rules {
+		rs := &bundle.rules[i]
+		if !opts.namespaceAllowed(rs.Namespace) {
+			continue
+		}
+		result, local, err := generateRules(rs, projectID, location, cluster)
+		if err != nil {
+			return errors.Wrapf(err, "generating rules failed for Rules %s/%s", rs.Namespace, rs.Name)
+		}
+		fmt.Fprintf(w, "---\n# rules__%s__%s.yaml\n%s", rs.Namespace, rs.Name, result)
+		if local != "" {
+			fmt.Fprintf(w, "---\n# %srules__%s__%s.yaml\n%s", LocalRuleFilePrefix, rs.Namespace, rs.Name, local)
+		}
+	}
+	for i := range bundle.clusterRules {
+		rs := &bundle.clusterRules[i]
+		result, local, err := generateClusterRules(rs, projectID, location, cluster)
+		if err != nil {
+			return errors.Wrapf(err, "generating rules failed for ClusterRules %s", rs.Name)
+		}
+		fmt.Fprintf(w, "---\n# clusterrules__%s.yaml\n%s", rs.Name, result)
+		if local != "" {
+			fmt.Fprintf(w, "---\n# %sclusterrules__%s.yaml\n%s", LocalRuleFilePrefix, rs.Name, local)
+		}
+	}
+	for i := range bundle.globalRules {
+		rs := &bundle.globalRules[i]
+		result, local, err := generateGlobalRules(rs)
+		if err != nil {
+			return errors.Wrapf(err, "generating rules failed for GlobalRules %s", rs.Name)
+		}
+		fmt.Fprintf(w, "---\n# globalrules__%s.yaml\n%s", rs.Name, result)
+		if local != "" {
+			fmt.Fprintf(w, "---\n# %sglobalrules__%s.yaml\n%s", LocalRuleFilePrefix, rs.Name, local)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// computeAPIEndpoint is the base URL of the GCE API.
+	computeAPIEndpoint = "https://compute.googleapis.com/compute/v1"
+	// cloudRunAPIEndpoint is the base URL of the Cloud Run admin API.
+	cloudRunAPIEndpoint = "https://run.googleapis.com/v2"
+
+	// googleCloudSDTokenScope is the OAuth scope requested for reading
+	// instance and service metadata.
+	googleCloudSDTokenScope = "https://www.googleapis.com/auth/cloud-platform.read-only"
+
+	// googleCloudSDPort is the port of the operator's metrics and status API
+	// server, which also serves HTTP service discovery. Must match the
+	// default of the --metrics-addr flag and the gmp-operator Service.
+	googleCloudSDPort = 18080
+)
+
+// invalidDiscoveryLabelCharRE matches characters that must be replaced before
+// instance labels can be used as Prometheus meta label name suffixes.
+var invalidDiscoveryLabelCharRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// sdTargetGroup is a target group in the JSON format of Prometheus's HTTP
+// service discovery protocol.
+type sdTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// handleDiscovery serves the Google Cloud targets of the ClusterStaticMonitoring
+// named in the request path in the HTTP service discovery format, i.e. under
+// /discovery/<name>. The collectors periodically refetch the endpoint per the
+// refresh interval of the generated http_sd_configs entry.
+func (s *statusAPI) handleDiscovery(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	name := strings.TrimPrefix(req.URL.Path, "/discovery/")
+	if name == "" || strings.Contains(name, "/") {
+		http.Error(w, "expected path /discovery/<name>", http.StatusNotFound)
+		return
+	}
+	var sm monitoringv1.ClusterStaticMonitoring
+	if err := s.client.Get(ctx, client.ObjectKey{Name: name}, &sm); apierrors.IsNotFound(err) {
+		http.Error(w, fmt.Sprintf("ClusterStaticMonitoring %q not found", name), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("getting ClusterStaticMonitoring failed: %s", err), http.StatusInternalServerError)
+		return
+	}
+	groups, err := s.discoverGoogleCloudTargets(ctx, &sm)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("discovering targets failed: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(groups); err != nil {
+		http.Error(w, fmt.Sprintf("encoding response failed: %s", err), http.StatusInternalServerError)
+	}
+}
+
+// discoverGoogleCloudTargets queries the Google Cloud APIs configured in the
+// resource and translates the results into target groups.
+func (s *statusAPI) discoverGoogleCloudTargets(ctx context.Context, sm *monitoringv1.ClusterStaticMonitoring) ([]sdTargetGroup, error) {
+	// Always return a non-nil slice so an empty result encodes as [] rather
+	// than null, which Prometheus rejects.
+	groups := []sdTargetGroup{}
+	if sm.Spec.GoogleCloud == nil {
+		return groups, nil
+	}
+	token, err := s.accessToken(ctx, sm.Spec.GoogleCloud.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	for _, gce := range sm.Spec.GoogleCloud.GCEInstances {
+		projectID := gce.ProjectID
+		if projectID == "" {
+			projectID = s.opts.ProjectID
+		}
+		for _, zone := range gce.Zones {
+			g, err := discoverGCEInstances(ctx, token, projectID, zone, gce)
+			if err != nil {
+				return nil, errors.Wrapf(err, "discover GCE instances in zone %q", zone)
+			}
+			groups = append(groups, g...)
+		}
+	}
+	for _, run := range sm.Spec.GoogleCloud.CloudRunServices {
+		projectID := run.ProjectID
+		if projectID == "" {
+			projectID = s.opts.ProjectID
+		}
+		g, err := discoverCloudRunServices(ctx, token, projectID, run.Region)
+		if err != nil {
+			return nil, errors.Wrapf(err, "discover Cloud Run services in region %q", run.Region)
+		}
+		groups = append(groups, g...)
+	}
+	return groups, nil
+}
+
+// discoverGCEInstances lists the running GCE instances of a zone matching the
+// configured label filters and returns one target group per instance, carrying
+// the instance name, zone, and instance labels as meta labels.
+func discoverGCEInstances(ctx context.Context, token, projectID, zone string, cfg monitoringv1.GCEInstanceDiscovery) ([]sdTargetGroup, error) {
+	filters := []string{`status = "RUNNING"`}
+	// Sort for stable request URLs across refreshes.
+	keys := make([]string, 0, len(cfg.LabelFilters))
+	for k := range cfg.LabelFilters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		filters = append(filters, fmt.Sprintf("labels.%s = %q", k, cfg.LabelFilters[k]))
+	}
+	u := fmt.Sprintf("%s/projects/%s/zones/%s/instances?filter=%s",
+		computeAPIEndpoint, projectID, zone, url.QueryEscape(strings.Join(filters, " AND ")))
+
+	var resp struct {
+		Items []struct {
+			Name              string            `json:"name"`
+			Labels            map[string]string `json:"labels"`
+			NetworkInterfaces []struct {
+				NetworkIP string `json:"networkIP"`
+			} `json:"networkInterfaces"`
+		} `json:"items"`
+	}
+	if err := googleCloudAPI(ctx, u, token, &resp); err != nil {
+		return nil, err
+	}
+	var groups []sdTargetGroup
+	for _, inst := range resp.Items {
+		if len(inst.NetworkInterfaces) == 0 {
+			continue
+		}
+		lset := map[string]string{
+			"__meta_gce_instance_name": inst.Name,
+			"__meta_gce_zone":          zone,
+			"__meta_gce_project":       projectID,
+		}
+		for k, v := range inst.Labels {
+			lset["__meta_gce_label_"+invalidDiscoveryLabelCharRE.ReplaceAllString(k, "_")] = v
+		}
+		groups = append(groups, sdTargetGroup{
+			Targets: []string{fmt.Sprintf("%s:%d", inst.NetworkInterfaces[0].NetworkIP, cfg.Port)},
+			Labels:  lset,
+		})
+	}
+	return groups, nil
+}
+
+// discoverCloudRunServices lists the Cloud Run services of a region and
+// returns one target group per service. Cloud Run services are only reachable
+// through their HTTPS URL, so targets force the https scheme regardless of the
+// resource's scheme setting.
+func discoverCloudRunServices(ctx context.Context, token, projectID, region string) ([]sdTargetGroup, error) {
+	u := fmt.Sprintf("%s/projects/%s/locations/%s/services", cloudRunAPIEndpoint, projectID, region)
+
+	var resp struct {
+		Services []struct {
+			Name string `json:"name"`
+			URI  string `json:"uri"`
+		} `json:"services"`
+	}
+	if err := googleCloudAPI(ctx, u, token, &resp); err != nil {
+		return nil, err
+	}
+	var groups []sdTargetGroup
+	for _, svc := range resp.Services {
+		su, err := url.Parse(svc.URI)
+		if err != nil || su.Host == "" {
+			continue
+		}
+		// The short name is the last segment of the full resource name.
+		shortName := svc.Name[strings.LastIndex(svc.Name, "/")+1:]
+		groups = append(groups, sdTargetGroup{
+			Targets: []string{su.Host + ":443"},
+			Labels: map[string]string{
+				"__scheme__":               "https",
+				"__meta_cloud_run_service": shortName,
+				"__meta_cloud_run_region":  region,
+				"__meta_cloud_run_project": projectID,
+			},
+		})
+	}
+	return groups, nil
+}
+
+// accessToken mints an OAuth access token with which the discovery APIs are
+// queried, using the given credentials or the operator's own ones.
+func (s *statusAPI) accessToken(ctx context.Context, credentials *corev1.SecretKeySelector) (string, error) {
+	var tokenSource oauth2.TokenSource
+
+	if credentials != nil {
+		b, err := getSecretKeyBytes(ctx, s.client, s.opts.PublicNamespace, credentials)
+		if err != nil {
+			return "", err
+		}
+		creds, err := google.CredentialsFromJSON(ctx, b, googleCloudSDTokenScope)
+		if err != nil {
+			return "", errors.Wrap(err, "parse GCP service account credentials")
+		}
+		tokenSource = creds.TokenSource
+	} else {
+		var err error
+		tokenSource, err = google.DefaultTokenSource(ctx, googleCloudSDTokenScope)
+		if err != nil {
+			return "", errors.Wrap(err, "find default GCP credentials")
+		}
+	}
+	token, err := tokenSource.Token()
+	if err != nil {
+		return "", errors.Wrap(err, "mint access token")
+	}
+	return token.AccessToken, nil
+}
+
+// googleCloudAPI issues an authenticated GET request and decodes the JSON
+// response into out.
+func googleCloudAPI(ctx context.Context, u, token string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(out), "decode response")
+}
@@ -0,0 +1,236 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// defaultTokenScope is the OAuth scope requested for datasource access
+	// tokens if none is configured explicitly.
+	defaultTokenScope = "https://www.googleapis.com/auth/monitoring.read"
+
+	// tokenRefreshSafety is the duration before token expiry at which a new
+	// token is written to the datasource at the latest.
+	tokenRefreshSafety = 5 * time.Minute
+)
+
+// setupGrafanaSyncControllers registers the controller that maintains OAuth
+// access tokens for Grafana datasources declared in GrafanaDatasourceSync
+// resources.
+func setupGrafanaSyncControllers(op *Operator) error {
+	err := ctrl.NewControllerManagedBy(op.manager).
+		Named("grafana-datasource-sync").
+		// Token rotation is driven by requeueing, only spec changes require
+		// an immediate reconciliation.
+		For(
+			&monitoringv1.GrafanaDatasourceSync{},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Complete(newGrafanaSyncReconciler(op.manager.GetClient(), op.opts))
+	if err != nil {
+		return errors.Wrap(err, "create grafana datasource sync controller")
+	}
+	return nil
+}
+
+type grafanaSyncReconciler struct {
+	client client.Client
+	opts   Options
+}
+
+func newGrafanaSyncReconciler(c client.Client, opts Options) *grafanaSyncReconciler {
+	return &grafanaSyncReconciler{
+		client: c,
+		opts:   opts,
+	}
+}
+
+func (r *grafanaSyncReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	logger, _ := logr.FromContext(ctx)
+	logger.WithValues("grafanadatasourcesync", req.NamespacedName).Info("reconciling grafana datasources")
+
+	var sync monitoringv1.GrafanaDatasourceSync
+	if err := r.client.Get(ctx, req.NamespacedName, &sync); apierrors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	} else if err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "get grafanadatasourcesync")
+	}
+	if isPaused(&sync) {
+		logger.Info("reconciliation paused via annotation")
+		return reconcile.Result{}, nil
+	}
+	apiToken, err := getSecretKeyBytes(ctx, r.client, sync.Namespace, sync.Spec.GrafanaSecret)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "get grafana API token")
+	}
+	status := monitoringv1.GrafanaDatasourceSyncStatus{
+		ObservedGeneration: sync.Generation,
+	}
+	// The earliest expiry across all datasources determines when the next
+	// rotation must happen.
+	var nextExpiry time.Time
+
+	for _, ds := range sync.Spec.Datasources {
+		dsStatus := monitoringv1.GrafanaDatasourceStatus{UID: ds.UID}
+
+		expiry, err := r.syncDatasource(ctx, &sync, strings.TrimSpace(string(apiToken)), ds)
+		if err != nil {
+			// Sync failures for one datasource must not block rotation of the
+			// remaining ones. They are surfaced in the status and retried.
+			logger.Error(err, "sync grafana datasource", "uid", ds.UID)
+			dsStatus.LastError = err.Error()
+		} else {
+			dsStatus.LastSyncTime = metav1.Now()
+			dsStatus.TokenExpireTime = metav1.NewTime(expiry)
+
+			if nextExpiry.IsZero() || expiry.Before(nextExpiry) {
+				nextExpiry = expiry
+			}
+		}
+		status.Datasources = append(status.Datasources, dsStatus)
+	}
+	sync.Status = status
+	if err := r.client.Status().Update(ctx, &sync); err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "update grafanadatasourcesync status")
+	}
+	// Rotate well before the earliest token expires. Failed datasources are
+	// retried after a minute at the latest.
+	requeue := time.Minute
+	if !nextExpiry.IsZero() {
+		if d := time.Until(nextExpiry) - tokenRefreshSafety; d > requeue {
+			requeue = d
+		}
+	}
+	return reconcile.Result{RequeueAfter: requeue}, nil
+}
+
+// syncDatasource mints a new access token for the datasource and writes it
+// into the datasource's Authorization header through the Grafana API.
+// It returns the expiry time of the written token.
+func (r *grafanaSyncReconciler) syncDatasource(ctx context.Context, sync *monitoringv1.GrafanaDatasourceSync, apiToken string, ds monitoringv1.GrafanaDatasource) (time.Time, error) {
+	scopes := ds.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{defaultTokenScope}
+	}
+	var tokenSource oauth2.TokenSource
+
+	if ds.Credentials != nil {
+		b, err := getSecretKeyBytes(ctx, r.client, sync.Namespace, ds.Credentials)
+		if err != nil {
+			return time.Time{}, err
+		}
+		creds, err := google.CredentialsFromJSON(ctx, b, scopes...)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "parse GCP service account credentials")
+		}
+		tokenSource = creds.TokenSource
+	} else {
+		var err error
+		tokenSource, err = google.DefaultTokenSource(ctx, scopes...)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "find default GCP credentials")
+		}
+	}
+	token, err := tokenSource.Token()
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "mint access token")
+	}
+	// The update endpoint requires the full datasource model, so fetch it
+	// first and only amend the authorization header configuration.
+	model, err := grafanaAPI(ctx, http.MethodGet, sync.Spec.GrafanaEndpoint, "api/datasources/uid/"+ds.UID, apiToken, nil)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "fetch datasource")
+	}
+	jsonData, ok := model["jsonData"].(map[string]interface{})
+	if !ok {
+		jsonData = map[string]interface{}{}
+	}
+	jsonData["httpHeaderName1"] = "Authorization"
+	model["jsonData"] = jsonData
+	model["secureJsonData"] = map[string]interface{}{
+		"httpHeaderValue1": fmt.Sprintf("Bearer %s", token.AccessToken),
+	}
+	id, ok := model["id"].(float64)
+	if !ok {
+		return time.Time{}, errors.Errorf("datasource %q has no numeric id", ds.UID)
+	}
+	if _, err := grafanaAPI(ctx, http.MethodPut, sync.Spec.GrafanaEndpoint, fmt.Sprintf("api/datasources/%d", int64(id)), apiToken, model); err != nil {
+		return time.Time{}, errors.Wrap(err, "update datasource")
+	}
+	return token.Expiry, nil
+}
+
+// grafanaAPI issues a JSON request against the Grafana HTTP API and decodes
+// the response object.
+func grafanaAPI(ctx context.Context, method, endpoint, path, apiToken string, body map[string]interface{}) (map[string]interface{}, error) {
+	var reqBody *bytes.Buffer
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal request body")
+		}
+		reqBody = bytes.NewBuffer(b)
+	} else {
+		reqBody = &bytes.Buffer{}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", strings.TrimSuffix(endpoint, "/"), path), reqBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "create request")
+	}
+	req.Header.Set("Authorization", "Bearer "+apiToken)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("request to %q failed with status %s: %s", path, resp.Status, strings.TrimSpace(string(b)))
+	}
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "decode response")
+	}
+	return result, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/config"
+	prommodel "github.com/prometheus/common/model"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
+	discoverykube "github.com/prometheus/prometheus/discovery/kubernetes"
+	"github.com/prometheus/prometheus/model/relabel"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// The pilot-agent port on which injected sidecars serve their merged
+	// metrics, i.e. Envoy's stats combined with the application's metrics.
+	// The port is not declared on any container, so targets are addressed
+	// through the pod IP rather than a discovered port.
+	istioMergedMetricsPort = 15020
+	istioMergedMetricsPath = "/stats/prometheus"
+
+	// Annotation the sidecar injector sets on every injected pod, used to
+	// discover pods running a sidecar without any user-provided selector.
+	istioStatusAnnotation = "__meta_kubernetes_pod_annotation_sidecar_istio_io_status"
+)
+
+// makeIstioSidecarScrapeConfigs generates the scrape job for the merged
+// metrics endpoints of Istio sidecar proxies across all namespaces. Pods are
+// discovered like regular workload targets, so each collector only scrapes
+// the sidecars on its own node.
+func makeIstioSidecarScrapeConfigs(cfg *monitoringv1.IstioSidecarScraping) ([]*promconfig.ScrapeConfig, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	interval, err := prommodel.ParseDuration(cfg.Interval)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid scrape interval")
+	}
+	discoveryCfgs := discovery.Configs{
+		&discoverykube.SDConfig{
+			HTTPClientConfig: config.DefaultHTTPClientConfig,
+			Role:             discoverykube.RolePod,
+			// Drop all potential targets not on the same node as the collector.
+			Selectors: []discoverykube.SelectorConfig{
+				{
+					Role:  discoverykube.RolePod,
+					Field: fmt.Sprintf("spec.nodeName=$(%s)", monitoringv1.EnvVarNodeName),
+				},
+			},
+		},
+	}
+	relabelCfgs := []*relabel.Config{
+		// Only scrape pods into which a sidecar was injected.
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{istioStatusAnnotation},
+			Regex:        relabel.MustNewRegexp(".+"),
+		},
+		// Pod discovery generates a target per declared container port. Keep a
+		// single target per pod and point it at the merged metrics endpoint.
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_container_init"},
+			Regex:        relabel.MustNewRegexp("false"),
+		},
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_container_name"},
+			Regex:        relabel.MustNewRegexp("istio-proxy"),
+		},
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_ip"},
+			TargetLabel:  "__address__",
+			Replacement:  fmt.Sprintf("$1:%d", istioMergedMetricsPort),
+		},
+		{
+			Action:      relabel.Replace,
+			Replacement: "istio-sidecars",
+			TargetLabel: "job",
+		},
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_namespace"},
+			TargetLabel:  "namespace",
+		},
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_name"},
+			TargetLabel:  "pod",
+		},
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_name"},
+			TargetLabel:  "instance",
+			Replacement:  fmt.Sprintf("$1:%d", istioMergedMetricsPort),
+		},
+	}
+	return []*promconfig.ScrapeConfig{
+		{
+			JobName:                 "istio-sidecars/metrics",
+			ServiceDiscoveryConfigs: discoveryCfgs,
+			ScrapeInterval:          interval,
+			MetricsPath:             istioMergedMetricsPath,
+			RelabelConfigs:          relabelCfgs,
+		},
+	}, nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/config"
+	prommodel "github.com/prometheus/common/model"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
+	discoverykube "github.com/prometheus/prometheus/discovery/kubernetes"
+	"github.com/prometheus/prometheus/model/relabel"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// NameKubeStateMetrics is the name of the managed kube-state-metrics
+	// Deployment and its ServiceAccount.
+	NameKubeStateMetrics = "kube-state-metrics"
+	// Pinned image the managed kube-state-metrics instance runs at. Upgraded
+	// deliberately with operator releases rather than tracking upstream.
+	imageKubeStateMetrics = "registry.k8s.io/kube-state-metrics/kube-state-metrics:v2.4.2"
+
+	kubeStateMetricsPort     = 8080
+	kubeStateMetricsPortName = "metrics"
+)
+
+// defaultKubeStateMetricsAllowlist is the curated set of metrics collected
+// when the KubeStateMetricsSpec does not specify its own allowlist. It covers
+// the state metrics most dashboards and alerting rules build on while keeping
+// the per-object series count bounded.
+var defaultKubeStateMetricsAllowlist = []string{
+	"kube_daemonset_status_.*",
+	"kube_deployment_spec_replicas",
+	"kube_deployment_status_replicas_(available|updated|unavailable)",
+	"kube_job_status_(active|failed|succeeded)",
+	"kube_namespace_status_phase",
+	"kube_node_info",
+	"kube_node_status_(allocatable|capacity|condition)",
+	"kube_pod_container_resource_(limits|requests)",
+	"kube_pod_container_status_(ready|restarts_total|waiting_reason)",
+	"kube_pod_info",
+	"kube_pod_status_phase",
+	"kube_statefulset_status_replicas_(current|ready|updated)",
+}
+
+// ensureKubeStateMetrics creates, updates, or removes the managed
+// kube-state-metrics Deployment according to the OperatorConfig.
+func (r *collectionReconciler) ensureKubeStateMetrics(ctx context.Context, spec *monitoringv1.CollectionSpec) error {
+	if spec.KubeStateMetrics == nil {
+		// Clean up a previously managed instance if the toggle was removed.
+		deploy := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: r.opts.OperatorNamespace,
+				Name:      NameKubeStateMetrics,
+			},
+		}
+		if err := r.client.Delete(ctx, deploy); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrap(err, "delete kube-state-metrics deployment")
+		}
+		return nil
+	}
+	allowlist := spec.KubeStateMetrics.MetricAllowlist
+	if len(allowlist) == 0 {
+		allowlist = defaultKubeStateMetricsAllowlist
+	}
+	replicas := int32(1)
+
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.opts.OperatorNamespace,
+			Name:      NameKubeStateMetrics,
+			Labels: map[string]string{
+				LabelAppName: NameKubeStateMetrics,
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					LabelAppName: NameKubeStateMetrics,
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						LabelAppName: NameKubeStateMetrics,
+					},
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: NameKubeStateMetrics,
+					Containers: []corev1.Container{
+						{
+							Name:  NameKubeStateMetrics,
+							Image: imageKubeStateMetrics,
+							Args: []string{
+								fmt.Sprintf("--port=%d", kubeStateMetricsPort),
+								fmt.Sprintf("--metric-allowlist=%s", strings.Join(allowlist, ",")),
+							},
+							Ports: []corev1.ContainerPort{
+								{Name: kubeStateMetricsPortName, ContainerPort: kubeStateMetricsPort},
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("50m"),
+									corev1.ResourceMemory: resource.MustParse("100Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("250Mi"),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := r.client.Update(ctx, deploy); apierrors.IsNotFound(err) {
+		if err := r.client.Create(ctx, deploy); err != nil {
+			return errors.Wrap(err, "create kube-state-metrics deployment")
+		}
+	} else if err != nil {
+		return errors.Wrap(err, "update kube-state-metrics deployment")
+	}
+	return nil
+}
+
+// makeKubeStateMetricsScrapeConfigs generates the scrape job for the managed
+// kube-state-metrics instance. The pod is discovered like regular workload
+// targets, so only the collector on the pod's node scrapes it.
+func makeKubeStateMetricsScrapeConfigs(cfg *monitoringv1.KubeStateMetricsSpec, operatorNamespace string) ([]*promconfig.ScrapeConfig, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	interval, err := prommodel.ParseDuration(cfg.Interval)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid scrape interval")
+	}
+	discoveryCfgs := discovery.Configs{
+		&discoverykube.SDConfig{
+			HTTPClientConfig:   config.DefaultHTTPClientConfig,
+			Role:               discoverykube.RolePod,
+			NamespaceDiscovery: discoverykube.NamespaceDiscovery{Names: []string{operatorNamespace}},
+			// Drop all potential targets not on the same node as the collector.
+			Selectors: []discoverykube.SelectorConfig{
+				{
+					Role:  discoverykube.RolePod,
+					Field: fmt.Sprintf("spec.nodeName=$(%s)", monitoringv1.EnvVarNodeName),
+				},
+			},
+		},
+	}
+	relabelCfgs := []*relabel.Config{
+		// Select by the sanitized form of the app.kubernetes.io/name label.
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_label_app_kubernetes_io_name"},
+			Regex:        relabel.MustNewRegexp(NameKubeStateMetrics),
+		},
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_container_port_name"},
+			Regex:        relabel.MustNewRegexp(kubeStateMetricsPortName),
+		},
+		{
+			Action:      relabel.Replace,
+			Replacement: NameKubeStateMetrics,
+			TargetLabel: "job",
+		},
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_name"},
+			TargetLabel:  "instance",
+			Replacement:  "$1:" + kubeStateMetricsPortName,
+		},
+	}
+	return []*promconfig.ScrapeConfig{
+		{
+			JobName:                 "kube-state-metrics/metrics",
+			ServiceDiscoveryConfigs: discoveryCfgs,
+			ScrapeInterval:          interval,
+			MetricsPath:             "/metrics",
+			RelabelConfigs:          relabelCfgs,
+		},
+	}, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// operatorMetrics are metrics about the operator's own reconciliation behavior.
+// Reconcile durations, work queue depths, and webhook latencies are already
+// provided by controller-runtime on the same registry. These metrics add
+// visibility into config generation, which fails per resource rather than per
+// reconcile loop.
+type operatorMetrics struct {
+	configGenerationFailures  *prometheus.CounterVec
+	statusUpdateFailures      prometheus.Counter
+	collectorSeries           *prometheus.GaugeVec
+	collectorTargets          *prometheus.GaugeVec
+	collectorMemoryRecommend  prometheus.Gauge
+	namespaceSeriesOverBudget *prometheus.GaugeVec
+}
+
+func newOperatorMetrics(reg prometheus.Registerer) *operatorMetrics {
+	m := &operatorMetrics{
+		configGenerationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "prometheus_engine_operator_config_generation_failures_total",
+			Help: "Number of failures generating configuration from a custom resource, by resource kind.",
+		}, []string{"kind"}),
+		statusUpdateFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "prometheus_engine_operator_status_update_failures_total",
+			Help: "Number of failed status updates on custom resources.",
+		}),
+		collectorSeries: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "prometheus_engine_operator_collector_series",
+			Help: "Number of in-memory series per collector pod, as reported by the collector itself.",
+		}, []string{"pod"}),
+		collectorTargets: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "prometheus_engine_operator_collector_targets",
+			Help: "Number of active scrape targets per collector pod, as reported by the collector itself.",
+		}, []string{"pod"}),
+		collectorMemoryRecommend: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "prometheus_engine_operator_collector_memory_recommendation_bytes",
+			Help: "Recommended memory request for the collector containers, derived from the busiest collector's series count.",
+		}),
+		namespaceSeriesOverBudget: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "prometheus_engine_operator_namespace_series_over_budget",
+			Help: "Number of active series above the configured ingestion budget per target namespace. Zero while the namespace is within its budget.",
+		}, []string{"namespace"}),
+	}
+	if reg != nil {
+		reg.MustRegister(
+			m.configGenerationFailures,
+			m.statusUpdateFailures,
+			m.collectorSeries,
+			m.collectorTargets,
+			m.collectorMemoryRecommend,
+			m.namespaceSeriesOverBudget,
+		)
+	}
+	return m
+}
@@ -0,0 +1,236 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/config"
+	prommodel "github.com/prometheus/common/model"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
+	discoverykube "github.com/prometheus/prometheus/discovery/kubernetes"
+	"github.com/prometheus/prometheus/model/relabel"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// NameNodeExporter is the name of the managed node-exporter DaemonSet and
+	// its ServiceAccount.
+	NameNodeExporter = "node-exporter"
+	// Pinned image the managed node-exporter runs at. Upgraded deliberately
+	// with operator releases rather than tracking upstream.
+	imageNodeExporter = "quay.io/prometheus/node-exporter:v1.3.1"
+
+	// The listen port is chosen outside of node-exporter's default 9100 as the
+	// pods run on the host network and must not collide with user-installed
+	// instances.
+	nodeExporterPort     = 19100
+	nodeExporterPortName = "metrics"
+)
+
+// defaultNodeExporterCollectors is the curated set of node-exporter collectors
+// enabled when the NodeExporterSpec does not specify its own. It covers the
+// CPU, memory, disk, filesystem, network, and load metrics most dashboards
+// build on while leaving the long tail of hardware collectors disabled.
+var defaultNodeExporterCollectors = []string{
+	"cpu",
+	"diskstats",
+	"filesystem",
+	"loadavg",
+	"meminfo",
+	"netdev",
+}
+
+// ensureNodeExporter creates, updates, or removes the managed node-exporter
+// DaemonSet according to the OperatorConfig.
+func (r *collectionReconciler) ensureNodeExporter(ctx context.Context, spec *monitoringv1.CollectionSpec) error {
+	if spec.NodeExporter == nil {
+		// Clean up a previously managed instance if the toggle was removed.
+		ds := &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: r.opts.OperatorNamespace,
+				Name:      NameNodeExporter,
+			},
+		}
+		if err := r.client.Delete(ctx, ds); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrap(err, "delete node-exporter daemon set")
+		}
+		return nil
+	}
+	collectors := spec.NodeExporter.EnabledCollectors
+	if len(collectors) == 0 {
+		collectors = defaultNodeExporterCollectors
+	}
+	args := []string{
+		fmt.Sprintf("--web.listen-address=:%d", nodeExporterPort),
+		"--path.procfs=/host/proc",
+		"--path.sysfs=/host/sys",
+		"--collector.disable-defaults",
+	}
+	for _, c := range collectors {
+		args = append(args, fmt.Sprintf("--collector.%s", c))
+	}
+	hostPathType := corev1.HostPathDirectory
+
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.opts.OperatorNamespace,
+			Name:      NameNodeExporter,
+			Labels: map[string]string{
+				LabelAppName: NameNodeExporter,
+			},
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					LabelAppName: NameNodeExporter,
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						LabelAppName: NameNodeExporter,
+					},
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: NameNodeExporter,
+					HostNetwork:        true,
+					HostPID:            true,
+					Tolerations: []corev1.Toleration{
+						// Export node metrics from all nodes, including
+						// tainted ones.
+						{Operator: corev1.TolerationOpExists},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  NameNodeExporter,
+							Image: imageNodeExporter,
+							Args:  args,
+							Ports: []corev1.ContainerPort{
+								{Name: nodeExporterPortName, ContainerPort: nodeExporterPort},
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("10m"),
+									corev1.ResourceMemory: resource.MustParse("16Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("64Mi"),
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "proc", MountPath: "/host/proc", ReadOnly: true},
+								{Name: "sys", MountPath: "/host/sys", ReadOnly: true},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "proc",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{Path: "/proc", Type: &hostPathType},
+							},
+						},
+						{
+							Name: "sys",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{Path: "/sys", Type: &hostPathType},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := r.client.Update(ctx, ds); apierrors.IsNotFound(err) {
+		if err := r.client.Create(ctx, ds); err != nil {
+			return errors.Wrap(err, "create node-exporter daemon set")
+		}
+	} else if err != nil {
+		return errors.Wrap(err, "update node-exporter daemon set")
+	}
+	return nil
+}
+
+// makeNodeExporterScrapeConfigs generates the scrape job for the managed
+// node-exporter pods. The pods are discovered like regular workload targets,
+// so each collector only scrapes the node-exporter on its own node.
+func makeNodeExporterScrapeConfigs(cfg *monitoringv1.NodeExporterSpec, operatorNamespace string) ([]*promconfig.ScrapeConfig, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	interval, err := prommodel.ParseDuration(cfg.Interval)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid scrape interval")
+	}
+	discoveryCfgs := discovery.Configs{
+		&discoverykube.SDConfig{
+			HTTPClientConfig:   config.DefaultHTTPClientConfig,
+			Role:               discoverykube.RolePod,
+			NamespaceDiscovery: discoverykube.NamespaceDiscovery{Names: []string{operatorNamespace}},
+			// Drop all potential targets not on the same node as the collector.
+			Selectors: []discoverykube.SelectorConfig{
+				{
+					Role:  discoverykube.RolePod,
+					Field: fmt.Sprintf("spec.nodeName=$(%s)", monitoringv1.EnvVarNodeName),
+				},
+			},
+		},
+	}
+	relabelCfgs := []*relabel.Config{
+		// Select by the sanitized form of the app.kubernetes.io/name label.
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_label_app_kubernetes_io_name"},
+			Regex:        relabel.MustNewRegexp(NameNodeExporter),
+		},
+		{
+			Action:       relabel.Keep,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_container_port_name"},
+			Regex:        relabel.MustNewRegexp(nodeExporterPortName),
+		},
+		{
+			Action:      relabel.Replace,
+			Replacement: NameNodeExporter,
+			TargetLabel: "job",
+		},
+		// Use the node name as instance like the kubelet jobs do, keeping node
+		// metrics joinable across both sources.
+		{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"__meta_kubernetes_pod_node_name"},
+			TargetLabel:  "instance",
+			Replacement:  "$1:" + nodeExporterPortName,
+		},
+	}
+	return []*promconfig.ScrapeConfig{
+		{
+			JobName:                 "node-exporter/metrics",
+			ServiceDiscoveryConfigs: discoveryCfgs,
+			ScrapeInterval:          interval,
+			MetricsPath:             "/metrics",
+			RelabelConfigs:          relabelCfgs,
+		},
+	}, nil
+}
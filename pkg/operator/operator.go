@@ -15,10 +15,17 @@
 package operator
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net"
 	"path/filepath"
 	"strconv"
@@ -30,14 +37,15 @@ import (
 	arv1 "k8s.io/api/admissionregistration/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	runtimeutil "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/util/cert"
 	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -68,6 +76,10 @@ const (
 	LabelAppName = "app.kubernetes.io/name"
 	// The component name, will be exposed as metric name.
 	AnnotationMetricName = "components.gke.io/component-name"
+	// AnnotationPaused suspends reconciliation of the annotated resource when
+	// set to "true", e.g. to hand-patch a managed workload during an incident
+	// without the operator reverting the change.
+	AnnotationPaused = "monitoring.googleapis.com/paused"
 	// ClusterAutoscalerSafeEvictionLabel is the annotation label that determines
 	// whether the cluster autoscaler can safely evict a Pod when the Pod doesn't
 	// satisfy certain eviction criteria.
@@ -85,11 +97,17 @@ type Operator struct {
 	opts    Options
 	client  client.Client
 	manager manager.Manager
+	metrics *operatorMetrics
 	// Due to the RBAC, the manager can only handle a single namespace per
 	// object at a time so this cache is used in cases where we want the same
 	// resource from multiple namespaces (not to be confused with cluster-wide
 	// resources).
 	managedNamespacesCache cache.Cache
+
+	// State of the webhook serving certificates, used for rotation and
+	// hot-reloading from a Secret.
+	lastCertRefresh   time.Time
+	certData, keyData []byte
 }
 
 // Options for the Operator.
@@ -115,6 +133,77 @@ type Options struct {
 	ListenAddr string
 	// Cleanup resources without this annotation.
 	CleanupAnnotKey string
+	// Whether to run leader election so that only a single replica acts at a
+	// time while others are on standby for fast failover.
+	LeaderElection bool
+	// Lifetime of self-signed webhook certificates generated by the operator.
+	CertValidity time.Duration
+	// Interval at which generated webhook certificates are rotated.
+	// Zero disables rotation.
+	CertRotation time.Duration
+	// Name of a Secret in the operator namespace from which webhook serving
+	// certificates are read and hot-reloaded on change. Takes precedence over
+	// generated and flag-provided certificates.
+	TLSSecretName string
+	// Namespaces from which PodMonitoring and Rules resources are considered.
+	// An empty list means all namespaces.
+	AllowedNamespaces []string
+	// Namespaces from which PodMonitoring and Rules resources are ignored.
+	// Takes precedence over AllowedNamespaces.
+	DeniedNamespaces []string
+	// Directory from which the operator installs and upgrades its own CRDs at
+	// startup. Empty leaves CRD management to out-of-band installation.
+	CRDsDir string
+	// Whether to translate prometheus-operator PodMonitor and ServiceMonitor
+	// resources into PodMonitorings.
+	PrometheusOperatorCompat bool
+	// Whether to roll out new collector configuration to the canary collectors
+	// first and only promote it fleet-wide after they stay healthy for the
+	// soak duration.
+	CollectorCanary bool
+	// How long new collector configuration soaks on the canary collectors
+	// before fleet-wide promotion.
+	CanarySoakDuration time.Duration
+	// Minimum interval between writes of the generated collector
+	// configuration. Changes arriving within the interval are coalesced into
+	// a single write to debounce collector config reloads.
+	ConfigReloadInterval time.Duration
+	// Whether to run without admission webhooks, e.g. on clusters where the
+	// control plane cannot reach webhook servers on workload nodes. Validation
+	// and defaulting are then applied during reconciliation and validation
+	// errors surface as status conditions instead of admission rejections.
+	DisableWebhooks bool
+	// Experimental capabilities toggled via the --feature-gates flag.
+	FeatureGates FeatureGates
+	// Estimated number of active series above which admission of a
+	// PodMonitoring or ClusterPodMonitoring returns a warning. A negative
+	// value disables the warning, zero applies the default threshold.
+	SeriesWarnThreshold int
+}
+
+// isPaused reports whether reconciliation of the given resource is suspended
+// via the pause annotation.
+func isPaused(obj metav1.Object) bool {
+	return obj.GetAnnotations()[AnnotationPaused] == "true"
+}
+
+// namespaceAllowed reports whether resources in the given namespace are
+// considered by the operator under the configured allow- and denylists.
+func (o *Options) namespaceAllowed(ns string) bool {
+	for _, denied := range o.DeniedNamespaces {
+		if ns == denied {
+			return false
+		}
+	}
+	if len(o.AllowedNamespaces) == 0 {
+		return true
+	}
+	for _, allowed := range o.AllowedNamespaces {
+		if ns == allowed {
+			return true
+		}
+	}
+	return false
 }
 
 func (o *Options) defaultAndValidate(logger logr.Logger) error {
@@ -128,6 +217,29 @@ func (o *Options) defaultAndValidate(logger logr.Logger) error {
 		o.PublicNamespace = DefaultOperatorNamespace
 	}
 
+	if o.CertValidity == 0 {
+		o.CertValidity = 365 * 24 * time.Hour
+	}
+	if o.CanarySoakDuration == 0 {
+		o.CanarySoakDuration = 10 * time.Minute
+	}
+	if o.ConfigReloadInterval == 0 {
+		o.ConfigReloadInterval = 30 * time.Second
+	}
+	if o.SeriesWarnThreshold == 0 {
+		o.SeriesWarnThreshold = 100000
+	}
+	if o.FeatureGates == nil {
+		o.FeatureGates, _ = ParseFeatureGates("")
+	}
+	// Feature gates subsume the dedicated flags for experimental features.
+	if o.FeatureGates.Enabled(FeaturePrometheusOperatorCompat) {
+		o.PrometheusOperatorCompat = true
+	}
+	if o.FeatureGates.Enabled(FeatureCollectorConfigCanary) {
+		o.CollectorCanary = true
+	}
+
 	// ProjectID and Cluster must be always be set. Collectors and rule-evaluator can
 	// auto-discover them but we need them in the operator to scope generated rules.
 	if o.ProjectID == "" {
@@ -158,6 +270,9 @@ func New(logger logr.Logger, clientConfig *rest.Config, registry prometheus.Regi
 	if err := monitoringv1.AddToScheme(sc); err != nil {
 		return nil, errors.Wrap(err, "add monitoringv1 scheme")
 	}
+	if err := apiextensionsv1.AddToScheme(sc); err != nil {
+		return nil, errors.Wrap(err, "add apiextensionsv1 scheme")
+	}
 	host, portStr, err := net.SplitHostPort(opts.ListenAddr)
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid listen address")
@@ -173,6 +288,16 @@ func New(logger logr.Logger, clientConfig *rest.Config, registry prometheus.Regi
 		// Don't run a metrics server with the manager. Metrics are being served
 		// explicitly in the main routine.
 		MetricsBindAddress: "0",
+		// Leader election so the operator Deployment can run with multiple
+		// replicas without double-reconciling. The webhook server keeps serving
+		// on all replicas as it is read-only.
+		LeaderElection:          opts.LeaderElection,
+		LeaderElectionID:        NameOperator,
+		LeaderElectionNamespace: opts.OperatorNamespace,
+		// Periodically re-run all reconciles even without change events so that
+		// manual edits to managed workloads and generated configuration are
+		// reverted.
+		SyncPeriod: &resyncPeriod,
 		// Manage cluster-wide and namespace resources at the same time.
 		NewCache: cache.NewCacheFunc(func(config *rest.Config, options cache.Options) (cache.Cache, error) {
 			return cache.New(clientConfig, cache.Options{
@@ -255,6 +380,7 @@ func New(logger logr.Logger, clientConfig *rest.Config, registry prometheus.Regi
 		client:                 client,
 		manager:                manager,
 		managedNamespacesCache: managedNamespacesCache,
+		metrics:                newOperatorMetrics(registry),
 	}
 	return op, nil
 }
@@ -263,28 +389,39 @@ func New(logger logr.Logger, clientConfig *rest.Config, registry prometheus.Regi
 // custom resources and registers handlers with the webhook server.
 func (o *Operator) setupAdmissionWebhooks(ctx context.Context) error {
 	// Write provided cert files.
-	caBundle, err := o.ensureCerts(ctx, o.manager.GetWebhookServer().CertDir)
+	certDir := o.manager.GetWebhookServer().CertDir
+	caBundle, err := o.ensureCerts(ctx, certDir)
 	if err != nil {
 		return err
 	}
 
-	// Keep setting the caBundle in the expected webhook configurations.
+	// Keep the serving certificates fresh and set the caBundle in the expected
+	// webhook configurations. The webhook server watches the certificate files
+	// and picks up changes transparently.
 	go func() {
-		// Only inject if we've an explicit CA bundle ourselves. Otherwise the webhook configs
-		// may already have been created with one.
-		if len(caBundle) == 0 {
-			return
-		}
 		// Initial sleep for the client to initialize before our first calls.
 		// Ideally we could explicitly wait for it.
 		time.Sleep(5 * time.Second)
 
 		for {
-			if err := o.setValidatingWebhookCABundle(ctx, caBundle); err != nil {
-				o.logger.Error(err, "Setting CA bundle for ValidatingWebhookConfiguration failed")
+			b, err := o.refreshCerts(ctx, certDir)
+			if err != nil {
+				o.logger.Error(err, "Refreshing webhook certificates failed")
+			} else if b != nil {
+				caBundle = b
 			}
-			if err := o.setMutatingWebhookCABundle(ctx, caBundle); err != nil {
-				o.logger.Error(err, "Setting CA bundle for MutatingWebhookConfiguration failed")
+			if err := o.ensureWebhookConfigs(ctx, caBundle); err != nil {
+				o.logger.Error(err, "Ensuring webhook configurations failed")
+			}
+			// Only inject if we've an explicit CA bundle ourselves. Otherwise the webhook configs
+			// may already have been created with one.
+			if len(caBundle) > 0 {
+				if err := o.setValidatingWebhookCABundle(ctx, caBundle); err != nil {
+					o.logger.Error(err, "Setting CA bundle for ValidatingWebhookConfiguration failed")
+				}
+				if err := o.setMutatingWebhookCABundle(ctx, caBundle); err != nil {
+					o.logger.Error(err, "Setting CA bundle for MutatingWebhookConfiguration failed")
+				}
 			}
 			select {
 			case <-ctx.Done():
@@ -296,14 +433,21 @@ func (o *Operator) setupAdmissionWebhooks(ctx context.Context) error {
 
 	s := o.manager.GetWebhookServer()
 
-	// Validating webhooks.
+	kubeClient, err := kubernetes.NewForConfig(o.manager.GetConfig())
+	if err != nil {
+		return errors.Wrap(err, "build Kubernetes clientset")
+	}
+
+	// Validating webhooks. The PodMonitoring handlers additionally estimate
+	// the series count the object will produce and attach a warning to the
+	// admission response if it exceeds the configured threshold.
 	s.Register(
 		validatePath(monitoringv1.PodMonitoringResource()),
-		admission.ValidatingWebhookFor(&monitoringv1.PodMonitoring{}),
+		&admission.Webhook{Handler: &podMonitoringAdmission{kubeClient: kubeClient, opts: o.opts}},
 	)
 	s.Register(
 		validatePath(monitoringv1.ClusterPodMonitoringResource()),
-		admission.ValidatingWebhookFor(&monitoringv1.ClusterPodMonitoring{}),
+		&admission.Webhook{Handler: &clusterPodMonitoringAdmission{kubeClient: kubeClient, opts: o.opts}},
 	)
 	s.Register(
 		validatePath(monitoringv1.OperatorConfigResource()),
@@ -311,6 +455,10 @@ func (o *Operator) setupAdmissionWebhooks(ctx context.Context) error {
 			namespace: o.opts.PublicNamespace,
 		}),
 	)
+	s.Register(
+		validatePath(monitoringv1.CollectionOverrideResource()),
+		admission.WithCustomValidator(&monitoringv1.CollectionOverride{}, &collectionOverrideValidator{}),
+	)
 	s.Register(
 		validatePath(monitoringv1.RulesResource()),
 		admission.WithCustomValidator(&monitoringv1.Rules{}, &rulesValidator{
@@ -345,10 +493,15 @@ func (o *Operator) setupAdmissionWebhooks(ctx context.Context) error {
 func (o *Operator) Run(ctx context.Context) error {
 	defer runtimeutil.HandleCrash()
 
+	if err := o.ensureCRDs(ctx); err != nil {
+		return errors.Wrap(err, "ensure CRDs")
+	}
 	if err := o.cleanupOldResources(ctx); err != nil {
 		return errors.Wrap(err, "cleanup old resources")
 	}
-	if err := o.setupAdmissionWebhooks(ctx); err != nil {
+	if o.opts.DisableWebhooks {
+		o.logger.Info("admission webhooks disabled, validating during reconciliation")
+	} else if err := o.setupAdmissionWebhooks(ctx); err != nil {
 		return errors.Wrap(err, "init admission resources")
 	}
 	if err := setupCollectionControllers(o); err != nil {
@@ -360,12 +513,33 @@ func (o *Operator) Run(ctx context.Context) error {
 	if err := setupOperatorConfigControllers(o); err != nil {
 		return errors.Wrap(err, "setup rule-evaluator controllers")
 	}
+	if err := setupGrafanaSyncControllers(o); err != nil {
+		return errors.Wrap(err, "setup grafana datasource sync controllers")
+	}
+	if err := setupDashboardControllers(o); err != nil {
+		return errors.Wrap(err, "setup dashboard controllers")
+	}
+	if o.opts.PrometheusOperatorCompat {
+		if ok, err := o.prometheusOperatorCRDsInstalled(ctx); err != nil {
+			return errors.Wrap(err, "check prometheus-operator CRDs")
+		} else if !ok {
+			o.logger.Info("prometheus-operator CRDs not installed, compatibility controllers disabled")
+		} else if err := setupPrometheusOperatorControllers(o); err != nil {
+			return errors.Wrap(err, "setup prometheus-operator compatibility controllers")
+		}
+	}
 
 	o.logger.Info("starting GMP operator")
 
 	go func() {
 		o.managedNamespacesCache.Start(ctx)
 	}()
+	go o.runGarbageCollection(ctx)
+	go o.runSizingRecommendations(ctx)
+	go o.runCardinalityReports(ctx)
+	if o.opts.FeatureGates.Enabled(FeatureScrapeHealthMetrics) {
+		go o.runScrapeHealthReports(ctx)
+	}
 	return o.manager.Start(ctx)
 }
 
@@ -428,7 +602,12 @@ func (o *Operator) ensureCerts(ctx context.Context, dir string) ([]byte, error)
 		crt, key, caData []byte
 		err              error
 	)
-	if o.opts.TLSKey != "" && o.opts.TLSCert != "" {
+	if o.opts.TLSSecretName != "" {
+		crt, key, caData, err = o.readCertsFromSecret(ctx)
+		if err != nil {
+			return nil, err
+		}
+	} else if o.opts.TLSKey != "" && o.opts.TLSCert != "" {
 		crt, err = base64.StdEncoding.DecodeString(o.opts.TLSCert)
 		if err != nil {
 			return nil, errors.Wrap(err, "decoding TLS certificate")
@@ -444,16 +623,15 @@ func (o *Operator) ensureCerts(ctx context.Context, dir string) ([]byte, error)
 			}
 		}
 	} else if o.opts.TLSKey == "" && o.opts.TLSCert == "" && o.opts.CACert == "" {
-		// Generate a self-signed pair if none was explicitly provided. It will be valid
-		// for 1 year.
-		// TODO(freinartz): re-generate at runtime and update the ValidatingWebhookConfiguration
-		// at runtime whenever the files change.
+		// Generate a self-signed pair if none was explicitly provided. It will be
+		// valid for the configured lifetime and optionally rotated at runtime.
 		fqdn := fmt.Sprintf("%s.%s.svc", NameOperator, o.opts.OperatorNamespace)
 
-		crt, key, err = cert.GenerateSelfSignedCertKey(fqdn, nil, nil)
+		crt, key, err = generateSelfSignedCertKey(fqdn, o.opts.CertValidity)
 		if err != nil {
 			return nil, errors.Wrap(err, "generate self-signed TLS key pair")
 		}
+		o.lastCertRefresh = time.Now()
 		// Use crt as the ca in the the self-sign case.
 		caData = crt
 	} else {
@@ -466,9 +644,107 @@ func (o *Operator) ensureCerts(ctx context.Context, dir string) ([]byte, error)
 	if err := ioutil.WriteFile(filepath.Join(dir, "tls.key"), key, 0666); err != nil {
 		return nil, errors.Wrap(err, "create key file")
 	}
+	o.certData, o.keyData = crt, key
 	return caData, nil
 }
 
+// refreshCerts renews the serving certificates if they are due for rotation or
+// the providing Secret changed. It returns the new CA bundle if the files were
+// rewritten and nil otherwise.
+func (o *Operator) refreshCerts(ctx context.Context, dir string) ([]byte, error) {
+	switch {
+	case o.opts.TLSSecretName != "":
+		crt, key, caData, err := o.readCertsFromSecret(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(crt, o.certData) && bytes.Equal(key, o.keyData) {
+			return nil, nil
+		}
+		if err := o.writeCertFiles(dir, crt, key); err != nil {
+			return nil, err
+		}
+		o.logger.Info("webhook serving certificate reloaded from Secret", "secret", o.opts.TLSSecretName)
+		return caData, nil
+
+	case o.opts.TLSKey == "" && o.opts.TLSCert == "":
+		if o.opts.CertRotation <= 0 || time.Since(o.lastCertRefresh) < o.opts.CertRotation {
+			return nil, nil
+		}
+		fqdn := fmt.Sprintf("%s.%s.svc", NameOperator, o.opts.OperatorNamespace)
+
+		crt, key, err := generateSelfSignedCertKey(fqdn, o.opts.CertValidity)
+		if err != nil {
+			return nil, errors.Wrap(err, "generate self-signed TLS key pair")
+		}
+		if err := o.writeCertFiles(dir, crt, key); err != nil {
+			return nil, err
+		}
+		o.lastCertRefresh = time.Now()
+		o.logger.Info("webhook serving certificate rotated")
+		return crt, nil
+	}
+	return nil, nil
+}
+
+// readCertsFromSecret reads the webhook serving certificate, key, and optional
+// CA from the configured Secret in the operator namespace.
+func (o *Operator) readCertsFromSecret(ctx context.Context) (crt, key, caData []byte, err error) {
+	var secret corev1.Secret
+	if err := o.client.Get(ctx, client.ObjectKey{
+		Namespace: o.opts.OperatorNamespace,
+		Name:      o.opts.TLSSecretName,
+	}, &secret); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "get TLS secret")
+	}
+	crt, key = secret.Data["tls.crt"], secret.Data["tls.key"]
+	if len(crt) == 0 || len(key) == 0 {
+		return nil, nil, nil, errors.Errorf("TLS secret %q must contain keys tls.crt and tls.key", o.opts.TLSSecretName)
+	}
+	// The CA may be omitted if the webhook configurations are provisioned with
+	// a CA bundle externally.
+	caData = secret.Data["ca.crt"]
+	return crt, key, caData, nil
+}
+
+func (o *Operator) writeCertFiles(dir string, crt, key []byte) error {
+	if err := ioutil.WriteFile(filepath.Join(dir, "tls.crt"), crt, 0666); err != nil {
+		return errors.Wrap(err, "create cert file")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "tls.key"), key, 0666); err != nil {
+		return errors.Wrap(err, "create key file")
+	}
+	o.certData, o.keyData = crt, key
+	return nil
+}
+
+// generateSelfSignedCertKey creates a self-signed certificate and key for the
+// given host with the provided lifetime.
+func generateSelfSignedCertKey(host string, validity time.Duration) ([]byte, []byte, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().Unix()),
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("%s@%d", host, time.Now().Unix())},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(validity),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{host},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	crt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	return crt, key, nil
+}
+
 // namespacedNamePredicate is an event filter predicate that only allows events with
 // a single object.
 type namespacedNamePredicate struct {
@@ -19,9 +19,11 @@ import (
 	"fmt"
 	"net/url"
 	"path"
+	"sort"
 	"strings"
 
 	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+	"github.com/alecthomas/units"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	promcommonconfig "github.com/prometheus/common/config"
@@ -39,6 +41,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -50,10 +53,13 @@ import (
 // Base resource names which may be used for multiple different resource kinds
 // related to the given component.
 const (
-	NameOperatorConfig = "config"
-	NameRuleEvaluator  = "rule-evaluator"
-	NameCollector      = "collector"
-	NameAlertmanager   = "alertmanager"
+	NameOperatorConfig  = "config"
+	NameRuleEvaluator   = "rule-evaluator"
+	NameCollector       = "collector"
+	NameAlertmanager    = "alertmanager"
+	NamePushGateway     = "push-gateway"
+	NameExporterSidecar = "export-sidecar"
+	NameOTLPReceiver    = "otlp-receiver"
 )
 
 const (
@@ -63,10 +69,18 @@ const (
 	AlertmanagerPublicSecretName = "alertmanager"
 	AlertmanagerPublicSecretKey  = "alertmanager.yaml"
 	rulesDir                     = "/etc/rules"
-	secretsDir                   = "/etc/secrets"
+	secretsDir                   = monitoringv1.SecretsDir
 	alertmanagerConfigKey        = "config.yaml"
+	// Name of the volume projecting the rules secret shards into the
+	// rule-evaluator pod.
+	rulesSecretVolumeName = "rules-secret"
 )
 
+// maxRulesSecretSize is the maximum payload size per rules Secret shard. It
+// stays well below the 1MiB limit on Secret objects to leave headroom for
+// metadata and encoding overhead.
+const maxRulesSecretSize = 512 * 1024
+
 var alertmanagerNoOpConfig = `
 receivers:
   - name: "noop"
@@ -118,11 +132,14 @@ func setupOperatorConfigControllers(op *Operator) error {
 		namespace: op.opts.OperatorNamespace,
 		name:      NameRuleEvaluator,
 	}
-	// Rule-evaluator secret filter.
-	objFilterRuleEvaluatorSecret := namespacedNamePredicate{
-		namespace: op.opts.OperatorNamespace,
-		name:      RulesSecretName,
-	}
+	// Rule-evaluator secret filter, covering all rules Secret shards.
+	objFilterRuleEvaluatorSecret := predicate.NewPredicateFuncs(func(object client.Object) bool {
+		if object.GetNamespace() != op.opts.OperatorNamespace {
+			return false
+		}
+		name := object.GetName()
+		return name == RulesSecretName || strings.HasPrefix(name, RulesSecretName+"-")
+	})
 	// Rule-evaluator secret filter.
 	objFilterAlertManagerSecret := namespacedNamePredicate{
 		namespace: op.opts.OperatorNamespace,
@@ -145,11 +162,19 @@ func setupOperatorConfigControllers(op *Operator) error {
 				objFilterRuleEvaluator,
 				predicate.GenerationChangedPredicate{},
 			)).
+		// User-provided Secrets and ConfigMaps in the public namespace may be
+		// referenced from the OperatorConfig. Reconcile on changes so rotated
+		// credentials propagate without manual restarts.
 		Watches(
 			source.NewKindWithCache(&corev1.Secret{}, op.managedNamespacesCache),
 			enqueueConst(objRequest),
 			builder.WithPredicates(predicate.NewPredicateFuncs(secretFilter(op.opts.PublicNamespace))),
 		).
+		Watches(
+			source.NewKindWithCache(&corev1.ConfigMap{}, op.managedNamespacesCache),
+			enqueueConst(objRequest),
+			builder.WithPredicates(predicate.NewPredicateFuncs(configMapFilter(op.opts.PublicNamespace))),
+		).
 		// Detect and undo changes to the secret.
 		Watches(
 			source.NewKindWithCache(&corev1.Secret{}, op.managedNamespacesCache),
@@ -159,7 +184,7 @@ func setupOperatorConfigControllers(op *Operator) error {
 			source.NewKindWithCache(&corev1.Secret{}, op.managedNamespacesCache),
 			enqueueConst(objRequest),
 			builder.WithPredicates(objFilterAlertManagerSecret)).
-		Complete(newOperatorConfigReconciler(op.manager.GetClient(), op.opts))
+		Complete(newOperatorConfigReconciler(op.manager.GetClient(), op.managedNamespacesCache, op.opts, op.manager.GetEventRecorderFor(NameOperator)))
 
 	if err != nil {
 		return errors.Wrap(err, "operator-config controller")
@@ -177,17 +202,34 @@ func secretFilter(ns string) func(object client.Object) bool {
 	}
 }
 
+// configMapFilter filters by non-default ConfigMaps in specified namespace.
+func configMapFilter(ns string) func(object client.Object) bool {
+	return func(object client.Object) bool {
+		if object.GetNamespace() == ns {
+			return object.GetName() != "kube-root-ca.crt"
+		}
+		return false
+	}
+}
+
 // operatorConfigReconciler reconciles the OperatorConfig CRD.
 type operatorConfigReconciler struct {
 	client client.Client
-	opts   Options
+	// Reader against the operator and public namespaces for resolving
+	// user-provided Secret and ConfigMap references, which the cache of the
+	// default client does not cover.
+	reader   client.Reader
+	opts     Options
+	recorder record.EventRecorder
 }
 
 // newOperatorConfigReconciler creates a new operatorConfigReconciler.
-func newOperatorConfigReconciler(c client.Client, opts Options) *operatorConfigReconciler {
+func newOperatorConfigReconciler(c client.Client, reader client.Reader, opts Options, recorder record.EventRecorder) *operatorConfigReconciler {
 	return &operatorConfigReconciler{
-		client: c,
-		opts:   opts,
+		client:   c,
+		reader:   reader,
+		opts:     opts,
+		recorder: recorder,
 	}
 }
 
@@ -204,29 +246,313 @@ func (r *operatorConfigReconciler) Reconcile(ctx context.Context, req reconcile.
 	} else if err != nil {
 		return reconcile.Result{}, errors.Wrapf(err, "get operatorconfig for incoming: %q", req.String())
 	}
+	if isPaused(config) {
+		logger.Info("reconciliation paused via annotation")
+		return reconcile.Result{}, nil
+	}
+
+	recErr := r.reconcile(ctx, config)
+
+	// Surface the outcome as a standardized status condition so tooling can
+	// assess the operator's health from the OperatorConfig resource.
+	if config.Name != "" {
+		cond := metav1.Condition{
+			Type:   monitoringv1.ReconcileSuccess,
+			Status: metav1.ConditionTrue,
+			Reason: monitoringv1.ReasonReconciled,
+		}
+		if recErr != nil {
+			cond = metav1.Condition{
+				Type:    monitoringv1.ReconcileSuccess,
+				Status:  metav1.ConditionFalse,
+				Reason:  monitoringv1.ReasonReconcileError,
+				Message: recErr.Error(),
+			}
+		}
+		if change, err := config.Status.SetMonitoringCondition(config.Generation, metav1.Now(), cond); err != nil {
+			logger.Error(err, "setting operatorconfig status state")
+		} else if change {
+			if err := r.client.Status().Update(ctx, config); err != nil {
+				logger.Error(err, "update operatorconfig status")
+			}
+		}
+	}
+
+	return reconcile.Result{}, recErr
+}
+
+// reconcile ensures all resources the operator derives from the OperatorConfig.
+func (r *operatorConfigReconciler) reconcile(ctx context.Context, config *monitoringv1.OperatorConfig) error {
 	// Ensure the rule-evaluator config and grab any to-be-mirrored
 	// secret data on the way.
 	secretData, err := r.ensureRuleEvaluatorConfig(ctx, &config.Rules)
 	if err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "ensure rule-evaluator config")
+		// Emit an event so failures show up in kubectl describe on the
+		// OperatorConfig rather than only in operator logs.
+		r.recorder.Eventf(config, corev1.EventTypeWarning, monitoringv1.ReasonReconcileError, "ensure rule-evaluator config: %s", err)
+		return errors.Wrap(err, "ensure rule-evaluator config")
 	}
 
-	if err := r.ensureAlertmanagerConfigSecret(ctx, config.ManagedAlertmanager); err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "ensure alertmanager config secret")
+	if err := r.ensureAlertmanagerConfigSecret(ctx, config); err != nil {
+		r.recorder.Eventf(config, corev1.EventTypeWarning, monitoringv1.ReasonReconcileError, "ensure alertmanager config secret: %s", err)
+		return errors.Wrap(err, "ensure alertmanager config secret")
 	}
 
 	// Mirror the fetched secret data to where the rule-evaluator can
 	// mount and access.
-	if err := r.ensureRuleEvaluatorSecrets(ctx, secretData); err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "ensure rule-evaluator secrets")
+	secretNames, err := r.ensureRuleEvaluatorSecrets(ctx, secretData)
+	if err != nil {
+		r.recorder.Eventf(config, corev1.EventTypeWarning, monitoringv1.ReasonReconcileError, "ensure rule-evaluator secrets: %s", err)
+		return errors.Wrap(err, "ensure rule-evaluator secrets")
 	}
 
 	// Ensure the rule-evaluator deployment and volume mounts.
-	if err := r.ensureRuleEvaluatorDeployment(ctx, &config.Rules); err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "ensure rule-evaluator deploy")
+	if err := r.ensureRuleEvaluatorDeployment(ctx, config, secretNames); err != nil {
+		r.recorder.Eventf(config, corev1.EventTypeWarning, monitoringv1.ReasonReconcileError, "ensure rule-evaluator deployment: %s", err)
+		return errors.Wrap(err, "ensure rule-evaluator deploy")
+	}
+
+	// Scale and configure the optional push-gateway deployment.
+	if err := r.ensurePushGatewayDeployment(ctx, config.ManagedPushGateway); err != nil {
+		r.recorder.Eventf(config, corev1.EventTypeWarning, monitoringv1.ReasonReconcileError, "ensure push-gateway deployment: %s", err)
+		return errors.Wrap(err, "ensure push-gateway deploy")
+	}
+
+	// Scale and configure the optional standalone exporter deployment.
+	if err := r.ensureExporterSidecarDeployment(ctx, config.ManagedExporter); err != nil {
+		r.recorder.Eventf(config, corev1.EventTypeWarning, monitoringv1.ReasonReconcileError, "ensure exporter deployment: %s", err)
+		return errors.Wrap(err, "ensure exporter deploy")
+	}
+
+	// Scale the optional managed OTLP receiver deployment.
+	if err := r.ensureOTLPReceiverDeployment(ctx, config.ManagedOTLPReceiver); err != nil {
+		r.recorder.Eventf(config, corev1.EventTypeWarning, monitoringv1.ReasonReconcileError, "ensure otlp-receiver deployment: %s", err)
+		return errors.Wrap(err, "ensure otlp-receiver deploy")
 	}
 
-	return reconcile.Result{}, nil
+	// Apply the proxy settings to the managed workloads that are not otherwise
+	// reconciled from the OperatorConfig. The collector and rule-evaluator
+	// receive them through their own reconciliation above.
+	if err := r.ensureWorkloadProxyConfig(ctx, config.Proxy); err != nil {
+		r.recorder.Eventf(config, corev1.EventTypeWarning, monitoringv1.ReasonReconcileError, "ensure proxy configuration: %s", err)
+		return errors.Wrap(err, "ensure proxy configuration")
+	}
+
+	return nil
+}
+
+// ensureWorkloadProxyConfig patches the proxy environment and trusted CA
+// mount into the alertmanager StatefulSet and the operator's own Deployment.
+// When the operator's own environment changes, Kubernetes restarts it and the
+// new settings take effect with the replacement pod.
+func (r *operatorConfigReconciler) ensureWorkloadProxyConfig(ctx context.Context, proxy *monitoringv1.ProxyConfig) error {
+	logger, _ := logr.FromContext(ctx)
+
+	var sset appsv1.StatefulSet
+	err := r.client.Get(ctx, client.ObjectKey{Namespace: r.opts.OperatorNamespace, Name: NameAlertmanager}, &sset)
+	switch {
+	case apierrors.IsNotFound(err):
+		// The managed alertmanager may deliberately not be installed.
+	case err != nil:
+		return errors.Wrap(err, "get alertmanager statefulset")
+	case isPaused(&sset):
+		logger.Info("alertmanager StatefulSet paused via annotation, skipping update")
+	default:
+		patch, err := proxyPodSpecPatch(proxy, &sset.Spec.Template.Spec)
+		if err != nil {
+			return errors.Wrap(err, "build alertmanager proxy patch")
+		}
+		if patch != nil {
+			if err := r.client.Patch(ctx, &sset, client.RawPatch(types.StrategicMergePatchType, patch)); err != nil {
+				return errors.Wrap(err, "patch alertmanager statefulset")
+			}
+		}
+	}
+
+	var deploy appsv1.Deployment
+	err = r.client.Get(ctx, client.ObjectKey{Namespace: r.opts.OperatorNamespace, Name: NameOperator}, &deploy)
+	switch {
+	case apierrors.IsNotFound(err):
+		// E.g. when running the operator from outside the cluster.
+	case err != nil:
+		return errors.Wrap(err, "get operator deployment")
+	case isPaused(&deploy):
+		logger.Info("operator Deployment paused via annotation, skipping update")
+	default:
+		patch, err := proxyPodSpecPatch(proxy, &deploy.Spec.Template.Spec)
+		if err != nil {
+			return errors.Wrap(err, "build operator proxy patch")
+		}
+		if patch != nil {
+			if err := r.client.Patch(ctx, &deploy, client.RawPatch(types.StrategicMergePatchType, patch)); err != nil {
+				return errors.Wrap(err, "patch operator deployment")
+			}
+		}
+	}
+	return nil
+}
+
+// ensurePushGatewayDeployment configures the push-gateway Deployment according
+// to the given spec. The Deployment is kept at zero replicas unless the
+// component is enabled.
+func (r *operatorConfigReconciler) ensurePushGatewayDeployment(ctx context.Context, spec *monitoringv1.PushGatewaySpec) error {
+	logger, _ := logr.FromContext(ctx)
+
+	var deploy appsv1.Deployment
+	err := r.client.Get(ctx, client.ObjectKey{Namespace: r.opts.OperatorNamespace, Name: NamePushGateway}, &deploy)
+	// The push-gateway is opt-in and its manifests may deliberately not be
+	// installed. Only emit a log line if it was enabled regardless.
+	if apierrors.IsNotFound(err) {
+		if spec != nil && spec.Enabled {
+			logger.Error(err, "push-gateway enabled but its Deployment does not exist")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if isPaused(&deploy) {
+		logger.Info("push-gateway Deployment paused via annotation, skipping update")
+		return nil
+	}
+
+	var replicas int32
+	var flags []string
+	if spec != nil && spec.Enabled {
+		replicas = 1
+		if spec.TTL != "" {
+			flags = append(flags, fmt.Sprintf("--push.ttl=%q", spec.TTL))
+		}
+	}
+
+	// Apply only the replica count and EXTRA_ARGS env var, which are the
+	// fields the operator manages on the push-gateway.
+	apply := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.opts.OperatorNamespace,
+			Name:      NamePushGateway,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: deploy.Spec.Selector,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "push-gateway",
+						Env: []corev1.EnvVar{
+							{Name: "EXTRA_ARGS", Value: strings.Join(flags, " ")},
+						},
+					}},
+				},
+			},
+		},
+	}
+	return errors.Wrap(applyObject(ctx, r.client, apply), "apply push-gateway deployment")
+}
+
+// ensureExporterSidecarDeployment configures the standalone exporter
+// Deployment according to the given spec. The Deployment is kept at zero
+// replicas unless the component is enabled.
+func (r *operatorConfigReconciler) ensureExporterSidecarDeployment(ctx context.Context, spec *monitoringv1.ExporterSidecarSpec) error {
+	logger, _ := logr.FromContext(ctx)
+
+	var deploy appsv1.Deployment
+	err := r.client.Get(ctx, client.ObjectKey{Namespace: r.opts.OperatorNamespace, Name: NameExporterSidecar}, &deploy)
+	// The exporter is opt-in and its manifests, including the storage volume
+	// of the tailed Prometheus server, may deliberately not be installed.
+	// Only emit a log line if it was enabled regardless.
+	if apierrors.IsNotFound(err) {
+		if spec != nil && spec.Enabled {
+			logger.Error(err, "exporter enabled but its Deployment does not exist")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if isPaused(&deploy) {
+		logger.Info("exporter Deployment paused via annotation, skipping update")
+		return nil
+	}
+
+	var replicas int32
+	var flags []string
+	if spec != nil && spec.Enabled {
+		replicas = 1
+		if spec.StoragePath != "" {
+			flags = append(flags, fmt.Sprintf("--prometheus.storage-path=%q", spec.StoragePath))
+		}
+		if spec.Endpoint != "" {
+			flags = append(flags, fmt.Sprintf("--prometheus.endpoint=%q", spec.Endpoint))
+		}
+	}
+
+	// Apply only the replica count and EXTRA_ARGS env var, which are the
+	// fields the operator manages on the exporter.
+	apply := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.opts.OperatorNamespace,
+			Name:      NameExporterSidecar,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: deploy.Spec.Selector,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: NameExporterSidecar,
+						Env: []corev1.EnvVar{
+							{Name: "EXTRA_ARGS", Value: strings.Join(flags, " ")},
+						},
+					}},
+				},
+			},
+		},
+	}
+	return errors.Wrap(applyObject(ctx, r.client, apply), "apply exporter deployment")
+}
+
+// ensureOTLPReceiverDeployment configures the OTLP receiver Deployment
+// according to the given spec. The Deployment is kept at zero replicas unless
+// the component is enabled.
+func (r *operatorConfigReconciler) ensureOTLPReceiverDeployment(ctx context.Context, spec *monitoringv1.OTLPReceiverSpec) error {
+	logger, _ := logr.FromContext(ctx)
+
+	var deploy appsv1.Deployment
+	err := r.client.Get(ctx, client.ObjectKey{Namespace: r.opts.OperatorNamespace, Name: NameOTLPReceiver}, &deploy)
+	// The OTLP receiver is opt-in and its manifests may deliberately not be
+	// installed. Only emit a log line if it was enabled regardless.
+	if apierrors.IsNotFound(err) {
+		if spec != nil && spec.Enabled {
+			logger.Error(err, "OTLP receiver enabled but its Deployment does not exist")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if isPaused(&deploy) {
+		logger.Info("otlp-receiver Deployment paused via annotation, skipping update")
+		return nil
+	}
+
+	var replicas int32
+	if spec != nil && spec.Enabled {
+		replicas = 1
+	}
+	// Apply only the replica count, which is the only field the operator
+	// manages on the OTLP receiver.
+	apply := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.opts.OperatorNamespace,
+			Name:      NameOTLPReceiver,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: deploy.Spec.Selector,
+		},
+	}
+	return errors.Wrap(applyObject(ctx, r.client, apply), "apply otlp-receiver deployment")
 }
 
 // ensureRuleEvaluatorConfig reconciles the config for rule-evaluator.
@@ -237,12 +563,8 @@ func (r *operatorConfigReconciler) ensureRuleEvaluatorConfig(ctx context.Context
 	}
 
 	// Upsert rule-evaluator config.
-	if err := r.client.Update(ctx, cfg); apierrors.IsNotFound(err) {
-		if err := r.client.Create(ctx, cfg); err != nil {
-			return nil, errors.Wrap(err, "create rule-evaluator config")
-		}
-	} else if err != nil {
-		return nil, errors.Wrap(err, "update rule-evaluator config")
+	if err := applyObject(ctx, r.client, cfg); err != nil {
+		return nil, errors.Wrap(err, "apply rule-evaluator config")
 	}
 	return secretData, nil
 }
@@ -257,7 +579,7 @@ func (r *operatorConfigReconciler) makeRuleEvaluatorConfig(ctx context.Context,
 	}
 	if spec.Credentials != nil {
 		p := pathForSelector(r.opts.PublicNamespace, &monitoringv1.SecretOrConfigMap{Secret: spec.Credentials})
-		b, err := getSecretKeyBytes(ctx, r.client, r.opts.PublicNamespace, spec.Credentials)
+		b, err := getSecretKeyBytes(ctx, r.reader, r.opts.PublicNamespace, spec.Credentials)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "get service account credentials")
 		}
@@ -291,34 +613,101 @@ func (r *operatorConfigReconciler) makeRuleEvaluatorConfig(ctx context.Context,
 	return cm, secretData, nil
 }
 
-// ensureRuleEvaluatorSecrets reconciles the Secrets for rule-evaluator.
-func (r *operatorConfigReconciler) ensureRuleEvaluatorSecrets(ctx context.Context, data map[string][]byte) error {
-	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        RulesSecretName,
-			Namespace:   r.opts.OperatorNamespace,
-			Annotations: componentAnnotations(),
-			Labels:      rulesLabels(),
-		},
-		Data: make(map[string][]byte),
+// rulesSecretShardName returns the name of the i-th rules Secret shard. The
+// first shard retains the plain RulesSecretName for compatibility with
+// existing installations.
+func rulesSecretShardName(i int) string {
+	if i == 0 {
+		return RulesSecretName
 	}
-	for f, b := range data {
-		secret.Data[f] = b
+	return fmt.Sprintf("%s-%d", RulesSecretName, i)
+}
+
+// rulesSecretShards splits the given secret data into shards of bounded size
+// so large installations do not hit the 1MiB limit on Secret objects. Keys
+// are assigned in sorted order, so the same input always yields the same
+// sharding. All shards are projected into a single directory in the
+// rule-evaluator, keeping file paths independent of which shard holds a key.
+func rulesSecretShards(data map[string][]byte) []map[string][]byte {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	shards := []map[string][]byte{{}}
+	var size int
+	for _, k := range keys {
+		if size > 0 && size+len(data[k]) > maxRulesSecretSize {
+			shards = append(shards, map[string][]byte{})
+			size = 0
+		}
+		shards[len(shards)-1][k] = data[k]
+		size += len(data[k])
 	}
+	return shards
+}
 
-	if err := r.client.Update(ctx, secret); apierrors.IsNotFound(err) {
-		if err := r.client.Create(ctx, secret); err != nil {
-			return errors.Wrap(err, "create rule-evaluator secrets")
+// ensureRuleEvaluatorSecrets reconciles the Secrets for rule-evaluator and
+// returns the names of the Secret shards holding the data.
+func (r *operatorConfigReconciler) ensureRuleEvaluatorSecrets(ctx context.Context, data map[string][]byte) ([]string, error) {
+	shards := rulesSecretShards(data)
+
+	names := make([]string, 0, len(shards))
+	for i, shard := range shards {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        rulesSecretShardName(i),
+				Namespace:   r.opts.OperatorNamespace,
+				Annotations: componentAnnotations(),
+				Labels:      rulesLabels(),
+			},
+			Data: shard,
 		}
-	} else if err != nil {
-		return errors.Wrap(err, "update rule-evaluator secrets")
+		if err := applyObject(ctx, r.client, secret); err != nil {
+			return nil, errors.Wrap(err, "apply rule-evaluator secrets")
+		}
+		names = append(names, secret.Name)
+	}
+	// Delete left-over shards from a previously larger sharding. Shards are
+	// named sequentially, so stop at the first one that doesn't exist.
+	for i := len(shards); ; i++ {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      rulesSecretShardName(i),
+				Namespace: r.opts.OperatorNamespace,
+			},
+		}
+		if err := r.client.Delete(ctx, secret); apierrors.IsNotFound(err) {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "delete stale rule-evaluator secret shard")
+		}
+	}
+	return names, nil
+}
+
+// validateAlertmanagerConfig checks that the given Alertmanager configuration
+// can be loaded. It does not replicate the full validation logic embedded in
+// the Alertmanager binary but catches configurations that are certain to make
+// it crash-loop, i.e. broken YAML and a missing root route.
+func validateAlertmanagerConfig(b []byte) error {
+	var cfg struct {
+		Route map[string]interface{} `yaml:"route"`
+	}
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return errors.Wrap(err, "parse YAML")
+	}
+	if len(cfg.Route) == 0 {
+		return errors.New("root route must be set")
 	}
 	return nil
 }
 
 // ensureAlertmanagerConfigSecret copies the managed Alertmanager config secret from gmp-public
-func (r *operatorConfigReconciler) ensureAlertmanagerConfigSecret(ctx context.Context, spec *monitoringv1.ManagedAlertmanagerSpec) error {
+func (r *operatorConfigReconciler) ensureAlertmanagerConfigSecret(ctx context.Context, config *monitoringv1.OperatorConfig) error {
 	logger, _ := logr.FromContext(ctx)
+	spec := config.ManagedAlertmanager
 	pubNamespace := r.opts.PublicNamespace
 
 	// This is the default, no-op secret config. If we find a user-defined config,
@@ -350,7 +739,7 @@ func (r *operatorConfigReconciler) ensureAlertmanagerConfigSecret(ctx context.Co
 	}
 
 	// Try and read the secret for use.
-	b, err := getSecretKeyBytes(ctx, r.client, pubNamespace, sel)
+	b, err := getSecretKeyBytes(ctx, r.reader, pubNamespace, sel)
 	if err != nil {
 		if !apierrors.IsNotFound(err) {
 			return err
@@ -359,25 +748,66 @@ func (r *operatorConfigReconciler) ensureAlertmanagerConfigSecret(ctx context.Co
 		// (ie, to disable managed AM), so we will continue with restoring the no-op config
 		// so that the managed AM pod doesn't crash loop.
 		logger.Info(fmt.Sprintf("alertmanager config secret not found in namespace %s: %s", pubNamespace, err.Error()))
+	} else if verr := validateAlertmanagerConfig(b); verr != nil {
+		// A config that does not load would leave Alertmanager crash-looping
+		// with no alert routing at all. Surface the error and keep serving
+		// the previous working config instead of distributing the broken one.
+		// The no-op config only applies if no config was distributed before.
+		logger.Error(verr, "invalid alertmanager config, keeping previous config")
+		r.recorder.Eventf(config, corev1.EventTypeWarning, monitoringv1.ReasonConfigInvalid,
+			"invalid Alertmanager config in secret %s/%s: %s", pubNamespace, sel.Name, verr)
+		r.setAlertmanagerConfigCondition(ctx, config, metav1.Condition{
+			Type:    monitoringv1.AlertmanagerConfigValid,
+			Status:  metav1.ConditionFalse,
+			Reason:  monitoringv1.ReasonConfigInvalid,
+			Message: verr.Error(),
+		})
+		var prev corev1.Secret
+		err := r.client.Get(ctx, client.ObjectKey{Namespace: r.opts.OperatorNamespace, Name: AlertmanagerSecretName}, &prev)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrap(err, "get previous alertmanager config secret")
+		}
+		if err == nil && len(prev.Data[alertmanagerConfigKey]) > 0 {
+			secret.Data[alertmanagerConfigKey] = prev.Data[alertmanagerConfigKey]
+		}
 	} else {
 		secret.Data[alertmanagerConfigKey] = b
+		r.setAlertmanagerConfigCondition(ctx, config, metav1.Condition{
+			Type:   monitoringv1.AlertmanagerConfigValid,
+			Status: metav1.ConditionTrue,
+			Reason: monitoringv1.ReasonConfigValid,
+		})
 	}
 
-	if err := r.client.Update(ctx, secret); apierrors.IsNotFound(err) {
-		if err := r.client.Create(ctx, secret); err != nil {
-			return errors.Wrap(err, "create alertmanager config secret")
+	return errors.Wrap(applyObject(ctx, r.client, secret), "apply alertmanager config secret")
+}
+
+// setAlertmanagerConfigCondition merges the given condition into the
+// OperatorConfig status and writes it back if it changed. Status update
+// failures are logged rather than returned as they must not block
+// distribution of the config secret.
+func (r *operatorConfigReconciler) setAlertmanagerConfigCondition(ctx context.Context, config *monitoringv1.OperatorConfig, cond metav1.Condition) {
+	logger, _ := logr.FromContext(ctx)
+
+	if config.Name == "" {
+		return
+	}
+	if change, err := config.Status.SetMonitoringCondition(config.Generation, metav1.Now(), cond); err != nil {
+		logger.Error(err, "setting operatorconfig status state")
+	} else if change {
+		if err := r.client.Status().Update(ctx, config); err != nil {
+			logger.Error(err, "update operatorconfig status")
 		}
-	} else if err != nil {
-		return errors.Wrap(err, "update alertmanager config secret")
 	}
-
-	return nil
 }
 
 // ensureRuleEvaluatorDeployment reconciles the Deployment for rule-evaluator.
-func (r *operatorConfigReconciler) ensureRuleEvaluatorDeployment(ctx context.Context, spec *monitoringv1.RuleEvaluatorSpec) error {
+// secretNames are the rules Secret shards to project into the secrets volume.
+func (r *operatorConfigReconciler) ensureRuleEvaluatorDeployment(ctx context.Context, config *monitoringv1.OperatorConfig, secretNames []string) error {
 	logger, _ := logr.FromContext(ctx)
 
+	spec, proxy := &config.Rules, config.Proxy
+
 	var deploy appsv1.Deployment
 	err := r.client.Get(ctx, client.ObjectKey{Namespace: r.opts.OperatorNamespace, Name: NameRuleEvaluator}, &deploy)
 	// Some users deliberately not want to run the rule-evaluator. Only emit a warning but don't cause
@@ -389,6 +819,10 @@ func (r *operatorConfigReconciler) ensureRuleEvaluatorDeployment(ctx context.Con
 	if err != nil {
 		return err
 	}
+	if isPaused(&deploy) {
+		logger.Info("rule-evaluator Deployment paused via annotation, skipping update")
+		return nil
+	}
 
 	var projectID, location, cluster = resolveLabels(r.opts, spec.ExternalLabels)
 
@@ -414,26 +848,91 @@ func (r *operatorConfigReconciler) ensureRuleEvaluatorDeployment(ctx context.Con
 	if spec.GeneratorURL != "" {
 		flags = append(flags, fmt.Sprintf("--query.generator-url=%q", spec.GeneratorURL))
 	}
+	if spec.QueryEndpoint != "" {
+		targetURL := fmt.Sprintf("%s/v1/projects/%s/location/global/prometheus", strings.TrimSuffix(spec.QueryEndpoint, "/"), queryProjectID)
+		flags = append(flags, fmt.Sprintf("--query.target-url=%q", targetURL))
+	}
+	if spec.ExportEndpoint != "" {
+		flags = append(flags, fmt.Sprintf("--export.endpoint=%q", spec.ExportEndpoint))
+	}
 
-	// Set EXTRA_ARGS envvar in evaluator container.
-	for i, c := range deploy.Spec.Template.Spec.Containers {
-		if c.Name != "evaluator" {
-			continue
-		}
-		var repl []corev1.EnvVar
+	// Declare only the parts of the evaluator container the operator manages.
+	// Server-side apply merges them into the Deployment, leaving fields set by
+	// the manifests or other controllers untouched. Entries the operator
+	// previously applied but no longer declares, e.g. a removed extra mount,
+	// are cleaned up along the way.
+	evaluator := corev1.Container{
+		Name: "evaluator",
+		Env: append([]corev1.EnvVar{
+			{Name: "EXTRA_ARGS", Value: strings.Join(flags, " ")},
+		}, proxyEnv(proxy)...),
+	}
 
-		for _, ev := range c.Env {
-			if ev.Name != "EXTRA_ARGS" {
-				repl = append(repl, ev)
-			}
+	// Project all rules Secret shards into the single secrets volume so the
+	// mirrored secret data appears under stable file paths regardless of
+	// which shard holds a given key.
+	defaultMode := int32(420)
+	var sources []corev1.VolumeProjection
+	for _, name := range secretNames {
+		sources = append(sources, corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			},
+		})
+	}
+	volumes := []corev1.Volume{{
+		Name: rulesSecretVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources:     sources,
+				DefaultMode: &defaultMode,
+			},
+		},
+	}}
+	for _, m := range spec.ExtraMounts {
+		vol, mount, err := extraMountVolume(m)
+		if err != nil {
+			return err
 		}
-		repl = append(repl, corev1.EnvVar{Name: "EXTRA_ARGS", Value: strings.Join(flags, " ")})
-
-		deploy.Spec.Template.Spec.Containers[i].Env = repl
+		volumes = append(volumes, vol)
+		evaluator.VolumeMounts = append(evaluator.VolumeMounts, mount)
+	}
+	if vol, mount, ok := proxyCAVolume(proxy); ok {
+		volumes = append(volumes, vol)
+		evaluator.VolumeMounts = append(evaluator.VolumeMounts, mount)
 	}
 
-	// Upsert rule-evaluator Deployment.
-	return r.client.Update(ctx, &deploy)
+	apply := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.opts.OperatorNamespace,
+			Name:      NameRuleEvaluator,
+		},
+		Spec: appsv1.DeploymentSpec{
+			// The selector field has no omitempty tag and would be serialized
+			// as an explicit null, so mirror the immutable live value.
+			Selector: deploy.Spec.Selector,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{evaluator},
+					Volumes:    volumes,
+				},
+			},
+		},
+	}
+	// Resolve the apply with a dry-run first and report the resulting pod
+	// template diff so unexpected rule-evaluator rollouts are traceable to
+	// the OperatorConfig change that caused them.
+	dry := apply.DeepCopy()
+	if err := applyObject(ctx, r.client, dry, client.DryRunAll); err != nil {
+		return errors.Wrap(err, "dry-run rule-evaluator deployment apply")
+	}
+	if diff := podTemplateDiff(deploy.Spec.Template, dry.Spec.Template); diff != "" {
+		logger.Info("updating rule-evaluator Deployment",
+			"diff", diff, "operatorconfig-generation", config.Generation)
+		r.recorder.Eventf(config, corev1.EventTypeNormal, "WorkloadUpdate",
+			"rule-evaluator Deployment pods change with OperatorConfig generation %d:\n%s", config.Generation, truncateDiff(diff))
+	}
+	return errors.Wrap(applyObject(ctx, r.client, apply), "apply rule-evaluator deployment")
 }
 
 // makeAlertmanagerConfigs creates the alertmanager_config entries as described in
@@ -498,7 +997,7 @@ func (r *operatorConfigReconciler) makeAlertmanagerConfigs(ctx context.Context,
 				Type: am.Authorization.Type,
 			}
 			if c := am.Authorization.Credentials; c != nil {
-				b, err := getSecretKeyBytes(ctx, r.client, r.opts.PublicNamespace, c)
+				b, err := getSecretKeyBytes(ctx, r.reader, r.opts.PublicNamespace, c)
 				if err != nil {
 					return nil, nil, err
 				}
@@ -516,7 +1015,7 @@ func (r *operatorConfigReconciler) makeAlertmanagerConfigs(ctx context.Context,
 			}
 			if am.TLS.CA != nil {
 				p := pathForSelector(r.opts.PublicNamespace, am.TLS.CA)
-				b, err := getSecretOrConfigMapBytes(ctx, r.client, r.opts.PublicNamespace, am.TLS.CA)
+				b, err := getSecretOrConfigMapBytes(ctx, r.reader, r.opts.PublicNamespace, am.TLS.CA)
 				if err != nil {
 					return nil, nil, err
 				}
@@ -525,7 +1024,7 @@ func (r *operatorConfigReconciler) makeAlertmanagerConfigs(ctx context.Context,
 			}
 			if am.TLS.Cert != nil {
 				p := pathForSelector(r.opts.PublicNamespace, am.TLS.Cert)
-				b, err := getSecretOrConfigMapBytes(ctx, r.client, r.opts.PublicNamespace, am.TLS.Cert)
+				b, err := getSecretOrConfigMapBytes(ctx, r.reader, r.opts.PublicNamespace, am.TLS.Cert)
 				if err != nil {
 					return nil, nil, err
 				}
@@ -534,7 +1033,7 @@ func (r *operatorConfigReconciler) makeAlertmanagerConfigs(ctx context.Context,
 			}
 			if am.TLS.KeySecret != nil {
 				p := pathForSelector(r.opts.PublicNamespace, &monitoringv1.SecretOrConfigMap{Secret: am.TLS.KeySecret})
-				b, err := getSecretKeyBytes(ctx, r.client, r.opts.PublicNamespace, am.TLS.KeySecret)
+				b, err := getSecretKeyBytes(ctx, r.reader, r.opts.PublicNamespace, am.TLS.KeySecret)
 				if err != nil {
 					return nil, nil, err
 				}
@@ -675,16 +1174,7 @@ func getConfigMapKeyBytes(ctx context.Context, kClient client.Reader, namespace
 // pathForSelector cretes the filepath for the provided NamespacedSecretOrConfigMap.
 // This can be used to avoid naming collisions of like-keys across K8s resources.
 func pathForSelector(namespace string, scm *monitoringv1.SecretOrConfigMap) string {
-	if scm == nil {
-		return ""
-	}
-	if scm.ConfigMap != nil {
-		return fmt.Sprintf("%s_%s_%s_%s", "configmap", namespace, scm.ConfigMap.Name, scm.ConfigMap.Key)
-	}
-	if scm.Secret != nil {
-		return fmt.Sprintf("%s_%s_%s_%s", "secret", namespace, scm.Secret.Name, scm.Secret.Key)
-	}
-	return ""
+	return monitoringv1.PathForSelector(namespace, scm)
 }
 
 type operatorConfigValidator struct {
@@ -700,11 +1190,66 @@ func (v *operatorConfigValidator) ValidateCreate(ctx context.Context, o runtime.
 	if _, err := makeKubeletScrapeConfigs(oc.Collection.KubeletScraping); err != nil {
 		return errors.Wrap(err, "failed to create kubelet scrape config")
 	}
+	if cp := oc.Collection.ControlPlaneScraping; cp != nil {
+		if _, err := prommodel.ParseDuration(cp.Interval); err != nil {
+			return errors.Wrap(err, "invalid control plane scrape interval")
+		}
+		if _, err := selectorKeepRelabels(cp.MatchOneOf, "__tmp_control_plane_match"); err != nil {
+			return errors.Wrap(err, "failed to create control plane scrape config")
+		}
+	}
+	if ksm := oc.Collection.KubeStateMetrics; ksm != nil {
+		if _, err := prommodel.ParseDuration(ksm.Interval); err != nil {
+			return errors.Wrap(err, "invalid kube-state-metrics scrape interval")
+		}
+	}
+	if ne := oc.Collection.NodeExporter; ne != nil {
+		if _, err := prommodel.ParseDuration(ne.Interval); err != nil {
+			return errors.Wrap(err, "invalid node-exporter scrape interval")
+		}
+	}
+	if ls := oc.Collection.LocalStorage; ls != nil {
+		if ls.Retention != "" {
+			if _, err := prommodel.ParseDuration(ls.Retention); err != nil {
+				return errors.Wrap(err, "invalid local storage retention")
+			}
+		}
+		if ls.RetentionSize != "" {
+			if _, err := units.ParseBase2Bytes(ls.RetentionSize); err != nil {
+				return errors.Wrap(err, "invalid local storage retention size")
+			}
+		}
+	}
 	if oc.Rules.GeneratorURL != "" {
 		if _, err := url.Parse(oc.Rules.GeneratorURL); err != nil {
 			return errors.Wrap(err, "failed to parse generator URL")
 		}
 	}
+	if oc.Rules.QueryEndpoint != "" {
+		u, err := url.Parse(oc.Rules.QueryEndpoint)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse query endpoint")
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.Errorf("query endpoint must be an http(s) URL but got %q", oc.Rules.QueryEndpoint)
+		}
+	}
+	// Export endpoints are gRPC targets in host:port form rather than URLs.
+	for _, ep := range []string{oc.Collection.ExportEndpoint, oc.Rules.ExportEndpoint} {
+		if strings.Contains(ep, "://") {
+			return errors.Errorf("export endpoint must be of form host:port but got %q", ep)
+		}
+	}
+	seen := map[string]bool{}
+	for _, b := range oc.Collection.NamespaceBudgets {
+		if b.Namespace == "" {
+			return errors.New("namespace budget must specify a namespace")
+		}
+		if seen[b.Namespace] {
+			return errors.Errorf("duplicate namespace budget for namespace %q", b.Namespace)
+		}
+		seen[b.Namespace] = true
+	}
 	return nil
 }
 
@@ -90,6 +90,97 @@ func TestOperatorConfigValidator(t *testing.T) {
 			},
 			err: `invalid scrape interval: empty duration string`,
 		},
+		{
+			desc: "bad control plane interval",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Collection: monitoringv1.CollectionSpec{
+					ControlPlaneScraping: &monitoringv1.ControlPlaneScraping{
+						Interval: "xyz",
+					},
+				},
+			},
+			err: `invalid control plane scrape interval: not a valid duration string: "xyz"`,
+		},
+		{
+			desc: "bad control plane matcher",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Collection: monitoringv1.CollectionSpec{
+					ControlPlaneScraping: &monitoringv1.ControlPlaneScraping{
+						Interval:   "30s",
+						MatchOneOf: []string{`{foo!="bar"}`},
+					},
+				},
+			},
+			err: `negated matcher "foo!=\"bar\"" in filter "{foo!=\"bar\"}" is not supported`,
+		},
+		{
+			desc: "bad kube-state-metrics interval",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Collection: monitoringv1.CollectionSpec{
+					KubeStateMetrics: &monitoringv1.KubeStateMetricsSpec{
+						Interval: "xyz",
+					},
+				},
+			},
+			err: `invalid kube-state-metrics scrape interval: not a valid duration string: "xyz"`,
+		},
+		{
+			desc: "bad node-exporter interval",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Collection: monitoringv1.CollectionSpec{
+					NodeExporter: &monitoringv1.NodeExporterSpec{
+						Interval: "xyz",
+					},
+				},
+			},
+			err: `invalid node-exporter scrape interval: not a valid duration string: "xyz"`,
+		},
+		{
+			desc: "bad local storage retention",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Collection: monitoringv1.CollectionSpec{
+					LocalStorage: &monitoringv1.LocalStorageSpec{
+						Retention: "xyz",
+					},
+				},
+			},
+			err: `invalid local storage retention: not a valid duration string: "xyz"`,
+		},
+		{
+			desc: "bad local storage retention size",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Collection: monitoringv1.CollectionSpec{
+					LocalStorage: &monitoringv1.LocalStorageSpec{
+						RetentionSize: "512XB",
+					},
+				},
+			},
+			err: `invalid local storage retention size`,
+		},
 		{
 			desc: "bad generator URL",
 			oc: &monitoringv1.OperatorConfig{
@@ -103,6 +194,63 @@ func TestOperatorConfigValidator(t *testing.T) {
 			},
 			err: `failed to parse generator URL: parse "~:://example.com": first path segment in URL cannot contain colon`,
 		},
+		{
+			desc: "bad query endpoint",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Rules: monitoringv1.RuleEvaluatorSpec{
+					QueryEndpoint: "us-central1-monitoring.googleapis.com",
+				},
+			},
+			err: `query endpoint must be an http(s) URL but got "us-central1-monitoring.googleapis.com"`,
+		},
+		{
+			desc: "bad export endpoint",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Collection: monitoringv1.CollectionSpec{
+					ExportEndpoint: "https://us-central1-monitoring.googleapis.com",
+				},
+			},
+			err: `export endpoint must be of form host:port but got "https://us-central1-monitoring.googleapis.com"`,
+		},
+		{
+			desc: "namespace budget without namespace",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Collection: monitoringv1.CollectionSpec{
+					NamespaceBudgets: []monitoringv1.NamespaceBudget{
+						{SampleLimit: 1000},
+					},
+				},
+			},
+			err: `namespace budget must specify a namespace`,
+		},
+		{
+			desc: "duplicate namespace budget",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Collection: monitoringv1.CollectionSpec{
+					NamespaceBudgets: []monitoringv1.NamespaceBudget{
+						{Namespace: "ns1", SampleLimit: 1000},
+						{Namespace: "ns1", MaxSeries: 50000},
+					},
+				},
+			},
+			err: `duplicate namespace budget for namespace "ns1"`,
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.desc, func(t *testing.T) {
@@ -119,3 +267,66 @@ func TestOperatorConfigValidator(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateAlertmanagerConfig(t *testing.T) {
+	valid := `
+receivers:
+  - name: default
+route:
+  receiver: default
+`
+	if err := validateAlertmanagerConfig([]byte(valid)); err != nil {
+		t.Fatalf("unexpected error for valid config: %s", err)
+	}
+	if err := validateAlertmanagerConfig([]byte(alertmanagerNoOpConfig)); err != nil {
+		t.Fatalf("unexpected error for no-op config: %s", err)
+	}
+	if err := validateAlertmanagerConfig([]byte("receivers: [\n")); err == nil {
+		t.Error("expected error for broken YAML")
+	}
+	if err := validateAlertmanagerConfig([]byte("receivers:\n  - name: default\n")); err == nil {
+		t.Error("expected error for missing route")
+	}
+}
+
+func TestRulesSecretShards(t *testing.T) {
+	big := func(c byte) []byte {
+		b := make([]byte, maxRulesSecretSize/2+1)
+		for i := range b {
+			b[i] = c
+		}
+		return b
+	}
+	data := map[string][]byte{
+		"a": big('a'),
+		"b": big('b'),
+		"c": big('c'),
+		"d": []byte("small"),
+	}
+	shards := rulesSecretShards(data)
+	if len(shards) != 3 {
+		t.Fatalf("expected 3 shards, got %d", len(shards))
+	}
+	// Keys are assigned in sorted order, fitting "d" alongside "c".
+	for i, want := range [][]string{{"a"}, {"b"}, {"c", "d"}} {
+		if len(shards[i]) != len(want) {
+			t.Fatalf("unexpected keys in shard %d: %v", i, shards[i])
+		}
+		for _, k := range want {
+			if _, ok := shards[i][k]; !ok {
+				t.Fatalf("expected key %q in shard %d", k, i)
+			}
+		}
+	}
+	// Empty data still yields the first shard so the mounted Secret exists.
+	if shards := rulesSecretShards(nil); len(shards) != 1 || len(shards[0]) != 0 {
+		t.Fatalf("expected single empty shard, got %v", shards)
+	}
+
+	if name := rulesSecretShardName(0); name != RulesSecretName {
+		t.Fatalf("expected first shard to be named %q, got %q", RulesSecretName, name)
+	}
+	if name := rulesSecretShardName(2); name != RulesSecretName+"-2" {
+		t.Fatalf("unexpected shard name %q", name)
+	}
+}
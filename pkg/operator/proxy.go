@@ -0,0 +1,168 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"encoding/json"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// proxyCAVolumeName is the name of the volume holding the trusted CA
+	// bundle of the OperatorConfig's proxy settings.
+	proxyCAVolumeName = "gmp-proxy-ca"
+	proxyCAMountPath  = "/etc/gmp-proxy"
+	proxyCAFileName   = "ca.crt"
+)
+
+// proxyEnvNames are the environment variables managed through the proxy
+// settings of the OperatorConfig.
+var proxyEnvNames = map[string]bool{
+	"HTTP_PROXY":    true,
+	"HTTPS_PROXY":   true,
+	"NO_PROXY":      true,
+	"SSL_CERT_FILE": true,
+}
+
+// proxyEnv returns the environment variables for the given proxy settings.
+func proxyEnv(p *monitoringv1.ProxyConfig) []corev1.EnvVar {
+	if p == nil {
+		return nil
+	}
+	var env []corev1.EnvVar
+	if p.HTTPProxy != "" {
+		env = append(env, corev1.EnvVar{Name: "HTTP_PROXY", Value: p.HTTPProxy})
+	}
+	httpsProxy := p.HTTPSProxy
+	if httpsProxy == "" {
+		httpsProxy = p.HTTPProxy
+	}
+	if httpsProxy != "" {
+		env = append(env, corev1.EnvVar{Name: "HTTPS_PROXY", Value: httpsProxy})
+	}
+	if p.NoProxy != "" {
+		env = append(env, corev1.EnvVar{Name: "NO_PROXY", Value: p.NoProxy})
+	}
+	if p.TrustedCA != nil {
+		env = append(env, corev1.EnvVar{Name: "SSL_CERT_FILE", Value: path.Join(proxyCAMountPath, proxyCAFileName)})
+	}
+	return env
+}
+
+// proxyCAVolume returns the volume and read-only mount for the trusted CA
+// bundle. The selected key is projected under a fixed file name so the
+// SSL_CERT_FILE path is independent of the ConfigMap layout.
+func proxyCAVolume(p *monitoringv1.ProxyConfig) (corev1.Volume, corev1.VolumeMount, bool) {
+	if p == nil || p.TrustedCA == nil {
+		return corev1.Volume{}, corev1.VolumeMount{}, false
+	}
+	vol := corev1.Volume{
+		Name: proxyCAVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: p.TrustedCA.LocalObjectReference,
+				Items: []corev1.KeyToPath{
+					{Key: p.TrustedCA.Key, Path: proxyCAFileName},
+				},
+			},
+		},
+	}
+	mount := corev1.VolumeMount{
+		Name:      proxyCAVolumeName,
+		ReadOnly:  true,
+		MountPath: proxyCAMountPath,
+	}
+	return vol, mount, true
+}
+
+// proxyEnvPatch returns the strategic merge patch entries reconciling the
+// proxy environment of a container, including delete directives for
+// previously injected variables that are no longer configured.
+func proxyEnvPatch(p *monitoringv1.ProxyConfig, container *corev1.Container) []interface{} {
+	var entries []interface{}
+	declared := map[string]bool{}
+	for _, ev := range proxyEnv(p) {
+		declared[ev.Name] = true
+		entries = append(entries, map[string]interface{}{"name": ev.Name, "value": ev.Value})
+	}
+	for _, ev := range container.Env {
+		if proxyEnvNames[ev.Name] && !declared[ev.Name] {
+			entries = append(entries, map[string]interface{}{"name": ev.Name, "$patch": "delete"})
+		}
+	}
+	return entries
+}
+
+// proxyPodSpecPatch builds a strategic merge patch applying the proxy
+// environment and trusted CA mount to every container of the given pod spec.
+// A nil config removes previously injected entries.
+func proxyPodSpecPatch(p *monitoringv1.ProxyConfig, podSpec *corev1.PodSpec) ([]byte, error) {
+	vol, mount, hasCA := proxyCAVolume(p)
+
+	var containers []interface{}
+	for i := range podSpec.Containers {
+		c := &podSpec.Containers[i]
+		entry := map[string]interface{}{"name": c.Name}
+		if env := proxyEnvPatch(p, c); len(env) > 0 {
+			entry["env"] = env
+		}
+		var mounts []interface{}
+		if hasCA {
+			mounts = append(mounts, mount)
+		}
+		for _, m := range c.VolumeMounts {
+			if m.Name == proxyCAVolumeName && !hasCA {
+				mounts = append(mounts, map[string]interface{}{"mountPath": m.MountPath, "$patch": "delete"})
+			}
+		}
+		if len(mounts) > 0 {
+			entry["volumeMounts"] = mounts
+		}
+		if len(entry) > 1 {
+			containers = append(containers, entry)
+		}
+	}
+	var volumes []interface{}
+	if hasCA {
+		volumes = append(volumes, vol)
+	}
+	for _, v := range podSpec.Volumes {
+		if v.Name == proxyCAVolumeName && !hasCA {
+			volumes = append(volumes, map[string]interface{}{"name": v.Name, "$patch": "delete"})
+		}
+	}
+
+	specPatch := map[string]interface{}{}
+	if len(containers) > 0 {
+		specPatch["containers"] = containers
+	}
+	if len(volumes) > 0 {
+		specPatch["volumes"] = volumes
+	}
+	if len(specPatch) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": specPatch,
+			},
+		},
+	})
+}
@@ -0,0 +1,460 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// Names of the service accounts the shipped manifests create for the managed
+// workloads. The generated role bindings reference them.
+const (
+	serviceAccountOperator  = "operator"
+	serviceAccountCollector = "collector"
+)
+
+// referencedKinds captures which kinds of user-provided configuration data
+// the resources of a manifest bundle reference. It determines whether the
+// operator needs read access to Secrets and ConfigMaps in the public
+// namespace at all.
+type referencedKinds struct {
+	secrets    bool
+	configMaps bool
+}
+
+// addSelector records the kind referenced by the given selector.
+func (rk *referencedKinds) addSelector(scm *monitoringv1.SecretOrConfigMap) {
+	if scm == nil {
+		return
+	}
+	if scm.Secret != nil {
+		rk.secrets = true
+	}
+	if scm.ConfigMap != nil {
+		rk.configMaps = true
+	}
+}
+
+// addTLS records the kinds referenced by the given TLS settings.
+func (rk *referencedKinds) addTLS(tls *monitoringv1.TLSConfig) {
+	if tls == nil {
+		return
+	}
+	rk.addSelector(tls.CA)
+	rk.addSelector(tls.Cert)
+	if tls.KeySecret != nil {
+		rk.secrets = true
+	}
+}
+
+// addEndpoints records the kinds referenced by the given scrape endpoints.
+func (rk *referencedKinds) addEndpoints(eps []monitoringv1.ScrapeEndpoint) {
+	for i := range eps {
+		rk.addTLS(eps[i].TLS)
+	}
+}
+
+// addOperatorConfig records the kinds referenced by the given OperatorConfig.
+func (rk *referencedKinds) addOperatorConfig(config *monitoringv1.OperatorConfig) {
+	if config.Rules.Credentials != nil {
+		rk.secrets = true
+	}
+	for i := range config.Rules.Alerting.Alertmanagers {
+		am := &config.Rules.Alerting.Alertmanagers[i]
+		if am.Authorization != nil && am.Authorization.Credentials != nil {
+			rk.secrets = true
+		}
+		rk.addTLS(am.TLS)
+	}
+	// The managed Alertmanager reads its configuration from a Secret in the
+	// public namespace, by default name if none is specified.
+	if config.ManagedAlertmanager != nil {
+		rk.secrets = true
+	}
+}
+
+// GenerateRBACFromFiles emits the minimal RBAC manifests the operator and
+// collector need for the monitoring configuration in the given YAML manifest
+// files, taking the enabled feature gates in opts into account. Permissions
+// for unused capabilities — such as reading Secrets in the public namespace
+// when no resource references any — are omitted, which security-sensitive
+// installations can use in place of the full default RBAC manifests.
+//
+// The generated rules cover the configuration as given. Adding resources that
+// use further capabilities later requires regenerating and reapplying them.
+func GenerateRBACFromFiles(w io.Writer, opts Options, files ...string) error {
+	// Only the namespaces matter for RBAC generation, so the full option
+	// validation with its cluster identification requirements does not apply.
+	if opts.OperatorNamespace == "" {
+		opts.OperatorNamespace = DefaultOperatorNamespace
+	}
+	if opts.PublicNamespace == "" {
+		opts.PublicNamespace = DefaultPublicNamespace
+	}
+	bundle, err := loadResources(files...)
+	if err != nil {
+		return err
+	}
+	var config monitoringv1.OperatorConfig
+	if n := len(bundle.operatorConfigs); n > 0 {
+		config = bundle.operatorConfigs[n-1]
+	}
+
+	var refs referencedKinds
+	refs.addOperatorConfig(&config)
+	for i := range bundle.podMons {
+		refs.addEndpoints(bundle.podMons[i].Spec.Endpoints)
+	}
+	for i := range bundle.clusterPodMons {
+		refs.addEndpoints(bundle.clusterPodMons[i].Spec.Endpoints)
+	}
+
+	objs := []runtime.Object{
+		collectorClusterRole(opts, &config),
+		operatorRole(opts),
+		operatorPublicRole(opts, refs),
+		operatorClusterRole(opts),
+	}
+	objs = append(objs, rbacBindings(opts)...)
+
+	for i, obj := range objs {
+		b, err := sigsyaml.Marshal(obj)
+		if err != nil {
+			return errors.Wrap(err, "marshal RBAC manifest")
+		}
+		if i > 0 {
+			fmt.Fprintln(w, "---")
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rbacTypeMeta returns the type metadata for the given RBAC kind so that the
+// marshalled manifests are self-contained.
+func rbacTypeMeta(kind string) metav1.TypeMeta {
+	return metav1.TypeMeta{
+		APIVersion: rbacv1.SchemeGroupVersion.String(),
+		Kind:       kind,
+	}
+}
+
+// collectorClusterRole returns the discovery and scrape permissions of the
+// collectors, restricted to what the given configuration uses.
+func collectorClusterRole(opts Options, config *monitoringv1.OperatorConfig) *rbacv1.ClusterRole {
+	role := &rbacv1.ClusterRole{
+		TypeMeta: rbacTypeMeta("ClusterRole"),
+		ObjectMeta: metav1.ObjectMeta{
+			Name: opts.OperatorNamespace + ":" + serviceAccountCollector,
+		},
+		Rules: []rbacv1.PolicyRule{
+			// Pod discovery for PodMonitoring and ClusterPodMonitoring targets.
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"configmaps"},
+				Verbs:     []string{"get"},
+			},
+		},
+	}
+	if config.Collection.KubeletScraping != nil {
+		role.Rules = append(role.Rules,
+			rbacv1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"nodes", "nodes/metrics"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+			rbacv1.PolicyRule{
+				NonResourceURLs: []string{"/metrics"},
+				Verbs:           []string{"get"},
+			},
+		)
+	}
+	// The rule-evaluator discovers Alertmanager endpoints through the
+	// Kubernetes API.
+	if config.ManagedAlertmanager != nil || len(config.Rules.Alerting.Alertmanagers) > 0 {
+		role.Rules = append(role.Rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"endpoints", "services"},
+			Verbs:     []string{"get", "list", "watch"},
+		})
+	}
+	return role
+}
+
+// operatorRole returns the permissions of the operator in its own namespace,
+// which are independent of the monitoring configuration.
+func operatorRole(opts Options) *rbacv1.Role {
+	return &rbacv1.Role{
+		TypeMeta: rbacTypeMeta("Role"),
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: opts.OperatorNamespace,
+			Name:      serviceAccountOperator,
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"secrets"},
+				Verbs:     []string{"list", "watch", "create"},
+			},
+			// The generated rules config is sharded across a dynamic number of
+			// Secrets, so write access cannot be pinned to fixed resource names.
+			{
+				APIGroups: []string{""},
+				Resources: []string{"secrets"},
+				Verbs:     []string{"get", "delete", "patch", "update"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"configmaps"},
+				Verbs:     []string{"list", "watch", "create"},
+			},
+			{
+				APIGroups:     []string{""},
+				Resources:     []string{"configmaps"},
+				ResourceNames: []string{NameCollector, NameRuleEvaluator, NameRulesGenerated, NameOperator},
+				Verbs:         []string{"get", "patch", "update"},
+			},
+			// Leader-election lock resources for the --leader-election flag.
+			{
+				APIGroups: []string{"coordination.k8s.io"},
+				Resources: []string{"leases"},
+				Verbs:     []string{"create"},
+			},
+			{
+				APIGroups:     []string{"coordination.k8s.io"},
+				Resources:     []string{"leases"},
+				ResourceNames: []string{NameOperator},
+				Verbs:         []string{"get", "watch", "update", "patch"},
+			},
+			{
+				APIGroups: []string{"apps"},
+				Resources: []string{"daemonsets"},
+				Verbs:     []string{"create"},
+			},
+			{
+				APIGroups:     []string{"apps"},
+				Resources:     []string{"daemonsets"},
+				ResourceNames: []string{NameCollector, NameNodeExporter, NameDCGMExporter},
+				Verbs:         []string{"get", "list", "watch", "delete", "patch", "update"},
+			},
+			{
+				APIGroups: []string{"apps"},
+				Resources: []string{"deployments"},
+				Verbs:     []string{"list", "watch", "create"},
+			},
+			{
+				APIGroups:     []string{"apps"},
+				Resources:     []string{"deployments"},
+				ResourceNames: []string{NameRuleEvaluator, NameKubeStateMetrics, NamePushGateway, NameExporterSidecar, NameOTLPReceiver},
+				Verbs:         []string{"get", "delete", "patch", "update"},
+			},
+			{
+				APIGroups:     []string{"apps"},
+				Resources:     []string{"deployments"},
+				ResourceNames: []string{NameOperator},
+				Verbs:         []string{"get", "patch"},
+			},
+			{
+				APIGroups:     []string{"apps"},
+				Resources:     []string{"statefulsets"},
+				ResourceNames: []string{NameAlertmanager},
+				Verbs:         []string{"get", "patch"},
+			},
+			{
+				APIGroups:     []string{""},
+				Resources:     []string{"services"},
+				ResourceNames: []string{NameAlertmanager},
+				Verbs:         []string{"get", "list", "watch"},
+			},
+		},
+	}
+}
+
+// operatorPublicRole returns the permissions of the operator in the public
+// namespace. Read access to Secrets and ConfigMaps is only included if the
+// configuration references any.
+func operatorPublicRole(opts Options, refs referencedKinds) *rbacv1.Role {
+	role := &rbacv1.Role{
+		TypeMeta: rbacTypeMeta("Role"),
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: opts.PublicNamespace,
+			Name:      serviceAccountOperator,
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{"monitoring.googleapis.com"},
+				Resources: []string{"operatorconfigs"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+		},
+	}
+	if refs.secrets {
+		role.Rules = append(role.Rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"secrets"},
+			Verbs:     []string{"get", "list", "watch"},
+		})
+	}
+	if refs.configMaps {
+		role.Rules = append(role.Rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"get", "list", "watch"},
+		})
+	}
+	return role
+}
+
+// operatorClusterRole returns the cluster-wide permissions of the operator,
+// extended by what the enabled feature gates require.
+func operatorClusterRole(opts Options) *rbacv1.ClusterRole {
+	role := &rbacv1.ClusterRole{
+		TypeMeta: rbacTypeMeta("ClusterRole"),
+		ObjectMeta: metav1.ObjectMeta{
+			Name: opts.OperatorNamespace + ":" + serviceAccountOperator,
+		},
+		Rules: []rbacv1.PolicyRule{
+			// Listing pods for validating scrape endpoints against declared
+			// container ports.
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+			// Injecting CA bundles into webhook configs of fixed name.
+			{
+				APIGroups:     []string{"admissionregistration.k8s.io"},
+				Resources:     []string{"validatingwebhookconfigurations", "mutatingwebhookconfigurations"},
+				ResourceNames: []string{fmt.Sprintf("%s.%s.monitoring.googleapis.com", NameOperator, opts.OperatorNamespace)},
+				Verbs:         []string{"get", "patch", "update", "watch"},
+			},
+			{
+				APIGroups: []string{"monitoring.googleapis.com"},
+				Resources: []string{
+					"clusterpodmonitorings", "clusterrules", "clusterstaticmonitorings", "collectionoverrides",
+					"dashboards", "globalrules", "grafanadatasourcesyncs", "podmonitorings", "rules",
+				},
+				Verbs: []string{"get", "list", "watch"},
+			},
+			{
+				APIGroups: []string{"monitoring.googleapis.com"},
+				Resources: []string{
+					"clusterpodmonitorings/status", "clusterrules/status", "clusterstaticmonitorings/status", "collectionoverrides/status",
+					"dashboards/status", "globalrules/status", "grafanadatasourcesyncs/status", "podmonitorings/status", "rules/status",
+				},
+				Verbs: []string{"get", "patch", "update"},
+			},
+		},
+	}
+	if opts.FeatureGates.Enabled(FeaturePrometheusOperatorCompat) {
+		role.Rules = append(role.Rules,
+			// Translating prometheus-operator resources into PodMonitorings.
+			rbacv1.PolicyRule{
+				APIGroups: []string{"monitoring.coreos.com"},
+				Resources: []string{"podmonitors", "servicemonitors"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+			// Probing whether the prometheus-operator CRDs are installed.
+			rbacv1.PolicyRule{
+				APIGroups: []string{"apiextensions.k8s.io"},
+				Resources: []string{"customresourcedefinitions"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+		)
+	}
+	return role
+}
+
+// rbacBindings returns the bindings of the generated roles to the service
+// accounts of the shipped manifests.
+func rbacBindings(opts Options) []runtime.Object {
+	operatorSubject := rbacv1.Subject{
+		Kind:      "ServiceAccount",
+		Namespace: opts.OperatorNamespace,
+		Name:      serviceAccountOperator,
+	}
+	return []runtime.Object{
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta: rbacTypeMeta("ClusterRoleBinding"),
+			ObjectMeta: metav1.ObjectMeta{
+				Name: opts.OperatorNamespace + ":" + serviceAccountOperator,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     opts.OperatorNamespace + ":" + serviceAccountOperator,
+			},
+			Subjects: []rbacv1.Subject{operatorSubject},
+		},
+		&rbacv1.RoleBinding{
+			TypeMeta: rbacTypeMeta("RoleBinding"),
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: opts.OperatorNamespace,
+				Name:      serviceAccountOperator,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "Role",
+				Name:     serviceAccountOperator,
+			},
+			Subjects: []rbacv1.Subject{operatorSubject},
+		},
+		&rbacv1.RoleBinding{
+			TypeMeta: rbacTypeMeta("RoleBinding"),
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: opts.PublicNamespace,
+				Name:      serviceAccountOperator,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "Role",
+				Name:     serviceAccountOperator,
+			},
+			Subjects: []rbacv1.Subject{operatorSubject},
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta: rbacTypeMeta("ClusterRoleBinding"),
+			ObjectMeta: metav1.ObjectMeta{
+				Name: opts.OperatorNamespace + ":" + serviceAccountCollector,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     opts.OperatorNamespace + ":" + serviceAccountCollector,
+			},
+			Subjects: []rbacv1.Subject{{
+				Kind:      "ServiceAccount",
+				Namespace: opts.OperatorNamespace,
+				Name:      serviceAccountCollector,
+			}},
+		},
+	}
+}
@@ -16,7 +16,9 @@ package operator
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
@@ -26,6 +28,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -39,7 +42,18 @@ import (
 )
 
 const (
-	nameRulesGenerated = "rules-generated"
+	// NameRulesGenerated is the name of the ConfigMap holding the rule files
+	// generated from the Rules, ClusterRules, and GlobalRules resources.
+	NameRulesGenerated = "rules-generated"
+	// LocalRuleFilePrefix marks generated rule files whose groups the
+	// rule-evaluator evaluates against the in-cluster collectors instead of
+	// Cloud Monitoring.
+	LocalRuleFilePrefix = "local__"
+	// customMetricsFilename is the key in the generated rules ConfigMap under
+	// which the metric names exported under the custom metric type prefix are
+	// written. It deliberately doesn't match the rule file glob of the
+	// rule-evaluator, which only considers .yaml files.
+	customMetricsFilename = "custom-metrics.json"
 )
 
 func setupRulesControllers(op *Operator) error {
@@ -58,7 +72,7 @@ func setupRulesControllers(op *Operator) error {
 	// Rule-evaluator rules ConfigMap filter.
 	objFilterRulesGenerated := namespacedNamePredicate{
 		namespace: op.opts.OperatorNamespace,
-		name:      nameRulesGenerated,
+		name:      NameRulesGenerated,
 	}
 
 	// Reconcile the generated rules that are used by the rule-evaluator deployment.
@@ -91,7 +105,7 @@ func setupRulesControllers(op *Operator) error {
 			enqueueConst(objRequest),
 			builder.WithPredicates(objFilterRulesGenerated),
 		).
-		Complete(newRulesReconciler(op.manager.GetClient(), op.opts))
+		Complete(newRulesReconciler(op.manager.GetClient(), op.opts, op.manager.GetEventRecorderFor(NameOperator)))
 	if err != nil {
 		return errors.Wrap(err, "create rules config controller")
 	}
@@ -99,20 +113,23 @@ func setupRulesControllers(op *Operator) error {
 }
 
 type rulesReconciler struct {
-	client client.Client
-	opts   Options
+	client        client.Client
+	opts          Options
+	recorder      record.EventRecorder
+	statusUpdates []client.Object
 }
 
-func newRulesReconciler(c client.Client, opts Options) *rulesReconciler {
+func newRulesReconciler(c client.Client, opts Options, recorder record.EventRecorder) *rulesReconciler {
 	return &rulesReconciler{
-		client: c,
-		opts:   opts,
+		client:   c,
+		opts:     opts,
+		recorder: recorder,
 	}
 }
 
 func (r *rulesReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
 	logger, _ := logr.FromContext(ctx)
-	logger.Info("reconciling rules")
+	logger.WithValues("rules", req.NamespacedName).Info("reconciling rules")
 
 	var config monitoringv1.OperatorConfig
 	// Fetch OperatorConfig if it exists.
@@ -121,12 +138,29 @@ func (r *rulesReconciler) Reconcile(ctx context.Context, req reconcile.Request)
 	} else if err != nil {
 		return reconcile.Result{}, errors.Wrapf(err, "get operatorconfig for incoming: %q", req.String())
 	}
+	if isPaused(&config) {
+		logger.Info("reconciliation paused via annotation")
+		return reconcile.Result{}, nil
+	}
 
 	var projectID, location, cluster = resolveLabels(r.opts, config.Rules.ExternalLabels)
 
 	if err := r.ensureRuleConfigs(ctx, projectID, location, cluster); err != nil {
 		return reconcile.Result{}, errors.Wrap(err, "ensure rule configmaps")
 	}
+	if err := r.ensureAlertPolicies(ctx, projectID, location, cluster); err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "ensure alerting policies")
+	}
+
+	// Reconcile any status updates.
+	for _, obj := range r.statusUpdates {
+		if err := r.client.Status().Update(ctx, obj); err != nil {
+			logger.Error(err, "update status", "obj", obj)
+		}
+	}
+	// Reset status updates for next reconcile loop.
+	r.statusUpdates = r.statusUpdates[:0]
+
 	return reconcile.Result{}, nil
 }
 
@@ -137,7 +171,7 @@ func (r *rulesReconciler) ensureRuleConfigs(ctx context.Context, projectID, loca
 	cm := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: r.opts.OperatorNamespace,
-			Name:      nameRulesGenerated,
+			Name:      NameRulesGenerated,
 			Labels: map[string]string{
 				LabelAppName: NameRuleEvaluator,
 			},
@@ -148,6 +182,14 @@ func (r *rulesReconciler) ensureRuleConfigs(ctx context.Context, projectID, loca
 			"empty.yaml": "",
 		},
 	}
+	// Maps each generated rule file to the resource it originated from.
+	attrs := map[string]SourceRef{}
+	// Names of recorded metrics the rule-evaluator writes under the custom
+	// metric type prefix.
+	customMetrics := map[string]struct{}{}
+
+	// Mark status updates in batch with single timestamp.
+	now := metav1.Now()
 
 	// Generate a final rule file for each Rules resource.
 	//
@@ -162,42 +204,149 @@ func (r *rulesReconciler) ensureRuleConfigs(ctx context.Context, projectID, loca
 	if err := r.client.List(ctx, &rulesList); err != nil {
 		return errors.Wrap(err, "list rules")
 	}
-	for _, rs := range rulesList.Items {
-		result, err := generateRules(&rs, projectID, location, cluster)
+	for _, r2 := range rulesList.Items {
+		// Reassign so we can safely get a pointer.
+		rs := r2
+		if !r.opts.namespaceAllowed(rs.Namespace) {
+			continue
+		}
+		cond := metav1.Condition{
+			Type:   monitoringv1.ConfigurationCreateSuccess,
+			Status: metav1.ConditionTrue,
+			Reason: monitoringv1.ReasonConfigurationCreated,
+		}
+		result, local, err := generateRules(&rs, projectID, location, cluster)
 		if err != nil {
-			// TODO(freinartz): update resource condition.
 			logger.Error(err, "converting rules failed", "rules_namespace", rs.Namespace, "rules_name", rs.Name)
+			r.recorder.Eventf(&rs, corev1.EventTypeWarning, monitoringv1.ReasonRuleGenerationError, "converting rules failed: %s", err)
+			cond = metav1.Condition{
+				Type:    monitoringv1.ConfigurationCreateSuccess,
+				Status:  metav1.ConditionFalse,
+				Reason:  monitoringv1.ReasonRuleGenerationError,
+				Message: err.Error(),
+			}
+		}
+		if change, err := rs.Status.SetMonitoringCondition(rs.Generation, now, cond); err != nil {
+			logger.Error(err, "setting rules status state")
+		} else if change {
+			r.statusUpdates = append(r.statusUpdates, &rs)
+		}
+		if rs.Spec.ExportCustomMetrics {
+			collectRecordedMetrics(rs.Spec.Groups, customMetrics)
 		}
 		filename := fmt.Sprintf("rules__%s__%s.yaml", rs.Namespace, rs.Name)
 		cm.Data[filename] = result
+		attrs[filename] = sourceRef("Rules", &rs)
+		if local != "" {
+			filename := fmt.Sprintf("%srules__%s__%s.yaml", LocalRuleFilePrefix, rs.Namespace, rs.Name)
+			cm.Data[filename] = local
+			attrs[filename] = sourceRef("Rules", &rs)
+		}
 	}
 
 	var clusterRulesList monitoringv1.ClusterRulesList
 	if err := r.client.List(ctx, &clusterRulesList); err != nil {
 		return errors.Wrap(err, "list cluster rules")
 	}
-	for _, rs := range clusterRulesList.Items {
-		result, err := generateClusterRules(&rs, projectID, location, cluster)
+	for _, r2 := range clusterRulesList.Items {
+		// Reassign so we can safely get a pointer.
+		rs := r2
+		cond := metav1.Condition{
+			Type:   monitoringv1.ConfigurationCreateSuccess,
+			Status: metav1.ConditionTrue,
+			Reason: monitoringv1.ReasonConfigurationCreated,
+		}
+		result, local, err := generateClusterRules(&rs, projectID, location, cluster)
 		if err != nil {
-			// TODO(freinartz): update resource condition.
 			logger.Error(err, "converting rules failed", "clusterrules_name", rs.Name)
+			r.recorder.Eventf(&rs, corev1.EventTypeWarning, monitoringv1.ReasonRuleGenerationError, "converting rules failed: %s", err)
+			cond = metav1.Condition{
+				Type:    monitoringv1.ConfigurationCreateSuccess,
+				Status:  metav1.ConditionFalse,
+				Reason:  monitoringv1.ReasonRuleGenerationError,
+				Message: err.Error(),
+			}
+		}
+		if change, err := rs.Status.SetMonitoringCondition(rs.Generation, now, cond); err != nil {
+			logger.Error(err, "setting clusterrules status state")
+		} else if change {
+			r.statusUpdates = append(r.statusUpdates, &rs)
+		}
+		if rs.Spec.ExportCustomMetrics {
+			collectRecordedMetrics(rs.Spec.Groups, customMetrics)
 		}
 		filename := fmt.Sprintf("clusterrules__%s.yaml", rs.Name)
 		cm.Data[filename] = string(result)
+		attrs[filename] = sourceRef("ClusterRules", &rs)
+		if local != "" {
+			filename := fmt.Sprintf("%sclusterrules__%s.yaml", LocalRuleFilePrefix, rs.Name)
+			cm.Data[filename] = local
+			attrs[filename] = sourceRef("ClusterRules", &rs)
+		}
 	}
 
 	var globalRulesList monitoringv1.GlobalRulesList
 	if err := r.client.List(ctx, &globalRulesList); err != nil {
 		return errors.Wrap(err, "list global rules")
 	}
-	for _, rs := range globalRulesList.Items {
-		result, err := generateGlobalRules(&rs)
+	for _, r2 := range globalRulesList.Items {
+		// Reassign so we can safely get a pointer.
+		rs := r2
+		cond := metav1.Condition{
+			Type:   monitoringv1.ConfigurationCreateSuccess,
+			Status: metav1.ConditionTrue,
+			Reason: monitoringv1.ReasonConfigurationCreated,
+		}
+		result, local, err := generateGlobalRules(&rs)
 		if err != nil {
-			// TODO(freinartz): update resource condition.
 			logger.Error(err, "converting rules failed", "globalrules_name", rs.Name)
+			r.recorder.Eventf(&rs, corev1.EventTypeWarning, monitoringv1.ReasonRuleGenerationError, "converting rules failed: %s", err)
+			cond = metav1.Condition{
+				Type:    monitoringv1.ConfigurationCreateSuccess,
+				Status:  metav1.ConditionFalse,
+				Reason:  monitoringv1.ReasonRuleGenerationError,
+				Message: err.Error(),
+			}
+		}
+		if change, err := rs.Status.SetMonitoringCondition(rs.Generation, now, cond); err != nil {
+			logger.Error(err, "setting globalrules status state")
+		} else if change {
+			r.statusUpdates = append(r.statusUpdates, &rs)
+		}
+		if rs.Spec.ExportCustomMetrics {
+			collectRecordedMetrics(rs.Spec.Groups, customMetrics)
 		}
 		filename := fmt.Sprintf("globalrules__%s.yaml", rs.Name)
 		cm.Data[filename] = string(result)
+		attrs[filename] = sourceRef("GlobalRules", &rs)
+		if local != "" {
+			filename := fmt.Sprintf("%sglobalrules__%s.yaml", LocalRuleFilePrefix, rs.Name)
+			cm.Data[filename] = local
+			attrs[filename] = sourceRef("GlobalRules", &rs)
+		}
+	}
+
+	// Write the sorted custom metric names so the rule-evaluator can pick
+	// them up alongside the rule files.
+	names := make([]string, 0, len(customMetrics))
+	for name := range customMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	namesJSON, err := json.Marshal(names)
+	if err != nil {
+		return errors.Wrap(err, "marshalling custom metric names failed")
+	}
+	cm.Data[customMetricsFilename] = string(namesJSON)
+
+	// Record which resource each rule file originated from so the generated
+	// config can be traced back to its sources.
+	attribution, err := sourceAttributionAnnotation(attrs)
+	if err != nil {
+		return err
+	}
+	cm.Annotations = map[string]string{
+		AnnotationSourceAttribution: attribution,
 	}
 
 	// Create or update generated rule ConfigMap.
@@ -211,55 +360,122 @@ func (r *rulesReconciler) ensureRuleConfigs(ctx context.Context, projectID, loca
 	return nil
 }
 
-func generateRules(apiRules *monitoringv1.Rules, projectID, location, cluster string) (string, error) {
-	rs, err := rules.FromAPIRules(apiRules.Spec.Groups)
+// collectRecordedMetrics adds the names of all metrics recorded by the given
+// rule groups to the set.
+func collectRecordedMetrics(groups []monitoringv1.RuleGroup, set map[string]struct{}) {
+	for _, g := range groups {
+		for _, rule := range g.Rules {
+			if rule.Record != "" {
+				set[rule.Record] = struct{}{}
+			}
+		}
+	}
+}
+
+// splitLocalGroups partitions rule groups by their local evaluation flag.
+func splitLocalGroups(groups []monitoringv1.RuleGroup) (regular, local []monitoringv1.RuleGroup) {
+	for _, g := range groups {
+		if g.Local {
+			local = append(local, g)
+		} else {
+			regular = append(regular, g)
+		}
+	}
+	return regular, local
+}
+
+// generateGroups converts and scopes the given rule groups and returns the
+// marshalled rule file. It returns an empty string for an empty group list.
+func generateGroups(groups []monitoringv1.RuleGroup, lset map[string]string) (string, error) {
+	if len(groups) == 0 {
+		return "", nil
+	}
+	rs, err := rules.FromAPIRules(groups)
 	if err != nil {
 		return "", errors.Wrap(err, "converting rules failed")
 	}
-	if err := rules.Scope(&rs, map[string]string{
+	if len(lset) > 0 {
+		if err := rules.Scope(&rs, lset); err != nil {
+			return "", errors.Wrap(err, "isolating rules failed")
+		}
+	}
+	result, err := yaml.Marshal(rs)
+	if err != nil {
+		return "", errors.Wrap(err, "marshalling rules failed")
+	}
+	return string(result), nil
+}
+
+// The generate functions return separate rule files for the groups evaluated
+// against Cloud Monitoring and the groups evaluated locally against the
+// in-cluster collectors. Local groups are not scoped by the project_id,
+// location, and cluster labels as those are only attached during export and
+// do not exist on the collectors' local data. The namespace label of Rules
+// resources is a target label and remains enforced.
+
+func generateRules(apiRules *monitoringv1.Rules, projectID, location, cluster string) (regular, local string, err error) {
+	groups, err := rules.MergeDependencies(apiRules.Spec.Groups)
+	if err != nil {
+		return "", "", errors.Wrap(err, "resolving rule group dependencies failed")
+	}
+	regularGroups, localGroups := splitLocalGroups(groups)
+
+	regular, err = generateGroups(regularGroups, map[string]string{
 		export.KeyProjectID: projectID,
 		export.KeyLocation:  location,
 		export.KeyCluster:   cluster,
 		export.KeyNamespace: apiRules.Namespace,
-	}); err != nil {
-		return "", errors.Wrap(err, "isolating rules failed")
+	})
+	if err != nil {
+		return "", "", err
 	}
-	result, err := yaml.Marshal(rs)
+	local, err = generateGroups(localGroups, map[string]string{
+		export.KeyNamespace: apiRules.Namespace,
+	})
 	if err != nil {
-		return "", errors.Wrap(err, "marshalling rules failed")
+		return "", "", err
 	}
-	return string(result), nil
+	return regular, local, nil
 }
 
-func generateClusterRules(apiRules *monitoringv1.ClusterRules, projectID, location, cluster string) (string, error) {
-	rs, err := rules.FromAPIRules(apiRules.Spec.Groups)
+func generateClusterRules(apiRules *monitoringv1.ClusterRules, projectID, location, cluster string) (regular, local string, err error) {
+	groups, err := rules.MergeDependencies(apiRules.Spec.Groups)
 	if err != nil {
-		return "", errors.Wrap(err, "converting rules failed")
+		return "", "", errors.Wrap(err, "resolving rule group dependencies failed")
 	}
-	if err := rules.Scope(&rs, map[string]string{
+	regularGroups, localGroups := splitLocalGroups(groups)
+
+	regular, err = generateGroups(regularGroups, map[string]string{
 		export.KeyProjectID: projectID,
 		export.KeyLocation:  location,
 		export.KeyCluster:   cluster,
-	}); err != nil {
-		return "", errors.Wrap(err, "isolating rules failed")
+	})
+	if err != nil {
+		return "", "", err
 	}
-	result, err := yaml.Marshal(rs)
+	local, err = generateGroups(localGroups, nil)
 	if err != nil {
-		return "", errors.Wrap(err, "marshalling rules failed")
+		return "", "", err
 	}
-	return string(result), nil
+	return regular, local, nil
 }
 
-func generateGlobalRules(apiRules *monitoringv1.GlobalRules) (string, error) {
-	rs, err := rules.FromAPIRules(apiRules.Spec.Groups)
+func generateGlobalRules(apiRules *monitoringv1.GlobalRules) (regular, local string, err error) {
+	groups, err := rules.MergeDependencies(apiRules.Spec.Groups)
 	if err != nil {
-		return "", errors.Wrap(err, "converting rules failed")
+		return "", "", errors.Wrap(err, "resolving rule group dependencies failed")
 	}
-	result, err := yaml.Marshal(rs)
+	regularGroups, localGroups := splitLocalGroups(groups)
+
+	regular, err = generateGroups(regularGroups, nil)
 	if err != nil {
-		return "", errors.Wrap(err, "marshalling rules failed")
+		return "", "", err
 	}
-	return string(result), nil
+	local, err = generateGroups(localGroups, nil)
+	if err != nil {
+		return "", "", err
+	}
+	return regular, local, nil
 }
 
 type rulesValidator struct {
@@ -267,7 +483,7 @@ type rulesValidator struct {
 }
 
 func (v *rulesValidator) ValidateCreate(ctx context.Context, o runtime.Object) error {
-	_, err := generateRules(o.(*monitoringv1.Rules), "test_project", "test_location", "test_cluster")
+	_, _, err := generateRules(o.(*monitoringv1.Rules), "test_project", "test_location", "test_cluster")
 	return err
 }
 
@@ -284,7 +500,7 @@ type clusterRulesValidator struct {
 }
 
 func (v *clusterRulesValidator) ValidateCreate(ctx context.Context, o runtime.Object) error {
-	_, err := generateClusterRules(o.(*monitoringv1.ClusterRules), "test_project", "test_location", "test_cluster")
+	_, _, err := generateClusterRules(o.(*monitoringv1.ClusterRules), "test_project", "test_location", "test_cluster")
 	return err
 }
 
@@ -299,7 +515,7 @@ func (v *clusterRulesValidator) ValidateDelete(ctx context.Context, o runtime.Ob
 type globalRulesValidator struct{}
 
 func (v *globalRulesValidator) ValidateCreate(ctx context.Context, o runtime.Object) error {
-	_, err := generateGlobalRules(o.(*monitoringv1.GlobalRules))
+	_, _, err := generateGlobalRules(o.(*monitoringv1.GlobalRules))
 	return err
 }
 
@@ -0,0 +1,91 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// scrapeConfigCache memoizes the scrape configs rendered for individual
+// monitoring resources. Rendering parses and validates all relabel rules and
+// does a marshal round-trip through the Prometheus config structs, which at
+// thousands of PodMonitorings makes re-rendering every object on every watch
+// event prohibitively expensive. Entries are invalidated by the object's
+// generation and the rendering inputs that are not part of the object itself.
+//
+// The cache is only accessed from the single reconcile loop and thus needs
+// no locking.
+type scrapeConfigCache struct {
+	entries map[string]*scrapeCacheEntry
+	seen    map[string]bool
+}
+
+type scrapeCacheEntry struct {
+	generation int64
+	inputs     string
+	cfgs       []*promconfig.ScrapeConfig
+}
+
+func newScrapeConfigCache() *scrapeConfigCache {
+	return &scrapeConfigCache{
+		entries: map[string]*scrapeCacheEntry{},
+		seen:    map[string]bool{},
+	}
+}
+
+// sweepStart marks the beginning of a full config generation. Entries not
+// accessed before the next call to sweep belong to deleted objects and are
+// dropped then.
+func (c *scrapeConfigCache) sweepStart() {
+	c.seen = map[string]bool{}
+}
+
+// sweep drops all entries not accessed since the last call to sweepStart.
+func (c *scrapeConfigCache) sweep() {
+	for key := range c.entries {
+		if !c.seen[key] {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// get returns the scrape configs for the object identified by key, invoking
+// render only if no current entry exists. The returned configs are shallow
+// copies whose metric relabel configs may be appended to and whose scalar
+// fields may be changed by per-namespace post-processing without corrupting
+// the cache.
+func (c *scrapeConfigCache) get(key string, generation int64, inputs string, render func() ([]*promconfig.ScrapeConfig, error)) ([]*promconfig.ScrapeConfig, error) {
+	c.seen[key] = true
+
+	e, ok := c.entries[key]
+	if !ok || e.generation != generation || e.inputs != inputs {
+		cfgs, err := render()
+		if err != nil {
+			delete(c.entries, key)
+			return nil, err
+		}
+		e = &scrapeCacheEntry{generation: generation, inputs: inputs, cfgs: cfgs}
+		c.entries[key] = e
+	}
+
+	out := make([]*promconfig.ScrapeConfig, len(e.cfgs))
+	for i, sc := range e.cfgs {
+		sc := *sc
+		sc.MetricRelabelConfigs = append([]*relabel.Config(nil), sc.MetricRelabelConfigs...)
+		out[i] = &sc
+	}
+	return out, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"testing"
+
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+func TestScrapeConfigCache(t *testing.T) {
+	cache := newScrapeConfigCache()
+
+	renders := 0
+	render := func() ([]*promconfig.ScrapeConfig, error) {
+		renders++
+		return []*promconfig.ScrapeConfig{
+			{JobName: "job1"},
+		}, nil
+	}
+
+	cache.sweepStart()
+	cfgs, err := cache.get("PodMonitoring/ns1/pm1", 1, "inputs", render)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renders != 1 {
+		t.Fatalf("expected 1 render, got %d", renders)
+	}
+	// Unchanged generation and inputs must hit the cache.
+	if _, err := cache.get("PodMonitoring/ns1/pm1", 1, "inputs", render); err != nil {
+		t.Fatal(err)
+	}
+	if renders != 1 {
+		t.Fatalf("expected 1 render, got %d", renders)
+	}
+	// Generation bump and changed inputs must each re-render.
+	if _, err := cache.get("PodMonitoring/ns1/pm1", 2, "inputs", render); err != nil {
+		t.Fatal(err)
+	}
+	if renders != 2 {
+		t.Fatalf("expected 2 renders, got %d", renders)
+	}
+	if _, err := cache.get("PodMonitoring/ns1/pm1", 2, "inputs2", render); err != nil {
+		t.Fatal(err)
+	}
+	if renders != 3 {
+		t.Fatalf("expected 3 renders, got %d", renders)
+	}
+
+	// Post-processing mutations of returned configs must not leak into
+	// subsequent cache hits.
+	cfgs, err = cache.get("PodMonitoring/ns1/pm1", 2, "inputs2", render)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgs[0].SampleLimit = 1000
+	cfgs[0].MetricRelabelConfigs = append(cfgs[0].MetricRelabelConfigs, &relabel.Config{Action: relabel.Drop})
+
+	cfgs, err = cache.get("PodMonitoring/ns1/pm1", 2, "inputs2", render)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfgs[0].SampleLimit != 0 {
+		t.Fatalf("mutation of returned config leaked into cache: sample limit %d", cfgs[0].SampleLimit)
+	}
+	if len(cfgs[0].MetricRelabelConfigs) != 0 {
+		t.Fatalf("mutation of returned config leaked into cache: %d metric relabel configs", len(cfgs[0].MetricRelabelConfigs))
+	}
+	if renders != 3 {
+		t.Fatalf("expected 3 renders, got %d", renders)
+	}
+
+	// Entries not accessed between sweepStart and sweep are dropped.
+	cache.sweepStart()
+	if _, err := cache.get("ClusterPodMonitoring/cpm1", 1, "inputs2", render); err != nil {
+		t.Fatal(err)
+	}
+	cache.sweep()
+
+	if _, ok := cache.entries["ClusterPodMonitoring/cpm1"]; !ok {
+		t.Fatal("expected entry for ClusterPodMonitoring/cpm1 to be retained")
+	}
+	if _, ok := cache.entries["PodMonitoring/ns1/pm1"]; ok {
+		t.Fatal("expected entry for PodMonitoring/ns1/pm1 to be dropped")
+	}
+}
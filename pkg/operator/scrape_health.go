@@ -0,0 +1,201 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// scrapeHealthInterval is the interval at which scrape health is
+	// aggregated from the collectors and exported.
+	scrapeHealthInterval = time.Minute
+
+	// Metric names of the exported per-PodMonitoring health series.
+	metricScrapeHealthTargets        = "prometheus_engine_podmonitoring_targets"
+	metricScrapeHealthTargetsUp      = "prometheus_engine_podmonitoring_targets_up"
+	metricScrapeHealthScrapeDuration = "prometheus_engine_podmonitoring_scrape_duration_seconds"
+)
+
+// scrapeDurationQuantiles are the scrape duration quantiles exported per
+// PodMonitoring.
+var scrapeDurationQuantiles = []string{"0.5", "0.9", "0.99"}
+
+// runScrapeHealthReports periodically aggregates per-PodMonitoring scrape
+// health (discovered targets, healthy targets, and scrape duration quantiles)
+// from the collectors and writes it to Cloud Monitoring through the export
+// pipeline. The series carry the PodMonitoring name and target namespace as
+// labels so teams can alert on the health of their own monitoring setup.
+func (o *Operator) runScrapeHealthReports(ctx context.Context) {
+	kubeClient, err := kubernetes.NewForConfig(o.manager.GetConfig())
+	if err != nil {
+		o.logger.Error(err, "build Kubernetes clientset for scrape health reports")
+		return
+	}
+	exporter, err := export.New(nil, nil, export.ExporterOpts{
+		UserAgent: fmt.Sprintf("operator/%s", export.Version),
+		ProjectID: o.opts.ProjectID,
+		Location:  o.opts.Location,
+		Cluster:   o.opts.Cluster,
+	})
+	if err != nil {
+		o.logger.Error(err, "create exporter for scrape health reports")
+		return
+	}
+	destination := export.NewStorage(exporter)
+
+	go func() {
+		if err := destination.Run(ctx); err != nil {
+			o.logger.Error(err, "background processing of scrape health storage")
+		}
+	}()
+
+	ticker := time.NewTicker(scrapeHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := o.exportScrapeHealth(ctx, kubeClient, destination); err != nil {
+				o.logger.Error(err, "export scrape health")
+			}
+		}
+	}
+}
+
+// scrapeHealthKey identifies the PodMonitoring or ClusterPodMonitoring a
+// scrape health sample belongs to. The job label on collected series is set
+// to the name of the monitoring resource, the namespace label to the targets'
+// namespace.
+type scrapeHealthKey struct {
+	namespace, job string
+}
+
+func (o *Operator) exportScrapeHealth(ctx context.Context, kubeClient kubernetes.Interface, destination *export.Storage) error {
+	// The external labels configured on the OperatorConfig take precedence
+	// over the operator's flags, mirroring the collectors' own export setup.
+	var config monitoringv1.OperatorConfig
+	err := o.client.Get(ctx, client.ObjectKey{Namespace: o.opts.PublicNamespace, Name: NameOperatorConfig}, &config)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "get operatorconfig")
+	}
+	if err := destination.ApplyConfig(&promconfig.Config{
+		GlobalConfig: promconfig.GlobalConfig{
+			ExternalLabels: labels.FromMap(config.Collection.ExternalLabels),
+		},
+	}); err != nil {
+		return errors.Wrap(err, "apply export config")
+	}
+	pods, err := kubeClient.CoreV1().Pods(o.opts.OperatorNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", LabelAppName, NameCollector),
+	})
+	if err != nil {
+		return errors.Wrap(err, "list collector pods")
+	}
+	var (
+		targets   = map[scrapeHealthKey]float64{}
+		targetsUp = map[scrapeHealthKey]float64{}
+		durations = map[string]map[scrapeHealthKey]float64{}
+	)
+	for _, q := range scrapeDurationQuantiles {
+		durations[q] = map[scrapeHealthKey]float64{}
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		pod := pod
+
+		byJob, err := queryCollectorVector(ctx, kubeClient, &pod, `count by (namespace, job) (up)`)
+		if err != nil {
+			// Unreachable collectors are expected during rollouts. Skip them
+			// rather than failing the whole round.
+			o.logger.V(1).Info("querying collector targets failed", "pod", pod.Name, "err", err)
+			continue
+		}
+		upByJob, err := queryCollectorVector(ctx, kubeClient, &pod, `sum by (namespace, job) (up)`)
+		if err != nil {
+			o.logger.V(1).Info("querying collector target health failed", "pod", pod.Name, "err", err)
+			continue
+		}
+		for _, s := range byJob {
+			targets[scrapeHealthKey{s.metric["namespace"], s.metric["job"]}] += s.value
+		}
+		for _, s := range upByJob {
+			targetsUp[scrapeHealthKey{s.metric["namespace"], s.metric["job"]}] += s.value
+		}
+		for _, q := range scrapeDurationQuantiles {
+			samples, err := queryCollectorVector(ctx, kubeClient, &pod,
+				fmt.Sprintf(`quantile by (namespace, job) (%s, scrape_duration_seconds)`, q))
+			if err != nil {
+				o.logger.V(1).Info("querying collector scrape durations failed", "pod", pod.Name, "err", err)
+				continue
+			}
+			for _, s := range samples {
+				key := scrapeHealthKey{s.metric["namespace"], s.metric["job"]}
+				// Per-collector quantiles cannot be merged exactly. Taking
+				// the maximum gives a conservative fleet-wide estimate.
+				if s.value > durations[q][key] {
+					durations[q][key] = s.value
+				}
+			}
+		}
+	}
+	now := time.Now().UnixMilli()
+	app := destination.Appender(ctx)
+
+	appendSample := func(metric string, key scrapeHealthKey, extra labels.Labels, v float64) error {
+		lset := append(labels.Labels{
+			{Name: labels.MetricName, Value: metric},
+			{Name: "namespace", Value: key.namespace},
+			{Name: "podmonitoring", Value: key.job},
+		}, extra...)
+		_, err := app.Append(0, lset, now, v)
+		return err
+	}
+	for key, v := range targets {
+		if err := appendSample(metricScrapeHealthTargets, key, nil, v); err != nil {
+			return errors.Wrap(err, "append scrape health sample")
+		}
+		if err := appendSample(metricScrapeHealthTargetsUp, key, nil, targetsUp[key]); err != nil {
+			return errors.Wrap(err, "append scrape health sample")
+		}
+	}
+	for q, byKey := range durations {
+		for key, v := range byKey {
+			lset := labels.Labels{{Name: "quantile", Value: q}}
+			if err := appendSample(metricScrapeHealthScrapeDuration, key, lset, v); err != nil {
+				return errors.Wrap(err, "append scrape health sample")
+			}
+		}
+	}
+	return app.Commit()
+}
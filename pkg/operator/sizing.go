@@ -0,0 +1,132 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// sizingInterval is the interval at which collector self-metrics are
+	// sampled for the sizing recommendation.
+	sizingInterval = 5 * time.Minute
+
+	// Heuristic memory cost per in-memory series, based on observed collector
+	// memory profiles across a range of fleet sizes. Deliberately conservative
+	// as running out of memory is much more disruptive than over-provisioning.
+	bytesPerSeries = 8192
+	// Base memory request covering the collector's fixed overhead.
+	baseMemoryBytes = 128 * 1024 * 1024
+)
+
+// runSizingRecommendations periodically samples the collectors' self-reported
+// series and target counts and derives a recommended memory request for the
+// collector containers. The per-pod counts and the recommendation are exposed
+// as operator metrics so users can size the collector DaemonSet from observed
+// load rather than guessing.
+func (o *Operator) runSizingRecommendations(ctx context.Context) {
+	kubeClient, err := kubernetes.NewForConfig(o.manager.GetConfig())
+	if err != nil {
+		o.logger.Error(err, "build Kubernetes clientset for sizing recommendations")
+		return
+	}
+	ticker := time.NewTicker(sizingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := o.updateSizingRecommendations(ctx, kubeClient); err != nil {
+				o.logger.Error(err, "update sizing recommendations")
+			}
+		}
+	}
+}
+
+func (o *Operator) updateSizingRecommendations(ctx context.Context, kubeClient kubernetes.Interface) error {
+	pods, err := kubeClient.CoreV1().Pods(o.opts.OperatorNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", LabelAppName, NameCollector),
+	})
+	if err != nil {
+		return err
+	}
+	o.metrics.collectorSeries.Reset()
+	o.metrics.collectorTargets.Reset()
+
+	var maxSeries float64
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		series, targets, err := scrapeCollectorStats(ctx, kubeClient, &pod)
+		if err != nil {
+			// Unreachable collectors are expected during rollouts. Skip them
+			// rather than failing the whole round.
+			o.logger.V(1).Info("scraping collector self-metrics failed", "pod", pod.Name, "err", err)
+			continue
+		}
+		o.metrics.collectorSeries.WithLabelValues(pod.Name).Set(series)
+		o.metrics.collectorTargets.WithLabelValues(pod.Name).Set(targets)
+
+		if series > maxSeries {
+			maxSeries = series
+		}
+	}
+	// The DaemonSet applies one resource request to all collectors, so the
+	// busiest node determines the recommendation.
+	o.metrics.collectorMemoryRecommend.Set(baseMemoryBytes + maxSeries*bytesPerSeries)
+	return nil
+}
+
+// scrapeCollectorStats reads the in-memory series and active target counts
+// from the self-metrics of the given collector pod via the API server's pod
+// proxy.
+func scrapeCollectorStats(ctx context.Context, kubeClient kubernetes.Interface, pod *corev1.Pod) (series, targets float64, err error) {
+	b, err := kubeClient.CoreV1().RESTClient().Get().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(fmt.Sprintf("%s:%d", pod.Name, collectorWebPort)).
+		SubResource("proxy").
+		Suffix("metrics").
+		DoRaw(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(b))
+	if err != nil {
+		return 0, 0, err
+	}
+	if mf, ok := families["prometheus_tsdb_head_series"]; ok && len(mf.Metric) > 0 {
+		series = mf.Metric[0].GetGauge().GetValue()
+	}
+	// Sum the active target counts across all scrape pools.
+	if mf, ok := families["prometheus_target_scrape_pool_targets"]; ok {
+		for _, m := range mf.Metric {
+			targets += m.GetGauge().GetValue()
+		}
+	}
+	return series, targets, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pkg/errors"
+)
+
+// StatusAPIHandler returns an HTTP handler serving debug information aggregated
+// from the collector fleet, so that users without pod port-forward or proxy
+// permissions can still inspect target discovery results:
+//
+//	/api/status/targets  the /api/v1/targets response of every collector pod
+//	/api/status/config   the rendered collector Prometheus configuration
+//
+// It additionally serves the Google Cloud targets of ClusterStaticMonitoring
+// resources to the collectors under /discovery/<name> in the format of
+// Prometheus's HTTP service discovery protocol.
+func (o *Operator) StatusAPIHandler() (http.Handler, error) {
+	kubeClient, err := kubernetes.NewForConfig(o.manager.GetConfig())
+	if err != nil {
+		return nil, errors.Wrap(err, "build Kubernetes clientset")
+	}
+	api := &statusAPI{client: o.client, kubeClient: kubeClient, opts: o.opts}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status/targets", api.handleTargets)
+	mux.HandleFunc("/api/status/config", api.handleConfig)
+	mux.HandleFunc("/discovery/", api.handleDiscovery)
+	return mux, nil
+}
+
+type statusAPI struct {
+	client     client.Client
+	kubeClient kubernetes.Interface
+	opts       Options
+}
+
+// collectorTargets holds the target state of a single collector pod. Targets
+// is the raw /api/v1/targets response of the collector's Prometheus server.
+type collectorTargets struct {
+	Pod     string          `json:"pod"`
+	Targets json.RawMessage `json:"targets,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+func (s *statusAPI) handleTargets(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	pods, err := s.kubeClient.CoreV1().Pods(s.opts.OperatorNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", LabelAppName, NameCollector),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("listing collector pods failed: %s", err), http.StatusInternalServerError)
+		return
+	}
+	collectors := []collectorTargets{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		c := collectorTargets{Pod: pod.Name}
+
+		b, err := s.kubeClient.CoreV1().RESTClient().Get().
+			Namespace(pod.Namespace).
+			Resource("pods").
+			Name(fmt.Sprintf("%s:%d", pod.Name, collectorWebPort)).
+			SubResource("proxy").
+			Suffix("api/v1/targets").
+			DoRaw(ctx)
+		if err != nil {
+			c.Error = err.Error()
+		} else {
+			c.Targets = json.RawMessage(b)
+		}
+		collectors = append(collectors, c)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"collectors": collectors}); err != nil {
+		http.Error(w, fmt.Sprintf("encoding response failed: %s", err), http.StatusInternalServerError)
+	}
+}
+
+func (s *statusAPI) handleConfig(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	cm, err := s.kubeClient.CoreV1().ConfigMaps(s.opts.OperatorNamespace).Get(ctx, NameCollector, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		http.Error(w, "collector configuration not generated yet", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("getting collector config failed: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, cm.Data[configFilename])
+}
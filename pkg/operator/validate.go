@@ -0,0 +1,153 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// resourceBundle holds the monitoring custom resources decoded from a set of
+// YAML manifests. Documents of other kinds are ignored.
+type resourceBundle struct {
+	operatorConfigs []monitoringv1.OperatorConfig
+	podMons         []monitoringv1.PodMonitoring
+	clusterPodMons  []monitoringv1.ClusterPodMonitoring
+	rules           []monitoringv1.Rules
+	clusterRules    []monitoringv1.ClusterRules
+	globalRules     []monitoringv1.GlobalRules
+}
+
+// loadResources decodes the monitoring custom resources from the given YAML
+// manifest files.
+func loadResources(files ...string) (*resourceBundle, error) {
+	var bundle resourceBundle
+
+	for _, fn := range files {
+		b, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read manifest %q", fn)
+		}
+		for _, doc := range strings.Split(string(b), "\n---") {
+			var meta struct {
+				Kind       string `json:"kind"`
+				APIVersion string `json:"apiVersion"`
+			}
+			if err := sigsyaml.Unmarshal([]byte(doc), &meta); err != nil {
+				return nil, errors.Wrapf(err, "parse document in %q", fn)
+			}
+			switch meta.Kind {
+			case "OperatorConfig":
+				var config monitoringv1.OperatorConfig
+				if err := sigsyaml.Unmarshal([]byte(doc), &config); err != nil {
+					return nil, errors.Wrapf(err, "parse OperatorConfig in %q", fn)
+				}
+				bundle.operatorConfigs = append(bundle.operatorConfigs, config)
+			case "PodMonitoring":
+				var pm monitoringv1.PodMonitoring
+				if err := sigsyaml.Unmarshal([]byte(doc), &pm); err != nil {
+					return nil, errors.Wrapf(err, "parse PodMonitoring in %q", fn)
+				}
+				bundle.podMons = append(bundle.podMons, pm)
+			case "ClusterPodMonitoring":
+				var cm monitoringv1.ClusterPodMonitoring
+				if err := sigsyaml.Unmarshal([]byte(doc), &cm); err != nil {
+					return nil, errors.Wrapf(err, "parse ClusterPodMonitoring in %q", fn)
+				}
+				bundle.clusterPodMons = append(bundle.clusterPodMons, cm)
+			case "Rules":
+				var rs monitoringv1.Rules
+				if err := sigsyaml.Unmarshal([]byte(doc), &rs); err != nil {
+					return nil, errors.Wrapf(err, "parse Rules in %q", fn)
+				}
+				bundle.rules = append(bundle.rules, rs)
+			case "ClusterRules":
+				var rs monitoringv1.ClusterRules
+				if err := sigsyaml.Unmarshal([]byte(doc), &rs); err != nil {
+					return nil, errors.Wrapf(err, "parse ClusterRules in %q", fn)
+				}
+				bundle.clusterRules = append(bundle.clusterRules, rs)
+			case "GlobalRules":
+				var rs monitoringv1.GlobalRules
+				if err := sigsyaml.Unmarshal([]byte(doc), &rs); err != nil {
+					return nil, errors.Wrapf(err, "parse GlobalRules in %q", fn)
+				}
+				bundle.globalRules = append(bundle.globalRules, rs)
+			}
+		}
+	}
+	return &bundle, nil
+}
+
+// ValidateFromFiles validates the monitoring custom resources in the given
+// YAML manifest files with the same logic the operator's admission webhooks
+// apply in the cluster. It returns one error per invalid resource so CI
+// pipelines can report all failures at once without cluster access.
+func ValidateFromFiles(files ...string) ([]error, error) {
+	ctx := context.Background()
+
+	var errs []error
+
+	for _, fn := range files {
+		bundle, err := loadResources(fn)
+		if err != nil {
+			return nil, err
+		}
+		for i := range bundle.operatorConfigs {
+			oc := &bundle.operatorConfigs[i]
+			v := operatorConfigValidator{namespace: DefaultPublicNamespace}
+			if err := v.ValidateCreate(ctx, oc); err != nil {
+				errs = append(errs, errors.Wrapf(err, "%s: OperatorConfig %s/%s", fn, oc.Namespace, oc.Name))
+			}
+		}
+		for i := range bundle.podMons {
+			pm := &bundle.podMons[i]
+			if err := pm.ValidateCreate(); err != nil {
+				errs = append(errs, errors.Wrapf(err, "%s: PodMonitoring %s/%s", fn, pm.Namespace, pm.Name))
+			}
+		}
+		for i := range bundle.clusterPodMons {
+			cm := &bundle.clusterPodMons[i]
+			if err := cm.ValidateCreate(); err != nil {
+				errs = append(errs, errors.Wrapf(err, "%s: ClusterPodMonitoring %s", fn, cm.Name))
+			}
+		}
+		for i := range bundle.rules {
+			rs := &bundle.rules[i]
+			if err := (&rulesValidator{}).ValidateCreate(ctx, rs); err != nil {
+				errs = append(errs, errors.Wrapf(err, "%s: Rules %s/%s", fn, rs.Namespace, rs.Name))
+			}
+		}
+		for i := range bundle.clusterRules {
+			rs := &bundle.clusterRules[i]
+			if err := (&clusterRulesValidator{}).ValidateCreate(ctx, rs); err != nil {
+				errs = append(errs, errors.Wrapf(err, "%s: ClusterRules %s", fn, rs.Name))
+			}
+		}
+		for i := range bundle.globalRules {
+			rs := &bundle.globalRules[i]
+			if err := (&globalRulesValidator{}).ValidateCreate(ctx, rs); err != nil {
+				errs = append(errs, errors.Wrapf(err, "%s: GlobalRules %s", fn, rs.Name))
+			}
+		}
+	}
+	return errs, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	arv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// webhookSpec holds the parts shared between validating and mutating webhook
+// entries.
+type webhookSpec struct {
+	name         string
+	clientConfig arv1.WebhookClientConfig
+	rules        []arv1.RuleWithOperations
+}
+
+// ensureWebhookConfigs creates the Validating- and MutatingWebhookConfiguration
+// with names and service references derived from the configured operator
+// namespace if they do not exist yet. The default deployment manifests provide
+// them for the default namespaces; creating them here permits installations in
+// custom namespaces, and multiple coexisting installations, without editing the
+// manifests. Existing configurations are left untouched so manifest-provided
+// ones remain authoritative.
+func (o *Operator) ensureWebhookConfigs(ctx context.Context, caBundle []byte) error {
+	var (
+		failurePolicy = arv1.Fail
+		sideEffects   = arv1.SideEffectClassNone
+		port          = int32(443)
+	)
+	newWebhook := func(verb, path string, gvr metav1.GroupVersionResource) webhookSpec {
+		return webhookSpec{
+			name: fmt.Sprintf("%s.%s.%s", verb, gvr.Resource, o.webhookConfigName()),
+			clientConfig: arv1.WebhookClientConfig{
+				Service: &arv1.ServiceReference{
+					Namespace: o.opts.OperatorNamespace,
+					Name:      NameOperator,
+					Path:      &path,
+					Port:      &port,
+				},
+				CABundle: caBundle,
+			},
+			rules: []arv1.RuleWithOperations{{
+				Operations: []arv1.OperationType{arv1.Create, arv1.Update},
+				Rule: arv1.Rule{
+					APIGroups:   []string{gvr.Group},
+					APIVersions: []string{gvr.Version},
+					Resources:   []string{gvr.Resource},
+				},
+			}},
+		}
+	}
+
+	var vwc arv1.ValidatingWebhookConfiguration
+	err := o.client.Get(ctx, client.ObjectKey{Name: o.webhookConfigName()}, &vwc)
+	if apierrors.IsNotFound(err) {
+		vwc = arv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: o.webhookConfigName()},
+		}
+		for _, gvr := range []metav1.GroupVersionResource{
+			monitoringv1.PodMonitoringResource(),
+			monitoringv1.ClusterPodMonitoringResource(),
+			monitoringv1.OperatorConfigResource(),
+			monitoringv1.CollectionOverrideResource(),
+			monitoringv1.RulesResource(),
+			monitoringv1.ClusterRulesResource(),
+			monitoringv1.GlobalRulesResource(),
+		} {
+			wh := newWebhook("validate", validatePath(gvr), gvr)
+			vwc.Webhooks = append(vwc.Webhooks, arv1.ValidatingWebhook{
+				Name:                    wh.name,
+				AdmissionReviewVersions: []string{"v1"},
+				ClientConfig:            wh.clientConfig,
+				FailurePolicy:           &failurePolicy,
+				SideEffects:             &sideEffects,
+				Rules:                   wh.rules,
+			})
+		}
+		if err := o.client.Create(ctx, &vwc); err != nil {
+			return errors.Wrap(err, "create ValidatingWebhookConfiguration")
+		}
+	} else if err != nil {
+		return errors.Wrap(err, "get ValidatingWebhookConfiguration")
+	}
+
+	var mwc arv1.MutatingWebhookConfiguration
+	err = o.client.Get(ctx, client.ObjectKey{Name: o.webhookConfigName()}, &mwc)
+	if apierrors.IsNotFound(err) {
+		mwc = arv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: o.webhookConfigName()},
+		}
+		for _, gvr := range []metav1.GroupVersionResource{
+			monitoringv1.PodMonitoringResource(),
+			monitoringv1.ClusterPodMonitoringResource(),
+		} {
+			wh := newWebhook("default", defaultPath(gvr), gvr)
+			mwc.Webhooks = append(mwc.Webhooks, arv1.MutatingWebhook{
+				Name:                    wh.name,
+				AdmissionReviewVersions: []string{"v1"},
+				ClientConfig:            wh.clientConfig,
+				FailurePolicy:           &failurePolicy,
+				SideEffects:             &sideEffects,
+				Rules:                   wh.rules,
+			})
+		}
+		if err := o.client.Create(ctx, &mwc); err != nil {
+			return errors.Wrap(err, "create MutatingWebhookConfiguration")
+		}
+	} else if err != nil {
+		return errors.Wrap(err, "get MutatingWebhookConfiguration")
+	}
+	return nil
+}
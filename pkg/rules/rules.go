@@ -25,6 +25,135 @@ import (
 	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
 )
 
+// MergeDependencies resolves the dependsOn declarations of the given groups.
+// Groups connected through dependencies are merged into a single group in
+// which the rules of a dependency precede the rules of its dependents, so all
+// of them are evaluated sequentially at one timestamp per interval. Prometheus
+// schedules groups independently, so without merging a dependent group races
+// the ingestion of its dependency's output.
+// The merged group inherits name, interval, and local setting from the first
+// declared group of the component. Connected groups must agree on interval and
+// local setting and must not form a dependency cycle.
+func MergeDependencies(groups []monitoringv1.RuleGroup) ([]monitoringv1.RuleGroup, error) {
+	var hasDeps bool
+	for _, g := range groups {
+		if len(g.DependsOn) > 0 {
+			hasDeps = true
+			break
+		}
+	}
+	if !hasDeps {
+		return groups, nil
+	}
+	index := make(map[string]int, len(groups))
+	for i, g := range groups {
+		if _, ok := index[g.Name]; ok {
+			return nil, errors.Errorf("duplicate rule group name %q", g.Name)
+		}
+		index[g.Name] = i
+	}
+	// Validate dependency edges and group the declarations into connected
+	// components, treating edges as undirected.
+	component := make([]int, len(groups))
+	for i := range component {
+		component[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if component[i] != i {
+			component[i] = find(component[i])
+		}
+		return component[i]
+	}
+	for i, g := range groups {
+		for _, dep := range g.DependsOn {
+			j, ok := index[dep]
+			if !ok {
+				return nil, errors.Errorf("rule group %q depends on unknown group %q", g.Name, dep)
+			}
+			d := groups[j]
+			if d.Interval != g.Interval {
+				return nil, errors.Errorf("rule group %q must have the same interval as its dependency %q", g.Name, dep)
+			}
+			if d.Local != g.Local {
+				return nil, errors.Errorf("rule group %q must have the same local setting as its dependency %q", g.Name, dep)
+			}
+			// Merge the components, keeping the lower declaration index as
+			// the representative.
+			ri, rj := find(i), find(j)
+			if ri < rj {
+				component[rj] = ri
+			} else if rj < ri {
+				component[ri] = rj
+			}
+		}
+	}
+	// Order the members of each component topologically via Kahn's algorithm,
+	// breaking ties by declaration order to keep the output deterministic.
+	indegree := make([]int, len(groups))
+	dependents := make([][]int, len(groups))
+	for i, g := range groups {
+		for _, dep := range g.DependsOn {
+			indegree[i]++
+			j := index[dep]
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+	var (
+		order   []int
+		pending []int
+	)
+	for i := range groups {
+		if indegree[i] == 0 {
+			pending = append(pending, i)
+		}
+	}
+	for len(pending) > 0 {
+		next := pending[0]
+		for _, i := range pending {
+			if i < next {
+				next = i
+			}
+		}
+		for k, i := range pending {
+			if i == next {
+				pending = append(pending[:k], pending[k+1:]...)
+				break
+			}
+		}
+		order = append(order, next)
+		for _, i := range dependents[next] {
+			if indegree[i]--; indegree[i] == 0 {
+				pending = append(pending, i)
+			}
+		}
+	}
+	if len(order) != len(groups) {
+		return nil, errors.New("rule group dependencies must not form a cycle")
+	}
+	// Emit one group per component in declaration order of its representative,
+	// concatenating the members' rules in topological order.
+	merged := make(map[int]int)
+	var result []monitoringv1.RuleGroup
+	for _, i := range order {
+		r := find(i)
+		if pos, ok := merged[r]; ok {
+			result[pos].Rules = append(result[pos].Rules, groups[i].Rules...)
+			continue
+		}
+		g := *groups[r].DeepCopy()
+		g.DependsOn = nil
+		if r != i {
+			// The representative is the first declared member but not
+			// necessarily the first in topological order.
+			g.Rules = append([]monitoringv1.Rule(nil), groups[i].Rules...)
+		}
+		result = append(result, g)
+		merged[r] = len(result) - 1
+	}
+	return result, nil
+}
+
 // FromAPIRules constructs rule groups from a list of rule groups in the
 // resource API format. It ensures that the groups are valid according to the
 // Prometheus upstream validation logic.
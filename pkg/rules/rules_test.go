@@ -15,13 +15,94 @@
 package rules
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/prometheus/prometheus/model/rulefmt"
 	yaml "gopkg.in/yaml.v3"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
 )
 
+func TestMergeDependencies(t *testing.T) {
+	groups := []monitoringv1.RuleGroup{
+		{
+			Name:      "chained",
+			Interval:  "60s",
+			DependsOn: []string{"base"},
+			Rules:     []monitoringv1.Rule{{Record: "job:up:ratio", Expr: "job:up:sum / job:up:count"}},
+		}, {
+			Name:     "base",
+			Interval: "60s",
+			Rules: []monitoringv1.Rule{
+				{Record: "job:up:sum", Expr: "sum by(job) (up)"},
+				{Record: "job:up:count", Expr: "count by(job) (up)"},
+			},
+		}, {
+			Name:     "independent",
+			Interval: "30s",
+			Rules:    []monitoringv1.Rule{{Record: "job:foo:sum", Expr: "sum by(job) (foo)"}},
+		},
+	}
+	got, err := MergeDependencies(groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []monitoringv1.RuleGroup{
+		{
+			Name:     "chained",
+			Interval: "60s",
+			Rules: []monitoringv1.Rule{
+				{Record: "job:up:sum", Expr: "sum by(job) (up)"},
+				{Record: "job:up:count", Expr: "count by(job) (up)"},
+				{Record: "job:up:ratio", Expr: "job:up:sum / job:up:count"},
+			},
+		}, {
+			Name:     "independent",
+			Interval: "30s",
+			Rules:    []monitoringv1.Rule{{Record: "job:foo:sum", Expr: "sum by(job) (foo)"}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want, +got):\n %s", diff)
+	}
+
+	for _, c := range []struct {
+		groups []monitoringv1.RuleGroup
+		err    string
+	}{
+		{
+			groups: []monitoringv1.RuleGroup{
+				{Name: "a", Interval: "60s", DependsOn: []string{"missing"}},
+			},
+			err: "unknown group",
+		}, {
+			groups: []monitoringv1.RuleGroup{
+				{Name: "a", Interval: "60s", DependsOn: []string{"b"}},
+				{Name: "b", Interval: "60s", DependsOn: []string{"a"}},
+			},
+			err: "cycle",
+		}, {
+			groups: []monitoringv1.RuleGroup{
+				{Name: "a", Interval: "60s", DependsOn: []string{"b"}},
+				{Name: "b", Interval: "30s"},
+			},
+			err: "same interval",
+		}, {
+			groups: []monitoringv1.RuleGroup{
+				{Name: "a", Interval: "60s", DependsOn: []string{"b"}},
+				{Name: "b", Interval: "60s", Local: true},
+			},
+			err: "same local setting",
+		},
+	} {
+		if _, err := MergeDependencies(c.groups); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expected error containing %q, got %v", c.err, err)
+		}
+	}
+}
+
 func TestScope(t *testing.T) {
 	input := `groups:
 - name: test
@@ -0,0 +1,84 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scrapeguard
+
+import (
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var errNoLimit = errors.New("no memory limit configured or detected")
+
+// Cgroup files holding the current memory usage and the memory limit of the
+// container, for the v2 and v1 cgroup hierarchies respectively.
+var cgroupFiles = []struct {
+	usage, limit string
+}{
+	{usage: "/sys/fs/cgroup/memory.current", limit: "/sys/fs/cgroup/memory.max"},
+	{usage: "/sys/fs/cgroup/memory/memory.usage_in_bytes", limit: "/sys/fs/cgroup/memory/memory.limit_in_bytes"},
+}
+
+// cgroupUsage returns a usageFunc reading usage and limit from the container's
+// cgroup. A non-zero limit overrides the cgroup-configured limit, e.g. when
+// the container runs without one.
+func cgroupUsage(limitOverride uint64) usageFunc {
+	return func() (uint64, uint64, error) {
+		for _, f := range cgroupFiles {
+			usage, err := readCgroupValue(f.usage)
+			if err != nil {
+				continue
+			}
+			limit := limitOverride
+			if limit == 0 {
+				limit, err = readCgroupValue(f.limit)
+				if err != nil {
+					return 0, 0, errNoLimit
+				}
+			}
+			return usage, limit, nil
+		}
+		if limitOverride == 0 {
+			return 0, 0, errNoLimit
+		}
+		return 0, 0, errors.New("reading cgroup memory usage failed")
+	}
+}
+
+// readCgroupValue reads a single numeric value from a cgroup file. An error
+// is returned for unlimited values ("max" in cgroup v2, a value out of any
+// practical range in v1).
+func readCgroupValue(path string) (uint64, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "max" {
+		return 0, errNoLimit
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse cgroup value in %q", path)
+	}
+	// Cgroup v1 reports the absence of a limit as a page-rounded maximum value.
+	if v >= math.MaxInt64/4096*4096 {
+		return 0, errNoLimit
+	}
+	return v, nil
+}
@@ -0,0 +1,311 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scrapeguard sheds scrape load before the collector runs out of
+// memory. The guard periodically compares the collector's memory usage
+// against its limit. If usage crosses the high watermark, scrape jobs are
+// skipped class by class in order of ascending priority until usage recovers,
+// rather than the collector being OOM killed and losing all targets at once.
+//
+// Priorities are assigned per job by encoding them into the generated job
+// name, which keeps the guard free of any dependency on how configuration is
+// delivered. Jobs without an encoded priority default to priority 0. The
+// highest priority class is never shed.
+package scrapeguard
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/config"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	shedPriorityClasses = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gcm_scrape_guard_shed_priority_classes",
+		Help: "Number of scrape priority classes currently shed due to memory pressure.",
+	})
+	scrapesSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gcm_scrape_guard_scrapes_skipped_total",
+		Help: "Number of scrapes skipped because their job's priority class was shed.",
+	})
+	memoryUsageRatio = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gcm_scrape_guard_memory_usage_ratio",
+		Help: "Last observed ratio of memory usage to the memory limit.",
+	})
+)
+
+const (
+	// Interval at which memory usage is evaluated against the watermarks.
+	evaluationInterval = 15 * time.Second
+
+	// Default fraction of the memory limit above which load is shed.
+	defaultHighWatermark = 0.8
+	// Default fraction of the memory limit below which shed load is restored.
+	defaultLowWatermark = 0.7
+)
+
+// prioritySuffix matches the priority encoded in a job name by AppendPriority.
+var prioritySuffix = regexp.MustCompile(`/priority=(-?\d+)$`)
+
+// AppendPriority returns the job name with the scrape priority encoded so
+// that it can be recovered with ParsePriority.
+func AppendPriority(jobName string, priority int) string {
+	return fmt.Sprintf("%s/priority=%d", jobName, priority)
+}
+
+// ParsePriority extracts the scrape priority encoded in the job name. Jobs
+// without an encoded priority default to priority 0.
+func ParsePriority(jobName string) int {
+	m := prioritySuffix.FindStringSubmatch(jobName)
+	if m == nil {
+		return 0
+	}
+	// The regexp guarantees a valid integer.
+	p, _ := strconv.Atoi(m[1])
+	return p
+}
+
+// usageFunc returns the current memory usage and the limit in bytes.
+type usageFunc func() (usage, limit uint64, err error)
+
+// Guard tracks memory pressure and decides which scrape jobs to skip.
+type Guard struct {
+	logger log.Logger
+	usage  usageFunc
+
+	highWatermark float64
+	lowWatermark  float64
+
+	// Guards the priority state below, which is updated through configuration
+	// reloads and the evaluation loop while being read on every scrape.
+	mtx sync.Mutex
+	// Priority per configured scrape job.
+	priorities map[string]int
+	// Sorted distinct priorities of the configured jobs.
+	classes []int
+	// Number of priority classes that are currently shed, starting from the
+	// lowest. Never extends to the highest class.
+	shed int
+}
+
+// Options holds configuration for a Guard.
+type Options struct {
+	// Memory limit in bytes against which usage is compared. If zero, the
+	// limit is auto-detected from the container's cgroup. The guard stays
+	// inactive if no limit can be determined.
+	MemoryLimit uint64
+	// Fraction of the memory limit above which scrape load is shed.
+	// Defaults to 0.8.
+	HighWatermark float64
+	// Fraction of the memory limit below which shed scrape load is restored.
+	// Defaults to 0.7.
+	LowWatermark float64
+}
+
+// New returns a guard that evaluates memory usage against the given options.
+func New(logger log.Logger, reg prometheus.Registerer, opts Options) (*Guard, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if reg != nil {
+		reg.MustRegister(shedPriorityClasses, scrapesSkipped, memoryUsageRatio)
+	}
+	if opts.HighWatermark == 0 {
+		opts.HighWatermark = defaultHighWatermark
+	}
+	if opts.LowWatermark == 0 {
+		opts.LowWatermark = defaultLowWatermark
+	}
+	if opts.LowWatermark >= opts.HighWatermark {
+		return nil, fmt.Errorf("low watermark %g must be below high watermark %g", opts.LowWatermark, opts.HighWatermark)
+	}
+	g := &Guard{
+		logger:        logger,
+		usage:         cgroupUsage(opts.MemoryLimit),
+		highWatermark: opts.HighWatermark,
+		lowWatermark:  opts.LowWatermark,
+		priorities:    map[string]int{},
+	}
+	return g, nil
+}
+
+// Like the exporter, the guard is accessed from within the scrape layer of
+// the Prometheus fork, where it is impractical to thread it through
+// explicitly. It is thus injected as a global at startup.
+var globalGuard *Guard
+
+// SetGlobal sets the global instance of the scrape guard.
+func SetGlobal(g *Guard) {
+	globalGuard = g
+}
+
+// Global returns the global instance of the scrape guard.
+func Global() *Guard {
+	if globalGuard == nil {
+		return Nop()
+	}
+	return globalGuard
+}
+
+// FromFlags returns a constructor for a new guard that is configured through
+// flags registered with the given application. The constructor must be called
+// after the flags have been parsed.
+func FromFlags(a *kingpin.Application) func(log.Logger, prometheus.Registerer) (*Guard, error) {
+	var opts Options
+
+	enabled := a.Flag("scrape.memory-shedding", "Skip scrape jobs in ascending priority order while memory usage is above the high watermark instead of risking an OOM kill.").
+		Default("false").Bool()
+
+	a.Flag("scrape.memory-limit-bytes", "Memory limit in bytes against which usage is compared for shedding scrape load. Defaults to the container's cgroup memory limit.").
+		Default("0").Uint64Var(&opts.MemoryLimit)
+
+	a.Flag("scrape.memory-high-watermark", "Fraction of the memory limit above which scrape load is shed.").
+		Default("0.8").Float64Var(&opts.HighWatermark)
+
+	a.Flag("scrape.memory-low-watermark", "Fraction of the memory limit below which shed scrape load is restored.").
+		Default("0.7").Float64Var(&opts.LowWatermark)
+
+	return func(logger log.Logger, reg prometheus.Registerer) (*Guard, error) {
+		if !*enabled {
+			return Nop(), nil
+		}
+		return New(logger, reg, opts)
+	}
+}
+
+// Nop returns an inactive guard that never sheds load.
+func Nop() *Guard {
+	return &Guard{
+		logger:        log.NewNopLogger(),
+		usage:         func() (uint64, uint64, error) { return 0, 0, errNoLimit },
+		highWatermark: defaultHighWatermark,
+		lowWatermark:  defaultLowWatermark,
+		priorities:    map[string]int{},
+	}
+}
+
+// ApplyConfig updates the guard with the priorities of all configured scrape
+// jobs. Previously shed classes are preserved where the priorities persist.
+func (g *Guard) ApplyConfig(cfg *config.Config) error {
+	priorities := make(map[string]int, len(cfg.ScrapeConfigs))
+	for _, sc := range cfg.ScrapeConfigs {
+		priorities[sc.JobName] = ParsePriority(sc.JobName)
+	}
+	classSet := map[int]struct{}{}
+	for _, p := range priorities {
+		classSet[p] = struct{}{}
+	}
+	classes := make([]int, 0, len(classSet))
+	for p := range classSet {
+		classes = append(classes, p)
+	}
+	sort.Ints(classes)
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	g.priorities = priorities
+	g.classes = classes
+	if max := maxShed(classes); g.shed > max {
+		g.shed = max
+	}
+	shedPriorityClasses.Set(float64(g.shed))
+	return nil
+}
+
+// maxShed returns the maximum number of classes that may be shed. The highest
+// class always remains so that the collector never goes entirely blind.
+func maxShed(classes []int) int {
+	if len(classes) == 0 {
+		return 0
+	}
+	return len(classes) - 1
+}
+
+// Allow returns whether the given scrape job may currently scrape. It is
+// intended to be called by the scrape loop before each scrape.
+func (g *Guard) Allow(jobName string) bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if g.shed == 0 {
+		return true
+	}
+	p, ok := g.priorities[jobName]
+	if !ok {
+		// Unknown jobs (e.g. from a config the guard has not seen) are
+		// never shed.
+		return true
+	}
+	// The shed count refers to the lowest classes.
+	if p <= g.classes[g.shed-1] {
+		scrapesSkipped.Inc()
+		return false
+	}
+	return true
+}
+
+// Run evaluates memory usage periodically until the context is cancelled.
+func (g *Guard) Run(ctx context.Context) error {
+	tick := time.NewTicker(evaluationInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+			g.evaluate()
+		}
+	}
+}
+
+// evaluate adjusts the number of shed classes by one step based on the
+// current memory usage. Shedding one class at a time keeps the load change
+// predictable and gives memory usage time to settle between steps.
+func (g *Guard) evaluate() {
+	usage, limit, err := g.usage()
+	if err != nil {
+		// No limit could be determined, the guard stays inactive.
+		level.Debug(g.logger).Log("msg", "reading memory usage failed", "err", err)
+		return
+	}
+	ratio := float64(usage) / float64(limit)
+	memoryUsageRatio.Set(ratio)
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	switch {
+	case ratio >= g.highWatermark && g.shed < maxShed(g.classes):
+		g.shed++
+		level.Warn(g.logger).Log("msg", "memory usage above high watermark, shedding scrape priority class",
+			"usage_ratio", ratio, "shed_classes", g.shed, "max_priority_shed", g.classes[g.shed-1])
+	case ratio < g.lowWatermark && g.shed > 0:
+		g.shed--
+		level.Info(g.logger).Log("msg", "memory usage below low watermark, restoring scrape priority class",
+			"usage_ratio", ratio, "shed_classes", g.shed)
+	}
+	shedPriorityClasses.Set(float64(g.shed))
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scrapeguard
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/config"
+)
+
+func TestParsePriority(t *testing.T) {
+	if got := ParsePriority(AppendPriority("PodMonitoring/ns1/name1/web", 7)); got != 7 {
+		t.Errorf("expected priority 7, got %d", got)
+	}
+	if got := ParsePriority(AppendPriority("PodMonitoring/ns1/name1/web", -3)); got != -3 {
+		t.Errorf("expected priority -3, got %d", got)
+	}
+	if got := ParsePriority("PodMonitoring/ns1/name1/web"); got != 0 {
+		t.Errorf("expected default priority 0, got %d", got)
+	}
+}
+
+func TestGuardShedding(t *testing.T) {
+	g, err := New(nil, nil, Options{MemoryLimit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var usage uint64
+	g.usage = func() (uint64, uint64, error) { return usage, 100, nil }
+
+	var (
+		jobLow  = AppendPriority("PodMonitoring/ns1/low/web", 1)
+		jobMid  = AppendPriority("PodMonitoring/ns1/mid/web", 5)
+		jobHigh = AppendPriority("PodMonitoring/ns1/high/web", 10)
+	)
+	if err := g.ApplyConfig(&config.Config{ScrapeConfigs: []*config.ScrapeConfig{
+		{JobName: jobLow}, {JobName: jobMid}, {JobName: jobHigh},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Below the high watermark everything is allowed.
+	usage = 50
+	g.evaluate()
+	for _, job := range []string{jobLow, jobMid, jobHigh} {
+		if !g.Allow(job) {
+			t.Errorf("expected job %q to be allowed", job)
+		}
+	}
+
+	// Crossing the high watermark sheds one class at a time, starting with
+	// the lowest priority.
+	usage = 90
+	g.evaluate()
+	if g.Allow(jobLow) {
+		t.Error("expected lowest priority job to be shed")
+	}
+	if !g.Allow(jobMid) || !g.Allow(jobHigh) {
+		t.Error("expected higher priority jobs to still be allowed")
+	}
+	g.evaluate()
+	if g.Allow(jobMid) {
+		t.Error("expected mid priority job to be shed")
+	}
+	// The highest class is never shed.
+	g.evaluate()
+	g.evaluate()
+	if !g.Allow(jobHigh) {
+		t.Error("expected highest priority job to never be shed")
+	}
+	// Jobs the guard does not know are never shed.
+	if !g.Allow("PodMonitoring/ns1/unknown/web") {
+		t.Error("expected unknown job to be allowed")
+	}
+
+	// Dropping below the low watermark restores classes step by step.
+	usage = 50
+	g.evaluate()
+	if !g.Allow(jobMid) {
+		t.Error("expected mid priority job to be restored")
+	}
+	if g.Allow(jobLow) {
+		t.Error("expected lowest priority job to still be shed")
+	}
+	g.evaluate()
+	if !g.Allow(jobLow) {
+		t.Error("expected lowest priority job to be restored")
+	}
+}
+
+func TestGuardInactiveWithoutLimit(t *testing.T) {
+	g := Nop()
+	g.evaluate()
+	if !g.Allow("PodMonitoring/ns1/name1/web") {
+		t.Error("expected inactive guard to allow all jobs")
+	}
+}